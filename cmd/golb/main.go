@@ -4,9 +4,8 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
@@ -21,115 +20,73 @@ func main() {
 	if err != nil {
 		log.Fatalf("Configuration error: %v", err)
 	}
+	logLevel, _ := golb.ParseLogLevel(cfg.LogLevel) // Validated by LoadConfig
+	golb.SetDefaultLogger(golb.NewLeveledLogger(golb.NewStdLogger(nil), logLevel))
 
 	// --- Load Balancer Strategy Selection ---
-	var lb golb.LoadBalancer
-	switch cfg.LoadBalancingAlgorithm {
-	case "least-connections":
-		lb = golb.NewLeastConnectionBalancer()
-		log.Println("Using Load Balancer: Least Connections")
-		log.Println("NOTE: Connection counting increment/decrement logic needs external implementation (handler/transport wrapping).")
-	case "least-response-time":
-		lb = golb.NewLeastResponseTimeBalancer(cfg.EWMAAlpha) // Pass alpha from config
-		log.Printf("Using Load Balancer: Least Response Time (EWMA Alpha: %.2f)", cfg.EWMAAlpha)
-		log.Println("NOTE: Response times updated via health check durations.")
-	case "weighted-round-robin":
-		lb = golb.NewWeightedRoundRobinBalancer()
-		log.Println("Using Load Balancer: Weighted Round Robin")
-		if len(cfg.BackendWeights) != len(cfg.BackendServers) {
-			log.Printf("Warning: Weights ignored due to count mismatch. Falling back to equal weights implicitly (like Round Robin).")
-			// Optionally, create a RoundRobinBalancer instead if weights are invalid
-			// lb = golb.NewRoundRobinBalancer()
-		}
-	case "round-robin":
-		fallthrough // Explicit fallthrough
-	default:
-		if cfg.LoadBalancingAlgorithm != "round-robin" {
-			log.Printf("Warning: Unknown load balancing algorithm '%s', defaulting to round-robin.", cfg.LoadBalancingAlgorithm)
-		}
-		lb = golb.NewRoundRobinBalancer()
-		log.Println("Using Load Balancer: Round Robin")
+	if !golb.HasBalancer(cfg.LoadBalancingAlgorithm) {
+		log.Printf("Warning: Unknown load balancing algorithm '%s', defaulting to round-robin.", cfg.LoadBalancingAlgorithm)
 		cfg.LoadBalancingAlgorithm = "round-robin" // Ensure config reflects the actual used algo
 	}
+	log.Printf("Using Load Balancer: %s", cfg.LoadBalancingAlgorithm)
+	if cfg.LoadBalancingAlgorithm == "least-response-time" || cfg.LoadBalancingAlgorithm == "peak-ewma" || cfg.LoadBalancingAlgorithm == "hybrid" {
+		log.Printf("NOTE: Response times updated via health check durations (EWMA Alpha: %.2f).", cfg.EWMAAlpha)
+	}
 
-	// --- Server Pool Initialization ---
-	pool := golb.NewServerPool(lb)
-
-	// --- Backend Initialization ---
-	for i, backendAddr := range cfg.BackendServers {
-		backendURL, err := url.Parse(backendAddr)
-		if err != nil {
-			log.Printf("Warning: Failed to parse backend URL '%s': %v. Skipping.", backendAddr, err)
-			continue
-		}
-
-		// Create the reverse proxy instance for this backend
-		proxy := httputil.NewSingleHostReverseProxy(backendURL)
-
-		// Customize Director
-		defaultDirector := proxy.Director
-		proxy.Director = func(req *http.Request) {
-			defaultDirector(req)
-			req.Host = backendURL.Host // Important for virtual hosting
-		}
-
-		// Customize Error Handler - needs access to pool to mark status
-		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			log.Printf("Proxy error forwarding to %s: %v", backendURL, err)
-			pool.MarkBackendStatus(backendURL, false) // Mark down on proxy errors
-
-			// --- Connection Tracking Decrement (Conceptual for LC) ---
-			// If using LeastConnections, decrement counter on error
-			// Find backend 'b' corresponding to backendURL and call:
-			// b.DecrementActiveConnections()
-
-			// Provide appropriate HTTP error
-			if errors.Is(err, context.Canceled) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
-				// Client disconnected or connection reset
-				http.Error(w, "Client Closed Request", 499) // Nginx's code
-			} else {
-				// Other errors (connection refused, timeout during proxying)
-				http.Error(w, "Bad Gateway", http.StatusBadGateway)
-			}
-		}
-
-		// Determine weight for WRR
-		weight := 1 // Default weight if not specified or counts mismatch
-		if cfg.LoadBalancingAlgorithm == "weighted-round-robin" && len(cfg.BackendWeights) == len(cfg.BackendServers) && i < len(cfg.BackendWeights) {
-			weight = cfg.BackendWeights[i]
-			if weight < 0 {
-				log.Printf("Warning: Backend %s has negative weight (%d), treating as 0.", backendAddr, weight)
-				weight = 0
-			}
+	// --- Server Pool and Backend Initialization ---
+	transport := golb.NewTransport(cfg) // Shared by all backends
+	pool, err := golb.BuildServerPool(cfg, cfg.LoadBalancingAlgorithm, cfg.BackendServers, cfg.BackendWeights, transport)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if cfg.SubsetSize > 0 {
+		subsetID := cfg.SubsetID
+		if subsetID == "" {
+			subsetID, _ = os.Hostname()
 		}
+		pool.SetSubset(subsetID, cfg.SubsetSize)
+		log.Printf("Balancing over a subset of %d backends (Subset ID: %s)", cfg.SubsetSize, subsetID)
+	}
 
-		// Create and add the backend to the pool
-		backendInstance := golb.NewBackend(backendURL, proxy, weight)
-		pool.AddBackend(backendInstance)
-		log.Printf("Configured backend: %s (Weight: %d)", backendAddr, weight)
+	// --- Routes: each gets its own pool and balancer; other paths use the default pool ---
+	router, err := golb.NewRouter(cfg, transport, golb.NewProxy(pool, cfg))
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
 
 	// --- Initial Health Check (Synchronous) ---
 	log.Println("Performing initial health check...")
-	// Create a client specifically for this initial check
-	initialCheckClient := &http.Client{
-		Timeout: cfg.BackendRequestTimeout, // Use configured timeout
+	initialCheckClient := pool.ManagementClient() // Shared with the periodic checks and /status
+	// Slow-starting backends get up to StartupGracePeriod to become healthy before we serve
+	if !pool.WaitUntilReady(context.Background(), initialCheckClient, cfg) && cfg.StartupGracePeriod > 0 {
+		log.Printf("Warning: Backends not ready after the startup grace period of %v; serving anyway.", cfg.StartupGracePeriod)
+	}
+	for _, route := range router.Routes() {
+		route.Pool.PerformHealthCheckCycle(initialCheckClient, cfg)
 	}
-	// Call performHealthCheckCycle directly (it's defined in health.go but accessible via pool)
-	pool.PerformHealthCheckCycle(initialCheckClient, cfg) // You need to expose performHealthCheckCycle or call it via HealthCheck differently
 	log.Println("Initial health check complete.")
 
-	// Ensure at least one valid backend was added
+	// Ensure at least one valid backend was added, unless backends may arrive later
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if pool.GetNextPeer(ctx) == nil && len(cfg.BackendServers) > 0 {
-		log.Fatal("Error: No valid backend servers were successfully configured.")
+	if cfg.AllowEmptyStart {
+		if pool.AliveCount() == 0 {
+			log.Println("Warning: No healthy backends yet; serving 503 until backends are added or recover.")
+		}
+	} else if peer, err := pool.GetNextPeer(ctx); peer == nil && len(cfg.BackendServers) > 0 {
+		log.Fatalf("Error: No valid backend servers were successfully configured: %v", err)
 	} else if len(cfg.BackendServers) == 0 {
 		log.Fatal("Error: No backend servers defined in configuration.") // Should be caught by LoadConfig, but double check
 	}
 
 	// --- Start Background Tasks ---
 	go pool.HealthCheck(cfg)
+	for _, route := range router.Routes() {
+		go route.Pool.HealthCheck(cfg)
+	}
+	if cfg.SummaryLogInterval > 0 {
+		go pool.RunSummaryLog(context.Background(), cfg.SummaryLogInterval)
+	}
 
 	// --- HTTP Server Setup ---
 	mux := http.NewServeMux()
@@ -139,45 +96,110 @@ func main() {
 		golb.StatusHandler(w, r, pool, cfg)
 	})
 
-	// Main proxy handler (closure captures pool)
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// --- Connection Tracking Increment/Decrement (Conceptual) ---
-		// This is where you would wrap the handler or ResponseWriter
-		// to accurately track connection start/end for LeastConnections.
-		// E.g., peer := pool.GetNextPeer(); if peer != nil { peer.Increment... }
-		//       defer peer.Decrement...
-		golb.Lb(w, r, pool, cfg.AccessLogEnabled, cfg.AccessLogPayloads)
+	// Prometheus metrics endpoint
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		golb.MetricsHandler(w, r, pool)
+	})
+
+	// Liveness/readiness endpoints for the load balancer itself (e.g. Kubernetes probes)
+	mux.HandleFunc("/livez", golb.LivezHandler)
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		golb.ReadyzHandler(w, r, pool, cfg)
 	})
 
-	// Configure the server
-	server := &http.Server{
-		Addr:    cfg.ProxyPort,
-		Handler: mux,
-		// Add timeouts for production use (ReadTimeout, WriteTimeout, IdleTimeout)
-		// ReadTimeout:  5 * time.Second,
-		// WriteTimeout: 10 * time.Second,
-		// IdleTimeout:  120 * time.Second,
+	// Admin endpoints, registered only with an admin token configured so the backends' own paths stay reachable otherwise
+	if cfg.AdminToken != "" {
+		mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+			golb.ConfigHandler(w, r, cfg)
+		})
+		// The load balancer's own build, runtime and memory info
+		mux.HandleFunc("/debug/info", func(w http.ResponseWriter, r *http.Request) {
+			golb.DebugInfoHandler(w, r, pool, cfg)
+		})
+		allPools := []*golb.ServerPool{pool}
+		for _, route := range router.Routes() {
+			allPools = append(allPools, route.Pool)
+		}
+		mux.HandleFunc("/admin/pause", func(w http.ResponseWriter, r *http.Request) {
+			golb.PauseHandler(w, r, cfg, allPools...)
+		})
+		mux.HandleFunc("/admin/resume", func(w http.ResponseWriter, r *http.Request) {
+			golb.ResumeHandler(w, r, cfg, allPools...)
+		})
 	}
+	golb.RegisterPprof(mux, cfg)
+
+	// Main proxy handler: routing, request filtering, (de)compression and forwarding to a pool.
+	// The global concurrency cap covers proxied traffic only, so monitoring keeps working under overload.
+	mux.Handle("/", golb.LimitConcurrency(cfg, nil, router))
+
+	// Configure the servers: TCP for HTTP/1.1 and HTTP/2, plus QUIC for HTTP/3 if enabled
+	handler := golb.CORS(cfg, golb.Authenticate(cfg, mux)) // CORS first: preflights carry no credentials
+	handler = golb.Recover(cfg, nil, handler)              // Outermost, so a panic anywhere becomes a 500
+	h3Server := golb.NewHTTP3Server(cfg, handler)
+	server := golb.NewHTTPServer(cfg, golb.AdvertiseHTTP3(h3Server, handler))
 
 	// --- Start Server & Handle Shutdown ---
+	listener, err := net.Listen("tcp", cfg.ProxyPort)
+	if err != nil {
+		log.Fatalf("Could not listen on %s: %v\n", cfg.ProxyPort, err)
+	}
+	if cfg.AcceptProxyProtocol {
+		listener = golb.NewProxyProtocolListener(listener) // Client addresses come from the L4 proxy in front
+	}
 	go func() {
 		log.Printf("Go Load Balancer (GoLB) started on port %s", cfg.ProxyPort)
 		log.Printf("Using load balancing algorithm: %s", cfg.LoadBalancingAlgorithm)
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("Could not listen on %s: %v\n", cfg.ProxyPort, err)
+		var err error
+		if cfg.TLSCertFile != "" {
+			err = server.ServeTLS(listener, cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error on %s: %v\n", cfg.ProxyPort, err)
+		}
+	}()
+	if h3Server != nil {
+		go func() {
+			log.Printf("HTTP/3 enabled on UDP port %s", cfg.ProxyPort)
+			if err := h3Server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("HTTP/3 server error on %s: %v\n", cfg.ProxyPort, err)
+			}
+		}()
+	}
+
+	// Reopen access log files on SIGHUP, e.g. from logrotate's postrotate script
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := golb.ReopenAccessLogs(); err != nil {
+				log.Printf("Failed to reopen access logs: %v", err)
+			}
 		}
 	}()
 
-	// Graceful shutdown
+	// Graceful shutdown: report not ready for PreShutdownDelay, then drain in-flight requests
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
 
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second) // Allow 30 seconds for graceful shutdown
+	ctx, cancel = context.WithTimeout(context.Background(), cfg.PreShutdownDelay+30*time.Second) // Allow 30 seconds for draining
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
+	err = golb.Drain(ctx, pool, cfg.PreShutdownDelay, func(ctx context.Context) error {
+		if h3Server != nil {
+			defer func() {
+				if err := h3Server.Shutdown(ctx); err != nil {
+					log.Printf("HTTP/3 server forced to shutdown: %v", err)
+				}
+			}()
+		}
+		return server.Shutdown(ctx)
+	})
+	if err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
@@ -0,0 +1,202 @@
+package golb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Access log formats for Config.AccessLogFormat; any other value containing "{{" is a
+// text/template executed with an AccessLogEntry
+const (
+	AccessLogFormatLogger   = ""         // Through the Logger as an "Access" message with key/value pairs
+	AccessLogFormatJSON     = "json"     // One JSON object per line
+	AccessLogFormatCombined = "combined" // Apache/nginx combined log format
+)
+
+// AccessLogEntry describes one proxied request for the access log
+type AccessLogEntry struct {
+	Time         time.Time     `json:"time"` // When the request started
+	Method       string        `json:"method"`
+	URI          string        `json:"uri"` // Path and query as requested
+	Proto        string        `json:"proto"`
+	Client       string        `json:"client"`
+	Backend      string        `json:"backend"`
+	Status       int           `json:"status"`
+	Bytes        int           `json:"bytes"` // Response body bytes
+	Duration     time.Duration `json:"durationNanoSec"`
+	RequestID    string        `json:"requestId,omitempty"`
+	Referer      string        `json:"referer,omitempty"`
+	UserAgent    string        `json:"userAgent,omitempty"`
+	RequestBody  string        `json:"requestBody,omitempty"` // Only with Config.AccessLogPayloads
+	ResponseBody string        `json:"responseBody,omitempty"`
+}
+
+// accessLog writes access log lines in a fixed format to a file, syslog or stdout
+type accessLog struct {
+	format string
+	tmpl   *template.Template // For custom formats
+	out    io.Writer
+}
+
+// parseAccessLogFormat validates format, returning the template for custom formats
+func parseAccessLogFormat(format string) (*template.Template, error) {
+	switch format {
+	case AccessLogFormatLogger, AccessLogFormatJSON, AccessLogFormatCombined:
+		return nil, nil
+	}
+	if !strings.Contains(format, "{{") {
+		return nil, fmt.Errorf("unknown access log format %q (expected json, combined or a template)", format)
+	}
+	return template.New("accessLog").Parse(format)
+}
+
+// newAccessLog returns the access log configured by cfg, or nil to log through the Logger.
+// An unusable format, file or syslog endpoint is reported to logger and also falls back to
+// the Logger.
+func newAccessLog(cfg *Config, logger Logger) *accessLog {
+	if cfg.AccessLogFormat == AccessLogFormatLogger && cfg.AccessLogFile == "" && cfg.AccessLogSyslog == "" {
+		return nil
+	}
+	tmpl, err := parseAccessLogFormat(cfg.AccessLogFormat)
+	if err != nil {
+		logger.Error("Invalid access log format, logging access through the logger", "error", err)
+		return nil
+	}
+	format := cfg.AccessLogFormat
+	if format == AccessLogFormatLogger {
+		format = AccessLogFormatCombined // A file or syslog gets plain lines rather than logger output
+	}
+	var out io.Writer = os.Stdout
+	switch {
+	case cfg.AccessLogSyslog != "":
+		writer, err := newSyslogWriter(cfg.AccessLogSyslog, cfg.AccessLogSyslogFacility, cfg.AccessLogSyslogTag)
+		if err != nil {
+			logger.Error("Failed to connect to syslog, logging access through the logger", "syslog", cfg.AccessLogSyslog, "error", err)
+			return nil
+		}
+		out = writer
+	case cfg.AccessLogFile != "" && cfg.AccessLogFile != "-":
+		file, err := openAccessLogFile(cfg.AccessLogFile)
+		if err != nil {
+			logger.Error("Failed to open access log file, logging access through the logger", "file", cfg.AccessLogFile, "error", err)
+			return nil
+		}
+		out = file
+	}
+	return &accessLog{format: format, tmpl: tmpl, out: out}
+}
+
+// write formats e as a single line; the whole line goes out in one Write
+func (a *accessLog) write(e *AccessLogEntry) error {
+	var line bytes.Buffer
+	switch a.format {
+	case AccessLogFormatJSON:
+		if err := json.NewEncoder(&line).Encode(e); err != nil {
+			return err
+		}
+	case AccessLogFormatCombined:
+		line.WriteString(combinedLogLine(e))
+	default:
+		if err := a.tmpl.Execute(&line, e); err != nil {
+			return err
+		}
+		line.WriteByte('\n')
+	}
+	_, err := a.out.Write(line.Bytes())
+	return err
+}
+
+// combinedLogLine formats e in the combined log format, without user identity:
+// client - - [time] "METHOD uri proto" status bytes "referer" "user agent"
+func combinedLogLine(e *AccessLogEntry) string {
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.Itoa(e.Bytes)
+	}
+	return fmt.Sprintf("%s - - [%s] %q %d %s %q %q\n",
+		e.Client, e.Time.Format("02/Jan/2006:15:04:05 -0700"), e.Method+" "+e.URI+" "+e.Proto,
+		e.Status, size, dashIfEmpty(e.Referer), dashIfEmpty(e.UserAgent))
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// accessLogFile is an append-only log file shared by every proxy logging to its path, so
+// ReopenAccessLogs can swap it for a fresh one after logrotate moved it away
+type accessLogFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+var (
+	accessLogFilesMu sync.Mutex
+	accessLogFiles   = map[string]*accessLogFile{}
+)
+
+// openAccessLogFile returns the shared handle for path, opening the file on first use
+func openAccessLogFile(path string) (*accessLogFile, error) {
+	accessLogFilesMu.Lock()
+	defer accessLogFilesMu.Unlock()
+	if f, ok := accessLogFiles[path]; ok {
+		return f, nil
+	}
+	file, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &accessLogFile{path: path, file: file}
+	accessLogFiles[path] = f
+	return f, nil
+}
+
+// openAppend opens path for appending, creating it if needed
+func openAppend(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+}
+
+func (f *accessLogFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(p)
+}
+
+// reopen replaces the file with a newly opened one at the same path
+func (f *accessLogFile) reopen() error {
+	file, err := openAppend(f.path)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	old := f.file
+	f.file = file
+	f.mu.Unlock()
+	return old.Close()
+}
+
+// ReopenAccessLogs reopens every access log file, e.g. on SIGHUP after logrotate renamed
+// them. Logging continues to the old file until its replacement is open.
+func ReopenAccessLogs() error {
+	accessLogFilesMu.Lock()
+	defer accessLogFilesMu.Unlock()
+	var errs []error
+	for _, f := range accessLogFiles {
+		if err := f.reopen(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
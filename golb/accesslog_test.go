@@ -0,0 +1,110 @@
+package golb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// closeAccessLogFiles forgets the shared access log files so a test's temp dir can be removed
+func closeAccessLogFiles() {
+	accessLogFilesMu.Lock()
+	defer accessLogFilesMu.Unlock()
+	for path, f := range accessLogFiles {
+		_ = f.file.Close()
+		delete(accessLogFiles, path)
+	}
+}
+
+// serveLogged sends one request through a proxy logging access with format to a temp file
+// and returns the file's contents
+func serveLogged(t *testing.T, format string) string {
+	t.Helper()
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	}))
+	cfg := DefaultConfig()
+	cfg.AccessLogEnabled = true
+	cfg.AccessLogFormat = format
+	cfg.AccessLogFile = filepath.Join(t.TempDir(), "access.log")
+	t.Cleanup(closeAccessLogFiles)
+
+	req := httptest.NewRequest("POST", "/items?id=7", nil)
+	req.RemoteAddr = "192.0.2.10:5000"
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", "test-agent/1.0")
+	NewProxy(pool, cfg).ServeHTTP(httptest.NewRecorder(), req)
+
+	data, err := os.ReadFile(cfg.AccessLogFile)
+	if err != nil {
+		t.Fatalf("Failed to read access log: %v", err)
+	}
+	return string(data)
+}
+
+func TestAccessLogCombinedFormat(t *testing.T) {
+	line := serveLogged(t, AccessLogFormatCombined)
+	pattern := regexp.MustCompile(`^192\.0\.2\.10 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "POST /items\?id=7 HTTP/1\.1" 201 5 "https://example\.com/" "test-agent/1\.0"\n$`)
+	if !pattern.MatchString(line) {
+		t.Errorf("Unexpected combined log line: %q", line)
+	}
+}
+
+func TestAccessLogJSONFormat(t *testing.T) {
+	line := serveLogged(t, AccessLogFormatJSON)
+	if strings.Count(line, "\n") != 1 {
+		t.Fatalf("Expected a single line, got %q", line)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("Expected a JSON object, got %q: %v", line, err)
+	}
+	for key, want := range map[string]any{"method": "POST", "uri": "/items?id=7", "client": "192.0.2.10", "status": 201.0, "bytes": 5.0, "userAgent": "test-agent/1.0"} {
+		if entry[key] != want {
+			t.Errorf("Expected %s=%v, got %v", key, want, entry[key])
+		}
+	}
+	for _, key := range []string{"time", "backend", "durationNanoSec", "requestId"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("Expected %s in the JSON entry %v", key, entry)
+		}
+	}
+}
+
+func TestAccessLogTemplateFormat(t *testing.T) {
+	if line := serveLogged(t, "{{.Method}} {{.URI}} -> {{.Status}}"); line != "POST /items?id=7 -> 201\n" {
+		t.Errorf("Unexpected templated log line: %q", line)
+	}
+	if _, err := parseAccessLogFormat("apache"); err == nil {
+		t.Errorf("Expected an unknown format name to be rejected")
+	}
+}
+
+func TestReopenAccessLogs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	t.Cleanup(closeAccessLogFiles)
+	log := newAccessLog(&Config{AccessLogFormat: "{{.Method}}", AccessLogFile: path}, &captureLogger{})
+	if err := log.write(&AccessLogEntry{Method: "GET"}); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := os.Rename(path, path+".1"); err != nil { // What logrotate does
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if err := ReopenAccessLogs(); err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	if err := log.write(&AccessLogEntry{Method: "PUT"}); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	rotated, _ := os.ReadFile(path + ".1")
+	current, _ := os.ReadFile(path)
+	if string(rotated) != "GET\n" || string(current) != "PUT\n" {
+		t.Errorf("Expected writes after reopening to go to the new file, got %q and %q", rotated, current)
+	}
+}
@@ -0,0 +1,64 @@
+package golb
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tuning of the gradient-based concurrency limit, after Netflix's gradient limiter
+const (
+	adaptiveTolerance      = 1.5  // Latency may grow this much over the no-load latency before the limit shrinks
+	adaptiveSmoothing      = 0.2  // Weight of each new estimate in the limit
+	adaptiveMinGradient    = 0.5  // A single sample at most halves the limit (before the queue allowance)
+	adaptiveBaselineWindow = 1000 // Samples after which the no-load latency is measured afresh
+)
+
+// adaptiveLimit discovers how many concurrent requests a backend handles well by comparing
+// each request's latency with the lowest one seen recently, taken as the no-load latency:
+// when latency rises the limit shrinks in proportion, when it holds steady the limit grows
+// by a queue allowance of sqrt(limit). The baseline restarts every adaptiveBaselineWindow
+// samples so a backend that got slower for good isn't throttled forever.
+type adaptiveLimit struct {
+	mu       sync.Mutex
+	limit    float64
+	maxLimit float64
+	minRTT   float64 // No-load latency in nanoseconds; 0 until the first sample
+	samples  int
+
+	current atomic.Int64 // Rounded limit, read on every selection without the lock
+}
+
+// newAdaptiveLimit returns a limit starting at initial and never exceeding maxLimit
+func newAdaptiveLimit(initial, maxLimit int) *adaptiveLimit {
+	l := &adaptiveLimit{limit: float64(initial), maxLimit: float64(maxLimit)}
+	l.current.Store(int64(initial))
+	return l
+}
+
+// Limit returns the current concurrency limit
+func (l *adaptiveLimit) Limit() int64 {
+	return l.current.Load()
+}
+
+// observe updates the limit with the latency of a request that completed while inflight
+// requests (including itself) were outstanding
+func (l *adaptiveLimit) observe(rtt time.Duration, inflight int64) {
+	sample := float64(max(rtt.Nanoseconds(), 1))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples++
+	if l.minRTT == 0 || sample < l.minRTT || l.samples%adaptiveBaselineWindow == 0 {
+		l.minRTT = sample
+	}
+
+	gradient := max(adaptiveMinGradient, min(1, adaptiveTolerance*l.minRTT/sample))
+	if gradient == 1 && float64(inflight) < l.limit/2 {
+		return // Latency is fine, but the backend isn't busy enough to show it could take more
+	}
+	estimate := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = max(1, min(l.maxLimit, (1-adaptiveSmoothing)*l.limit+adaptiveSmoothing*estimate))
+	l.current.Store(int64(l.limit))
+}
@@ -0,0 +1,83 @@
+package golb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimitShrinksAsLatencyGrows(t *testing.T) {
+	l := newAdaptiveLimit(50, 1000)
+	// Latency doubles for every 5 concurrent requests beyond the first 5
+	latency := func(inflight int64) time.Duration {
+		return 10 * time.Millisecond * time.Duration(max(inflight, 5)) / 5
+	}
+	l.observe(latency(1), 1) // No-load baseline
+	for range 300 {
+		inflight := l.Limit() // Saturated: every slot is in use
+		l.observe(latency(inflight), inflight)
+	}
+	if got := l.Limit(); got >= 20 || got < 5 {
+		t.Errorf("Expected the limit to settle near where latency starts growing, got %d", got)
+	}
+}
+
+func TestAdaptiveLimitGrowsOnlyWhenBusy(t *testing.T) {
+	l := newAdaptiveLimit(20, 40)
+	for range 50 {
+		l.observe(10*time.Millisecond, 2) // Steady latency, mostly idle
+	}
+	if got := l.Limit(); got != 20 {
+		t.Errorf("Expected an idle backend's limit to stay put, got %d", got)
+	}
+	for range 200 {
+		l.observe(10*time.Millisecond, l.Limit())
+	}
+	if got := l.Limit(); got != 40 {
+		t.Errorf("Expected a busy backend with steady latency to grow to the max limit, got %d", got)
+	}
+}
+
+func TestAdaptiveConcurrencyThroughProxy(t *testing.T) {
+	var inflight atomic.Int64
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		time.Sleep(time.Duration(n) * 2 * time.Millisecond) // Slower the more requests pile up
+	}))
+	pool.SetLogger(&captureLogger{})
+	backend.EnableAdaptiveConcurrency(40, 100)
+	cfg := DefaultConfig()
+	cfg.QueueTimeout = 5 * time.Second
+	proxy := NewProxy(pool, cfg)
+
+	for range 5 {
+		var wg sync.WaitGroup
+		for range 40 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			}()
+		}
+		wg.Wait()
+	}
+	limit := backend.ConnectionLimit()
+	if limit >= 40 {
+		t.Errorf("Expected the limit to adapt downward under load, got %d", limit)
+	}
+
+	rr := httptest.NewRecorder()
+	StatusHandler(rr, httptest.NewRequest("GET", "/status", nil), pool, cfg)
+	var statuses []BackendStatus
+	if err := json.NewDecoder(rr.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].ConnectionLimit != limit {
+		t.Errorf("Expected /status to report the current limit %d, got %+v", limit, statuses)
+	}
+}
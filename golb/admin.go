@@ -0,0 +1,100 @@
+package golb
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+)
+
+// AdminTokenHeader carries cfg.AdminToken on requests to admin endpoints. It is separate from
+// Authorization so admin calls still work when Authenticate guards all traffic.
+const AdminTokenHeader = "X-GoLB-Admin-Token"
+
+// requireAdmin reports whether r carries the admin token, answering the request if not:
+// 404 when no token is configured (admin endpoints are disabled), 401 when it's missing or wrong.
+func requireAdmin(w http.ResponseWriter, r *http.Request, cfg *Config) bool {
+	if cfg.AdminToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(AdminTokenHeader)), []byte(cfg.AdminToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// ConfigHandler returns the effective configuration, after defaults, file, environment and
+// flags were merged, as JSON with secrets redacted (see Config.Redacted). It requires the
+// admin token.
+func ConfigHandler(w http.ResponseWriter, r *http.Request, cfg *Config) {
+	if !requireAdmin(w, r, cfg) {
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(cfg.Redacted())
+}
+
+// PauseHandler pauses pools (see ServerPool.Pause): new requests get cfg.PausedStatusCode
+// until ResumeHandler is called. It requires the admin token and POST.
+func PauseHandler(w http.ResponseWriter, r *http.Request, cfg *Config, pools ...*ServerPool) {
+	setPaused(w, r, cfg, true, pools)
+}
+
+// ResumeHandler resumes pools paused by PauseHandler. It requires the admin token and POST.
+func ResumeHandler(w http.ResponseWriter, r *http.Request, cfg *Config, pools ...*ServerPool) {
+	setPaused(w, r, cfg, false, pools)
+}
+
+func setPaused(w http.ResponseWriter, r *http.Request, cfg *Config, paused bool, pools []*ServerPool) {
+	if !requireAdmin(w, r, cfg) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	for _, pool := range pools {
+		if paused {
+			pool.Pause()
+		} else {
+			pool.Resume()
+		}
+	}
+	if len(pools) > 0 {
+		pools[0].Logger().Warn("Admin changed pause state", "paused", paused, "client", ClientIP(r))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]bool{"paused": paused})
+}
+
+// RegisterPprof mounts the net/http/pprof handlers under /debug/pprof/ on mux, behind the
+// admin token, if cfg.EnablePprof is set. Profiles expose memory contents and stack traces,
+// so they are never served without the token.
+func RegisterPprof(mux *http.ServeMux, cfg *Config) {
+	if !cfg.EnablePprof {
+		return
+	}
+	profiles := http.NewServeMux()
+	profiles.HandleFunc("/debug/pprof/", pprof.Index) // Also serves the named profiles, e.g. heap
+	profiles.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	profiles.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	profiles.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	profiles.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/pprof/", func(w http.ResponseWriter, r *http.Request) {
+		if requireAdmin(w, r, cfg) {
+			profiles.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package golb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigHandler(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BackendServers = []string{"http://10.0.0.1:8080"}
+	cfg.HealthCheckInterval = 7 * time.Second
+	cfg.AdminToken = "admin-secret"
+	cfg.AuthBearerToken = "bearer-secret"
+	cfg.TLSKeyFile = "/etc/golb/key.pem"
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/config", nil)
+		if token != "" {
+			req.Header.Set(AdminTokenHeader, token)
+		}
+		rr := httptest.NewRecorder()
+		ConfigHandler(rr, req, cfg)
+		return rr
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if rr := get(token); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %d with admin token %q, got %d", http.StatusUnauthorized, token, rr.Code)
+		}
+	}
+
+	rr := get("admin-secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected %d with the admin token, got %d", http.StatusOK, rr.Code)
+	}
+	var got Config
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode config: %v", err)
+	}
+	if len(got.BackendServers) != 1 || got.BackendServers[0] != "http://10.0.0.1:8080" || got.HealthCheckInterval != 7*time.Second {
+		t.Errorf("Expected the effective config, got backends %v and interval %v", got.BackendServers, got.HealthCheckInterval)
+	}
+	for name, value := range map[string]string{"AdminToken": got.AdminToken, "AuthBearerToken": got.AuthBearerToken, "TLSKeyFile": got.TLSKeyFile} {
+		if value != "REDACTED" {
+			t.Errorf("Expected %s to be redacted, got %q", name, value)
+		}
+	}
+	if cfg.AdminToken != "admin-secret" {
+		t.Errorf("Expected the served config not to modify the original")
+	}
+
+	// Without a token the admin endpoints don't exist
+	cfg.AdminToken = ""
+	if rr := get(""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected %d with no admin token configured, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	cfg := DefaultConfig()
+	cfg.AdminToken = "admin-secret"
+	proxy := NewProxy(pool, cfg)
+
+	admin := func(handler func(http.ResponseWriter, *http.Request, *Config, ...*ServerPool), method string) int {
+		req := httptest.NewRequest(method, "/admin", nil)
+		req.Header.Set(AdminTokenHeader, "admin-secret")
+		rr := httptest.NewRecorder()
+		handler(rr, req, cfg, pool)
+		return rr.Code
+	}
+	proxied := func() int {
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		return rr.Code
+	}
+
+	if code := proxied(); code != http.StatusOK {
+		t.Fatalf("Expected %d before pausing, got %d", http.StatusOK, code)
+	}
+	if code := admin(PauseHandler, "GET"); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected %d for GET, got %d", http.StatusMethodNotAllowed, code)
+	}
+	if code := admin(PauseHandler, "POST"); code != http.StatusOK {
+		t.Fatalf("Expected %d from pause, got %d", http.StatusOK, code)
+	}
+	if code := proxied(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d while paused, got %d", http.StatusServiceUnavailable, code)
+	}
+	pool.PerformHealthCheckCycle(&http.Client{Timeout: cfg.BackendRequestTimeout}, cfg)
+	if !backend.IsAlive() {
+		t.Errorf("Expected health checks to keep running while paused")
+	}
+
+	cfg.PausedStatusCode = http.StatusTooManyRequests
+	if code := proxied(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the configured status %d while paused, got %d", http.StatusTooManyRequests, code)
+	}
+
+	if code := admin(ResumeHandler, "POST"); code != http.StatusOK {
+		t.Fatalf("Expected %d from resume, got %d", http.StatusOK, code)
+	}
+	if code := proxied(); code != http.StatusOK {
+		t.Errorf("Expected %d after resuming, got %d", http.StatusOK, code)
+	}
+}
+
+func TestPprofEndpoints(t *testing.T) {
+	get := func(cfg *Config, token string) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		mux.Handle("/", http.NotFoundHandler()) // Stands in for the proxy
+		RegisterPprof(mux, cfg)
+		req := httptest.NewRequest("GET", "/debug/pprof/", nil)
+		if token != "" {
+			req.Header.Set(AdminTokenHeader, token)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	cfg := DefaultConfig()
+	cfg.EnablePprof = true
+	cfg.AdminToken = "admin-secret"
+	if rr := get(cfg, "admin-secret"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "goroutine") {
+		t.Errorf("Expected the pprof index with the admin token, got %d", rr.Code)
+	}
+	for _, token := range []string{"", "wrong"} {
+		if rr := get(cfg, token); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %d with admin token %q, got %d", http.StatusUnauthorized, token, rr.Code)
+		}
+	}
+
+	cfg.EnablePprof = false
+	if rr := get(cfg, "admin-secret"); rr.Code != http.StatusNotFound || strings.Contains(rr.Body.String(), "goroutine") {
+		t.Errorf("Expected no pprof endpoints when disabled, got %d", rr.Code)
+	}
+}
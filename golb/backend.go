@@ -1,46 +1,102 @@
 package golb
 
 import (
+	"context"
 	"net/http/httputil"
 	"net/url"
-	"sync"
+	"slices"
+	"strings"
 	"sync/atomic"
+	"time"
 )
 
 // Backend holds information and state about a single backend server
 type Backend struct {
 	URL          *url.URL
-	Alive        atomic.Bool // Tracks health status
+	Alive        atomic.Bool // Tracks health status; change it with SetAlive so the pool notices
 	ReverseProxy *httputil.ReverseProxy
 
 	// --- State for Load Balancing Strategies ---
-	// Mutex protects state fields not handled atomically (e.g., currentWeight)
-	stateMutex sync.Mutex
 	// Least Connections: Count of active connections proxied *to* this backend
 	activeConnections atomic.Int64
+	// Connection limit: backend is skipped while activeConnections >= maxConnections (0 = unlimited)
+	maxConnections atomic.Int64
+	// Adaptive connection limit learned from latency, nil unless enabled; also caps maxConnections
+	concurrency *adaptiveLimit
 	// Least Response Time: EWMA of response times in nanoseconds
 	ewmaResponseTime atomic.Int64
-	// Weighted Round Robin: Static weight assigned at config time
-	weight int
-	// Weighted Round Robin: Internal algorithm state
+	// Weighted balancers: weight assigned at config time, adjustable with SetWeight
+	weight atomic.Int64
+	// Weight assigned at config time, restored when a reported capacity goes away
+	configuredWeight int
+	// The weight comes from a capacity reported in health checks, see applyReportedCapacity
+	capacityReported atomic.Bool
+	// The weight is steered by a cutover, which reported capacities must not override
+	cutoverWeight atomic.Bool
+	// Set by SetWeight so the WRR balancer restarts currentWeight on its next pass
+	weightChanged atomic.Bool
+	// Weighted Round Robin: Internal algorithm state, guarded by the balancer's lock
 	currentWeight int
+
+	// Latency distribution of proxied requests, for percentiles in /status and /metrics
+	latency *latencyHistogram
+	// Coarse request duration histogram with trace exemplars, exported in /metrics
+	durations *durationHistogram
+
+	// Proxied request timeout override; 0 uses the global Config.RequestTimeout
+	requestTimeout atomic.Int64
+
+	// Health check URL override; empty checks URL + Config.HealthCheckPath
+	healthCheckURL atomic.Pointer[string]
+	// gRPC health check service override; empty uses Config.HealthCheckService
+	healthCheckSvc atomic.Pointer[string]
+
+	// Groups the backend belongs to, see SetTags
+	tags []string
+
+	// Outlier detection: rolling outcome counts and ejection deadline (Unix nanoseconds, 0 if never ejected)
+	outcomes     outcomeWindow
+	ejectedUntil atomic.Int64
+
+	// Back-off requested by the backend through 503 + Retry-After (Unix nanoseconds, 0 if never)
+	backoffUntil atomic.Int64
+
+	// Lifetime request, response and error totals, see Counters
+	counters backendCounters
+
+	// Called after the alive status or the backup role flips, so the owning pool can refresh its alive set
+	onAliveChange func()
 }
 
 // NewBackend creates a new Backend instance
 func NewBackend(targetURL *url.URL, proxy *httputil.ReverseProxy, weight int) *Backend {
 	b := &Backend{
-		URL:          targetURL,
-		ReverseProxy: proxy,
-		weight:       weight, // Assign weight during creation
+		URL:              targetURL,
+		ReverseProxy:     proxy,
+		latency:          newLatencyHistogram(),
+		durations:        newDurationHistogram(),
+		configuredWeight: weight,
 		// Atomics default to 0, Alive defaults to false (needs first health check)
 	}
+	b.weight.Store(int64(weight))
 	b.Alive.Store(false) // Start as not alive
 	return b
 }
 
 // SetAlive safely sets the alive status of the backend
 func (b *Backend) SetAlive(alive bool) {
-	b.Alive.Store(alive)
+	b.setAlive(alive)
+}
+
+// setAlive is SetAlive reporting whether the status changed
+func (b *Backend) setAlive(alive bool) bool {
+	if b.Alive.Swap(alive) == alive {
+		return false
+	}
+	if b.onAliveChange != nil {
+		b.onAliveChange()
+	}
+	return true
 }
 
 // IsAlive safely checks the alive status of the backend
@@ -48,21 +104,216 @@ func (b *Backend) IsAlive() bool {
 	return b.Alive.Load()
 }
 
+// IsEjected reports whether outlier detection has temporarily removed the backend from selection
+func (b *Backend) IsEjected() bool {
+	return time.Now().UnixNano() < b.ejectedUntil.Load()
+}
+
+// EjectedUntil returns when the current ejection ends, or the zero time if not ejected
+func (b *Backend) EjectedUntil() time.Time {
+	if !b.IsEjected() {
+		return time.Time{}
+	}
+	return time.Unix(0, b.ejectedUntil.Load())
+}
+
+// IsAvailable reports whether the backend can be selected: alive, not ejected or backing off,
+// and below its connection limit
+func (b *Backend) IsAvailable() bool {
+	return b.IsAlive() && b.hasCapacity()
+}
+
+// hasCapacity is IsAvailable without the liveness check, for balancers handed the pool's alive set
+func (b *Backend) hasCapacity() bool {
+	return !b.IsEjected() && !b.IsBackingOff() && !b.IsSaturated()
+}
+
+// SetMaxConnections limits the concurrent requests proxied to the backend; 0 means unlimited
+func (b *Backend) SetMaxConnections(n int) {
+	b.maxConnections.Store(int64(n))
+}
+
+// SetRequestTimeout overrides the global request timeout for requests to this backend; 0 clears it
+func (b *Backend) SetRequestTimeout(d time.Duration) {
+	b.requestTimeout.Store(int64(d))
+}
+
+// RequestTimeout returns the backend's request timeout override, or 0 if it uses the global timeout
+func (b *Backend) RequestTimeout() time.Duration {
+	return time.Duration(b.requestTimeout.Load())
+}
+
+// SetHealthCheckURL makes health checks request rawURL instead of the backend URL plus
+// Config.HealthCheckPath, e.g. a sidecar on another scheme or port; "" clears it
+func (b *Backend) SetHealthCheckURL(rawURL string) {
+	b.healthCheckURL.Store(&rawURL)
+}
+
+// HealthCheckURL returns the URL health checks request for the given health check path
+func (b *Backend) HealthCheckURL(healthCheckPath string) string {
+	if override := b.healthCheckURL.Load(); override != nil && *override != "" {
+		return *override
+	}
+	return b.ResolvePath(healthCheckPath)
+}
+
+// SetHealthCheckService makes gRPC health checks ask about service instead of
+// Config.HealthCheckService; "" clears it
+func (b *Backend) SetHealthCheckService(service string) {
+	b.healthCheckSvc.Store(&service)
+}
+
+// HealthCheckService returns the gRPC service gRPC health checks ask about, given the global one
+func (b *Backend) HealthCheckService(defaultService string) string {
+	if override := b.healthCheckSvc.Load(); override != nil && *override != "" {
+		return *override
+	}
+	return defaultService
+}
+
+// ResolvePath returns the URL of path on this backend. A backend URL with a path is a base
+// path: path goes under it with exactly one slash in between, as proxied requests do, so
+// "/health" on http://host/base is http://host/base/health. A query in path replaces any
+// query in the backend URL.
+func (b *Backend) ResolvePath(path string) string {
+	u := *b.URL
+	path, query, hasQuery := strings.Cut(path, "?")
+	u.Path, u.RawPath = singleJoiningSlash(b.URL.Path, path), ""
+	if hasQuery {
+		u.RawQuery = query
+	}
+	return u.String()
+}
+
+// SetTags sets the groups the backend belongs to, e.g. "blue". Call it before the backend
+// serves traffic.
+func (b *Backend) SetTags(tags ...string) {
+	b.tags = tags
+}
+
+// Tags returns the groups the backend belongs to
+func (b *Backend) Tags() []string {
+	return b.tags
+}
+
+// HasTag reports whether the backend belongs to the group tag
+func (b *Backend) HasTag(tag string) bool {
+	return slices.Contains(b.tags, tag)
+}
+
+// EnableAdaptiveConcurrency limits concurrent requests to a limit learned from request
+// latencies, starting at initial and never above maxLimit. Call it before the backend
+// serves traffic.
+func (b *Backend) EnableAdaptiveConcurrency(initial, maxLimit int) {
+	b.concurrency = newAdaptiveLimit(initial, maxLimit)
+}
+
+// ConnectionLimit returns the concurrent request limit in effect: the static limit, lowered
+// by the adaptive one if enabled. 0 means unlimited.
+func (b *Backend) ConnectionLimit() int64 {
+	limit := b.maxConnections.Load()
+	if b.concurrency != nil {
+		if adaptive := b.concurrency.Limit(); limit == 0 || adaptive < limit {
+			limit = adaptive
+		}
+	}
+	return limit
+}
+
+// observeConcurrency feeds the latency of a completed request to the adaptive limit, if
+// enabled. Call it before the request's connection is released.
+func (b *Backend) observeConcurrency(d time.Duration) {
+	if b.concurrency != nil {
+		b.concurrency.observe(d, b.activeConnections.Load())
+	}
+}
+
+// IsSaturated reports whether the backend has reached its connection limit
+func (b *Backend) IsSaturated() bool {
+	limit := b.ConnectionLimit()
+	return limit > 0 && b.activeConnections.Load() >= limit
+}
+
+// eject removes the backend from selection until the given time. It returns false if
+// the backend was already ejected, so concurrent failures eject it only once.
+func (b *Backend) eject(until time.Time) bool {
+	current := b.ejectedUntil.Load()
+	if time.Now().UnixNano() < current {
+		return false
+	}
+	return b.ejectedUntil.CompareAndSwap(current, until.UnixNano())
+}
+
 // IncrementActiveConnections atomically increases the connection count
 // NOTE: Call this when a request is successfully routed TO this backend.
 func (b *Backend) IncrementActiveConnections() {
 	b.activeConnections.Add(1)
 }
 
-// DecrementActiveConnections atomically decreases the connection count
+// DecrementActiveConnections atomically decreases the connection count, never below zero:
+// an unmatched decrement is a wiring bug, logged as a warning instead of skewing
+// least-connections for good.
 // NOTE: Call this when a request routed TO this backend finishes or errors.
 func (b *Backend) DecrementActiveConnections() {
-	b.activeConnections.Add(-1)
+	for {
+		current := b.activeConnections.Load()
+		if current <= 0 {
+			DefaultLogger().Warn("Active connection count would drop below zero, ignoring decrement", "backend", b.URL.String(), "count", current)
+			return
+		}
+		if b.activeConnections.CompareAndSwap(current, current-1) {
+			return
+		}
+	}
 }
 
-// GetWeight returns the static weight of the backend
+// GetWeight returns the current weight of the backend
 func (b *Backend) GetWeight() int {
-	return b.weight
+	return int(b.weight.Load())
+}
+
+// SetWeight changes the backend's weight at runtime, e.g. from an autoscaler; negative
+// weights count as 0, which makes the backend a backup (see IsBackup). Weighted round robin
+// starts the backend's smoothing state afresh on its next selection, so the new weight
+// applies from the next cycle.
+func (b *Backend) SetWeight(weight int) {
+	wasBackup := b.IsBackup()
+	b.weight.Store(int64(max(weight, 0)))
+	b.weightChanged.Store(true)
+	if b.IsBackup() != wasBackup && b.onAliveChange != nil {
+		b.onAliveChange()
+	}
+}
+
+// BackupTag marks a backend as a backup regardless of its weight, see IsBackup
+const BackupTag = "backup"
+
+// IsBackup reports whether the backend is a standby, only selected while no primary
+// backend is alive: its weight is 0 or it is tagged BackupTag
+func (b *Backend) IsBackup() bool {
+	return b.GetWeight() == 0 || b.HasTag(BackupTag)
+}
+
+// ObserveLatency records the duration of a request proxied to this backend
+func (b *Backend) ObserveLatency(d time.Duration) {
+	b.ObserveLatencyCtx(context.Background(), d)
+}
+
+// ObserveLatencyCtx is ObserveLatency for the request of ctx: if it carries a trace ID (see
+// WithTraceID), the request becomes the exemplar of its /metrics histogram bucket
+func (b *Backend) ObserveLatencyCtx(ctx context.Context, d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	b.latency.Observe(d)
+	traceID, _ := TraceIDFromContext(ctx)
+	b.durations.Observe(d, traceID)
+}
+
+// LatencyPercentile estimates the q-th quantile (e.g. 0.99) of observed request latencies,
+// or 0 if none have been recorded
+func (b *Backend) LatencyPercentile(q float64) time.Duration {
+	return b.latency.Percentile(q)
 }
 
 // Note: Get/Set for ewmaResponseTime and activeConnections are handled via atomics directly
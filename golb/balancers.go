@@ -0,0 +1,61 @@
+package golb
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// BalancerFactory creates a LoadBalancer, reading any tuning (e.g. EWMAAlpha) from cfg
+type BalancerFactory func(cfg *Config) LoadBalancer
+
+var (
+	balancersMu sync.RWMutex
+	balancers   = map[string]BalancerFactory{
+		"round-robin":          func(*Config) LoadBalancer { return NewRoundRobinBalancer() },
+		"least-connections":    func(*Config) LoadBalancer { return NewLeastConnectionBalancer() },
+		"least-response-time":  func(cfg *Config) LoadBalancer { return NewLeastResponseTimeBalancer(cfg.EWMAAlpha) },
+		"weighted-round-robin": func(cfg *Config) LoadBalancer { return NewCappedWeightedRoundRobinBalancer(cfg.MaxWeightRatio) },
+		"peak-ewma":            func(cfg *Config) LoadBalancer { return NewPeakEWMABalancer(cfg.EWMAAlpha) },
+		"hybrid":               func(cfg *Config) LoadBalancer { return NewHybridBalancer(cfg.EWMAAlpha, cfg.SelectionLatencyWeight) },
+	}
+)
+
+// RegisterBalancer makes a load balancing algorithm available by name, e.g. for
+// Config.LoadBalancingAlgorithm and per-route algorithms. Registering an existing name replaces it.
+func RegisterBalancer(name string, factory BalancerFactory) {
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+	balancers[name] = factory
+}
+
+// HasBalancer reports whether an algorithm is registered under name
+func HasBalancer(name string) bool {
+	balancersMu.RLock()
+	defer balancersMu.RUnlock()
+	_, ok := balancers[name]
+	return ok
+}
+
+// BalancerNames returns the registered algorithm names, sorted
+func BalancerNames() []string {
+	balancersMu.RLock()
+	defer balancersMu.RUnlock()
+	names := make([]string, 0, len(balancers))
+	for name := range balancers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// NewBalancer creates a new instance of the algorithm registered under name
+func NewBalancer(name string, cfg *Config) (LoadBalancer, error) {
+	balancersMu.RLock()
+	factory, ok := balancers[name]
+	balancersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown load balancing algorithm %q (available: %v)", name, BalancerNames())
+	}
+	return factory(cfg), nil
+}
@@ -0,0 +1,61 @@
+package golb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// BenchmarkSelectBackend measures one selection for each built-in algorithm across pool
+// sizes and alive ratios, e.g. -bench 'SelectBackend/least-connections/backends=100'
+func BenchmarkSelectBackend(b *testing.B) {
+	algorithms := []string{"round-robin", "least-connections", "least-response-time", "weighted-round-robin", "peak-ewma"}
+	for _, algorithm := range algorithms {
+		for _, n := range []int{2, 10, 100} {
+			for _, alivePercent := range []int{100, 50, 10} {
+				name := fmt.Sprintf("%s/backends=%d/alive=%d%%", algorithm, n, alivePercent)
+				b.Run(name, func(b *testing.B) {
+					lb, err := NewBalancer(algorithm, DefaultConfig())
+					if err != nil {
+						b.Fatal(err)
+					}
+					pool := newLargePool(b, lb, n)
+					aliveEvery := 100 / alivePercent // At least one backend stays alive
+					for i, backend := range pool.backends {
+						backend.SetAlive(i%aliveEvery == 0)
+						backend.SetWeight(i%5 + 1)
+						backend.activeConnections.Store(int64(i % 7))
+						backend.ewmaResponseTime.Store(int64(time.Duration(i%11+1) * time.Millisecond))
+					}
+					b.ReportAllocs()
+					b.ResetTimer()
+					for range b.N {
+						if pool.SelectBackend() == nil {
+							b.Fatal("expected a backend")
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+// BenchmarkLb measures the whole proxy path, selection through response, against a local backend
+func BenchmarkLb(b *testing.B) {
+	pool, _ := newTestPool(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	pool.SetLogger(&captureLogger{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		rr := httptest.NewRecorder()
+		Lb(rr, httptest.NewRequest("GET", "/", nil), pool, false, false)
+		if rr.Code != http.StatusOK {
+			b.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	}
+}
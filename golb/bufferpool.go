@@ -0,0 +1,77 @@
+package golb
+
+import (
+	"bytes"
+	"sync"
+)
+
+// BufferPool reuses fixed-size byte slices across requests. It implements
+// httputil.BufferPool, so reverse proxies copy response bodies without a fresh 32KB
+// buffer per request.
+type BufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// NewBufferPool creates a pool of buffers of size bytes
+func NewBufferPool(size int) *BufferPool {
+	return &BufferPool{size: size}
+}
+
+// Get returns a buffer of the pool's size, allocating one if none is free
+func (bp *BufferPool) Get() []byte {
+	if b, ok := bp.pool.Get().(*[]byte); ok {
+		return *b
+	}
+	return make([]byte, bp.size)
+}
+
+// Put returns b for reuse. Buffers of any other size are left to the garbage collector.
+func (bp *BufferPool) Put(b []byte) {
+	if cap(b) != bp.size {
+		return
+	}
+	b = b[:bp.size]
+	bp.pool.Put(&b)
+}
+
+var (
+	copyBufferPoolsMu sync.Mutex
+	copyBufferPools   = map[int]*BufferPool{} // By buffer size, shared by every backend proxy
+)
+
+// sharedBufferPool returns the process-wide copy buffer pool for size, or nil for size 0
+func sharedBufferPool(size int) *BufferPool {
+	if size <= 0 {
+		return nil
+	}
+	copyBufferPoolsMu.Lock()
+	defer copyBufferPoolsMu.Unlock()
+	bp, ok := copyBufferPools[size]
+	if !ok {
+		bp = NewBufferPool(size)
+		copyBufferPools[size] = bp
+	}
+	return bp
+}
+
+// captureBuffers holds the growable buffers used to capture access log payloads
+var captureBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// getCaptureBuffer returns an empty buffer, reused if maxPooled allows pooling
+func getCaptureBuffer(maxPooled int) *bytes.Buffer {
+	if maxPooled <= 0 {
+		return new(bytes.Buffer)
+	}
+	return captureBuffers.Get().(*bytes.Buffer)
+}
+
+// putCaptureBuffer resets buf and keeps it for reuse unless it grew past maxPooled bytes,
+// so one huge payload doesn't pin its memory in the pool
+func putCaptureBuffer(buf *bytes.Buffer, maxPooled int) {
+	if buf == nil || maxPooled <= 0 || buf.Cap() > maxPooled {
+		return
+	}
+	buf.Reset()
+	captureBuffers.Put(buf)
+}
@@ -0,0 +1,115 @@
+package golb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBufferPoolReusesOnlyItsSize(t *testing.T) {
+	bp := NewBufferPool(1024)
+	b := bp.Get()
+	if len(b) != 1024 {
+		t.Fatalf("Expected a 1024 byte buffer, got %d", len(b))
+	}
+	bp.Put(b[:10]) // Callers may hand back a resliced buffer
+	if got := bp.Get(); len(got) != 1024 {
+		t.Errorf("Expected pooled buffers to come back full size, got %d", len(got))
+	}
+	bp.Put(make([]byte, 10)) // Foreign size: dropped
+	if got := bp.Get(); len(got) != 1024 {
+		t.Errorf("Expected foreign buffers not to be pooled, got %d bytes", len(got))
+	}
+
+	if sharedBufferPool(0) != nil {
+		t.Errorf("Expected no shared pool for size 0")
+	}
+	if sharedBufferPool(4096) != sharedBufferPool(4096) {
+		t.Errorf("Expected one shared pool per size")
+	}
+}
+
+// newAccessLoggedProxy proxies to a backend built like the real ones, logging payloads to logger
+func newAccessLoggedProxy(tb testing.TB, cfg *Config, handler http.Handler, logger Logger) *Proxy {
+	tb.Helper()
+	server := httptest.NewServer(handler)
+	tb.Cleanup(server.Close)
+	cfg.AccessLogEnabled, cfg.AccessLogPayloads = true, true
+	pool, err := BuildServerPool(cfg, "round-robin", []string{server.URL}, nil, nil)
+	if err != nil {
+		tb.Fatalf("Failed to build pool: %v", err)
+	}
+	pool.SetLogger(logger)
+	markAllAlive(pool)
+	return NewProxy(pool, cfg)
+}
+
+func TestCapturedPayloadsWithPooledBuffers(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body) // HTTP/1 servers can't read the body once the response is flowing
+		_, _ = w.Write(body)
+	})
+	cfg := DefaultConfig()
+	cfg.MaxPooledBufferSize = 4096 // Some payloads outgrow the pool and must be dropped, not truncated
+	logger := &captureLogger{}
+	proxy := newAccessLoggedProxy(t, cfg, echo, logger)
+
+	// Concurrent requests with distinct bodies: reused buffers must never leak into another log line
+	const requests = 50
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := strings.Repeat(fmt.Sprintf("<%d>", i), i*40+1)
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+			if rr.Body.String() != body {
+				t.Errorf("Request %d: backend response corrupted (status %d, %d bytes)", i, rr.Code, rr.Body.Len())
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range requests {
+		body := strings.Repeat(fmt.Sprintf("<%d>", i), i*40+1)
+		want := "requestBody" + body + "responseBody" + body
+		if line, ok := logger.find(want); !ok || !strings.HasSuffix(line, want) {
+			t.Errorf("Request %d: access log does not contain its exact payloads", i)
+		}
+	}
+}
+
+// BenchmarkProxyAllocations compares allocations per request with and without buffer
+// pooling, for a 64KB response with access log payloads enabled
+func BenchmarkProxyAllocations(b *testing.B) {
+	payload := strings.Repeat("x", 64*1024)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, payload)
+	})
+	for _, pooled := range []bool{false, true} {
+		name := "unpooled"
+		cfg := DefaultConfig()
+		if pooled {
+			name = "pooled"
+		} else {
+			cfg.ProxyBufferSize, cfg.MaxPooledBufferSize = 0, 0
+		}
+		b.Run(name, func(b *testing.B) {
+			proxy := newAccessLoggedProxy(b, cfg, handler, &captureLogger{})
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				rr := httptest.NewRecorder()
+				proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+				if rr.Body.Len() != len(payload) {
+					b.Fatalf("expected %d bytes, got %d", len(payload), rr.Body.Len())
+				}
+			}
+		})
+	}
+}
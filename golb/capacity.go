@@ -0,0 +1,40 @@
+package golb
+
+import "math"
+
+// capacity returns the share of traffic b can take right now, from 0 to 100: nothing while
+// it is down, ejected by outlier detection or backing off after a Retry-After, otherwise its
+// weight relative to the heaviest backend in the pool (which a cutover ramps up and down),
+// scaled by the connection headroom left under its limit.
+func (b *Backend) capacity(maxWeight int) int {
+	if !b.IsAvailable() {
+		return 0
+	}
+	share := 1.0
+	if maxWeight > 0 {
+		share = float64(b.GetWeight()) / float64(maxWeight)
+	}
+	if limit := b.ConnectionLimit(); limit > 0 {
+		share *= max(0, float64(limit-b.activeConnections.Load())/float64(limit))
+	}
+	return int(math.Round(100 * share))
+}
+
+// maxWeight returns the largest weight of the pool's backends
+func (s *ServerPool) maxWeight() int {
+	heaviest := 0
+	for _, b := range s.snapshotBackends() {
+		heaviest = max(heaviest, b.GetWeight())
+	}
+	return heaviest
+}
+
+// Capacity totals the capacity of the pool's backends, as reported per backend by /status:
+// 100 per backend able to take its full share, so 250 is the equivalent of two and a half.
+func (s *ServerPool) Capacity() int {
+	maxWeight, total := s.maxWeight(), 0
+	for _, b := range s.snapshotBackends() {
+		total += b.capacity(maxWeight)
+	}
+	return total
+}
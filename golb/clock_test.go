@@ -0,0 +1,199 @@
+package golb
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when Advance is called
+type fakeClock struct {
+	mu      sync.Mutex
+	changed *sync.Cond // Broadcast when a waiter is added
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a pending After (period 0) or ticker
+type fakeWaiter struct {
+	at     time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	f := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	return f.add(d, 0).c
+}
+
+func (f *fakeClock) NewTicker(d time.Duration) Ticker {
+	return &fakeTicker{clock: f, waiter: f.add(d, d)}
+}
+
+func (f *fakeClock) add(d, period time.Duration) *fakeWaiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{at: f.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	if d <= 0 && period == 0 {
+		w.c <- f.now
+		return w
+	}
+	f.waiters = append(f.waiters, w)
+	f.changed.Broadcast()
+	return w
+}
+
+// Advance moves the clock forward by d, firing the waiters that come due. Like time.Ticker,
+// a ticker that hasn't been read drops ticks.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		for !w.at.After(f.now) {
+			select {
+			case w.c <- w.at:
+			default:
+			}
+			if w.period == 0 {
+				break
+			}
+			w.at = w.at.Add(w.period)
+		}
+		if w.at.After(f.now) {
+			pending = append(pending, w)
+		}
+	}
+	f.waiters = pending
+}
+
+// BlockUntil waits until n waiters are pending, i.e. the code under test went back to sleep
+func (f *fakeClock) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.changed.Wait()
+	}
+}
+
+type fakeTicker struct {
+	clock  *fakeClock
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.waiter.c }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, w := range t.clock.waiters {
+		if w == t.waiter {
+			t.clock.waiters = append(t.clock.waiters[:i], t.clock.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestHealthChecksFollowClock(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	checks := make(chan struct{}, 10)
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		checks <- struct{}{}
+	}))
+	pool.SetLogger(&captureLogger{})
+	clock := newFakeClock()
+	pool.SetClock(clock)
+
+	cfg := DefaultConfig()
+	cfg.HealthCheckInterval = 10 * time.Second
+	cfg.UnhealthyCheckInterval = 2 * time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.RunHealthChecks(ctx, &http.Client{}, cfg)
+
+	// step advances the clock and waits for the health check loop to go back to sleep
+	step := func(d time.Duration) {
+		clock.BlockUntil(1)
+		clock.Advance(d)
+		clock.BlockUntil(1)
+	}
+	expectChecks := func(n int, when string) {
+		t.Helper()
+		if got := len(checks); got != n {
+			t.Fatalf("Expected %d health checks %s, got %d", n, when, got)
+		}
+		for range n {
+			<-checks
+		}
+	}
+
+	step(9 * time.Second)
+	expectChecks(0, "before the interval has passed")
+	step(time.Second)
+	expectChecks(1, "once the interval has passed")
+
+	// Once down, the backend is checked on the shorter unhealthy interval
+	healthy.Store(false)
+	step(10 * time.Second)
+	expectChecks(1, "one interval later")
+	if backend.IsAlive() {
+		t.Fatalf("Expected the failing check to mark the backend down")
+	}
+	healthy.Store(true)
+	step(2 * time.Second)
+	expectChecks(1, "after the unhealthy interval")
+	if !backend.IsAlive() {
+		t.Errorf("Expected the backend back up")
+	}
+}
+
+func TestSummaryLogFollowsClock(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	capture := &captureLogger{}
+	pool.SetLogger(capture)
+	clock := newFakeClock()
+	pool.SetClock(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.RunSummaryLog(ctx, time.Minute)
+
+	clock.BlockUntil(1)
+	clock.Advance(59 * time.Second)
+	if _, ok := capture.find("Pool summary"); ok {
+		t.Fatalf("Expected no summary before the interval")
+	}
+	pool.backends[0].counters.requests.Add(120)
+	clock.Advance(time.Second)
+	deadline := time.After(time.Second)
+	for {
+		if _, ok := capture.find("Pool summary", "requestsPerSecond2"); ok {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("Expected a summary with 2 requests per second, got %v", capture.lines)
+		default:
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package golb
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// coalescedResponse is the response of a coalesced request, shared with identical requests
+// that arrived while it was in flight
+type coalescedResponse struct {
+	status   int
+	header   http.Header
+	body     []byte
+	complete bool // False if the body outgrew the limit or isn't shareable; followers then make their own request
+}
+
+// Coalesce merges concurrent identical GET requests into one upstream request when
+// cfg.CoalesceRequests is set: the first request goes through to next while the rest wait
+// and get a copy of its response, saving the backend from a stampede on e.g. a cache miss.
+// Requests are identical when their host, URI and Accept and Accept-Encoding headers match;
+// requests with credentials (Authorization or Cookie), ranges, conditions or
+// Cache-Control: no-cache are never coalesced. Responses larger than cfg.CoalesceMaxBodySize
+// or not meant to be shared (see shareableResponse) are not shared: waiting requests are
+// proxied on their own.
+func Coalesce(cfg *Config, next http.Handler) http.Handler {
+	if !cfg.CoalesceRequests {
+		return next
+	}
+	var group singleflight.Group
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !coalescable(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := strings.Join([]string{r.Host, r.URL.RequestURI(), r.Header.Get("Accept"), r.Header.Get("Accept-Encoding")}, "\n")
+
+		led := false
+		v, _, _ := group.Do(key, func() (any, error) {
+			led = true
+			rec := &coalesceRecorder{ResponseWriter: w, resp: &coalescedResponse{complete: true}, limit: cfg.CoalesceMaxBodySize}
+			// Detached from this client: others may be waiting for the response after it leaves
+			next.ServeHTTP(rec, r.WithContext(context.WithoutCancel(r.Context())))
+			if rec.resp.status == 0 { // Nothing written: an empty 200
+				rec.resp.status, rec.resp.header = http.StatusOK, w.Header().Clone()
+				rec.resp.complete = shareableResponse(rec.resp.header)
+			}
+			return rec.resp, nil
+		})
+		if led {
+			return // The response already went to this client
+		}
+		resp := v.(*coalescedResponse)
+		if !resp.complete {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for name, values := range resp.header {
+			w.Header()[name] = append([]string(nil), values...)
+		}
+		w.Header().Del(cfg.RequestIDHeader) // Identifies the first request, not this one
+		w.WriteHeader(resp.status)
+		_, _ = w.Write(resp.body)
+	})
+}
+
+// coalesceUncacheableHeaders are request headers that make a GET's response specific to it
+var coalesceUncacheableHeaders = []string{"Authorization", "Cookie", "Range", "If-Range", "If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since"}
+
+// coalescable reports whether r is a cacheable GET whose response can be shared
+func coalescable(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	for _, name := range coalesceUncacheableHeaders {
+		if r.Header.Get(name) != "" {
+			return false
+		}
+	}
+	return !headerHasToken(r.Header, "Cache-Control", "no-cache") && !headerHasToken(r.Header, "Pragma", "no-cache")
+}
+
+// shareableResponse reports whether a response with header can go to other clients: not if
+// it sets cookies, is private or no-store, or varies on headers other than the ones in the
+// coalescing key
+func shareableResponse(header http.Header) bool {
+	if len(header.Values("Set-Cookie")) > 0 || headerHasToken(header, "Cache-Control", "private") || headerHasToken(header, "Cache-Control", "no-store") {
+		return false
+	}
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			switch http.CanonicalHeaderKey(strings.TrimSpace(name)) {
+			case "", "Accept", "Accept-Encoding":
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// headerHasToken reports whether the comma-separated header name has token, ignoring case
+// and directive arguments (private="Set-Cookie")
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			directive, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if strings.EqualFold(directive, token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// coalesceRecorder passes the response through to the first client while keeping a copy,
+// up to limit bytes, for the requests coalesced with it
+type coalesceRecorder struct {
+	http.ResponseWriter
+	resp  *coalescedResponse
+	limit int64
+}
+
+func (c *coalesceRecorder) WriteHeader(status int) {
+	if c.resp.status == 0 {
+		c.resp.status = status
+		c.resp.header = c.ResponseWriter.Header().Clone() // Final headers, as sent
+		c.resp.complete = shareableResponse(c.resp.header)
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *coalesceRecorder) Write(p []byte) (int, error) {
+	if c.resp.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.resp.complete {
+		if int64(len(c.resp.body)+len(p)) > c.limit {
+			c.resp.complete, c.resp.body = false, nil
+		} else {
+			c.resp.body = append(c.resp.body, p...)
+		}
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush keeps streaming responses streaming for the first client
+func (c *coalesceRecorder) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (c *coalesceRecorder) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
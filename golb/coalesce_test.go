@@ -0,0 +1,144 @@
+package golb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesceIdenticalGets(t *testing.T) {
+	var upstream atomic.Int64
+	release := make(chan struct{})
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream.Add(1)
+		<-release
+		w.Header().Set("X-Version", "7")
+		_, _ = w.Write([]byte("shared body"))
+	}))
+	pool.SetLogger(&captureLogger{})
+	cfg := DefaultConfig()
+	cfg.CoalesceRequests = true
+	proxy := NewProxy(pool, cfg)
+
+	// serveAll sends n concurrent copies of req once the first is being served upstream
+	serveAll := func(n int, header http.Header) []*httptest.ResponseRecorder {
+		recorders := make([]*httptest.ResponseRecorder, n)
+		var wg sync.WaitGroup
+		for i := range recorders {
+			recorders[i] = httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/popular?page=1", nil)
+			req.Header = header.Clone()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				proxy.ServeHTTP(recorders[i], req)
+			}()
+		}
+		time.Sleep(100 * time.Millisecond) // Let every request reach the backend or join the one in flight
+		release <- struct{}{}
+		for range upstream.Load() - 1 {
+			release <- struct{}{}
+		}
+		wg.Wait()
+		return recorders
+	}
+
+	recorders := serveAll(10, http.Header{})
+	if n := upstream.Load(); n != 1 {
+		t.Errorf("Expected 10 identical GETs to cause a single upstream request, got %d", n)
+	}
+	for i, rr := range recorders {
+		if rr.Code != http.StatusOK || rr.Body.String() != "shared body" || rr.Header().Get("X-Version") != "7" {
+			t.Errorf("Request %d: expected the shared response, got %d %q %v", i, rr.Code, rr.Body.String(), rr.Header())
+		}
+	}
+
+	// Requests with credentials are never shared
+	upstream.Store(0)
+	serveAll(3, http.Header{"Authorization": {"Bearer token"}})
+	if n := upstream.Load(); n != 3 {
+		t.Errorf("Expected each request with credentials to go upstream, got %d upstream requests", n)
+	}
+}
+
+func TestCoalesceSkipsUncacheable(t *testing.T) {
+	var upstream atomic.Int64
+	var responseHeader atomic.Value
+	responseHeader.Store(http.Header{})
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := upstream.Add(1)
+		time.Sleep(50 * time.Millisecond) // Long enough for the others to join
+		for name, values := range responseHeader.Load().(http.Header) {
+			w.Header()[name] = values
+		}
+		if w.Header().Get("Set-Cookie") != "" {
+			w.Header().Set("Set-Cookie", fmt.Sprintf("session=%d", n))
+		}
+		_, _ = w.Write([]byte("body"))
+	}))
+	pool.SetLogger(&captureLogger{})
+	cfg := DefaultConfig()
+	cfg.CoalesceRequests = true
+	proxy := NewProxy(pool, cfg)
+
+	serveAll := func(n int, header http.Header) []*httptest.ResponseRecorder {
+		upstream.Store(0)
+		recorders := make([]*httptest.ResponseRecorder, n)
+		var wg sync.WaitGroup
+		for i := range recorders {
+			recorders[i] = httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/item", nil)
+			req.Header = header.Clone()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				proxy.ServeHTTP(recorders[i], req)
+			}()
+		}
+		wg.Wait()
+		return recorders
+	}
+
+	serveAll(3, http.Header{})
+	if n := upstream.Load(); n != 1 {
+		t.Fatalf("Expected plain GETs to be coalesced, got %d upstream requests", n)
+	}
+
+	for name, header := range map[string]http.Header{
+		"range":         {"Range": {"bytes=0-1"}},
+		"if-none-match": {"If-None-Match": {`"v1"`}},
+		"if-modified":   {"If-Modified-Since": {"Mon, 02 Jan 2006 15:04:05 GMT"}},
+		"no-cache":      {"Cache-Control": {"max-age=0, no-cache"}},
+	} {
+		serveAll(3, header)
+		if n := upstream.Load(); n != 3 {
+			t.Errorf("%s: expected each request to go upstream, got %d upstream requests", name, n)
+		}
+	}
+
+	for name, header := range map[string]http.Header{
+		"set-cookie": {"Set-Cookie": {"session"}},
+		"private":    {"Cache-Control": {"private, max-age=60"}},
+		"no-store":   {"Cache-Control": {"no-store"}},
+		"vary":       {"Vary": {"Accept-Encoding, Accept-Language"}},
+	} {
+		responseHeader.Store(header)
+		recorders := serveAll(3, http.Header{})
+		if n := upstream.Load(); n != 3 {
+			t.Errorf("%s: expected the response not to be shared, got %d upstream requests", name, n)
+		}
+		if name == "set-cookie" {
+			cookies := map[string]bool{}
+			for _, rr := range recorders {
+				cookies[rr.Header().Get("Set-Cookie")] = true
+			}
+			if len(cookies) != 3 {
+				t.Errorf("Expected every client to get its own cookie, got %v", cookies)
+			}
+		}
+	}
+}
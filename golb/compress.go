@@ -0,0 +1,254 @@
+package golb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipWriterPool reuses gzip writers (and their large internal buffers) across responses
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// Compress gzips responses for clients that accept it when the response has a compressible
+// content type, is not already encoded, and is at least cfg.CompressionMinSize bytes.
+// Responses of unknown length are buffered up to the threshold before deciding.
+func Compress(cfg *Config, next http.Handler) http.Handler {
+	if !cfg.CompressionEnabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{
+			ResponseWriter: w,
+			minSize:        cfg.CompressionMinSize,
+			contentTypes:   cfg.CompressibleContentTypes,
+		}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip (and doesn't set q=0)
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.TrimSpace(coding) != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isCompressibleType matches a Content-Type against exact media types or "type/*" patterns
+func isCompressibleType(contentType string, patterns []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if strings.EqualFold(mediaType, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter decides at header time whether to compress. When the body length
+// is unknown it holds back the header and buffers until minSize bytes are seen.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize      int
+	contentTypes []string
+
+	status      int
+	buf         []byte
+	gz          *gzip.Writer
+	wroteHeader bool // WriteHeader was called on this writer
+	pending     bool // Header held back while buffering up to minSize
+	passthrough bool // Response is sent unmodified
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = statusCode
+
+	h := w.Header()
+	eligible := statusCode >= http.StatusOK && statusCode != http.StatusNoContent &&
+		statusCode != http.StatusPartialContent && statusCode != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && isCompressibleType(h.Get("Content-Type"), w.contentTypes)
+	if eligible {
+		if cl := h.Get("Content-Length"); cl != "" {
+			if n, err := strconv.Atoi(cl); err == nil && n < w.minSize {
+				eligible = false
+			} else if err == nil {
+				w.startGzip()
+				return
+			}
+		}
+	}
+	if !eligible {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.pending = true
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case w.passthrough:
+		return w.ResponseWriter.Write(b)
+	case w.gz != nil:
+		return w.gz.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		w.startGzip()
+		if _, err := w.gz.Write(w.buf); err != nil {
+			return 0, err
+		}
+		w.buf = nil
+	}
+	return len(b), nil
+}
+
+// startGzip commits to a compressed response and writes the held-back header
+func (w *gzipResponseWriter) startGzip() {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", "gzip")
+	h.Add("Vary", "Accept-Encoding")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.pending = false
+	w.gz = gzipWriterPool.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+}
+
+// Flush commits a buffered response to compression so streaming keeps working
+func (w *gzipResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.pending {
+		w.startGzip()
+		if len(w.buf) > 0 {
+			_, _ = w.gz.Write(w.buf)
+			w.buf = nil
+		}
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish completes the response: small buffered bodies are sent uncompressed,
+// otherwise the gzip stream is closed and its writer returned to the pool.
+func (w *gzipResponseWriter) finish() {
+	if w.pending {
+		w.ResponseWriter.WriteHeader(w.status)
+		_, _ = w.ResponseWriter.Write(w.buf)
+		w.pending = false
+		return
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+		w.gz.Reset(nil)
+		gzipWriterPool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// DecompressRequest decodes gzip-encoded request bodies before proxying so that size limits
+// apply to the decoded size. Bodies that inflate beyond cfg.MaxDecompressedBodySize are
+// rejected with 413 as soon as the limit is crossed, without inflating the rest.
+// The backend receives the decoded body with Content-Encoding removed.
+func DecompressRequest(cfg *Config, next http.Handler) http.Handler {
+	if !cfg.DecompressRequests {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if r.Body == nil || (encoding != "gzip" && encoding != "x-gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		decoded, err := readGzipLimited(r.Body, cfg.MaxDecompressedBodySize)
+		_ = r.Body.Close()
+		if errors.Is(err, errBodyTooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Invalid gzip request body", http.StatusBadRequest)
+			return
+		}
+
+		r.Header.Del("Content-Encoding")
+		r.Header.Set("Content-Length", strconv.Itoa(len(decoded)))
+		r.ContentLength = int64(len(decoded))
+		r.TransferEncoding = nil // The length is known now
+		r.Body = io.NopCloser(bytes.NewReader(decoded))
+		next.ServeHTTP(w, r)
+	})
+}
+
+var errBodyTooLarge = errors.New("decompressed body exceeds limit")
+
+// readGzipLimited inflates body, failing with errBodyTooLarge once more than limit bytes
+// are produced. A limit <= 0 means unlimited.
+func readGzipLimited(body io.Reader, limit int64) ([]byte, error) {
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = zr.Close() }()
+
+	var reader io.Reader = zr
+	if limit > 0 {
+		reader = io.LimitReader(zr, limit+1) // One extra byte tells "exactly limit" from "over limit"
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(decoded)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return decoded, nil
+}
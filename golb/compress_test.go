@@ -0,0 +1,201 @@
+package golb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	largeJSON := `{"items": [` + strings.Repeat(`{"name": "item", "value": 42},`, 100) + `{}]}`
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		contentEncode  string
+		setLength      bool
+		body           string
+		expectGzip     bool
+	}{
+		{"large JSON is gzipped", "gzip, deflate", "application/json", "", false, largeJSON, true},
+		{"large JSON with Content-Length is gzipped", "gzip", "application/json", "", true, largeJSON, true},
+		{"small body is not gzipped", "gzip", "application/json", "", false, `{"ok": true}`, false},
+		{"small body with Content-Length is not gzipped", "gzip", "application/json", "", true, `{"ok": true}`, false},
+		{"already encoded is not gzipped", "gzip", "application/json", "br", false, largeJSON, false},
+		{"incompressible type is not gzipped", "gzip", "image/png", "", false, largeJSON, false},
+		{"client without gzip support", "", "application/json", "", false, largeJSON, false},
+		{"client refusing gzip", "gzip;q=0", "application/json", "", false, largeJSON, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.contentEncode != "" {
+					w.Header().Set("Content-Encoding", tt.contentEncode)
+				}
+				if tt.setLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+				}
+				_, _ = io.WriteString(w, tt.body)
+			}))
+
+			cfg := DefaultConfig()
+			cfg.CompressionEnabled = true
+			handler := Compress(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Lb(w, r, pool, false, false)
+			}))
+
+			req := httptest.NewRequest("GET", "/data", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+			gzipped := rr.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.expectGzip {
+				t.Fatalf("Expected gzip=%v, got Content-Encoding %q", tt.expectGzip, rr.Header().Get("Content-Encoding"))
+			}
+
+			body := rr.Body.String()
+			if gzipped {
+				if rr.Header().Get("Content-Length") != "" {
+					t.Errorf("Expected Content-Length to be removed from gzipped response")
+				}
+				zr, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatalf("Failed to create gzip reader: %v", err)
+				}
+				decoded, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("Failed to decompress body: %v", err)
+				}
+				body = string(decoded)
+			}
+			if body != tt.body {
+				t.Errorf("Body mismatch after decoding: got %d bytes, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"gzip":                true,
+		"deflate, gzip;q=0.5": true,
+		"GZIP":                true,
+		"*":                   true,
+		"gzip;q=0":            false,
+		"deflate, br":         false,
+		"":                    false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+// countingReader records how many bytes have been read from the wrapped reader
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("Failed to gzip data: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressRequest(t *testing.T) {
+	var receivedBody, receivedEncoding string
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receivedBody = string(body)
+		receivedEncoding = r.Header.Get("Content-Encoding")
+	}))
+
+	cfg := DefaultConfig()
+	cfg.DecompressRequests = true
+	cfg.MaxDecompressedBodySize = 1 << 20
+	handler := DecompressRequest(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Lb(w, r, pool, false, false)
+	}))
+
+	payload := `{"message": "hello"}`
+	req := httptest.NewRequest("POST", "/upload", bytes.NewReader(gzipBytes(t, []byte(payload))))
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if receivedBody != payload {
+		t.Errorf("Expected backend to receive decoded body %q, got %q", payload, receivedBody)
+	}
+	if receivedEncoding != "" {
+		t.Errorf("Expected Content-Encoding to be removed, backend saw %q", receivedEncoding)
+	}
+
+	req = httptest.NewRequest("POST", "/upload", strings.NewReader("not gzip"))
+	req.Header.Set("Content-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid gzip body, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestDecompressRequestRejectsGzipBomb(t *testing.T) {
+	backendHit := false
+	cfg := DefaultConfig()
+	cfg.DecompressRequests = true
+	cfg.MaxDecompressedBodySize = 1 << 20 // 1 MiB
+	handler := DecompressRequest(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendHit = true
+	}))
+
+	// 64 MiB of zeros compresses to well under 100 KiB
+	bomb := gzipBytes(t, make([]byte, 64<<20))
+	body := &countingReader{r: bytes.NewReader(bomb)}
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	if backendHit {
+		t.Errorf("Expected oversized body to be rejected before proxying")
+	}
+	// Inflation must stop at the limit, long before the whole compressed stream is consumed
+	if body.n >= len(bomb)/4 {
+		t.Errorf("Expected decoding to stop early, consumed %d of %d compressed bytes", body.n, len(bomb))
+	}
+}
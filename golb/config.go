@@ -1,15 +1,22 @@
 package golb
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"gopkg.in/yaml.v3"
 )
 
@@ -22,42 +29,378 @@ const (
 	DefaultEWMAAlpha = 0.15
 )
 
+// DefaultCompressibleContentTypes are the response media types gzipped when compression is enabled
+var DefaultCompressibleContentTypes = []string{
+	"text/*", "application/json", "application/javascript", "application/xml",
+	"application/xhtml+xml", "application/rss+xml", "image/svg+xml",
+}
+
+// BackendOptions holds settings for a single backend, overriding the global ones where set
+type BackendOptions struct {
+	RequestTimeout time.Duration     `yaml:"requestTimeout" json:"requestTimeout" toml:"requestTimeout"`          // 0 uses Config.RequestTimeout
+	Headers        map[string]string `yaml:"headers,omitempty" json:"headers,omitempty" toml:"headers,omitempty"` // Set on every request to this backend, e.g. its own auth token
+	HealthCheckURL string            `yaml:"healthCheckURL" json:"healthCheckURL" toml:"healthCheckURL"`          // Full URL checked instead of the backend URL + HealthCheckPath, e.g. a plain-HTTP sidecar
+	Tags           []string          `yaml:"tags,omitempty" json:"tags,omitempty" toml:"tags,omitempty"`          // Groups the backend belongs to, e.g. "blue" or "green" for ServerPool.BeginCutover
+
+	StripResponseHeaders []string `yaml:"stripResponseHeaders,omitempty" json:"stripResponseHeaders,omitempty" toml:"stripResponseHeaders,omitempty"` // Removed from this backend's responses, in addition to Config.StripResponseHeaders
+	HealthCheckService   string   `yaml:"healthCheckService" json:"healthCheckService" toml:"healthCheckService"`                                     // gRPC service checked instead of Config.HealthCheckService
+	ProxyURL             string   `yaml:"proxyURL" json:"proxyURL" toml:"proxyURL"`                                                                   // Egress proxy for this backend instead of Config.BackendProxyURL
+}
+
 // Config holds all configuration parameters for the load balancer
 type Config struct {
-	ProxyPort              string        `yaml:"proxyPort"`
-	BackendServers         []string      `yaml:"backendServers"`
-	BackendWeights         []int         `yaml:"backendWeights,omitempty"` // For WRR
-	HealthCheckPath        string        `yaml:"healthCheckPath"`
-	InfoPath               string        `yaml:"infoPath"`
-	HealthCheckInterval    time.Duration `yaml:"healthCheckInterval"`
-	BackendRequestTimeout  time.Duration `yaml:"backendRequestTimeout"`
-	LoadBalancingAlgorithm string        `yaml:"loadBalancingAlgorithm"`
-	EWMAAlpha              float64       `yaml:"ewmaAlpha"` // For Least Response Time
+	ProxyPort              string        `yaml:"proxyPort" json:"proxyPort" toml:"proxyPort"`
+	BackendServers         []string      `yaml:"backendServers" json:"backendServers" toml:"backendServers"`
+	BackendWeights         []int         `yaml:"backendWeights,omitempty" json:"backendWeights,omitempty" toml:"backendWeights,omitempty"` // For weighted-round-robin and least-response-time; 0 makes a backend a backup
+	HealthCheckPath        string        `yaml:"healthCheckPath" json:"healthCheckPath" toml:"healthCheckPath"`
+	InfoPath               string        `yaml:"infoPath" json:"infoPath" toml:"infoPath"`
+	HealthCheckInterval    time.Duration `yaml:"healthCheckInterval" json:"healthCheckInterval" toml:"healthCheckInterval"`
+	BackendRequestTimeout  time.Duration `yaml:"backendRequestTimeout" json:"backendRequestTimeout" toml:"backendRequestTimeout"`
+	LoadBalancingAlgorithm string        `yaml:"loadBalancingAlgorithm" json:"loadBalancingAlgorithm" toml:"loadBalancingAlgorithm"`
+	EWMAAlpha              float64       `yaml:"ewmaAlpha" json:"ewmaAlpha" toml:"ewmaAlpha"`                                        // For Least Response Time
+	MaxWeightRatio         float64       `yaml:"maxWeightRatio" json:"maxWeightRatio" toml:"maxWeightRatio"`                         // Weighted round robin: cap weights at this multiple of the smallest, 0 for no cap
+	SelectionLatencyWeight float64       `yaml:"selectionLatencyWeight" json:"selectionLatencyWeight" toml:"selectionLatencyWeight"` // Hybrid: 1 balances on latency only, 0 on connections only
+
+	AccessLogEnabled  bool   `yaml:"accessLogEnabled" json:"accessLogEnabled" toml:"accessLogEnabled"`    // Enable access logging
+	AccessLogPayloads bool   `yaml:"accessLogPayloads" json:"accessLogPayloads" toml:"accessLogPayloads"` // Enable logging of request/response payloads
+	AccessLogFormat   string `yaml:"accessLogFormat" json:"accessLogFormat" toml:"accessLogFormat"`       // "" (through the logger), "json", "combined" or a text/template over AccessLogEntry
+	AccessLogFile     string `yaml:"accessLogFile" json:"accessLogFile" toml:"accessLogFile"`             // Appended to and reopened on SIGHUP; "-" is stdout; setting it alone implies "combined"
+	// Access logs go to this syslog endpoint instead of the file: "udp://host:514", "tcp://host:601", "unixgram:///dev/log" or "local"
+	AccessLogSyslog         string `yaml:"accessLogSyslog" json:"accessLogSyslog" toml:"accessLogSyslog"`
+	AccessLogSyslogFacility string `yaml:"accessLogSyslogFacility" json:"accessLogSyslogFacility" toml:"accessLogSyslogFacility"` // E.g. "local0" or "daemon"
+	AccessLogSyslogTag      string `yaml:"accessLogSyslogTag" json:"accessLogSyslogTag" toml:"accessLogSyslogTag"`
+	DebugLevel              bool   `yaml:"debugLevel" json:"debugLevel" toml:"debugLevel"` // Shorthand for LogLevel "debug"
+
+	LogLevel string `yaml:"logLevel" json:"logLevel" toml:"logLevel"` // Minimum level logged: debug, info, warn or error
+
+	// Readiness: /readyz reports ready only once enough backends are healthy (at least one is always required)
+	MinHealthyBackends int           `yaml:"minHealthyBackends" json:"minHealthyBackends" toml:"minHealthyBackends"` // Minimum count of healthy backends
+	MinHealthyFraction float64       `yaml:"minHealthyFraction" json:"minHealthyFraction" toml:"minHealthyFraction"` // Minimum fraction (0-1) of backends healthy
+	StartupGracePeriod time.Duration `yaml:"startupGracePeriod" json:"startupGracePeriod" toml:"startupGracePeriod"` // At startup, wait up to this long for enough backends to warm up
+
+	SummaryLogInterval time.Duration `yaml:"summaryLogInterval" json:"summaryLogInterval" toml:"summaryLogInterval"` // Log a pool summary (backends, healthy, connections, request rate) this often; 0 disables
+
+	// Request filtering, applied before a backend is selected
+	AllowedMethods      []string `yaml:"allowedMethods,omitempty" json:"allowedMethods,omitempty" toml:"allowedMethods,omitempty"`                // Empty allows all methods
+	BlockedPathPrefixes []string `yaml:"blockedPathPrefixes,omitempty" json:"blockedPathPrefixes,omitempty" toml:"blockedPathPrefixes,omitempty"` // Requests under these paths get 403
+	StrictHTTP          bool     `yaml:"strictHTTP" json:"strictHTTP" toml:"strictHTTP"`                                                          // Reject ambiguous body framing (request smuggling) with 400
+
+	// Response headers removed before backend responses reach clients, e.g. Server or X-Powered-By
+	StripResponseHeaders []string `yaml:"stripResponseHeaders,omitempty" json:"stripResponseHeaders,omitempty" toml:"stripResponseHeaders,omitempty"` // Per-backend lists in BackendOptions add to these
+
+	// Client request headers forwarded to backends: with an allow list only those pass, the deny list is always
+	// removed. Hop-by-hop headers are never forwarded. Routes can set their own lists.
+	ForwardHeaderAllowList []string `yaml:"forwardHeaderAllowList,omitempty" json:"forwardHeaderAllowList,omitempty" toml:"forwardHeaderAllowList,omitempty"`
+	ForwardHeaderDenyList  []string `yaml:"forwardHeaderDenyList,omitempty" json:"forwardHeaderDenyList,omitempty" toml:"forwardHeaderDenyList,omitempty"` // e.g. Cookie
+
+	// Request rewrites as Go text/templates executed against RequestTemplateData, keyed by header
+	// name ("Host" sets the Host, ":path" the upstream path, an empty result removes a header). Config file only.
+	RequestTemplate map[string]string `yaml:"requestTemplate,omitempty" json:"requestTemplate,omitempty" toml:"requestTemplate,omitempty"`
+
+	// Authentication in front of all traffic: Basic auth and/or a shared bearer token
+	AuthUsername     string   `yaml:"authUsername" json:"authUsername" toml:"authUsername"`
+	AuthPasswordHash string   `yaml:"authPasswordHash" json:"authPasswordHash" toml:"authPasswordHash"` // bcrypt hash
+	AuthBearerToken  string   `yaml:"authBearerToken" json:"authBearerToken" toml:"authBearerToken"`
+	AuthExemptPaths  []string `yaml:"authExemptPaths" json:"authExemptPaths" toml:"authExemptPaths"` // Exact paths served without credentials
+
+	// Admin endpoints such as /config require this token in the X-GoLB-Admin-Token header; empty disables them
+	AdminToken  string `yaml:"adminToken" json:"adminToken" toml:"adminToken"`
+	EnablePprof bool   `yaml:"enablePprof" json:"enablePprof" toml:"enablePprof"` // Serve net/http/pprof under /debug/pprof/, behind the admin token
+
+	// CORS: preflights are answered by the proxy; empty CORSAllowedOrigins disables CORS handling
+	CORSAllowedOrigins   []string      `yaml:"corsAllowedOrigins,omitempty" json:"corsAllowedOrigins,omitempty" toml:"corsAllowedOrigins,omitempty"` // Exact, "https://*.example.com" or "*"
+	CORSAllowedMethods   []string      `yaml:"corsAllowedMethods" json:"corsAllowedMethods" toml:"corsAllowedMethods"`
+	CORSAllowedHeaders   []string      `yaml:"corsAllowedHeaders,omitempty" json:"corsAllowedHeaders,omitempty" toml:"corsAllowedHeaders,omitempty"` // Empty echoes the requested headers
+	CORSAllowCredentials bool          `yaml:"corsAllowCredentials" json:"corsAllowCredentials" toml:"corsAllowCredentials"`
+	CORSMaxAge           time.Duration `yaml:"corsMaxAge" json:"corsMaxAge" toml:"corsMaxAge"` // How long browsers may cache preflight results
+
+	// Response compression (gzip) for clients that accept it
+	CompressionEnabled       bool     `yaml:"compressionEnabled" json:"compressionEnabled" toml:"compressionEnabled"`
+	CompressionMinSize       int      `yaml:"compressionMinSize" json:"compressionMinSize" toml:"compressionMinSize"`                   // Smaller bodies are sent uncompressed
+	CompressibleContentTypes []string `yaml:"compressibleContentTypes" json:"compressibleContentTypes" toml:"compressibleContentTypes"` // Exact media types or "type/*"
+
+	// Request decompression: gzip request bodies are decoded before proxying, capped at the decoded size
+	DecompressRequests      bool  `yaml:"decompressRequests" json:"decompressRequests" toml:"decompressRequests"`
+	MaxDecompressedBodySize int64 `yaml:"maxDecompressedBodySize" json:"maxDecompressedBodySize" toml:"maxDecompressedBodySize"` // Bytes; 0 means unlimited
+
+	// Outlier detection: eject backends whose error rate (5xx and proxy errors) over a sliding window is too high
+	OutlierErrorRateThreshold float64       `yaml:"outlierErrorRateThreshold" json:"outlierErrorRateThreshold" toml:"outlierErrorRateThreshold"` // 0-1; 0 disables
+	OutlierWindow             time.Duration `yaml:"outlierWindow" json:"outlierWindow" toml:"outlierWindow"`
+	OutlierMinRequests        int           `yaml:"outlierMinRequests" json:"outlierMinRequests" toml:"outlierMinRequests"` // Requests in the window before the rate is trusted
+	OutlierEjectionTime       time.Duration `yaml:"outlierEjectionTime" json:"outlierEjectionTime" toml:"outlierEjectionTime"`
+	OutlierMaxEjectionPercent int           `yaml:"outlierMaxEjectionPercent" json:"outlierMaxEjectionPercent" toml:"outlierMaxEjectionPercent"` // 0-100 of the backends ejected at once; one can always be
+
+	// Connection limits and queuing: requests wait for a free slot instead of failing immediately
+	MaxConnectionsPerBackend int           `yaml:"maxConnectionsPerBackend" json:"maxConnectionsPerBackend" toml:"maxConnectionsPerBackend"` // 0 means unlimited
+	QueueTimeout             time.Duration `yaml:"queueTimeout" json:"queueTimeout" toml:"queueTimeout"`                                     // 0 waits until the client gives up
+	MaxQueueLength           int           `yaml:"maxQueueLength" json:"maxQueueLength" toml:"maxQueueLength"`                               // 0 means unbounded
+	MaxWaitForBackend        time.Duration `yaml:"maxWaitForBackend" json:"maxWaitForBackend" toml:"maxWaitForBackend"`                      // Shorter limit while no backend is alive at all; 0 uses QueueTimeout
+	MaxGlobalConcurrency     int           `yaml:"maxGlobalConcurrency" json:"maxGlobalConcurrency" toml:"maxGlobalConcurrency"`             // Requests in flight across all routes before new ones get 503; 0 means unlimited
+
+	// Adaptive concurrency: each backend's connection limit is learned from request latency, shrinking as latency rises
+	AdaptiveConcurrency             bool `yaml:"adaptiveConcurrency" json:"adaptiveConcurrency" toml:"adaptiveConcurrency"`                                     // Also capped by MaxConnectionsPerBackend if set
+	AdaptiveConcurrencyInitialLimit int  `yaml:"adaptiveConcurrencyInitialLimit" json:"adaptiveConcurrencyInitialLimit" toml:"adaptiveConcurrencyInitialLimit"` // Limit before any request completed
+	AdaptiveConcurrencyMaxLimit     int  `yaml:"adaptiveConcurrencyMaxLimit" json:"adaptiveConcurrencyMaxLimit" toml:"adaptiveConcurrencyMaxLimit"`
+
+	// PROXY protocol: send the client address to backends, and/or read it from an L4 proxy in front
+	BackendProxyProtocol string `yaml:"backendProxyProtocol" json:"backendProxyProtocol" toml:"backendProxyProtocol"` // "", "v1" or "v2"; disables upstream keep-alives
+	AcceptProxyProtocol  bool   `yaml:"acceptProxyProtocol" json:"acceptProxyProtocol" toml:"acceptProxyProtocol"`    // Require a PROXY header on inbound connections
+
+	// Egress proxy all backend connections go through: http://, https:// or socks5:// (with optional user:password@).
+	// Empty uses the HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment; BackendOptions.ProxyURL overrides it per backend.
+	BackendProxyURL string `yaml:"backendProxyURL" json:"backendProxyURL" toml:"backendProxyURL"`
+
+	// Proxied request timeouts: global default plus per-backend overrides keyed by backend URL (file only)
+	RequestTimeout time.Duration             `yaml:"requestTimeout" json:"requestTimeout" toml:"requestTimeout"` // 0 means no limit
+	BackendOptions map[string]BackendOptions `yaml:"backendOptions,omitempty" json:"backendOptions,omitempty" toml:"backendOptions,omitempty"`
+
+	// Path-based routing: requests under a route's prefix go to that route's own pool (file only)
+	Routes []RouteConfig `yaml:"routes,omitempty" json:"routes,omitempty" toml:"routes,omitempty"`
+
+	// Shadow traffic: copies of requests are replayed to this backend and its responses discarded
+	ShadowBackend     string        `yaml:"shadowBackend" json:"shadowBackend" toml:"shadowBackend"`             // Empty disables mirroring
+	ShadowTimeout     time.Duration `yaml:"shadowTimeout" json:"shadowTimeout" toml:"shadowTimeout"`             // Limit for each mirrored request
+	ShadowMaxBodySize int64         `yaml:"shadowMaxBodySize" json:"shadowMaxBodySize" toml:"shadowMaxBodySize"` // Larger requests are not mirrored
+	ShadowSampleRate  float64       `yaml:"shadowSampleRate" json:"shadowSampleRate" toml:"shadowSampleRate"`    // Fraction (0-1) of requests mirrored, picked at random
+	ShadowMaxInFlight int           `yaml:"shadowMaxInFlight" json:"shadowMaxInFlight" toml:"shadowMaxInFlight"` // Mirrored requests beyond this many in flight are dropped, 0 for no limit
+
+	// Request coalescing: concurrent identical GETs share a single upstream request
+	CoalesceRequests    bool  `yaml:"coalesceRequests" json:"coalesceRequests" toml:"coalesceRequests"`
+	CoalesceMaxBodySize int64 `yaml:"coalesceMaxBodySize" json:"coalesceMaxBodySize" toml:"coalesceMaxBodySize"` // Larger responses are not shared
+
+	// Failover retries: a request that could not be delivered is retried on another backend, within a budget
+	MaxRetries            int     `yaml:"maxRetries" json:"maxRetries" toml:"maxRetries"`                                  // Further backends tried after a failure, 0 disables retries
+	RetryMaxBodySize      int64   `yaml:"retryMaxBodySize" json:"retryMaxBodySize" toml:"retryMaxBodySize"`                // Requests with larger bodies are not retried
+	RetryBudgetMaxTokens  int     `yaml:"retryBudgetMaxTokens" json:"retryBudgetMaxTokens" toml:"retryBudgetMaxTokens"`    // Retries stop while tokens are at or below half of this; 0 disables the budget
+	RetryBudgetTokenRatio float64 `yaml:"retryBudgetTokenRatio" json:"retryBudgetTokenRatio" toml:"retryBudgetTokenRatio"` // Tokens regained per successful request; each failure costs one
+	RetryPolicy           string  `yaml:"retryPolicy" json:"retryPolicy" toml:"retryPolicy"`                               // "none", "connect-only" or "connect-and-status"
+	// Idempotent requests answered with one of these statuses (e.g. 502,503,504) are retried too, within MaxRetries and the budget
+	RetryOnStatuses []int         `yaml:"retryOnStatuses,omitempty" json:"retryOnStatuses,omitempty" toml:"retryOnStatuses,omitempty"`
+	RetryBackoff    time.Duration `yaml:"retryBackoff" json:"retryBackoff" toml:"retryBackoff"` // Wait before the first retry, doubling for each one after; never past the request's deadline
+
+	// Client-facing protocols: TLS enables HTTP/2 negotiation and is required for HTTP/3 (QUIC, same port over UDP)
+	TLSCertFile string `yaml:"tlsCertFile" json:"tlsCertFile" toml:"tlsCertFile"`
+	TLSKeyFile  string `yaml:"tlsKeyFile" json:"tlsKeyFile" toml:"tlsKeyFile"`
+	EnableHTTP2 bool   `yaml:"enableHTTP2" json:"enableHTTP2" toml:"enableHTTP2"` // HTTP/2 over TLS
+	EnableH2C   bool   `yaml:"enableH2C" json:"enableH2C" toml:"enableH2C"`       // Unencrypted HTTP/2 with prior knowledge
+	EnableHTTP3 bool   `yaml:"enableHTTP3" json:"enableHTTP3" toml:"enableHTTP3"` // Advertised to clients via Alt-Svc
+
+	// Error responses for requests that could not be proxied (JSON for clients that accept it)
+	HideErrorDetails    bool `yaml:"hideErrorDetails" json:"hideErrorDetails" toml:"hideErrorDetails"`          // Omit the backend and underlying error, e.g. in production
+	NoBackendStatusCode int  `yaml:"noBackendStatusCode" json:"noBackendStatusCode" toml:"noBackendStatusCode"` // Status when no backend is available, a 5xx such as 503 or 502
+	PausedStatusCode    int  `yaml:"pausedStatusCode" json:"pausedStatusCode" toml:"pausedStatusCode"`          // Status while paused via /admin/pause, a 4xx or 5xx
+
+	// Request IDs: taken from this header or generated, forwarded to backends, echoed to clients and logged
+	RequestIDHeader string `yaml:"requestIDHeader" json:"requestIDHeader" toml:"requestIDHeader"` // Empty disables request IDs
+
+	// Debugging: responses say which backend served them and why the balancer chose it; keep off in production
+	DebugHeaders bool `yaml:"debugHeaders" json:"debugHeaders" toml:"debugHeaders"`
 
-	AccessLogEnabled  bool `yaml:"accessLogEnabled"`  // Enable access logging
-	AccessLogPayloads bool `yaml:"accessLogPayloads"` // Enable logging of request/response payloads
-	DebugLevel        bool `yaml:"debugLevel"`        // Enable debug level logging
+	// Subsetting: with large pools each instance balances over a deterministic subset of the backends
+	SubsetSize int    `yaml:"subsetSize" json:"subsetSize" toml:"subsetSize"` // 0 uses all backends
+	SubsetID   string `yaml:"subsetID" json:"subsetID" toml:"subsetID"`       // Identifies this instance; empty uses the hostname
 
-	// Internal field, not loaded from yaml/env
-	ConfigFile string `yaml:"-"`
+	// Zone affinity: prefer backends tagged ZoneTagPrefix+LocalZone while any of them is alive and has capacity
+	LocalZone string `yaml:"localZone" json:"localZone" toml:"localZone"` // Zone this instance runs in; empty disables the preference
+
+	// Upstream connection pool of the transport shared by all backends
+	MaxIdleConnsPerBackend int           `yaml:"maxIdleConnsPerBackend" json:"maxIdleConnsPerBackend" toml:"maxIdleConnsPerBackend"` // Idle keep-alive connections kept per backend
+	MaxConnsPerBackend     int           `yaml:"maxConnsPerBackend" json:"maxConnsPerBackend" toml:"maxConnsPerBackend"`             // TCP connections per backend, 0 means unlimited; requests beyond wait for one
+	IdleConnTimeout        time.Duration `yaml:"idleConnTimeout" json:"idleConnTimeout" toml:"idleConnTimeout"`
+	DisableKeepAlives      bool          `yaml:"disableKeepAlives" json:"disableKeepAlives" toml:"disableKeepAlives"` // New connection for every request
+
+	// Per-phase limits on proxied requests, so connection problems fail fast while slow bodies may stream; 0 disables each
+	BackendDialTimeout           time.Duration `yaml:"backendDialTimeout" json:"backendDialTimeout" toml:"backendDialTimeout"`                               // Establishing the TCP connection
+	BackendTLSHandshakeTimeout   time.Duration `yaml:"backendTLSHandshakeTimeout" json:"backendTLSHandshakeTimeout" toml:"backendTLSHandshakeTimeout"`       // TLS handshake with https backends
+	BackendResponseHeaderTimeout time.Duration `yaml:"backendResponseHeaderTimeout" json:"backendResponseHeaderTimeout" toml:"backendResponseHeaderTimeout"` // From the request being sent to the response headers
+
+	// Health check request: method and extra headers (e.g. auth) sent to HealthCheckPath; headers are file/env only
+	HealthCheckMethod  string            `yaml:"healthCheckMethod" json:"healthCheckMethod" toml:"healthCheckMethod"` // GET or e.g. HEAD
+	HealthCheckHeaders map[string]string `yaml:"healthCheckHeaders,omitempty" json:"healthCheckHeaders,omitempty" toml:"healthCheckHeaders,omitempty"`
+	// Health check responses counted as healthy: comma-separated codes, ranges and classes, e.g. "200,204", "200-299" or "2xx",
+	// or in config files a list such as [200, 204]
+	HealthCheckExpectedStatuses StatusCodes `yaml:"healthCheckExpectedStatuses" json:"healthCheckExpectedStatuses" toml:"healthCheckExpectedStatuses"`
+	// "grpc" checks backends with the gRPC health checking protocol instead, healthy only while the service is SERVING
+	HealthCheckType    string `yaml:"healthCheckType" json:"healthCheckType" toml:"healthCheckType"`          // "http" or "grpc"
+	HealthCheckService string `yaml:"healthCheckService" json:"healthCheckService" toml:"healthCheckService"` // gRPC service name, empty for the server as a whole
+	// Health checks run concurrently; one taking longer than the timeout is abandoned and its backend marked down
+	HealthCheckConcurrency int           `yaml:"healthCheckConcurrency" json:"healthCheckConcurrency" toml:"healthCheckConcurrency"` // Checks running at once, 0 for no limit
+	HealthCheckTimeout     time.Duration `yaml:"healthCheckTimeout" json:"healthCheckTimeout" toml:"healthCheckTimeout"`             // 0 uses BackendRequestTimeout
+	// Healthy HTTP check responses carrying this header (e.g. "X-Capacity: 80") set the backend's weight to its value; once it
+	// goes away the configured weight is restored. Empty disables it. Reports override SetWeight but not cutovers.
+	HealthCheckCapacityHeader string `yaml:"healthCheckCapacityHeader" json:"healthCheckCapacityHeader" toml:"healthCheckCapacityHeader"`
+
+	// Start even if no backends are configured or reachable, answering 503 until backends are added
+	AllowEmptyStart bool `yaml:"allowEmptyStart" json:"allowEmptyStart" toml:"allowEmptyStart"`
+
+	// Down backends are re-checked on their own, shorter interval so recoveries are noticed quickly
+	UnhealthyCheckInterval time.Duration `yaml:"unhealthyCheckInterval" json:"unhealthyCheckInterval" toml:"unhealthyCheckInterval"` // 0 uses HealthCheckInterval
+
+	// Backends answering 503 with Retry-After are skipped for the requested time (capped at 5m)
+	HonorBackendRetryAfter bool `yaml:"honorBackendRetryAfter" json:"honorBackendRetryAfter" toml:"honorBackendRetryAfter"`
+
+	// Client-facing server timeouts, guarding against slow clients (0 means no limit). Read and
+	// write are off by default: they bound the whole body and response, cutting off long uploads
+	// and streamed responses such as server-sent events.
+	ReadTimeout       time.Duration `yaml:"readTimeout" json:"readTimeout" toml:"readTimeout"`                   // Whole request, including the body
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" json:"readHeaderTimeout" toml:"readHeaderTimeout"` // Request headers only
+	WriteTimeout      time.Duration `yaml:"writeTimeout" json:"writeTimeout" toml:"writeTimeout"`                // From the end of the request headers to the end of the response
+	IdleTimeout       time.Duration `yaml:"idleTimeout" json:"idleTimeout" toml:"idleTimeout"`                   // Keep-alive connections waiting for the next request
+
+	// Buffers reused across requests: copy buffers for proxied bodies and access log payload captures
+	ProxyBufferSize     int `yaml:"proxyBufferSize" json:"proxyBufferSize" toml:"proxyBufferSize"`             // Bytes per copy buffer, 0 allocates one per request
+	MaxPooledBufferSize int `yaml:"maxPooledBufferSize" json:"maxPooledBufferSize" toml:"maxPooledBufferSize"` // Larger capture buffers are dropped instead of pooled, 0 disables pooling them
+
+	// Forwarded headers (X-Forwarded-For etc.) are only honored from these proxies, e.g. "10.0.0.0/8"; others are stripped
+	TrustedProxies []string `yaml:"trustedProxies,omitempty" json:"trustedProxies,omitempty" toml:"trustedProxies,omitempty"` // CIDRs or single IPs
+
+	// Two-phase shutdown: on SIGTERM /readyz fails first, and requests keep being served for this long before draining
+	PreShutdownDelay time.Duration `yaml:"preShutdownDelay" json:"preShutdownDelay" toml:"preShutdownDelay"` // E.g. a few readiness probe periods; 0 drains right away
+
+	// Backend host names are re-resolved this often, and idle connections to old addresses closed; 0 leaves DNS to the OS per dial
+	BackendDNSRefreshInterval time.Duration `yaml:"backendDNSRefreshInterval" json:"backendDNSRefreshInterval" toml:"backendDNSRefreshInterval"`
+
+	// Dual-stack backends: race connections to their IPv6 and IPv4 addresses (Happy Eyeballs, RFC 8305) so a dead family doesn't stall connection setup
+	BackendHappyEyeballs bool `yaml:"backendHappyEyeballs" json:"backendHappyEyeballs" toml:"backendHappyEyeballs"`
+
+	// Served instead of a 503 while no backend is available, e.g. a maintenance page: a fixed upstream or a static directory
+	FallbackBackend   string `yaml:"fallbackBackend" json:"fallbackBackend" toml:"fallbackBackend"` // URL; takes precedence over FallbackStaticDir
+	FallbackStaticDir string `yaml:"fallbackStaticDir" json:"fallbackStaticDir" toml:"fallbackStaticDir"`
+
+	// Internal fields, not loaded from file
+	ConfigFile    string `yaml:"-" json:"-" toml:"-"`
+	RequireAllEnv bool   `yaml:"-" json:"-" toml:"-"` // Fail on undefined $VAR or ${VAR} references in the config file, else expand them to ""
+
+	expectedStatuses statusRanges // HealthCheckExpectedStatuses as parsed by validateConfig, see healthyStatuses
 }
 
 // DefaultConfig returns a configuration with default values
 func DefaultConfig() *Config {
 	return &Config{
-		ProxyPort:              ":8080",
-		BackendServers:         []string{"http://localhost:9091", "http://localhost:9092"}, // Adjusted example defaults
-		BackendWeights:         []int{},
-		HealthCheckPath:        "/health",
-		InfoPath:               "/info",
-		HealthCheckInterval:    10 * time.Second,
-		BackendRequestTimeout:  2 * time.Second,
-		LoadBalancingAlgorithm: DefaultLBAlgorithm,
-		EWMAAlpha:              DefaultEWMAAlpha,
-		AccessLogEnabled:       false,
-		AccessLogPayloads:      false,
-		DebugLevel:             false,
-		ConfigFile:             "",
+		ProxyPort:                       ":8080",
+		BackendServers:                  []string{"http://localhost:9091", "http://localhost:9092"}, // Adjusted example defaults
+		BackendWeights:                  []int{},
+		HealthCheckPath:                 "/health",
+		InfoPath:                        "/info",
+		HealthCheckInterval:             10 * time.Second,
+		BackendRequestTimeout:           2 * time.Second,
+		LoadBalancingAlgorithm:          DefaultLBAlgorithm,
+		EWMAAlpha:                       DefaultEWMAAlpha,
+		MaxWeightRatio:                  0,
+		SelectionLatencyWeight:          0.5,
+		AccessLogEnabled:                false,
+		AccessLogPayloads:               false,
+		AccessLogFormat:                 "",
+		AccessLogFile:                   "",
+		AccessLogSyslog:                 "",
+		AccessLogSyslogFacility:         "local0",
+		AccessLogSyslogTag:              "golb",
+		DebugLevel:                      false,
+		LogLevel:                        "info",
+		MinHealthyBackends:              0,
+		MinHealthyFraction:              0,
+		StartupGracePeriod:              0,
+		SummaryLogInterval:              0,
+		AllowedMethods:                  []string{},
+		BlockedPathPrefixes:             []string{},
+		StrictHTTP:                      false,
+		StripResponseHeaders:            []string{},
+		ForwardHeaderAllowList:          []string{},
+		ForwardHeaderDenyList:           []string{},
+		AuthUsername:                    "",
+		AuthPasswordHash:                "",
+		AuthBearerToken:                 "",
+		AdminToken:                      "",
+		EnablePprof:                     false,
+		AuthExemptPaths:                 []string{"/livez", "/readyz"},
+		CORSAllowedOrigins:              []string{},
+		CORSAllowedMethods:              []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		CORSAllowedHeaders:              []string{},
+		CORSAllowCredentials:            false,
+		CORSMaxAge:                      10 * time.Minute,
+		CompressionEnabled:              false,
+		CompressionMinSize:              1024,
+		CompressibleContentTypes:        append([]string(nil), DefaultCompressibleContentTypes...),
+		DecompressRequests:              false,
+		MaxDecompressedBodySize:         10 << 20, // 10 MiB
+		OutlierErrorRateThreshold:       0,
+		OutlierWindow:                   30 * time.Second,
+		OutlierMinRequests:              10,
+		OutlierEjectionTime:             30 * time.Second,
+		OutlierMaxEjectionPercent:       50,
+		MaxConnectionsPerBackend:        0,
+		MaxGlobalConcurrency:            0,
+		QueueTimeout:                    0,
+		MaxQueueLength:                  0,
+		MaxWaitForBackend:               0,
+		AdaptiveConcurrency:             false,
+		AdaptiveConcurrencyInitialLimit: 20,
+		AdaptiveConcurrencyMaxLimit:     1000,
+		BackendProxyProtocol:            "",
+		BackendProxyURL:                 "",
+		AcceptProxyProtocol:             false,
+		RequestTimeout:                  0,
+		BackendOptions:                  map[string]BackendOptions{},
+		Routes:                          []RouteConfig{},
+		ShadowBackend:                   "",
+		ShadowTimeout:                   10 * time.Second,
+		ShadowMaxBodySize:               1 << 20, // 1 MiB
+		ShadowSampleRate:                1,
+		ShadowMaxInFlight:               64,
+		CoalesceRequests:                false,
+		CoalesceMaxBodySize:             1 << 20,
+		MaxRetries:                      0,
+		RetryMaxBodySize:                1 << 20,
+		RetryPolicy:                     RetryPolicyConnectAndStatus,
+		RetryOnStatuses:                 []int{},
+		RetryBackoff:                    0,
+		RetryBudgetMaxTokens:            10,
+		RetryBudgetTokenRatio:           0.1,
+		TLSCertFile:                     "",
+		TLSKeyFile:                      "",
+		EnableHTTP2:                     true,
+		EnableH2C:                       false,
+		EnableHTTP3:                     false,
+		HideErrorDetails:                false,
+		DebugHeaders:                    false,
+		NoBackendStatusCode:             http.StatusServiceUnavailable,
+		PausedStatusCode:                http.StatusServiceUnavailable,
+		RequestIDHeader:                 DefaultRequestIDHeader,
+		SubsetSize:                      0,
+		SubsetID:                        "",
+		LocalZone:                       "",
+		MaxIdleConnsPerBackend:          32,
+		MaxConnsPerBackend:              0,
+		IdleConnTimeout:                 90 * time.Second,
+		DisableKeepAlives:               false,
+		BackendDialTimeout:              30 * time.Second,
+		BackendTLSHandshakeTimeout:      10 * time.Second,
+		BackendResponseHeaderTimeout:    0,
+		HealthCheckMethod:               http.MethodGet,
+		HealthCheckHeaders:              map[string]string{},
+		HealthCheckExpectedStatuses:     "200",
+		HealthCheckType:                 HealthCheckTypeHTTP,
+		HealthCheckConcurrency:          8,
+		HealthCheckTimeout:              0,
+		HealthCheckService:              "",
+		HealthCheckCapacityHeader:       "",
+		AllowEmptyStart:                 false,
+		UnhealthyCheckInterval:          2 * time.Second,
+		HonorBackendRetryAfter:          false,
+		ReadTimeout:                     0,
+		ReadHeaderTimeout:               10 * time.Second,
+		WriteTimeout:                    0,
+		IdleTimeout:                     120 * time.Second,
+		ProxyBufferSize:                 32 * 1024,
+		MaxPooledBufferSize:             1 << 20,
+		TrustedProxies:                  []string{},
+		PreShutdownDelay:                0,
+		BackendDNSRefreshInterval:       0,
+		BackendHappyEyeballs:            false,
+		FallbackBackend:                 "",
+		FallbackStaticDir:               "",
+		ConfigFile:                      "",
+		RequireAllEnv:                   true,
 	}
 }
 
@@ -67,29 +410,25 @@ func LoadConfig() (*Config, error) {
 
 	// --- Define Flags ---
 	// Use default values from the DefaultConfig struct
-	flagProxyPort := flag.String("port", cfg.ProxyPort, "Port for the proxy server (e.g., :8080) (Env: "+EnvPrefix+"PORT)")
-	flagBackendServers := flag.String("backends", strings.Join(cfg.BackendServers, ","), "Comma-separated list of backend server URLs (Env: "+EnvPrefix+"BACKENDS)")
-	flagBackendWeights := flag.String("weights", "", "Comma-separated list of backend weights (optional, for WRR) (Env: "+EnvPrefix+"WEIGHTS)") // Weights as string flag
-	flagHealthPath := flag.String("health-path", cfg.HealthCheckPath, "Path for backend health checks (Env: "+EnvPrefix+"HEALTH_PATH)")
-	flagInfoPath := flag.String("info-path", cfg.InfoPath, "Path for backend info endpoint (Env: "+EnvPrefix+"INFO_PATH)")
-	flagHealthInterval := flag.Duration("health-interval", cfg.HealthCheckInterval, "Interval for health checks (e.g., 10s, 1m) (Env: "+EnvPrefix+"HEALTH_INTERVAL)")
-	flagBackendTimeout := flag.Duration("backend-timeout", cfg.BackendRequestTimeout, "Timeout for backend health/info requests (e.g., 2s) (Env: "+EnvPrefix+"BACKEND_TIMEOUT)")
-	flagConfigFile := flag.String("config", cfg.ConfigFile, "Path to YAML configuration file")
-	flagLBAlgo := flag.String("lb-algo", cfg.LoadBalancingAlgorithm, "Load balancing algorithm: round-robin, least-connections, least-response-time, weighted-round-robin (Env: "+EnvPrefix+"LB_ALGORITHM)")
-	flagEWMAAlpha := flag.Float64("ewma-alpha", cfg.EWMAAlpha, "EWMA smoothing factor (0 < alpha <= 1) for least-response-time (Env: "+EnvPrefix+"EWMA_ALPHA)")
-	flagAccessLogEnabled := flag.Bool("access-log-enabled", cfg.AccessLogEnabled, "Enable access logging (Env: "+EnvPrefix+"ACCESS_LOG_ENABLED)")
-	flagAccessLogPayloads := flag.Bool("access-log-payloads", cfg.AccessLogPayloads, "Enable logging of request and response payloads (Env: "+EnvPrefix+"ACCESS_LOG_PAYLOADS)")
-	flagDebugLevel := flag.Bool("debug", cfg.DebugLevel, "Enable debug level logging (Env: "+EnvPrefix+"DEBUG)")
+	flags := defineFlags(cfg)
 
 	// Parse flags early to potentially get the config file path
 	flag.Parse()
 
+	// RequireAllEnv governs how the config file itself is read, so resolve it (Env, then Flag) before loading the file
+	envBool("REQUIRE_ALL_ENV", &cfg.RequireAllEnv)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "require-all-env" {
+			cfg.RequireAllEnv = *flags.requireAllEnv
+		}
+	})
+
 	// --- Load from Config File ---
 	// Use the value parsed from flags OR the default ""
-	if *flagConfigFile != "" {
-		log.Printf("Loading configuration from file: %s", *flagConfigFile)
-		if err := loadConfigFromFile(*flagConfigFile, cfg); err != nil {
-			log.Printf("Warning: Failed to load config file '%s': %v. Using other sources.", *flagConfigFile, err)
+	if *flags.configFile != "" {
+		DefaultLogger().Info("Loading configuration from file", "file", *flags.configFile)
+		if err := loadConfigFromFile(*flags.configFile, cfg); err != nil {
+			DefaultLogger().Warn("Failed to load config file, using other sources", "file", *flags.configFile, "error", err)
 			// Decide if a missing/invalid config file is fatal - here we just warn
 		}
 	}
@@ -99,147 +438,1213 @@ func LoadConfig() (*Config, error) {
 
 	// --- Apply Command Line Flags (Highest Priority) ---
 	// Use flag.Visit to only apply flags that were actually set
-	applyFlags(cfg, flagProxyPort, flagBackendServers, flagBackendWeights, flagHealthPath, flagInfoPath, flagHealthInterval, flagBackendTimeout, flagConfigFile, flagLBAlgo, flagEWMAAlpha, flagAccessLogEnabled, flagAccessLogPayloads, flagDebugLevel)
+	applyFlags(cfg, flags)
 
 	// --- Final Validation ---
-	if len(cfg.BackendServers) == 0 || (len(cfg.BackendServers) == 1 && cfg.BackendServers[0] == "") {
-		return nil, errors.New("configuration error: no backend servers specified")
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	DefaultLogger().Info("Final configuration loaded", "config", fmt.Sprintf("%+v", cfg.Redacted()))
+	return cfg, nil
+}
+
+// BackendOptionsFor returns the per-backend settings configured for a backend URL (zero value if none)
+func (c *Config) BackendOptionsFor(backendURL string) BackendOptions {
+	return c.BackendOptions[backendURL]
+}
+
+// Redacted returns a copy of the config with secrets masked, safe for logging and /config
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	for _, secret := range []*string{&redacted.AuthPasswordHash, &redacted.AuthBearerToken, &redacted.AdminToken, &redacted.TLSKeyFile} {
+		if *secret != "" {
+			*secret = "REDACTED"
+		}
+	}
+	if len(c.HealthCheckHeaders) > 0 { // Header values are often credentials
+		redacted.HealthCheckHeaders = make(map[string]string, len(c.HealthCheckHeaders))
+		for name := range c.HealthCheckHeaders {
+			redacted.HealthCheckHeaders[name] = "REDACTED"
+		}
 	}
-	if cfg.LoadBalancingAlgorithm == "weighted-round-robin" && len(cfg.BackendWeights) != len(cfg.BackendServers) {
-		log.Printf("Warning: Mismatch between number of backends (%d) and weights (%d). Weights ignored unless count matches.", len(cfg.BackendServers), len(cfg.BackendWeights))
-		// Optionally treat as error: return nil, errors.New("configuration error: backend count and weight count mismatch for weighted-round-robin")
+	// URLs may carry credentials as userinfo
+	redacted.BackendProxyURL = redactURL(c.BackendProxyURL)
+	redacted.BackendServers = redactURLs(c.BackendServers)
+	redacted.ShadowBackend = redactURL(c.ShadowBackend)
+	redacted.FallbackBackend = redactURL(c.FallbackBackend)
+	redacted.AccessLogSyslog = redactURL(c.AccessLogSyslog)
+	if len(c.Routes) > 0 {
+		redacted.Routes = make([]RouteConfig, len(c.Routes))
+		for i, route := range c.Routes {
+			route.Backends = redactURLs(route.Backends)
+			redacted.Routes[i] = route
+		}
+	}
+	if len(c.BackendOptions) > 0 { // Per-backend headers and proxy credentials too
+		redacted.BackendOptions = make(map[string]BackendOptions, len(c.BackendOptions))
+		for backend, opts := range c.BackendOptions {
+			backend = redactURL(backend)
+			opts.ProxyURL = redactURL(opts.ProxyURL)
+			if len(opts.Headers) > 0 {
+				headers := make(map[string]string, len(opts.Headers))
+				for name := range opts.Headers {
+					headers[name] = "REDACTED"
+				}
+				opts.Headers = headers
+			}
+			redacted.BackendOptions[backend] = opts
+		}
+	}
+	return &redacted
+}
+
+// redactURL masks the password in rawURL, if it has one
+func redactURL(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Redacted()
+	}
+	return rawURL
+}
+
+// redactURLs is redactURL for each of rawURLs
+func redactURLs(rawURLs []string) []string {
+	if rawURLs == nil {
+		return nil
+	}
+	redacted := make([]string, len(rawURLs))
+	for i, rawURL := range rawURLs {
+		redacted[i] = redactURL(rawURL)
+	}
+	return redacted
+}
+
+// validateBackendURLs checks that every backend is an absolute http or https URL with a
+// host, returning an error that lists all that aren't
+func validateBackendURLs(backends []string) error {
+	var invalid []string
+	for _, backend := range backends {
+		if problem := backendURLProblem(backend); problem != "" {
+			invalid = append(invalid, fmt.Sprintf("%q (%s)", backend, problem))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid backend URLs: %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// backendURLProblem returns what is wrong with a backend URL, or "" if it is fine
+func backendURLProblem(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	switch {
+	case err != nil:
+		return "not a URL"
+	case u.Scheme != "http" && u.Scheme != "https":
+		return "scheme must be http or https"
+	case u.Host == "" || u.Hostname() == "":
+		return "no host"
+	}
+	return ""
+}
+
+// validateConfig checks the merged configuration, returning an error for fatal problems
+// and resetting recoverable invalid values to their defaults with a warning.
+func validateConfig(cfg *Config) error {
+	if len(cfg.BackendServers) == 1 && cfg.BackendServers[0] == "" {
+		cfg.BackendServers = []string{}
+	}
+	if len(cfg.BackendServers) == 0 && !cfg.AllowEmptyStart {
+		return errors.New("configuration error: no backend servers specified")
+	}
+	if err := validateBackendURLs(cfg.BackendServers); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+	weighted := cfg.LoadBalancingAlgorithm == "weighted-round-robin" || cfg.LoadBalancingAlgorithm == "least-response-time" && len(cfg.BackendWeights) > 0
+	if weighted && len(cfg.BackendWeights) != len(cfg.BackendServers) {
+		DefaultLogger().Warn("Mismatch between number of backends and weights, weights ignored unless count matches", "backends", len(cfg.BackendServers), "weights", len(cfg.BackendWeights))
+		// Optionally treat as error: return errors.New("configuration error: backend count and weight count mismatch for weighted-round-robin")
+	}
+	if cfg.MaxWeightRatio != 0 && cfg.MaxWeightRatio < 1 {
+		return errors.New("configuration error: max weight ratio must be 0 (no cap) or at least 1")
+	}
+	if cfg.SelectionLatencyWeight < 0 || cfg.SelectionLatencyWeight > 1 {
+		return fmt.Errorf("configuration error: selection latency weight must be between 0 and 1, got %g", cfg.SelectionLatencyWeight)
 	}
 	if cfg.EWMAAlpha <= 0 || cfg.EWMAAlpha > 1.0 {
-		log.Printf("Warning: Invalid EWMA alpha value (%.2f), using default %.2f.", cfg.EWMAAlpha, DefaultEWMAAlpha)
+		DefaultLogger().Warn("Invalid EWMA alpha value, using default", "alpha", cfg.EWMAAlpha, "default", DefaultEWMAAlpha)
 		cfg.EWMAAlpha = DefaultEWMAAlpha
 	}
-
-	log.Printf("Final Configuration Loaded: %+v", cfg)
-	return cfg, nil
+	if cfg.DebugLevel {
+		cfg.LogLevel = "debug"
+	}
+	if _, err := ParseLogLevel(cfg.LogLevel); err != nil {
+		DefaultLogger().Warn("Invalid log level, using info", "logLevel", cfg.LogLevel)
+		cfg.LogLevel = "info"
+	}
+	if cfg.OutlierErrorRateThreshold < 0 || cfg.OutlierErrorRateThreshold > 1.0 {
+		DefaultLogger().Warn("Invalid outlier error rate threshold, disabling outlier detection", "outlierErrorRateThreshold", cfg.OutlierErrorRateThreshold)
+		cfg.OutlierErrorRateThreshold = 0
+	}
+	if cfg.OutlierMaxEjectionPercent < 0 || cfg.OutlierMaxEjectionPercent > 100 {
+		return fmt.Errorf("configuration error: outlier max ejection percent %d must be between 0 and 100", cfg.OutlierMaxEjectionPercent)
+	}
+	cfg.BackendProxyProtocol = strings.ToLower(cfg.BackendProxyProtocol)
+	if cfg.BackendProxyProtocol != "" && cfg.BackendProxyProtocol != ProxyProtocolV1 && cfg.BackendProxyProtocol != ProxyProtocolV2 {
+		return fmt.Errorf("configuration error: invalid backend PROXY protocol version %q (expected v1 or v2)", cfg.BackendProxyProtocol)
+	}
+	if _, err := parseEgressProxyURL(cfg.BackendProxyURL); err != nil {
+		return fmt.Errorf("configuration error: backend proxy URL: %w", err)
+	}
+	for backend, opts := range cfg.BackendOptions {
+		if _, err := parseEgressProxyURL(opts.ProxyURL); err != nil {
+			return fmt.Errorf("configuration error: proxy URL for backend %s: %w", backend, err)
+		}
+	}
+	if _, err := parseAccessLogFormat(cfg.AccessLogFormat); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+	if cfg.AccessLogSyslog != "" {
+		if _, _, err := parseSyslogTarget(cfg.AccessLogSyslog); err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+		if _, err := parseSyslogFacility(cfg.AccessLogSyslogFacility); err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+	}
+	if err := validateRoutes(cfg); err != nil {
+		return err
+	}
+	if cfg.ShadowBackend != "" {
+		if u, err := url.Parse(cfg.ShadowBackend); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("configuration error: invalid shadow backend URL %q", cfg.ShadowBackend)
+		}
+	}
+	if cfg.ShadowMaxInFlight < 0 {
+		return errors.New("configuration error: shadow max in flight must not be negative")
+	}
+	if cfg.ShadowSampleRate < 0 || cfg.ShadowSampleRate > 1 {
+		return fmt.Errorf("configuration error: shadow sample rate must be between 0 and 1, got %g", cfg.ShadowSampleRate)
+	}
+	for backend, opts := range cfg.BackendOptions {
+		if opts.HealthCheckURL == "" {
+			continue
+		}
+		if u, err := url.Parse(opts.HealthCheckURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("configuration error: invalid health check URL %q for backend %s", opts.HealthCheckURL, backend)
+		}
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return errors.New("configuration error: TLS requires both a certificate and a key file")
+	}
+	if cfg.EnableHTTP3 && cfg.TLSCertFile == "" {
+		return errors.New("configuration error: HTTP/3 requires a TLS certificate and key")
+	}
+	if cfg.SubsetSize < 0 {
+		DefaultLogger().Warn("Invalid subset size, using all backends", "subsetSize", cfg.SubsetSize)
+		cfg.SubsetSize = 0
+	}
+	if cfg.NoBackendStatusCode < 500 || cfg.NoBackendStatusCode > 599 {
+		return fmt.Errorf("configuration error: no-backend status code must be a 5xx, got %d", cfg.NoBackendStatusCode)
+	}
+	if cfg.CORSAllowCredentials && slices.Contains(cfg.CORSAllowedOrigins, "*") {
+		return errors.New(`configuration error: CORS origin "*" can't be combined with allowing credentials; list the allowed origins instead`)
+	}
+	if cfg.AuthUsername != "" && cfg.AuthPasswordHash == "" {
+		return errors.New("configuration error: basic auth requires an auth password hash as well as the username")
+	}
+	if cfg.AuthPasswordHash != "" && cfg.AuthUsername == "" {
+		return errors.New("configuration error: basic auth requires an auth username as well as the password hash")
+	}
+	if cfg.EnablePprof && cfg.AdminToken == "" {
+		return errors.New("configuration error: pprof endpoints require an admin token")
+	}
+	if cfg.PausedStatusCode < 400 || cfg.PausedStatusCode > 599 {
+		return fmt.Errorf("configuration error: paused status code must be a 4xx or 5xx, got %d", cfg.PausedStatusCode)
+	}
+	if cfg.CoalesceMaxBodySize < 0 {
+		return errors.New("configuration error: coalesce max body size must not be negative")
+	}
+	if cfg.MaxRetries < 0 || cfg.RetryMaxBodySize < 0 {
+		return errors.New("configuration error: max retries and retry max body size must not be negative")
+	}
+	if cfg.RetryBudgetMaxTokens < 0 || (cfg.RetryBudgetMaxTokens > 0 && cfg.RetryBudgetTokenRatio <= 0) {
+		return errors.New("configuration error: retry budget needs non-negative max tokens and a positive token ratio")
+	}
+	cfg.RetryPolicy = strings.ToLower(cfg.RetryPolicy)
+	switch cfg.RetryPolicy {
+	case "":
+		cfg.RetryPolicy = RetryPolicyConnectAndStatus
+	case RetryPolicyNone, RetryPolicyConnectOnly, RetryPolicyConnectAndStatus:
+	default:
+		return fmt.Errorf("configuration error: unknown retry policy %q, expected %s, %s or %s", cfg.RetryPolicy, RetryPolicyNone, RetryPolicyConnectOnly, RetryPolicyConnectAndStatus)
+	}
+	for _, status := range cfg.RetryOnStatuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("configuration error: invalid retry-on status %d", status)
+		}
+	}
+	if cfg.RetryBackoff < 0 {
+		return errors.New("configuration error: retry backoff must not be negative")
+	}
+	if cfg.MaxIdleConnsPerBackend < 0 || cfg.MaxConnsPerBackend < 0 {
+		return errors.New("configuration error: backend connection limits must not be negative")
+	}
+	if cfg.BackendDialTimeout < 0 || cfg.BackendTLSHandshakeTimeout < 0 || cfg.BackendResponseHeaderTimeout < 0 {
+		return errors.New("configuration error: backend dial, TLS handshake and response header timeouts must not be negative")
+	}
+	if _, err := parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+	if _, err := newRequestTemplate(cfg.RequestTemplate); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+	if cfg.BackendDNSRefreshInterval < 0 {
+		return errors.New("configuration error: backend DNS refresh interval must not be negative")
+	}
+	if cfg.AdaptiveConcurrency && (cfg.AdaptiveConcurrencyInitialLimit < 1 || cfg.AdaptiveConcurrencyMaxLimit < cfg.AdaptiveConcurrencyInitialLimit) {
+		return errors.New("configuration error: adaptive concurrency needs an initial limit of at least 1 and a max limit no lower")
+	}
+	if cfg.MaxWaitForBackend < 0 {
+		return errors.New("configuration error: max wait for backend must not be negative")
+	}
+	if cfg.SummaryLogInterval < 0 {
+		return errors.New("configuration error: summary log interval must not be negative")
+	}
+	if cfg.StartupGracePeriod < 0 {
+		return errors.New("configuration error: startup grace period must not be negative")
+	}
+	if cfg.PreShutdownDelay < 0 {
+		return errors.New("configuration error: pre-shutdown delay must not be negative")
+	}
+	if cfg.ProxyBufferSize < 0 || cfg.MaxPooledBufferSize < 0 {
+		return errors.New("configuration error: buffer sizes must not be negative")
+	}
+	cfg.HealthCheckMethod = strings.ToUpper(cfg.HealthCheckMethod)
+	if cfg.HealthCheckMethod == "" {
+		cfg.HealthCheckMethod = http.MethodGet
+	}
+	expectedStatuses, err := parseStatusRanges(string(cfg.HealthCheckExpectedStatuses))
+	if err != nil {
+		return fmt.Errorf("configuration error: health check expected statuses: %w", err)
+	}
+	cfg.expectedStatuses = expectedStatuses
+	cfg.HealthCheckType = strings.ToLower(cfg.HealthCheckType)
+	switch cfg.HealthCheckType {
+	case "":
+		cfg.HealthCheckType = HealthCheckTypeHTTP
+	case HealthCheckTypeHTTP, HealthCheckTypeGRPC:
+	default:
+		return fmt.Errorf("configuration error: unknown health check type %q, expected %s or %s", cfg.HealthCheckType, HealthCheckTypeHTTP, HealthCheckTypeGRPC)
+	}
+	if cfg.HealthCheckConcurrency < 0 || cfg.HealthCheckTimeout < 0 {
+		return errors.New("configuration error: health check concurrency and timeout must not be negative")
+	}
+	if cfg.MinHealthyBackends < 0 {
+		DefaultLogger().Warn("Invalid minimum healthy backends, using 0", "minHealthyBackends", cfg.MinHealthyBackends)
+		cfg.MinHealthyBackends = 0
+	}
+	if cfg.MinHealthyFraction < 0 || cfg.MinHealthyFraction > 1.0 {
+		DefaultLogger().Warn("Invalid minimum healthy fraction, using 0", "minHealthyFraction", cfg.MinHealthyFraction)
+		cfg.MinHealthyFraction = 0
+	}
+	return nil
 }
 
-// loadConfigFromFile reads and parses the YAML file into the Config struct
+// loadConfigFromFile reads the config file and parses it into the Config struct.
+// The format is chosen by file extension: .yaml/.yml, .json or .toml.
+// Environment variable references (${VAR} or $VAR) are expanded before parsing, see expandEnv.
 func loadConfigFromFile(filePath string, cfg *Config) error {
-	yamlFile, err := os.ReadFile(filePath)
+	raw, err := os.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("could not read file: %w", err)
 	}
-	// Unmarshal into the existing cfg pointer to overwrite defaults/previous values
-	err = yaml.Unmarshal(yamlFile, cfg)
+	expanded, err := expandEnv(string(raw), cfg.RequireAllEnv)
 	if err != nil {
-		return fmt.Errorf("could not parse YAML: %w", err)
+		return err
+	}
+	data := []byte(expanded)
+	// Unmarshal into the existing cfg pointer to overwrite defaults/previous values
+	switch ext := strings.ToLower(filepath.Ext(filePath)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("could not parse YAML: %w", err)
+		}
+	case ".json":
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("could not parse JSON: %w", err)
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(data), cfg); err != nil {
+			return fmt.Errorf("could not parse TOML: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q (expected .yaml, .yml, .json or .toml)", ext)
 	}
 	return nil
 }
 
-// loadConfigFromEnv loads configuration from environment variables, overwriting existing values
-func loadConfigFromEnv(cfg *Config) {
-	if port := os.Getenv(EnvPrefix + "PORT"); port != "" {
-		cfg.ProxyPort = port
-	}
-	if backends := os.Getenv(EnvPrefix + "BACKENDS"); backends != "" {
-		cfg.BackendServers = parseCommaSeparatedString(backends)
+// expandEnv replaces ${NAME} and $NAME references with values from the environment, where
+// NAME is [A-Za-z_][A-Za-z0-9_]*, and ${NAME:-default} with default when NAME is unset or
+// empty. "$$" yields a literal "$". Both forms follow the same rule for undefined variables:
+// an error naming them if requireAll is set, else the empty string. A "$" not followed by a
+// name is literal, so rewrite references ("$1") survive; bcrypt hashes and template variables
+// need their "$" doubled.
+func expandEnv(s string, requireAll bool) (string, error) {
+	var out strings.Builder
+	var missing []string
+	lookup := func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok && requireAll && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+		return value
 	}
-	if weightsStr := os.Getenv(EnvPrefix + "WEIGHTS"); weightsStr != "" {
-		weights, err := parseCommaSeparatedInts(weightsStr)
-		if err == nil {
-			cfg.BackendWeights = weights
-		} else {
-			log.Printf("Warning: Invalid format for env var %sWEIGHTS: %v", EnvPrefix, err)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		switch next := s[i+1]; {
+		case next == '$':
+			out.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				out.WriteByte('$')
+				continue
+			}
+			name, fallback, hasDefault := strings.Cut(s[i+2:i+2+end], ":-")
+			if !isEnvName(name) {
+				out.WriteByte('$')
+				continue
+			}
+			if hasDefault {
+				if value := os.Getenv(name); value != "" {
+					fallback = value
+				}
+				out.WriteString(fallback)
+			} else {
+				out.WriteString(lookup(name))
+			}
+			i += 2 + end
+		case isEnvNameStart(next):
+			end := i + 2
+			for end < len(s) && (isEnvNameStart(s[end]) || s[end] >= '0' && s[end] <= '9') {
+				end++
+			}
+			out.WriteString(lookup(s[i+1 : end]))
+			i = end - 1
+		default:
+			out.WriteByte('$')
 		}
 	}
-	if path := os.Getenv(EnvPrefix + "HEALTH_PATH"); path != "" {
-		cfg.HealthCheckPath = path
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined environment variables in config file: %s (use ${NAME:-default}, or $$ for a literal $)", strings.Join(missing, ", "))
 	}
-	if path := os.Getenv(EnvPrefix + "INFO_PATH"); path != "" {
-		cfg.InfoPath = path
+	return out.String(), nil
+}
+
+// isEnvName reports whether name is a variable name expandEnv substitutes
+func isEnvName(name string) bool {
+	if name == "" || !isEnvNameStart(name[0]) {
+		return false
 	}
-	if intervalStr := os.Getenv(EnvPrefix + "HEALTH_INTERVAL"); intervalStr != "" {
-		if d, err := time.ParseDuration(intervalStr); err == nil {
-			cfg.HealthCheckInterval = d
-		} else {
-			log.Printf("Warning: Invalid format for env var %sHEALTH_INTERVAL: %v", EnvPrefix, err)
+	for i := 1; i < len(name); i++ {
+		if !isEnvNameStart(name[i]) && (name[i] < '0' || name[i] > '9') {
+			return false
 		}
 	}
-	if timeoutStr := os.Getenv(EnvPrefix + "BACKEND_TIMEOUT"); timeoutStr != "" {
-		if d, err := time.ParseDuration(timeoutStr); err == nil {
-			cfg.BackendRequestTimeout = d
-		} else {
-			log.Printf("Warning: Invalid format for env var %sBACKEND_TIMEOUT: %v", EnvPrefix, err)
-		}
+	return true
+}
+
+func isEnvNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// UnmarshalJSON decodes a JSON config, accepting durations either as Go
+// duration strings ("10s") or as integer nanoseconds.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // Keep nanosecond counts exact
+	if err := decoder.Decode(&raw); err != nil {
+		return err
 	}
-	if algo := os.Getenv(EnvPrefix + "LB_ALGORITHM"); algo != "" {
-		cfg.LoadBalancingAlgorithm = strings.ToLower(algo)
+	normalized, err := normalizeJSONDurations(raw, reflect.TypeOf(c))
+	if err != nil {
+		return err
 	}
-	if alphaStr := os.Getenv(EnvPrefix + "EWMA_ALPHA"); alphaStr != "" {
-		if alpha, err := strconv.ParseFloat(alphaStr, 64); err == nil {
-			cfg.EWMAAlpha = alpha
-		} else {
-			log.Printf("Warning: Invalid format for env var %sEWMA_ALPHA: %v", EnvPrefix, err)
-		}
+	if data, err = json.Marshal(normalized); err != nil {
+		return err
 	}
-	if accessLogStr := os.Getenv(EnvPrefix + "ACCESS_LOG_ENABLED"); accessLogStr != "" {
-		if accessLog, err := strconv.ParseBool(accessLogStr); err == nil {
-			cfg.AccessLogEnabled = accessLog
-		} else {
-			log.Printf("Warning: Invalid format for env var %sACCESS_LOG_ENABLED: %v", EnvPrefix, err)
-		}
+	type plainConfig Config // Drops the methods to avoid recursing into UnmarshalJSON
+	return json.Unmarshal(data, (*plainConfig)(c))
+}
+
+// normalizeJSONDurations walks a decoded JSON value alongside the Go type it will be
+// unmarshaled into, replacing duration strings with nanosecond counts wherever the
+// target is a time.Duration. Keys are matched like encoding/json (json tag, case-insensitive).
+func normalizeJSONDurations(v interface{}, t reflect.Type) (interface{}, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
 	}
-	if accessLogPayloadsStr := os.Getenv(EnvPrefix + "ACCESS_LOG_PAYLOADS"); accessLogPayloadsStr != "" {
-		if accessLogPayloads, err := strconv.ParseBool(accessLogPayloadsStr); err == nil {
-			cfg.AccessLogPayloads = accessLogPayloads
-		} else {
-			log.Printf("Warning: Invalid format for env var %sACCESS_LOG_PAYLOADS: %v", EnvPrefix, err)
+	if t == reflect.TypeOf(time.Duration(0)) {
+		if str, ok := v.(string); ok {
+			d, err := time.ParseDuration(str)
+			if err != nil {
+				return nil, err
+			}
+			return int64(d), nil
 		}
+		return v, nil
 	}
-	if debugStr := os.Getenv(EnvPrefix + "DEBUG"); debugStr != "" {
-		if debug, err := strconv.ParseBool(debugStr); err == nil {
-			cfg.DebugLevel = debug
-		} else {
-			log.Printf("Warning: Invalid format for env var %sDEBUG: %v", EnvPrefix, err)
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return v, nil
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			for key, value := range obj {
+				if strings.EqualFold(key, name) {
+					normalized, err := normalizeJSONDurations(value, field.Type)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %w", key, err)
+					}
+					obj[key] = normalized
+				}
+			}
+		}
+	case reflect.Map:
+		if obj, ok := v.(map[string]interface{}); ok {
+			for key, value := range obj {
+				normalized, err := normalizeJSONDurations(value, t.Elem())
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", key, err)
+				}
+				obj[key] = normalized
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if list, ok := v.([]interface{}); ok {
+			for i, value := range list {
+				normalized, err := normalizeJSONDurations(value, t.Elem())
+				if err != nil {
+					return nil, fmt.Errorf("[%d]: %w", i, err)
+				}
+				list[i] = normalized
+			}
 		}
 	}
+	return v, nil
+}
+
+// loadConfigFromEnv loads configuration from environment variables, overwriting existing values
+func loadConfigFromEnv(cfg *Config) {
+	envString("PORT", &cfg.ProxyPort)
+	envStrings("BACKENDS", &cfg.BackendServers)
+	envInts("WEIGHTS", &cfg.BackendWeights)
+	envString("HEALTH_PATH", &cfg.HealthCheckPath)
+	envString("INFO_PATH", &cfg.InfoPath)
+	envDuration("HEALTH_INTERVAL", &cfg.HealthCheckInterval)
+	envDuration("BACKEND_TIMEOUT", &cfg.BackendRequestTimeout)
+	if algo := os.Getenv(EnvPrefix + "LB_ALGORITHM"); algo != "" {
+		cfg.LoadBalancingAlgorithm = strings.ToLower(algo)
+	}
+	envFloat("EWMA_ALPHA", &cfg.EWMAAlpha)
+	envFloat("MAX_WEIGHT_RATIO", &cfg.MaxWeightRatio)
+	envFloat("SELECTION_LATENCY_WEIGHT", &cfg.SelectionLatencyWeight)
+	envBool("ACCESS_LOG_ENABLED", &cfg.AccessLogEnabled)
+	envBool("ACCESS_LOG_PAYLOADS", &cfg.AccessLogPayloads)
+	envString("ACCESS_LOG_FORMAT", &cfg.AccessLogFormat)
+	envString("ACCESS_LOG_FILE", &cfg.AccessLogFile)
+	envString("ACCESS_LOG_SYSLOG", &cfg.AccessLogSyslog)
+	envString("ACCESS_LOG_SYSLOG_FACILITY", &cfg.AccessLogSyslogFacility)
+	envString("ACCESS_LOG_SYSLOG_TAG", &cfg.AccessLogSyslogTag)
+	envBool("DEBUG", &cfg.DebugLevel)
+	envString("LOG_LEVEL", &cfg.LogLevel)
+	envInt("MIN_HEALTHY_BACKENDS", &cfg.MinHealthyBackends)
+	envFloat("MIN_HEALTHY_FRACTION", &cfg.MinHealthyFraction)
+	envDuration("STARTUP_GRACE_PERIOD", &cfg.StartupGracePeriod)
+	envDuration("SUMMARY_LOG_INTERVAL", &cfg.SummaryLogInterval)
+	envStrings("ALLOWED_METHODS", &cfg.AllowedMethods)
+	envStrings("BLOCKED_PATH_PREFIXES", &cfg.BlockedPathPrefixes)
+	envBool("STRICT_HTTP", &cfg.StrictHTTP)
+	envStrings("STRIP_RESPONSE_HEADERS", &cfg.StripResponseHeaders)
+	envStrings("FORWARD_HEADER_ALLOW_LIST", &cfg.ForwardHeaderAllowList)
+	envStrings("FORWARD_HEADER_DENY_LIST", &cfg.ForwardHeaderDenyList)
+	envString("AUTH_USERNAME", &cfg.AuthUsername)
+	envString("AUTH_PASSWORD_HASH", &cfg.AuthPasswordHash)
+	envString("AUTH_BEARER_TOKEN", &cfg.AuthBearerToken)
+	envStrings("AUTH_EXEMPT_PATHS", &cfg.AuthExemptPaths)
+	envString("ADMIN_TOKEN", &cfg.AdminToken)
+	envBool("ENABLE_PPROF", &cfg.EnablePprof)
+	envStrings("CORS_ALLOWED_ORIGINS", &cfg.CORSAllowedOrigins)
+	envStrings("CORS_ALLOWED_METHODS", &cfg.CORSAllowedMethods)
+	envStrings("CORS_ALLOWED_HEADERS", &cfg.CORSAllowedHeaders)
+	envBool("CORS_ALLOW_CREDENTIALS", &cfg.CORSAllowCredentials)
+	envDuration("CORS_MAX_AGE", &cfg.CORSMaxAge)
+	envBool("COMPRESSION_ENABLED", &cfg.CompressionEnabled)
+	envInt("COMPRESSION_MIN_SIZE", &cfg.CompressionMinSize)
+	envStrings("COMPRESSIBLE_CONTENT_TYPES", &cfg.CompressibleContentTypes)
+	envBool("DECOMPRESS_REQUESTS", &cfg.DecompressRequests)
+	envInt64("MAX_DECOMPRESSED_BODY_SIZE", &cfg.MaxDecompressedBodySize)
+	envFloat("OUTLIER_ERROR_RATE_THRESHOLD", &cfg.OutlierErrorRateThreshold)
+	envDuration("OUTLIER_WINDOW", &cfg.OutlierWindow)
+	envInt("OUTLIER_MIN_REQUESTS", &cfg.OutlierMinRequests)
+	envDuration("OUTLIER_EJECTION_TIME", &cfg.OutlierEjectionTime)
+	envInt("OUTLIER_MAX_EJECTION_PERCENT", &cfg.OutlierMaxEjectionPercent)
+	envInt("MAX_CONNECTIONS_PER_BACKEND", &cfg.MaxConnectionsPerBackend)
+	envInt("MAX_GLOBAL_CONCURRENCY", &cfg.MaxGlobalConcurrency)
+	envDuration("QUEUE_TIMEOUT", &cfg.QueueTimeout)
+	envInt("MAX_QUEUE_LENGTH", &cfg.MaxQueueLength)
+	envDuration("MAX_WAIT_FOR_BACKEND", &cfg.MaxWaitForBackend)
+	envBool("ADAPTIVE_CONCURRENCY", &cfg.AdaptiveConcurrency)
+	envInt("ADAPTIVE_CONCURRENCY_INITIAL_LIMIT", &cfg.AdaptiveConcurrencyInitialLimit)
+	envInt("ADAPTIVE_CONCURRENCY_MAX_LIMIT", &cfg.AdaptiveConcurrencyMaxLimit)
+	envString("BACKEND_PROXY_PROTOCOL", &cfg.BackendProxyProtocol)
+	envString("BACKEND_PROXY_URL", &cfg.BackendProxyURL)
+	envBool("ACCEPT_PROXY_PROTOCOL", &cfg.AcceptProxyProtocol)
+	envDuration("REQUEST_TIMEOUT", &cfg.RequestTimeout)
+	envString("SHADOW_BACKEND", &cfg.ShadowBackend)
+	envDuration("SHADOW_TIMEOUT", &cfg.ShadowTimeout)
+	envInt64("SHADOW_MAX_BODY_SIZE", &cfg.ShadowMaxBodySize)
+	envFloat("SHADOW_SAMPLE_RATE", &cfg.ShadowSampleRate)
+	envInt("SHADOW_MAX_IN_FLIGHT", &cfg.ShadowMaxInFlight)
+	envBool("COALESCE_REQUESTS", &cfg.CoalesceRequests)
+	envInt64("COALESCE_MAX_BODY_SIZE", &cfg.CoalesceMaxBodySize)
+	envInt("MAX_RETRIES", &cfg.MaxRetries)
+	envInt64("RETRY_MAX_BODY_SIZE", &cfg.RetryMaxBodySize)
+	envString("RETRY_POLICY", &cfg.RetryPolicy)
+	envInts("RETRY_ON_STATUSES", &cfg.RetryOnStatuses)
+	envDuration("RETRY_BACKOFF", &cfg.RetryBackoff)
+	envInt("RETRY_BUDGET_MAX_TOKENS", &cfg.RetryBudgetMaxTokens)
+	envFloat("RETRY_BUDGET_TOKEN_RATIO", &cfg.RetryBudgetTokenRatio)
+	envString("TLS_CERT_FILE", &cfg.TLSCertFile)
+	envString("TLS_KEY_FILE", &cfg.TLSKeyFile)
+	envBool("ENABLE_HTTP2", &cfg.EnableHTTP2)
+	envBool("ENABLE_H2C", &cfg.EnableH2C)
+	envBool("ENABLE_HTTP3", &cfg.EnableHTTP3)
+	envBool("HIDE_ERROR_DETAILS", &cfg.HideErrorDetails)
+	envBool("DEBUG_HEADERS", &cfg.DebugHeaders)
+	envInt("NO_BACKEND_STATUS_CODE", &cfg.NoBackendStatusCode)
+	envInt("PAUSED_STATUS_CODE", &cfg.PausedStatusCode)
+	envString("REQUEST_ID_HEADER", &cfg.RequestIDHeader)
+	envInt("SUBSET_SIZE", &cfg.SubsetSize)
+	envString("SUBSET_ID", &cfg.SubsetID)
+	envString("LOCAL_ZONE", &cfg.LocalZone)
+	envInt("MAX_IDLE_CONNS_PER_BACKEND", &cfg.MaxIdleConnsPerBackend)
+	envInt("MAX_CONNS_PER_BACKEND", &cfg.MaxConnsPerBackend)
+	envDuration("IDLE_CONN_TIMEOUT", &cfg.IdleConnTimeout)
+	envBool("DISABLE_KEEP_ALIVES", &cfg.DisableKeepAlives)
+	envDuration("BACKEND_DIAL_TIMEOUT", &cfg.BackendDialTimeout)
+	envDuration("BACKEND_TLS_HANDSHAKE_TIMEOUT", &cfg.BackendTLSHandshakeTimeout)
+	envDuration("BACKEND_RESPONSE_HEADER_TIMEOUT", &cfg.BackendResponseHeaderTimeout)
+	envString("HEALTH_CHECK_METHOD", &cfg.HealthCheckMethod)
+	envHeaders("HEALTH_CHECK_HEADERS", &cfg.HealthCheckHeaders)
+	envString("HEALTH_CHECK_EXPECTED_STATUSES", (*string)(&cfg.HealthCheckExpectedStatuses))
+	envString("HEALTH_CHECK_TYPE", &cfg.HealthCheckType)
+	envString("HEALTH_CHECK_SERVICE", &cfg.HealthCheckService)
+	envInt("HEALTH_CHECK_CONCURRENCY", &cfg.HealthCheckConcurrency)
+	envDuration("HEALTH_CHECK_TIMEOUT", &cfg.HealthCheckTimeout)
+	envString("HEALTH_CHECK_CAPACITY_HEADER", &cfg.HealthCheckCapacityHeader)
+	envBool("ALLOW_EMPTY_START", &cfg.AllowEmptyStart)
+	envDuration("UNHEALTHY_CHECK_INTERVAL", &cfg.UnhealthyCheckInterval)
+	envBool("HONOR_BACKEND_RETRY_AFTER", &cfg.HonorBackendRetryAfter)
+	envDuration("READ_TIMEOUT", &cfg.ReadTimeout)
+	envDuration("READ_HEADER_TIMEOUT", &cfg.ReadHeaderTimeout)
+	envDuration("WRITE_TIMEOUT", &cfg.WriteTimeout)
+	envDuration("IDLE_TIMEOUT", &cfg.IdleTimeout)
+	envInt("PROXY_BUFFER_SIZE", &cfg.ProxyBufferSize)
+	envInt("MAX_POOLED_BUFFER_SIZE", &cfg.MaxPooledBufferSize)
+	envStrings("TRUSTED_PROXIES", &cfg.TrustedProxies)
+	envDuration("PRE_SHUTDOWN_DELAY", &cfg.PreShutdownDelay)
+	envDuration("BACKEND_DNS_REFRESH_INTERVAL", &cfg.BackendDNSRefreshInterval)
+	envBool("BACKEND_HAPPY_EYEBALLS", &cfg.BackendHappyEyeballs)
+	envString("FALLBACK_BACKEND", &cfg.FallbackBackend)
+	envString("FALLBACK_STATIC_DIR", &cfg.FallbackStaticDir)
+}
+
+// configFlags holds the command line flags, defined with the current config values as defaults
+type configFlags struct {
+	proxyPort             *string
+	backendServers        *string
+	backendWeights        *string // Weights as string flag
+	healthPath            *string
+	infoPath              *string
+	healthInterval        *time.Duration
+	backendRequestTimeout *time.Duration
+	configFile            *string
+	lbAlgo                *string
+	ewmaAlpha             *float64
+	maxWeightRatio        *float64
+	latencyWeight         *float64
+	accessLogEnabled      *bool
+	accessLogPayloads     *bool
+	accessLogFormat       *string
+	accessLogFile         *string
+	accessLogSyslog       *string
+	syslogFacility        *string
+	syslogTag             *string
+	debugLevel            *bool
+	logLevel              *string
+	requireAllEnv         *bool
+	minHealthyBackends    *int
+	minHealthyFraction    *float64
+	startupGracePeriod    *time.Duration
+	summaryLogInterval    *time.Duration
+	allowedMethods        *string
+	blockedPaths          *string
+	strictHTTP            *bool
+	enablePprof           *bool
+	stripRespHeaders      *string
+	fwdHeaderAllow        *string
+	fwdHeaderDeny         *string
+	authUsername          *string
+	authExemptPaths       *string
+	corsOrigins           *string
+	compression           *bool
+	compressionMinSize    *int
+	decompressRequests    *bool
+	maxDecompressed       *int64
+	outlierThreshold      *float64
+	outlierWindow         *time.Duration
+	outlierMinRequests    *int
+	outlierEjection       *time.Duration
+	outlierMaxEjection    *int
+	maxConnections        *int
+	globalConcurrency     *int
+	queueTimeout          *time.Duration
+	maxQueueLength        *int
+	maxWaitForBackend     *time.Duration
+	adaptiveConcurrency   *bool
+	adaptiveInitial       *int
+	adaptiveMax           *int
+	backendProxyProto     *string
+	backendProxyURL       *string
+	acceptProxyProto      *bool
+	requestTimeout        *time.Duration
+	shadowBackend         *string
+	shadowTimeout         *time.Duration
+	shadowMaxBodySize     *int64
+	shadowSampleRate      *float64
+	shadowMaxInFlight     *int
+	coalesceRequests      *bool
+	coalesceMaxBodySize   *int64
+	maxRetries            *int
+	retryPolicy           *string
+	retryMaxBodySize      *int64
+	retryOnStatuses       *string
+	retryBackoff          *time.Duration
+	retryBudgetTokens     *int
+	retryBudgetRatio      *float64
+	tlsCertFile           *string
+	tlsKeyFile            *string
+	enableHTTP2           *bool
+	enableH2C             *bool
+	enableHTTP3           *bool
+	hideErrorDetails      *bool
+	debugHeaders          *bool
+	noBackendStatus       *int
+	pausedStatus          *int
+	requestIDHeader       *string
+	subsetSize            *int
+	subsetID              *string
+	localZone             *string
+	maxIdleConns          *int
+	maxConns              *int
+	idleConnTimeout       *time.Duration
+	disableKeepAlives     *bool
+	dialTimeout           *time.Duration
+	tlsTimeout            *time.Duration
+	headerTimeout         *time.Duration
+	healthMethod          *string
+	healthStatuses        *string
+	healthType            *string
+	healthService         *string
+	capacityHeader        *string
+	healthConcurrency     *int
+	healthTimeout         *time.Duration
+	allowEmptyStart       *bool
+	unhealthyInterval     *time.Duration
+	honorRetryAfter       *bool
+	readTimeout           *time.Duration
+	readHeaderTimeout     *time.Duration
+	writeTimeout          *time.Duration
+	idleTimeout           *time.Duration
+	proxyBufferSize       *int
+	maxPooledBufferSize   *int
+	trustedProxies        *string
+	preShutdownDelay      *time.Duration
+	backendDNSRefresh     *time.Duration
+	happyEyeballs         *bool
+	fallbackBackend       *string
+	fallbackStaticDir     *string
+}
+
+// defineFlags registers the command line flags on the default flag set
+func defineFlags(cfg *Config) *configFlags {
+	return &configFlags{
+		proxyPort:             flag.String("port", cfg.ProxyPort, "Port for the proxy server (e.g., :8080) (Env: "+EnvPrefix+"PORT)"),
+		backendServers:        flag.String("backends", strings.Join(cfg.BackendServers, ","), "Comma-separated list of backend server URLs (Env: "+EnvPrefix+"BACKENDS)"),
+		backendWeights:        flag.String("weights", "", "Comma-separated list of backend weights (optional, for weighted-round-robin and least-response-time) (Env: "+EnvPrefix+"WEIGHTS)"),
+		healthPath:            flag.String("health-path", cfg.HealthCheckPath, "Path for backend health checks (Env: "+EnvPrefix+"HEALTH_PATH)"),
+		infoPath:              flag.String("info-path", cfg.InfoPath, "Path for backend info endpoint (Env: "+EnvPrefix+"INFO_PATH)"),
+		healthInterval:        flag.Duration("health-interval", cfg.HealthCheckInterval, "Interval for health checks (e.g., 10s, 1m) (Env: "+EnvPrefix+"HEALTH_INTERVAL)"),
+		backendRequestTimeout: flag.Duration("backend-timeout", cfg.BackendRequestTimeout, "Timeout for backend health/info requests (e.g., 2s) (Env: "+EnvPrefix+"BACKEND_TIMEOUT)"),
+		configFile:            flag.String("config", cfg.ConfigFile, "Path to configuration file (.yaml, .yml, .json or .toml)"),
+		lbAlgo:                flag.String("lb-algo", cfg.LoadBalancingAlgorithm, "Load balancing algorithm: round-robin, least-connections, least-response-time, weighted-round-robin, peak-ewma, hybrid (Env: "+EnvPrefix+"LB_ALGORITHM)"),
+		ewmaAlpha:             flag.Float64("ewma-alpha", cfg.EWMAAlpha, "EWMA smoothing factor (0 < alpha <= 1) for least-response-time, peak-ewma and hybrid (Env: "+EnvPrefix+"EWMA_ALPHA)"),
+		maxWeightRatio:        flag.Float64("max-weight-ratio", cfg.MaxWeightRatio, "Cap weighted-round-robin weights at this multiple of the smallest, 0 for no cap (Env: "+EnvPrefix+"MAX_WEIGHT_RATIO)"),
+		latencyWeight:         flag.Float64("selection-latency-weight", cfg.SelectionLatencyWeight, "Hybrid balancer blend (0-1): 1 balances on latency only, 0 on active connections only (Env: "+EnvPrefix+"SELECTION_LATENCY_WEIGHT)"),
+		accessLogEnabled:      flag.Bool("access-log-enabled", cfg.AccessLogEnabled, "Enable access logging (Env: "+EnvPrefix+"ACCESS_LOG_ENABLED)"),
+		accessLogPayloads:     flag.Bool("access-log-payloads", cfg.AccessLogPayloads, "Enable logging of request and response payloads (Env: "+EnvPrefix+"ACCESS_LOG_PAYLOADS)"),
+		accessLogFormat:       flag.String("access-log-format", cfg.AccessLogFormat, "Access log format: json, combined or a Go template; empty logs through the logger (Env: "+EnvPrefix+"ACCESS_LOG_FORMAT)"),
+		accessLogFile:         flag.String("access-log-file", cfg.AccessLogFile, "File access logs are appended to, reopened on SIGHUP; - for stdout (Env: "+EnvPrefix+"ACCESS_LOG_FILE)"),
+		accessLogSyslog:       flag.String("access-log-syslog", cfg.AccessLogSyslog, "Syslog endpoint for access logs instead of the file, e.g. udp://host:514 or local (Env: "+EnvPrefix+"ACCESS_LOG_SYSLOG)"),
+		syslogFacility:        flag.String("access-log-syslog-facility", cfg.AccessLogSyslogFacility, "Syslog facility of access log messages, e.g. local0 (Env: "+EnvPrefix+"ACCESS_LOG_SYSLOG_FACILITY)"),
+		syslogTag:             flag.String("access-log-syslog-tag", cfg.AccessLogSyslogTag, "Syslog tag of access log messages (Env: "+EnvPrefix+"ACCESS_LOG_SYSLOG_TAG)"),
+		debugLevel:            flag.Bool("debug", cfg.DebugLevel, "Enable debug level logging, same as -log-level=debug (Env: "+EnvPrefix+"DEBUG)"),
+		logLevel:              flag.String("log-level", cfg.LogLevel, "Minimum log level: debug, info, warn or error (Env: "+EnvPrefix+"LOG_LEVEL)"),
+		requireAllEnv:         flag.Bool("require-all-env", cfg.RequireAllEnv, "Fail if the config file references undefined environment variables; false expands them to empty strings (Env: "+EnvPrefix+"REQUIRE_ALL_ENV)"),
+		minHealthyBackends:    flag.Int("min-healthy-backends", cfg.MinHealthyBackends, "Minimum number of healthy backends before reporting ready (Env: "+EnvPrefix+"MIN_HEALTHY_BACKENDS)"),
+		minHealthyFraction:    flag.Float64("min-healthy-fraction", cfg.MinHealthyFraction, "Minimum fraction (0-1) of healthy backends before reporting ready (Env: "+EnvPrefix+"MIN_HEALTHY_FRACTION)"),
+		startupGracePeriod:    flag.Duration("startup-grace-period", cfg.StartupGracePeriod, "How long to wait at startup for enough backends to become healthy before serving (Env: "+EnvPrefix+"STARTUP_GRACE_PERIOD)"),
+		summaryLogInterval:    flag.Duration("summary-log-interval", cfg.SummaryLogInterval, "How often to log a pool summary, 0 to disable (Env: "+EnvPrefix+"SUMMARY_LOG_INTERVAL)"),
+		allowedMethods:        flag.String("allowed-methods", strings.Join(cfg.AllowedMethods, ","), "Comma-separated list of allowed HTTP methods, empty allows all (Env: "+EnvPrefix+"ALLOWED_METHODS)"),
+		blockedPaths:          flag.String("blocked-path-prefixes", strings.Join(cfg.BlockedPathPrefixes, ","), "Comma-separated list of path prefixes rejected with 403 (Env: "+EnvPrefix+"BLOCKED_PATH_PREFIXES)"),
+		strictHTTP:            flag.Bool("strict-http", cfg.StrictHTTP, "Reject requests with conflicting Content-Length/Transfer-Encoding framing with 400 (Env: "+EnvPrefix+"STRICT_HTTP)"),
+		enablePprof:           flag.Bool("enable-pprof", cfg.EnablePprof, "Serve Go profiling endpoints under /debug/pprof/, requires the admin token (Env: "+EnvPrefix+"ENABLE_PPROF)"),
+		stripRespHeaders:      flag.String("strip-response-headers", strings.Join(cfg.StripResponseHeaders, ","), "Comma-separated response headers removed before responses reach clients, e.g. Server,X-Powered-By (Env: "+EnvPrefix+"STRIP_RESPONSE_HEADERS)"),
+		fwdHeaderAllow:        flag.String("forward-header-allow-list", strings.Join(cfg.ForwardHeaderAllowList, ","), "Comma-separated request headers forwarded to backends, empty forwards all (Env: "+EnvPrefix+"FORWARD_HEADER_ALLOW_LIST)"),
+		fwdHeaderDeny:         flag.String("forward-header-deny-list", strings.Join(cfg.ForwardHeaderDenyList, ","), "Comma-separated request headers never forwarded to backends, e.g. Cookie (Env: "+EnvPrefix+"FORWARD_HEADER_DENY_LIST)"),
+		authUsername:          flag.String("auth-username", cfg.AuthUsername, "Username for HTTP Basic auth; password hash and token are env/file only (Env: "+EnvPrefix+"AUTH_USERNAME)"),
+		authExemptPaths:       flag.String("auth-exempt-paths", strings.Join(cfg.AuthExemptPaths, ","), "Comma-separated list of paths served without authentication (Env: "+EnvPrefix+"AUTH_EXEMPT_PATHS)"),
+		corsOrigins:           flag.String("cors-allowed-origins", strings.Join(cfg.CORSAllowedOrigins, ","), "Comma-separated list of allowed CORS origins, empty disables CORS (Env: "+EnvPrefix+"CORS_ALLOWED_ORIGINS)"),
+		compression:           flag.Bool("compression", cfg.CompressionEnabled, "Enable gzip compression of responses (Env: "+EnvPrefix+"COMPRESSION_ENABLED)"),
+		compressionMinSize:    flag.Int("compression-min-size", cfg.CompressionMinSize, "Minimum response size in bytes to compress (Env: "+EnvPrefix+"COMPRESSION_MIN_SIZE)"),
+		decompressRequests:    flag.Bool("decompress-requests", cfg.DecompressRequests, "Decode gzip request bodies before proxying (Env: "+EnvPrefix+"DECOMPRESS_REQUESTS)"),
+		maxDecompressed:       flag.Int64("max-decompressed-body-size", cfg.MaxDecompressedBodySize, "Maximum decoded request body size in bytes, 0 for unlimited (Env: "+EnvPrefix+"MAX_DECOMPRESSED_BODY_SIZE)"),
+		outlierThreshold:      flag.Float64("outlier-error-rate-threshold", cfg.OutlierErrorRateThreshold, "Error rate (0-1) over the outlier window that ejects a backend, 0 disables (Env: "+EnvPrefix+"OUTLIER_ERROR_RATE_THRESHOLD)"),
+		outlierWindow:         flag.Duration("outlier-window", cfg.OutlierWindow, "Sliding window for outlier error rates (Env: "+EnvPrefix+"OUTLIER_WINDOW)"),
+		outlierMinRequests:    flag.Int("outlier-min-requests", cfg.OutlierMinRequests, "Minimum requests in the window before a backend can be ejected (Env: "+EnvPrefix+"OUTLIER_MIN_REQUESTS)"),
+		outlierEjection:       flag.Duration("outlier-ejection-time", cfg.OutlierEjectionTime, "How long an ejected backend is kept out of rotation (Env: "+EnvPrefix+"OUTLIER_EJECTION_TIME)"),
+		outlierMaxEjection:    flag.Int("outlier-max-ejection-percent", cfg.OutlierMaxEjectionPercent, "Most backends (0-100 percent) ejected at once; one can always be (Env: "+EnvPrefix+"OUTLIER_MAX_EJECTION_PERCENT)"),
+		maxConnections:        flag.Int("max-connections-per-backend", cfg.MaxConnectionsPerBackend, "Maximum concurrent requests per backend, 0 for unlimited (Env: "+EnvPrefix+"MAX_CONNECTIONS_PER_BACKEND)"),
+		globalConcurrency:     flag.Int("max-global-concurrency", cfg.MaxGlobalConcurrency, "Maximum requests in flight across all routes, beyond which requests get 503; 0 for unlimited (Env: "+EnvPrefix+"MAX_GLOBAL_CONCURRENCY)"),
+		queueTimeout:          flag.Duration("queue-timeout", cfg.QueueTimeout, "How long a request waits for a free backend before 503, 0 for no limit (Env: "+EnvPrefix+"QUEUE_TIMEOUT)"),
+		maxQueueLength:        flag.Int("max-queue-length", cfg.MaxQueueLength, "Maximum requests waiting for a backend, 0 for unbounded (Env: "+EnvPrefix+"MAX_QUEUE_LENGTH)"),
+		maxWaitForBackend:     flag.Duration("max-wait-for-backend", cfg.MaxWaitForBackend, "How long a request waits while no backend is alive before 503, 0 to use the queue timeout (Env: "+EnvPrefix+"MAX_WAIT_FOR_BACKEND)"),
+		adaptiveConcurrency:   flag.Bool("adaptive-concurrency", cfg.AdaptiveConcurrency, "Learn each backend's connection limit from request latency (Env: "+EnvPrefix+"ADAPTIVE_CONCURRENCY)"),
+		adaptiveInitial:       flag.Int("adaptive-concurrency-initial-limit", cfg.AdaptiveConcurrencyInitialLimit, "Adaptive connection limit before any request completed (Env: "+EnvPrefix+"ADAPTIVE_CONCURRENCY_INITIAL_LIMIT)"),
+		adaptiveMax:           flag.Int("adaptive-concurrency-max-limit", cfg.AdaptiveConcurrencyMaxLimit, "Upper bound of the adaptive connection limit (Env: "+EnvPrefix+"ADAPTIVE_CONCURRENCY_MAX_LIMIT)"),
+		backendProxyProto:     flag.String("backend-proxy-protocol", cfg.BackendProxyProtocol, "Send a PROXY protocol header to backends: v1 or v2, empty disables (Env: "+EnvPrefix+"BACKEND_PROXY_PROTOCOL)"),
+		backendProxyURL:       flag.String("backend-proxy-url", cfg.BackendProxyURL, "Egress proxy for backend connections: http://, https:// or socks5:// URL, empty uses the environment (Env: "+EnvPrefix+"BACKEND_PROXY_URL)"),
+		acceptProxyProto:      flag.Bool("accept-proxy-protocol", cfg.AcceptProxyProtocol, "Require a PROXY protocol header on inbound connections (Env: "+EnvPrefix+"ACCEPT_PROXY_PROTOCOL)"),
+		requestTimeout:        flag.Duration("request-timeout", cfg.RequestTimeout, "Timeout for proxied requests, 0 for no limit; per-backend overrides are file only (Env: "+EnvPrefix+"REQUEST_TIMEOUT)"),
+		shadowBackend:         flag.String("shadow-backend", cfg.ShadowBackend, "URL of a backend receiving mirrored copies of requests (Env: "+EnvPrefix+"SHADOW_BACKEND)"),
+		shadowTimeout:         flag.Duration("shadow-timeout", cfg.ShadowTimeout, "Timeout for each mirrored request (Env: "+EnvPrefix+"SHADOW_TIMEOUT)"),
+		shadowMaxBodySize:     flag.Int64("shadow-max-body-size", cfg.ShadowMaxBodySize, "Requests with larger bodies are not mirrored (Env: "+EnvPrefix+"SHADOW_MAX_BODY_SIZE)"),
+		shadowSampleRate:      flag.Float64("shadow-sample-rate", cfg.ShadowSampleRate, "Fraction (0-1) of requests mirrored to the shadow backend (Env: "+EnvPrefix+"SHADOW_SAMPLE_RATE)"),
+		shadowMaxInFlight:     flag.Int("shadow-max-in-flight", cfg.ShadowMaxInFlight, "Mirrored requests in flight at most; more are dropped, 0 for no limit (Env: "+EnvPrefix+"SHADOW_MAX_IN_FLIGHT)"),
+		coalesceRequests:      flag.Bool("coalesce-requests", cfg.CoalesceRequests, "Share one upstream request among concurrent identical GETs (Env: "+EnvPrefix+"COALESCE_REQUESTS)"),
+		coalesceMaxBodySize:   flag.Int64("coalesce-max-body-size", cfg.CoalesceMaxBodySize, "Responses with larger bodies are not shared by coalesced requests (Env: "+EnvPrefix+"COALESCE_MAX_BODY_SIZE)"),
+		maxRetries:            flag.Int("max-retries", cfg.MaxRetries, "Other backends to try when a request could not be delivered, 0 disables retries (Env: "+EnvPrefix+"MAX_RETRIES)"),
+		retryPolicy:           flag.String("retry-policy", cfg.RetryPolicy, "What is retried: none, connect-only (connection failures) or connect-and-status (also retry-on-statuses) (Env: "+EnvPrefix+"RETRY_POLICY)"),
+		retryMaxBodySize:      flag.Int64("retry-max-body-size", cfg.RetryMaxBodySize, "Requests with larger bodies are not retried (Env: "+EnvPrefix+"RETRY_MAX_BODY_SIZE)"),
+		retryOnStatuses:       flag.String("retry-on-statuses", joinInts(cfg.RetryOnStatuses), "Comma-separated backend statuses retried on another backend for idempotent requests, e.g. 502,503,504 (Env: "+EnvPrefix+"RETRY_ON_STATUSES)"),
+		retryBackoff:          flag.Duration("retry-backoff", cfg.RetryBackoff, "Wait before the first retry, doubling for each further one (Env: "+EnvPrefix+"RETRY_BACKOFF)"),
+		retryBudgetTokens:     flag.Int("retry-budget-max-tokens", cfg.RetryBudgetMaxTokens, "Retry budget size; retries stop while at most half is left, 0 for no budget (Env: "+EnvPrefix+"RETRY_BUDGET_MAX_TOKENS)"),
+		retryBudgetRatio:      flag.Float64("retry-budget-token-ratio", cfg.RetryBudgetTokenRatio, "Retry budget tokens regained per successful request; each failure costs one (Env: "+EnvPrefix+"RETRY_BUDGET_TOKEN_RATIO)"),
+		tlsCertFile:           flag.String("tls-cert", cfg.TLSCertFile, "TLS certificate file for the client-facing listener (Env: "+EnvPrefix+"TLS_CERT_FILE)"),
+		tlsKeyFile:            flag.String("tls-key", cfg.TLSKeyFile, "TLS private key file for the client-facing listener (Env: "+EnvPrefix+"TLS_KEY_FILE)"),
+		enableHTTP2:           flag.Bool("http2", cfg.EnableHTTP2, "Negotiate HTTP/2 with TLS clients (Env: "+EnvPrefix+"ENABLE_HTTP2)"),
+		enableH2C:             flag.Bool("h2c", cfg.EnableH2C, "Accept unencrypted HTTP/2 with prior knowledge (Env: "+EnvPrefix+"ENABLE_H2C)"),
+		enableHTTP3:           flag.Bool("http3", cfg.EnableHTTP3, "Also serve HTTP/3 over QUIC on the same port, requires TLS (Env: "+EnvPrefix+"ENABLE_HTTP3)"),
+		hideErrorDetails:      flag.Bool("hide-error-details", cfg.HideErrorDetails, "Omit backend URLs and error details from proxy error responses (Env: "+EnvPrefix+"HIDE_ERROR_DETAILS)"),
+		debugHeaders:          flag.Bool("debug-headers", cfg.DebugHeaders, "Add response headers naming the chosen backend and why it was chosen; not for production (Env: "+EnvPrefix+"DEBUG_HEADERS)"),
+		noBackendStatus:       flag.Int("no-backend-status-code", cfg.NoBackendStatusCode, "Response status when no backend is available, a 5xx such as 503 or 502 (Env: "+EnvPrefix+"NO_BACKEND_STATUS_CODE)"),
+		pausedStatus:          flag.Int("paused-status-code", cfg.PausedStatusCode, "Response status for new requests while paused via /admin/pause, a 4xx or 5xx (Env: "+EnvPrefix+"PAUSED_STATUS_CODE)"),
+		requestIDHeader:       flag.String("request-id-header", cfg.RequestIDHeader, "Header carrying the request ID, generated when absent; empty disables (Env: "+EnvPrefix+"REQUEST_ID_HEADER)"),
+		subsetSize:            flag.Int("subset-size", cfg.SubsetSize, "Number of backends this instance balances over, 0 for all (Env: "+EnvPrefix+"SUBSET_SIZE)"),
+		subsetID:              flag.String("subset-id", cfg.SubsetID, "Instance identity used to pick the backend subset, defaults to the hostname (Env: "+EnvPrefix+"SUBSET_ID)"),
+		localZone:             flag.String("local-zone", cfg.LocalZone, "Zone this instance runs in; backends tagged zone:<zone> are preferred (Env: "+EnvPrefix+"LOCAL_ZONE)"),
+		maxIdleConns:          flag.Int("max-idle-conns-per-backend", cfg.MaxIdleConnsPerBackend, "Idle keep-alive connections kept per backend (Env: "+EnvPrefix+"MAX_IDLE_CONNS_PER_BACKEND)"),
+		maxConns:              flag.Int("max-conns-per-backend", cfg.MaxConnsPerBackend, "Maximum TCP connections per backend, 0 for unlimited (Env: "+EnvPrefix+"MAX_CONNS_PER_BACKEND)"),
+		idleConnTimeout:       flag.Duration("idle-conn-timeout", cfg.IdleConnTimeout, "How long idle backend connections are kept (Env: "+EnvPrefix+"IDLE_CONN_TIMEOUT)"),
+		disableKeepAlives:     flag.Bool("disable-keep-alives", cfg.DisableKeepAlives, "Open a new backend connection for every request (Env: "+EnvPrefix+"DISABLE_KEEP_ALIVES)"),
+		dialTimeout:           flag.Duration("backend-dial-timeout", cfg.BackendDialTimeout, "Timeout for connecting to a backend, 0 for none (Env: "+EnvPrefix+"BACKEND_DIAL_TIMEOUT)"),
+		tlsTimeout:            flag.Duration("backend-tls-handshake-timeout", cfg.BackendTLSHandshakeTimeout, "Timeout for the TLS handshake with https backends, 0 for none (Env: "+EnvPrefix+"BACKEND_TLS_HANDSHAKE_TIMEOUT)"),
+		headerTimeout:         flag.Duration("backend-response-header-timeout", cfg.BackendResponseHeaderTimeout, "Timeout for a backend's response headers once the request is sent, 0 for none (Env: "+EnvPrefix+"BACKEND_RESPONSE_HEADER_TIMEOUT)"),
+		healthMethod:          flag.String("health-method", cfg.HealthCheckMethod, "HTTP method for backend health checks, e.g. GET or HEAD (Env: "+EnvPrefix+"HEALTH_CHECK_METHOD)"),
+		healthStatuses:        flag.String("health-expected-statuses", string(cfg.HealthCheckExpectedStatuses), "Health check status codes counted as healthy, e.g. 200,204 or 2xx (Env: "+EnvPrefix+"HEALTH_CHECK_EXPECTED_STATUSES)"),
+		healthType:            flag.String("health-check-type", cfg.HealthCheckType, "Backend health check protocol: http or grpc (Env: "+EnvPrefix+"HEALTH_CHECK_TYPE)"),
+		healthService:         flag.String("health-check-service", cfg.HealthCheckService, "gRPC service name for grpc health checks, empty for the whole server (Env: "+EnvPrefix+"HEALTH_CHECK_SERVICE)"),
+		capacityHeader:        flag.String("health-check-capacity-header", cfg.HealthCheckCapacityHeader, "Health check response header whose value becomes the backend's weight, e.g. X-Capacity (Env: "+EnvPrefix+"HEALTH_CHECK_CAPACITY_HEADER)"),
+		healthConcurrency:     flag.Int("health-check-concurrency", cfg.HealthCheckConcurrency, "Health checks running at once, 0 for no limit (Env: "+EnvPrefix+"HEALTH_CHECK_CONCURRENCY)"),
+		healthTimeout:         flag.Duration("health-check-timeout", cfg.HealthCheckTimeout, "Health checks taking longer are abandoned and the backend marked down, 0 uses -backend-timeout (Env: "+EnvPrefix+"HEALTH_CHECK_TIMEOUT)"),
+		allowEmptyStart:       flag.Bool("allow-empty-start", cfg.AllowEmptyStart, "Start without configured or reachable backends and serve 503 until some are added (Env: "+EnvPrefix+"ALLOW_EMPTY_START)"),
+		unhealthyInterval:     flag.Duration("unhealthy-check-interval", cfg.UnhealthyCheckInterval, "Health check interval for backends that are down, 0 for the regular interval (Env: "+EnvPrefix+"UNHEALTHY_CHECK_INTERVAL)"),
+		honorRetryAfter:       flag.Bool("honor-backend-retry-after", cfg.HonorBackendRetryAfter, "Skip backends that answer 503 with Retry-After for the requested time (Env: "+EnvPrefix+"HONOR_BACKEND_RETRY_AFTER)"),
+		readTimeout:           flag.Duration("read-timeout", cfg.ReadTimeout, "Maximum time to read a client request including its body, 0 for no limit (Env: "+EnvPrefix+"READ_TIMEOUT)"),
+		readHeaderTimeout:     flag.Duration("read-header-timeout", cfg.ReadHeaderTimeout, "Maximum time to read client request headers, 0 for no limit (Env: "+EnvPrefix+"READ_HEADER_TIMEOUT)"),
+		writeTimeout:          flag.Duration("write-timeout", cfg.WriteTimeout, "Maximum time to write a response, 0 for no limit (Env: "+EnvPrefix+"WRITE_TIMEOUT)"),
+		idleTimeout:           flag.Duration("idle-timeout", cfg.IdleTimeout, "How long idle client keep-alive connections are kept open (Env: "+EnvPrefix+"IDLE_TIMEOUT)"),
+		proxyBufferSize:       flag.Int("proxy-buffer-size", cfg.ProxyBufferSize, "Size in bytes of the pooled buffers used to copy proxied bodies, 0 to allocate per request (Env: "+EnvPrefix+"PROXY_BUFFER_SIZE)"),
+		maxPooledBufferSize:   flag.Int("max-pooled-buffer-size", cfg.MaxPooledBufferSize, "Largest access log capture buffer kept for reuse, 0 to disable pooling (Env: "+EnvPrefix+"MAX_POOLED_BUFFER_SIZE)"),
+		trustedProxies:        flag.String("trusted-proxies", strings.Join(cfg.TrustedProxies, ","), "Comma-separated CIDRs of proxies whose forwarded headers are trusted (Env: "+EnvPrefix+"TRUSTED_PROXIES)"),
+		preShutdownDelay:      flag.Duration("pre-shutdown-delay", cfg.PreShutdownDelay, "How long to keep serving while reporting not ready before draining on shutdown (Env: "+EnvPrefix+"PRE_SHUTDOWN_DELAY)"),
+		backendDNSRefresh:     flag.Duration("backend-dns-refresh-interval", cfg.BackendDNSRefreshInterval, "How often backend host names are re-resolved, 0 to resolve on every new connection (Env: "+EnvPrefix+"BACKEND_DNS_REFRESH_INTERVAL)"),
+		happyEyeballs:         flag.Bool("backend-happy-eyeballs", cfg.BackendHappyEyeballs, "Race connections to the IPv6 and IPv4 addresses of dual-stack backends (Env: "+EnvPrefix+"BACKEND_HAPPY_EYEBALLS)"),
+		fallbackBackend:       flag.String("fallback-backend", cfg.FallbackBackend, "URL to proxy to while no backend is available, e.g. a maintenance page (Env: "+EnvPrefix+"FALLBACK_BACKEND)"),
+		fallbackStaticDir:     flag.String("fallback-static-dir", cfg.FallbackStaticDir, "Directory of static files served while no backend is available (Env: "+EnvPrefix+"FALLBACK_STATIC_DIR)"),
+	}
 }
 
 // applyFlags overwrites cfg fields if the corresponding flag was explicitly set on the command line
-func applyFlags(cfg *Config, flagProxyPort *string, flagBackendServers *string, flagBackendWeights *string, flagHealthPath *string, flagInfoPath *string, flagHealthInterval *time.Duration, flagBackendTimeout *time.Duration, flagConfigFile *string, flagLBAlgo *string, flagEWMAAlpha *float64, flagAccessLogEnabled *bool, flagAccessLogPayloads *bool, flagDebugLevel *bool) {
+func applyFlags(cfg *Config, flags *configFlags) {
 	flag.Visit(func(f *flag.Flag) {
 		switch f.Name {
 		case "port":
-			cfg.ProxyPort = *flagProxyPort
+			cfg.ProxyPort = *flags.proxyPort
 		case "backends":
-			cfg.BackendServers = parseCommaSeparatedString(*flagBackendServers)
+			cfg.BackendServers = parseCommaSeparatedString(*flags.backendServers)
 		case "weights":
-			weights, err := parseCommaSeparatedInts(*flagBackendWeights)
+			weights, err := parseCommaSeparatedInts(*flags.backendWeights)
 			if err == nil {
 				cfg.BackendWeights = weights
 			} else {
-				log.Printf("Warning: Invalid format for flag -weights: %v", err)
+				DefaultLogger().Warn("Invalid format for flag", "flag", "-weights", "error", err)
 			}
 		case "health-path":
-			cfg.HealthCheckPath = *flagHealthPath
+			cfg.HealthCheckPath = *flags.healthPath
 		case "info-path":
-			cfg.InfoPath = *flagInfoPath
+			cfg.InfoPath = *flags.infoPath
 		case "health-interval":
-			cfg.HealthCheckInterval = *flagHealthInterval
+			cfg.HealthCheckInterval = *flags.healthInterval
 		case "backend-timeout":
-			cfg.BackendRequestTimeout = *flagBackendTimeout
+			cfg.BackendRequestTimeout = *flags.backendRequestTimeout
 		case "config":
-			cfg.ConfigFile = *flagConfigFile // Store the used path
+			cfg.ConfigFile = *flags.configFile // Store the used path
 		case "lb-algo":
-			cfg.LoadBalancingAlgorithm = strings.ToLower(*flagLBAlgo)
+			cfg.LoadBalancingAlgorithm = strings.ToLower(*flags.lbAlgo)
 		case "ewma-alpha":
-			cfg.EWMAAlpha = *flagEWMAAlpha
+			cfg.EWMAAlpha = *flags.ewmaAlpha
+		case "max-weight-ratio":
+			cfg.MaxWeightRatio = *flags.maxWeightRatio
+		case "selection-latency-weight":
+			cfg.SelectionLatencyWeight = *flags.latencyWeight
 		case "access-log-enabled":
-			cfg.AccessLogEnabled = *flagAccessLogEnabled
+			cfg.AccessLogEnabled = *flags.accessLogEnabled
 		case "access-log-payloads":
-			cfg.AccessLogPayloads = *flagAccessLogPayloads
+			cfg.AccessLogPayloads = *flags.accessLogPayloads
+		case "access-log-format":
+			cfg.AccessLogFormat = *flags.accessLogFormat
+		case "access-log-file":
+			cfg.AccessLogFile = *flags.accessLogFile
+		case "access-log-syslog":
+			cfg.AccessLogSyslog = *flags.accessLogSyslog
+		case "access-log-syslog-facility":
+			cfg.AccessLogSyslogFacility = *flags.syslogFacility
+		case "access-log-syslog-tag":
+			cfg.AccessLogSyslogTag = *flags.syslogTag
 		case "debug":
-			cfg.DebugLevel = *flagDebugLevel
+			cfg.DebugLevel = *flags.debugLevel
+		case "log-level":
+			cfg.LogLevel = *flags.logLevel
+		case "min-healthy-backends":
+			cfg.MinHealthyBackends = *flags.minHealthyBackends
+		case "min-healthy-fraction":
+			cfg.MinHealthyFraction = *flags.minHealthyFraction
+		case "startup-grace-period":
+			cfg.StartupGracePeriod = *flags.startupGracePeriod
+		case "summary-log-interval":
+			cfg.SummaryLogInterval = *flags.summaryLogInterval
+		case "allowed-methods":
+			cfg.AllowedMethods = parseCommaSeparatedString(*flags.allowedMethods)
+		case "blocked-path-prefixes":
+			cfg.BlockedPathPrefixes = parseCommaSeparatedString(*flags.blockedPaths)
+		case "strict-http":
+			cfg.StrictHTTP = *flags.strictHTTP
+		case "enable-pprof":
+			cfg.EnablePprof = *flags.enablePprof
+		case "strip-response-headers":
+			cfg.StripResponseHeaders = parseCommaSeparatedString(*flags.stripRespHeaders)
+		case "forward-header-allow-list":
+			cfg.ForwardHeaderAllowList = parseCommaSeparatedString(*flags.fwdHeaderAllow)
+		case "forward-header-deny-list":
+			cfg.ForwardHeaderDenyList = parseCommaSeparatedString(*flags.fwdHeaderDeny)
+		case "auth-username":
+			cfg.AuthUsername = *flags.authUsername
+		case "auth-exempt-paths":
+			cfg.AuthExemptPaths = parseCommaSeparatedString(*flags.authExemptPaths)
+		case "cors-allowed-origins":
+			cfg.CORSAllowedOrigins = parseCommaSeparatedString(*flags.corsOrigins)
+		case "compression":
+			cfg.CompressionEnabled = *flags.compression
+		case "compression-min-size":
+			cfg.CompressionMinSize = *flags.compressionMinSize
+		case "decompress-requests":
+			cfg.DecompressRequests = *flags.decompressRequests
+		case "max-decompressed-body-size":
+			cfg.MaxDecompressedBodySize = *flags.maxDecompressed
+		case "outlier-error-rate-threshold":
+			cfg.OutlierErrorRateThreshold = *flags.outlierThreshold
+		case "outlier-window":
+			cfg.OutlierWindow = *flags.outlierWindow
+		case "outlier-min-requests":
+			cfg.OutlierMinRequests = *flags.outlierMinRequests
+		case "outlier-ejection-time":
+			cfg.OutlierEjectionTime = *flags.outlierEjection
+		case "outlier-max-ejection-percent":
+			cfg.OutlierMaxEjectionPercent = *flags.outlierMaxEjection
+		case "max-connections-per-backend":
+			cfg.MaxConnectionsPerBackend = *flags.maxConnections
+		case "max-global-concurrency":
+			cfg.MaxGlobalConcurrency = *flags.globalConcurrency
+		case "queue-timeout":
+			cfg.QueueTimeout = *flags.queueTimeout
+		case "max-queue-length":
+			cfg.MaxQueueLength = *flags.maxQueueLength
+		case "max-wait-for-backend":
+			cfg.MaxWaitForBackend = *flags.maxWaitForBackend
+		case "adaptive-concurrency":
+			cfg.AdaptiveConcurrency = *flags.adaptiveConcurrency
+		case "adaptive-concurrency-initial-limit":
+			cfg.AdaptiveConcurrencyInitialLimit = *flags.adaptiveInitial
+		case "adaptive-concurrency-max-limit":
+			cfg.AdaptiveConcurrencyMaxLimit = *flags.adaptiveMax
+		case "backend-proxy-protocol":
+			cfg.BackendProxyProtocol = strings.ToLower(*flags.backendProxyProto)
+		case "backend-proxy-url":
+			cfg.BackendProxyURL = *flags.backendProxyURL
+		case "accept-proxy-protocol":
+			cfg.AcceptProxyProtocol = *flags.acceptProxyProto
+		case "request-timeout":
+			cfg.RequestTimeout = *flags.requestTimeout
+		case "shadow-backend":
+			cfg.ShadowBackend = *flags.shadowBackend
+		case "shadow-timeout":
+			cfg.ShadowTimeout = *flags.shadowTimeout
+		case "shadow-max-body-size":
+			cfg.ShadowMaxBodySize = *flags.shadowMaxBodySize
+		case "shadow-sample-rate":
+			cfg.ShadowSampleRate = *flags.shadowSampleRate
+		case "shadow-max-in-flight":
+			cfg.ShadowMaxInFlight = *flags.shadowMaxInFlight
+		case "coalesce-requests":
+			cfg.CoalesceRequests = *flags.coalesceRequests
+		case "coalesce-max-body-size":
+			cfg.CoalesceMaxBodySize = *flags.coalesceMaxBodySize
+		case "max-retries":
+			cfg.MaxRetries = *flags.maxRetries
+		case "retry-policy":
+			cfg.RetryPolicy = *flags.retryPolicy
+		case "retry-max-body-size":
+			cfg.RetryMaxBodySize = *flags.retryMaxBodySize
+		case "retry-on-statuses":
+			statuses, err := parseCommaSeparatedInts(*flags.retryOnStatuses)
+			if err == nil {
+				cfg.RetryOnStatuses = statuses
+			} else {
+				DefaultLogger().Warn("Invalid format for flag", "flag", "-retry-on-statuses", "error", err)
+			}
+		case "retry-backoff":
+			cfg.RetryBackoff = *flags.retryBackoff
+		case "retry-budget-max-tokens":
+			cfg.RetryBudgetMaxTokens = *flags.retryBudgetTokens
+		case "retry-budget-token-ratio":
+			cfg.RetryBudgetTokenRatio = *flags.retryBudgetRatio
+		case "tls-cert":
+			cfg.TLSCertFile = *flags.tlsCertFile
+		case "tls-key":
+			cfg.TLSKeyFile = *flags.tlsKeyFile
+		case "http2":
+			cfg.EnableHTTP2 = *flags.enableHTTP2
+		case "h2c":
+			cfg.EnableH2C = *flags.enableH2C
+		case "http3":
+			cfg.EnableHTTP3 = *flags.enableHTTP3
+		case "hide-error-details":
+			cfg.HideErrorDetails = *flags.hideErrorDetails
+		case "debug-headers":
+			cfg.DebugHeaders = *flags.debugHeaders
+		case "no-backend-status-code":
+			cfg.NoBackendStatusCode = *flags.noBackendStatus
+		case "paused-status-code":
+			cfg.PausedStatusCode = *flags.pausedStatus
+		case "request-id-header":
+			cfg.RequestIDHeader = *flags.requestIDHeader
+		case "subset-size":
+			cfg.SubsetSize = *flags.subsetSize
+		case "subset-id":
+			cfg.SubsetID = *flags.subsetID
+		case "local-zone":
+			cfg.LocalZone = *flags.localZone
+		case "max-idle-conns-per-backend":
+			cfg.MaxIdleConnsPerBackend = *flags.maxIdleConns
+		case "max-conns-per-backend":
+			cfg.MaxConnsPerBackend = *flags.maxConns
+		case "idle-conn-timeout":
+			cfg.IdleConnTimeout = *flags.idleConnTimeout
+		case "disable-keep-alives":
+			cfg.DisableKeepAlives = *flags.disableKeepAlives
+		case "backend-dial-timeout":
+			cfg.BackendDialTimeout = *flags.dialTimeout
+		case "backend-tls-handshake-timeout":
+			cfg.BackendTLSHandshakeTimeout = *flags.tlsTimeout
+		case "backend-response-header-timeout":
+			cfg.BackendResponseHeaderTimeout = *flags.headerTimeout
+		case "health-method":
+			cfg.HealthCheckMethod = strings.ToUpper(*flags.healthMethod)
+		case "health-expected-statuses":
+			cfg.HealthCheckExpectedStatuses = StatusCodes(*flags.healthStatuses)
+		case "health-check-type":
+			cfg.HealthCheckType = *flags.healthType
+		case "health-check-service":
+			cfg.HealthCheckService = *flags.healthService
+		case "health-check-capacity-header":
+			cfg.HealthCheckCapacityHeader = *flags.capacityHeader
+		case "health-check-concurrency":
+			cfg.HealthCheckConcurrency = *flags.healthConcurrency
+		case "health-check-timeout":
+			cfg.HealthCheckTimeout = *flags.healthTimeout
+		case "allow-empty-start":
+			cfg.AllowEmptyStart = *flags.allowEmptyStart
+		case "unhealthy-check-interval":
+			cfg.UnhealthyCheckInterval = *flags.unhealthyInterval
+		case "honor-backend-retry-after":
+			cfg.HonorBackendRetryAfter = *flags.honorRetryAfter
+		case "read-timeout":
+			cfg.ReadTimeout = *flags.readTimeout
+		case "read-header-timeout":
+			cfg.ReadHeaderTimeout = *flags.readHeaderTimeout
+		case "write-timeout":
+			cfg.WriteTimeout = *flags.writeTimeout
+		case "idle-timeout":
+			cfg.IdleTimeout = *flags.idleTimeout
+		case "proxy-buffer-size":
+			cfg.ProxyBufferSize = *flags.proxyBufferSize
+		case "max-pooled-buffer-size":
+			cfg.MaxPooledBufferSize = *flags.maxPooledBufferSize
+		case "trusted-proxies":
+			cfg.TrustedProxies = parseCommaSeparatedString(*flags.trustedProxies)
+		case "pre-shutdown-delay":
+			cfg.PreShutdownDelay = *flags.preShutdownDelay
+		case "backend-dns-refresh-interval":
+			cfg.BackendDNSRefreshInterval = *flags.backendDNSRefresh
+		case "backend-happy-eyeballs":
+			cfg.BackendHappyEyeballs = *flags.happyEyeballs
+		case "fallback-backend":
+			cfg.FallbackBackend = *flags.fallbackBackend
+		case "fallback-static-dir":
+			cfg.FallbackStaticDir = *flags.fallbackStaticDir
 		}
 	})
 }
 
+// --- Env Helpers ---
+// Each helper overwrites dst when the prefixed env var is set, warning (and keeping dst) on invalid values.
+
+func envString(name string, dst *string) {
+	if value := os.Getenv(EnvPrefix + name); value != "" {
+		*dst = value
+	}
+}
+
+func envStrings(name string, dst *[]string) {
+	if value := os.Getenv(EnvPrefix + name); value != "" {
+		*dst = parseCommaSeparatedString(value)
+	}
+}
+
+// envHeaders reads headers as a comma-separated list of "Name: value" pairs
+func envHeaders(name string, dst *map[string]string) {
+	if value := os.Getenv(EnvPrefix + name); value != "" {
+		headers := make(map[string]string)
+		for _, pair := range parseCommaSeparatedString(value) {
+			key, val, ok := strings.Cut(pair, ":")
+			if !ok || strings.TrimSpace(key) == "" {
+				DefaultLogger().Warn("Invalid format for env var", "var", EnvPrefix+name, "error", fmt.Sprintf("expected Name: value, got %q", pair))
+				return
+			}
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+		*dst = headers
+	}
+}
+
+func envInts(name string, dst *[]int) {
+	if value := os.Getenv(EnvPrefix + name); value != "" {
+		if ints, err := parseCommaSeparatedInts(value); err == nil {
+			*dst = ints
+		} else {
+			DefaultLogger().Warn("Invalid format for env var", "var", EnvPrefix+name, "error", err)
+		}
+	}
+}
+
+func envBool(name string, dst *bool) {
+	if value := os.Getenv(EnvPrefix + name); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			*dst = b
+		} else {
+			DefaultLogger().Warn("Invalid format for env var", "var", EnvPrefix+name, "error", err)
+		}
+	}
+}
+
+func envInt(name string, dst *int) {
+	if value := os.Getenv(EnvPrefix + name); value != "" {
+		if i, err := strconv.Atoi(value); err == nil {
+			*dst = i
+		} else {
+			DefaultLogger().Warn("Invalid format for env var", "var", EnvPrefix+name, "error", err)
+		}
+	}
+}
+
+func envInt64(name string, dst *int64) {
+	if value := os.Getenv(EnvPrefix + name); value != "" {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			*dst = i
+		} else {
+			DefaultLogger().Warn("Invalid format for env var", "var", EnvPrefix+name, "error", err)
+		}
+	}
+}
+
+func envFloat(name string, dst *float64) {
+	if value := os.Getenv(EnvPrefix + name); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			*dst = f
+		} else {
+			DefaultLogger().Warn("Invalid format for env var", "var", EnvPrefix+name, "error", err)
+		}
+	}
+}
+
+func envDuration(name string, dst *time.Duration) {
+	if value := os.Getenv(EnvPrefix + name); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			*dst = d
+		} else {
+			DefaultLogger().Warn("Invalid format for env var", "var", EnvPrefix+name, "error", err)
+		}
+	}
+}
+
 // --- Helper Functions ---
 
 func parseCommaSeparatedString(s string) []string {
@@ -272,3 +1677,12 @@ func parseCommaSeparatedInts(s string) ([]int, error) {
 	}
 	return ints, nil
 }
+
+// joinInts formats ints as a comma-separated list, the inverse of parseCommaSeparatedInts
+func joinInts(ints []int) string {
+	parts := make([]string, len(ints))
+	for i, n := range ints {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
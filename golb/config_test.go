@@ -0,0 +1,297 @@
+package golb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a file with the given name in a temp dir and returns its path
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigFromFileFormats(t *testing.T) {
+	expected := DefaultConfig()
+	expected.ProxyPort = ":9090"
+	expected.BackendServers = []string{"http://a:1", "http://b:2"}
+	expected.BackendWeights = []int{3, 1}
+	expected.HealthCheckPath = "/healthz"
+	expected.InfoPath = "/about"
+	expected.HealthCheckInterval = 15 * time.Second
+	expected.BackendRequestTimeout = 3 * time.Second
+	expected.LoadBalancingAlgorithm = "weighted-round-robin"
+	expected.EWMAAlpha = 0.3
+	expected.AccessLogEnabled = true
+	expected.DebugLevel = true
+	expected.LogLevel = "warn"
+
+	files := map[string]string{
+		"golb.yaml": `
+proxyPort: ":9090"
+backendServers:
+  - http://a:1
+  - http://b:2
+backendWeights: [3, 1]
+healthCheckPath: /healthz
+infoPath: /about
+healthCheckInterval: 15s
+backendRequestTimeout: 3s
+loadBalancingAlgorithm: weighted-round-robin
+ewmaAlpha: 0.3
+accessLogEnabled: true
+debugLevel: true
+logLevel: warn
+`,
+		"golb.json": `{
+	"proxyPort": ":9090",
+	"backendServers": ["http://a:1", "http://b:2"],
+	"backendWeights": [3, 1],
+	"healthCheckPath": "/healthz",
+	"infoPath": "/about",
+	"healthCheckInterval": "15s",
+	"backendRequestTimeout": 3000000000,
+	"loadBalancingAlgorithm": "weighted-round-robin",
+	"ewmaAlpha": 0.3,
+	"accessLogEnabled": true,
+	"debugLevel": true,
+	"logLevel": "warn"
+}`,
+		"golb.toml": `
+proxyPort = ":9090"
+backendServers = ["http://a:1", "http://b:2"]
+backendWeights = [3, 1]
+healthCheckPath = "/healthz"
+infoPath = "/about"
+healthCheckInterval = "15s"
+backendRequestTimeout = "3s"
+loadBalancingAlgorithm = "weighted-round-robin"
+ewmaAlpha = 0.3
+accessLogEnabled = true
+debugLevel = true
+logLevel = "warn"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfigFile(t, name, content)
+			cfg := DefaultConfig()
+			if err := loadConfigFromFile(path, cfg); err != nil {
+				t.Fatalf("loadConfigFromFile returned error: %v", err)
+			}
+			if !reflect.DeepEqual(cfg, expected) {
+				t.Errorf("Config mismatch for %s:\n got: %+v\nwant: %+v", name, cfg, expected)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromFileKeepsDefaults(t *testing.T) {
+	path := writeConfigFile(t, "partial.json", `{"proxyPort": ":7000"}`)
+	cfg := DefaultConfig()
+	if err := loadConfigFromFile(path, cfg); err != nil {
+		t.Fatalf("loadConfigFromFile returned error: %v", err)
+	}
+	if cfg.ProxyPort != ":7000" {
+		t.Errorf("Expected proxy port :7000, got %s", cfg.ProxyPort)
+	}
+	if cfg.HealthCheckInterval != DefaultConfig().HealthCheckInterval {
+		t.Errorf("Expected default health check interval to be kept, got %v", cfg.HealthCheckInterval)
+	}
+}
+
+func TestLoadConfigFromFileUnknownExtension(t *testing.T) {
+	path := writeConfigFile(t, "golb.ini", "proxyPort=:9090")
+	err := loadConfigFromFile(path, DefaultConfig())
+	if err == nil {
+		t.Fatal("Expected error for unknown config file extension")
+	}
+	if !strings.Contains(err.Error(), ".ini") {
+		t.Errorf("Expected error to mention the extension, got: %v", err)
+	}
+}
+
+func TestLoadConfigFromFileExpandsEnv(t *testing.T) {
+	t.Setenv("GOLB_TEST_PORT", ":9191")
+	t.Setenv("GOLB_TEST_HOST", "backend.internal")
+
+	path := writeConfigFile(t, "env.yaml", `
+proxyPort: ${GOLB_TEST_PORT}
+backendServers:
+  - http://$GOLB_TEST_HOST:8080
+healthCheckPath: /health$$check
+infoPath: ${GOLB_TEST_UNDEFINED:-/info}
+healthCheckService: ${GOLB_TEST_PORT:-unused}
+`)
+	cfg := DefaultConfig()
+	if err := loadConfigFromFile(path, cfg); err != nil {
+		t.Fatalf("loadConfigFromFile returned error: %v", err)
+	}
+
+	if cfg.ProxyPort != ":9191" {
+		t.Errorf("Expected ${VAR} to expand to :9191, got %q", cfg.ProxyPort)
+	}
+	if len(cfg.BackendServers) != 1 || cfg.BackendServers[0] != "http://backend.internal:8080" {
+		t.Errorf("Expected $VAR to expand in backend URL, got %v", cfg.BackendServers)
+	}
+	if cfg.HealthCheckPath != "/health$check" {
+		t.Errorf("Expected $$ to yield a literal $, got %q", cfg.HealthCheckPath)
+	}
+	if cfg.InfoPath != "/info" {
+		t.Errorf("Expected the default of an undefined variable, got %q", cfg.InfoPath)
+	}
+	if cfg.HealthCheckService != ":9191" {
+		t.Errorf("Expected a defined variable to win over its default, got %q", cfg.HealthCheckService)
+	}
+}
+
+func TestLoadConfigFromFileRequireAllEnv(t *testing.T) {
+	t.Setenv("GOLB_TEST_PORT", ":9191")
+
+	// Both reference forms follow the same rule
+	path := writeConfigFile(t, "env.yaml", `
+proxyPort: ${GOLB_TEST_PORT}
+infoPath: "${GOLB_TEST_UNDEFINED}"
+healthCheckService: svc$GOLB_TEST_MISSING
+`)
+	cfg := DefaultConfig()
+	err := loadConfigFromFile(path, cfg)
+	if err == nil {
+		t.Fatal("Expected error for undefined variables by default")
+	}
+	for _, name := range []string{"GOLB_TEST_UNDEFINED", "GOLB_TEST_MISSING"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected error to name the undefined variable %s, got: %v", name, err)
+		}
+	}
+
+	cfg = DefaultConfig()
+	cfg.RequireAllEnv = false
+	if err := loadConfigFromFile(path, cfg); err != nil {
+		t.Fatalf("Unexpected error with RequireAllEnv off: %v", err)
+	}
+	if cfg.InfoPath != "" || cfg.HealthCheckService != "svc" {
+		t.Errorf("Expected undefined ${VAR} and $VAR to expand to empty strings, got %q and %q", cfg.InfoPath, cfg.HealthCheckService)
+	}
+
+	// Escapes are not variable references and must not trip the strict check
+	path = writeConfigFile(t, "escaped.yaml", `healthCheckPath: /cost$$5`)
+	cfg = DefaultConfig()
+	if err := loadConfigFromFile(path, cfg); err != nil {
+		t.Fatalf("Unexpected error for escaped $: %v", err)
+	}
+	if cfg.HealthCheckPath != "/cost$5" {
+		t.Errorf("Expected /cost$5, got %q", cfg.HealthCheckPath)
+	}
+}
+
+func TestLoadConfigFromFileKeepsLiteralDollars(t *testing.T) {
+	const hash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+	path := writeConfigFile(t, "literal.yaml", `
+authPasswordHash: "`+strings.ReplaceAll(hash, "$", "$$")+`"
+requestTemplate:
+  X-Original-Path: "{{$$p := .Path}}{{$$p}}"
+routes:
+  - pathPrefix: /api
+    backends: ["http://a:1"]
+    pathRewrite:
+      pattern: "^/api/(.*)$"
+      replacement: "/v2/$1"
+`)
+	for _, requireAll := range []bool{false, true} {
+		cfg := DefaultConfig()
+		cfg.RequireAllEnv = requireAll
+		if err := loadConfigFromFile(path, cfg); err != nil {
+			t.Fatalf("loadConfigFromFile returned error: %v", err)
+		}
+		if cfg.AuthPasswordHash != hash {
+			t.Errorf("Expected the escaped bcrypt hash to be kept, got %q", cfg.AuthPasswordHash)
+		}
+		if got := cfg.RequestTemplate["X-Original-Path"]; got != "{{$p := .Path}}{{$p}}" {
+			t.Errorf("Expected escaped template variables to be kept, got %q", got)
+		}
+		if len(cfg.Routes) != 1 || cfg.Routes[0].PathRewrite == nil || cfg.Routes[0].PathRewrite.Replacement != "/v2/$1" {
+			t.Errorf("Expected the $1 rewrite reference to be kept, got %+v", cfg.Routes)
+		}
+	}
+
+	// An unescaped hash reads as variable references rather than silently losing them
+	path = writeConfigFile(t, "unescaped.yaml", `authPasswordHash: "`+hash+`"`)
+	if err := loadConfigFromFile(path, DefaultConfig()); err == nil || !strings.Contains(err.Error(), "N9qo8") {
+		t.Errorf("Expected an unescaped bcrypt hash to be reported as an undefined variable, got: %v", err)
+	}
+}
+
+func TestLoadConfigExpectedStatusesList(t *testing.T) {
+	files := map[string]string{
+		"list.yaml":   "healthCheckExpectedStatuses: [200, 204, 3xx]\n",
+		"string.yaml": "healthCheckExpectedStatuses: \"200,204,3xx\"\n",
+		"list.json":   `{"healthCheckExpectedStatuses": [200, 204, "3xx"]}`,
+		"string.json": `{"healthCheckExpectedStatuses": "200,204,3xx"}`,
+		"list.toml":   `healthCheckExpectedStatuses = [200, 204, "3xx"]`,
+		"string.toml": `healthCheckExpectedStatuses = "200,204,3xx"`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if err := loadConfigFromFile(writeConfigFile(t, name, content), cfg); err != nil {
+				t.Fatalf("loadConfigFromFile returned error: %v", err)
+			}
+			if cfg.HealthCheckExpectedStatuses != "200,204,3xx" {
+				t.Errorf("Expected the statuses 200,204,3xx, got %q", cfg.HealthCheckExpectedStatuses)
+			}
+			if err := validateConfig(cfg); err != nil {
+				t.Fatalf("Unexpected validation error: %v", err)
+			}
+			if !cfg.expectedStatuses.contains(204) || !cfg.expectedStatuses.contains(301) || cfg.expectedStatuses.contains(500) {
+				t.Errorf("Unexpected parsed statuses %v", cfg.expectedStatuses)
+			}
+		})
+	}
+
+	cfg := DefaultConfig()
+	cfg.HealthCheckExpectedStatuses = "2xx,oops"
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected an invalid status spec to fail validation")
+	}
+}
+
+func TestValidateConfigBackendURLs(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BackendServers = []string{"http://a:8080", "localhost:8080", "https://b", "ftp://files.example.com", "http://", "http://c:8080/base"}
+	err := validateConfig(cfg)
+	if err == nil {
+		t.Fatal("Expected invalid backend URLs to fail validation")
+	}
+	for _, bad := range []string{`"localhost:8080"`, `"ftp://files.example.com"`, `"http://" (no host)`} {
+		if !strings.Contains(err.Error(), bad) {
+			t.Errorf("Expected the error to list %s, got: %v", bad, err)
+		}
+	}
+	for _, good := range []string{"http://a:8080", "https://b", "http://c:8080/base"} {
+		if strings.Contains(err.Error(), `"`+good+`"`) {
+			t.Errorf("Expected the error not to list valid backend %s, got: %v", good, err)
+		}
+	}
+
+	cfg = DefaultConfig()
+	cfg.BackendServers = []string{"http://a:8080", "https://b"}
+	if err := validateConfig(cfg); err != nil {
+		t.Errorf("Expected valid backend URLs to pass, got: %v", err)
+	}
+
+	// Route backends are checked too
+	cfg.Routes = []RouteConfig{{PathPrefix: "/api", Backends: []string{"http://api:8080", "api-2:8080"}}}
+	if err := validateConfig(cfg); err == nil || !strings.Contains(err.Error(), `"api-2:8080"`) {
+		t.Errorf("Expected the route's invalid backend to be listed, got: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package golb
+
+import (
+	"net/url"
+	"sync/atomic"
+)
+
+// BackendCounters are lifetime totals for a backend since the process started
+type BackendCounters struct {
+	Requests     int64 `json:"requests"` // Requests routed to the backend
+	Responses2xx int64 `json:"responses2xx"`
+	Responses3xx int64 `json:"responses3xx"`
+	Responses4xx int64 `json:"responses4xx"`
+	Responses5xx int64 `json:"responses5xx"` // Including 502/504 answered by the proxy on errors
+	ProxyErrors  int64 `json:"proxyErrors"`  // Backend unreachable, timed out or failed mid-response
+	BytesProxied int64 `json:"bytesProxied"` // Response body bytes sent to clients
+
+	ClientDisconnects int64 `json:"clientDisconnects"` // Requests abandoned by the client before the backend answered (499)
+}
+
+// backendCounters holds the lock-free counters behind BackendCounters
+type backendCounters struct {
+	requests     atomic.Int64
+	responses    [4]atomic.Int64 // 2xx, 3xx, 4xx, 5xx
+	proxyErrors  atomic.Int64
+	bytesProxied atomic.Int64
+
+	clientDisconnects atomic.Int64
+}
+
+// recordResponse counts a completed response by status class, with its body size
+func (c *backendCounters) recordResponse(status, bytes int) {
+	if class := status/100 - 2; class >= 0 && class < len(c.responses) {
+		c.responses[class].Add(1)
+	}
+	c.bytesProxied.Add(int64(bytes))
+}
+
+// Counters returns a snapshot of the backend's lifetime counters
+func (b *Backend) Counters() BackendCounters {
+	return BackendCounters{
+		Requests:     b.counters.requests.Load(),
+		Responses2xx: b.counters.responses[0].Load(),
+		Responses3xx: b.counters.responses[1].Load(),
+		Responses4xx: b.counters.responses[2].Load(),
+		Responses5xx: b.counters.responses[3].Load(),
+		ProxyErrors:  b.counters.proxyErrors.Load(),
+		BytesProxied: b.counters.bytesProxied.Load(),
+
+		ClientDisconnects: b.counters.clientDisconnects.Load(),
+	}
+}
+
+// recordProxyError counts a proxy error against the pool's backend at backendURL
+func (s *ServerPool) recordProxyError(backendURL *url.URL) {
+	if b := s.backendByURL(backendURL); b != nil {
+		b.counters.proxyErrors.Add(1)
+	}
+}
+
+// recordClientDisconnect counts a request to the pool's backend at backendURL that the
+// client gave up on
+func (s *ServerPool) recordClientDisconnect(backendURL *url.URL) {
+	if b := s.backendByURL(backendURL); b != nil {
+		b.counters.clientDisconnects.Add(1)
+	}
+}
+
+// backendByURL returns the pool's backend at backendURL, or nil if it has none
+func (s *ServerPool) backendByURL(backendURL *url.URL) *Backend {
+	target := backendURL.String()
+	for _, b := range s.snapshotBackends() {
+		if b.URL.String() == target {
+			return b
+		}
+	}
+	return nil
+}
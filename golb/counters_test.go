@@ -0,0 +1,77 @@
+package golb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBackendCounters(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		case "/broken":
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close() // No response at all: a proxy error
+		default:
+			_, _ = w.Write([]byte("hello"))
+		}
+	})
+	cfg := DefaultConfig()
+	logger := &captureLogger{}
+	proxy := newAccessLoggedProxy(t, cfg, backend, logger)
+	b := proxy.Pool().backends[0]
+
+	paths := []string{"/ok", "/ok", "/ok", "/missing", "/moved", "/fail", "/broken"} // Broken last: it marks the backend down
+	for _, path := range paths {
+		proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	got := b.Counters()
+	want := BackendCounters{
+		Requests:     7,
+		Responses2xx: 3,
+		Responses3xx: 1,
+		Responses4xx: 1,
+		Responses5xx: 2, // The 500 and the proxy's 502
+		ProxyErrors:  1,
+	}
+	want.BytesProxied = got.BytesProxied // Checked separately: redirect and error bodies vary
+	if got != want {
+		t.Errorf("Counters = %+v, want %+v", got, want)
+	}
+	if got.BytesProxied < int64(3*len("hello")) {
+		t.Errorf("Expected at least the successful bodies to be counted, got %d bytes", got.BytesProxied)
+	}
+
+	// Exposed in /status and /metrics
+	rr := httptest.NewRecorder()
+	StatusHandler(rr, httptest.NewRequest("GET", "/status", nil), proxy.Pool(), cfg)
+	var statuses []BackendStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Counters != got {
+		t.Errorf("Expected /status to report %+v, got %+v", got, statuses)
+	}
+	rr = httptest.NewRecorder()
+	MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil), proxy.Pool())
+	label := `{backend="` + b.URL.String() + `"`
+	for _, line := range []string{
+		"golb_backend_requests_total" + label + "} 7",
+		"golb_backend_responses_total" + label + `,code="2xx"} 3`,
+		"golb_backend_responses_total" + label + `,code="5xx"} 2`,
+		"golb_backend_proxy_errors_total" + label + "} 1",
+	} {
+		if !strings.Contains(rr.Body.String(), line) {
+			t.Errorf("Expected /metrics to contain %q", line)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package golb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// cutoverWeightScale multiplies weights during a cutover, so backends of weight 1 can still
+// be ramped in 1% steps
+const cutoverWeightScale = 100
+
+// minCutoverStep is the shortest interval between weight adjustments of a cutover
+const minCutoverStep = 10 * time.Millisecond
+
+// CutoverStatus describes the progress of a blue/green cutover, see BeginCutover
+type CutoverStatus struct {
+	From     string        `json:"from"` // Tag of the group traffic moves away from
+	To       string        `json:"to"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"durationNanoSec"`
+	Progress float64       `json:"progress"` // Share of traffic moved so far, 0 to 1
+}
+
+// BeginCutover gradually moves traffic from the backends tagged fromTag to those tagged
+// toTag over d: their weights ramp linearly from 100/0 to 0/100 (relative to each backend's
+// own weight, at least 1), adjusted every d/100. At the end the from group keeps weight 0
+// and the to group its original weight. Weights only steer weighted balancers such as
+// weighted-round-robin. Progress is reported by Cutover and /status.
+func (s *ServerPool) BeginCutover(fromTag, toTag string, d time.Duration) error {
+	if d <= 0 || fromTag == toTag {
+		return errors.New("cutover needs two different tags and a positive duration")
+	}
+	base := make(map[*Backend]int)
+	var from, to int
+	for _, b := range s.snapshotBackends() {
+		base[b] = b.GetWeight()
+		switch {
+		case b.HasTag(fromTag):
+			from++
+			base[b] = max(base[b], 1)
+		case b.HasTag(toTag):
+			to++
+			base[b] = max(base[b], 1)
+		}
+	}
+	if from == 0 || to == 0 {
+		return fmt.Errorf("cutover needs backends tagged %q and %q, found %d and %d", fromTag, toTag, from, to)
+	}
+
+	s.cutoverMu.Lock()
+	if s.cutover != nil && s.cutover.Progress < 1 {
+		s.cutoverMu.Unlock()
+		return errors.New("a cutover is already in progress")
+	}
+	status := &CutoverStatus{From: fromTag, To: toTag, Started: s.clock.Now(), Duration: d}
+	s.cutover = status
+	s.cutoverMu.Unlock()
+
+	s.applyCutover(status, base, 0)
+	s.logger.Info("Cutover started", "from", fromTag, "to", toTag, "backends", from+to, "duration", d)
+	go func() {
+		ticker := s.clock.NewTicker(max(d/cutoverWeightScale, minCutoverStep))
+		defer ticker.Stop()
+		for range ticker.C() {
+			progress := min(1, float64(s.clock.Now().Sub(status.Started))/float64(d))
+			s.applyCutover(status, base, progress)
+			if progress == 1 {
+				s.logger.Info("Cutover complete", "from", fromTag, "to", toTag)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// applyCutover sets the weights of every backend in base for the given progress and records it
+func (s *ServerPool) applyCutover(status *CutoverStatus, base map[*Backend]int, progress float64) {
+	for b, weight := range base {
+		b.cutoverWeight.Store(progress < 1 || b.HasTag(status.From)) // Drained backends stay drained
+		switch {
+		case progress == 1 && b.HasTag(status.From):
+			b.SetWeight(0)
+		case progress == 1:
+			b.SetWeight(weight) // Back to the configured scale
+		case b.HasTag(status.From):
+			b.SetWeight(int(math.Round(float64(weight*cutoverWeightScale) * (1 - progress))))
+		case b.HasTag(status.To):
+			b.SetWeight(int(math.Round(float64(weight*cutoverWeightScale) * progress)))
+		default:
+			b.SetWeight(weight * cutoverWeightScale) // Bystanders keep their share
+		}
+	}
+	s.cutoverMu.Lock()
+	status.Progress = progress
+	s.cutoverMu.Unlock()
+}
+
+// Cutover returns the progress of the most recent cutover, if any was started
+func (s *ServerPool) Cutover() (CutoverStatus, bool) {
+	s.cutoverMu.Lock()
+	defer s.cutoverMu.Unlock()
+	if s.cutover == nil {
+		return CutoverStatus{}, false
+	}
+	return *s.cutover, true
+}
@@ -0,0 +1,82 @@
+package golb
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCutoverRampsTraffic(t *testing.T) {
+	pool := newLargePool(t, NewWeightedRoundRobinBalancer(), 3)
+	pool.SetLogger(&captureLogger{})
+	clock := newFakeClock()
+	pool.SetClock(clock)
+	blue, green, other := pool.backends[0], pool.backends[1], pool.backends[2]
+	blue.SetTags("blue")
+	green.SetTags("green")
+
+	if err := pool.BeginCutover("blue", "purple", time.Minute); err == nil {
+		t.Fatalf("Expected a cutover to an empty group to be rejected")
+	}
+	if err := pool.BeginCutover("blue", "green", 100*time.Second); err != nil {
+		t.Fatalf("Failed to begin cutover: %v", err)
+	}
+	if err := pool.BeginCutover("blue", "green", time.Minute); err == nil {
+		t.Fatalf("Expected a second cutover to be rejected while one is in progress")
+	}
+
+	// share returns the fraction of 200 selections that went to b
+	share := func(b *Backend) float64 {
+		n := 0
+		for range 200 {
+			if pool.SelectBackend() == b {
+				n++
+			}
+		}
+		return float64(n) / 200
+	}
+	// advanceTo moves the clock and waits for the cutover to catch up
+	advanceTo := func(progress float64, d time.Duration) {
+		t.Helper()
+		clock.BlockUntil(1)
+		clock.Advance(d)
+		deadline := time.Now().Add(time.Second)
+		for status, _ := pool.Cutover(); status.Progress != progress; status, _ = pool.Cutover() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected cutover progress %v, got %v", progress, status.Progress)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if s := share(green); s != 0 || share(other) != 0.5 {
+		t.Errorf("Expected no traffic on green at the start, got %v", s)
+	}
+	advanceTo(0.25, 25*time.Second)
+	if s := share(green); s < 0.1 || s > 0.15 { // A quarter of the blue/green half
+		t.Errorf("Expected about 12.5%% of traffic on green a quarter in, got %v", s)
+	}
+	advanceTo(0.75, 50*time.Second)
+	if s := share(blue); s < 0.1 || s > 0.15 {
+		t.Errorf("Expected about 12.5%% of traffic left on blue three quarters in, got %v", s)
+	}
+
+	rr := httptest.NewRecorder()
+	StatusHandler(rr, httptest.NewRequest("GET", "/status", nil), pool, DefaultConfig())
+	var statuses []BackendStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if statuses[0].Cutover == nil || statuses[0].Cutover.Progress != 0.75 || statuses[2].Cutover != nil {
+		t.Errorf("Expected cutover progress on the blue and green backends only, got %+v", statuses)
+	}
+
+	advanceTo(1, 25*time.Second)
+	if blue.GetWeight() != 0 || green.GetWeight() != 1 || other.GetWeight() != 1 {
+		t.Errorf("Expected final weights 0/1/1, got %d/%d/%d", blue.GetWeight(), green.GetWeight(), other.GetWeight())
+	}
+	if s := share(blue); s != 0 {
+		t.Errorf("Expected no traffic on blue after the cutover, got %v", s)
+	}
+}
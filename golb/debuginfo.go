@@ -0,0 +1,76 @@
+package golb
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// processStart is when the load balancer started, for the uptime in DebugInfo
+var processStart = time.Now()
+
+// DebugInfo describes the load balancer process itself, served by DebugInfoHandler; backend
+// info is in BackendStatus
+type DebugInfo struct {
+	Version       string        `json:"version"` // Main module version, "(devel)" for local builds
+	GoVersion     string        `json:"goVersion"`
+	Revision      string        `json:"revision,omitempty"` // VCS revision the binary was built from, if stamped
+	Started       time.Time     `json:"started"`
+	UptimeSeconds float64       `json:"uptimeSeconds"`
+	Goroutines    int           `json:"goroutines"`
+	Memory        DebugMemStats `json:"memory"`
+	Algorithm     string        `json:"algorithm"`
+	Backends      int           `json:"backends"`
+	Healthy       int           `json:"healthy"`
+}
+
+// DebugMemStats is a subset of runtime.MemStats
+type DebugMemStats struct {
+	HeapAllocBytes uint64 `json:"heapAllocBytes"`
+	HeapInuseBytes uint64 `json:"heapInuseBytes"`
+	SysBytes       uint64 `json:"sysBytes"`
+	NumGC          uint32 `json:"numGC"`
+}
+
+// debugInfo collects the DebugInfo for pool and cfg
+func debugInfo(pool *ServerPool, cfg *Config) DebugInfo {
+	info := DebugInfo{
+		Version:       "unknown",
+		GoVersion:     runtime.Version(),
+		Started:       processStart,
+		UptimeSeconds: time.Since(processStart).Seconds(),
+		Goroutines:    runtime.NumGoroutine(),
+		Algorithm:     cfg.LoadBalancingAlgorithm,
+		Backends:      pool.Size(),
+		Healthy:       pool.AliveCount(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.Version = build.Main.Version
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Revision = setting.Value
+			}
+		}
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	info.Memory = DebugMemStats{HeapAllocBytes: mem.HeapAlloc, HeapInuseBytes: mem.HeapInuse, SysBytes: mem.Sys, NumGC: mem.NumGC}
+	return info
+}
+
+// DebugInfoHandler returns the load balancer's build version, Go version, uptime, goroutine
+// count and memory statistics as JSON, along with the balancing algorithm and backend count.
+// It requires the admin token: reading memory statistics briefly stops the world, and a
+// public path would shadow the backends' own /debug/info.
+func DebugInfoHandler(w http.ResponseWriter, r *http.Request, pool *ServerPool, cfg *Config) {
+	if !requireAdmin(w, r, cfg) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(debugInfo(pool, cfg))
+}
@@ -0,0 +1,58 @@
+package golb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestDebugInfoHandler(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	cfg := DefaultConfig()
+	cfg.LoadBalancingAlgorithm = "least-connections"
+
+	// Admin only: hidden without a token, refused with a wrong one
+	for _, tc := range []struct {
+		token, sent string
+		want        int
+	}{
+		{"", "", http.StatusNotFound},
+		{"secret", "wrong", http.StatusUnauthorized},
+	} {
+		cfg.AdminToken = tc.token
+		req := httptest.NewRequest("GET", "/debug/info", nil)
+		req.Header.Set(AdminTokenHeader, tc.sent)
+		rr := httptest.NewRecorder()
+		DebugInfoHandler(rr, req, pool, cfg)
+		if rr.Code != tc.want {
+			t.Errorf("Expected %d with admin token %q and %q sent, got %d", tc.want, tc.token, tc.sent, rr.Code)
+		}
+	}
+
+	cfg.AdminToken = "secret"
+	req := httptest.NewRequest("GET", "/debug/info", nil)
+	req.Header.Set(AdminTokenHeader, "secret")
+	rr := httptest.NewRecorder()
+	DebugInfoHandler(rr, req, pool, cfg)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected a JSON 200, got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var info DebugInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Failed to decode debug info: %v", err)
+	}
+	if info.Version == "" || info.GoVersion != runtime.Version() {
+		t.Errorf("Expected the build and Go versions, got %q and %q", info.Version, info.GoVersion)
+	}
+	if info.UptimeSeconds <= 0 || info.Started.IsZero() {
+		t.Errorf("Expected a positive uptime, got %v since %v", info.UptimeSeconds, info.Started)
+	}
+	if info.Goroutines <= 0 || info.Memory.SysBytes == 0 {
+		t.Errorf("Expected runtime stats, got %d goroutines and %+v", info.Goroutines, info.Memory)
+	}
+	if info.Algorithm != "least-connections" || info.Backends != 1 || info.Healthy != 1 {
+		t.Errorf("Expected the algorithm and backend counts, got %q, %d and %d", info.Algorithm, info.Backends, info.Healthy)
+	}
+}
@@ -0,0 +1,154 @@
+package golb
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// hostResolver looks up the addresses of a host name; *net.Resolver implements it
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// dnsDialer resolves backend host names itself, caching the answer for refreshInterval,
+// so a backend whose address changes is reached at its new address without a restart.
+// Once a host has been dialed, a background loop re-resolves it every refreshInterval and
+// calls onChange (closing idle keep-alive connections) when its addresses change, since
+// those connections would otherwise keep going to the old address.
+type dnsDialer struct {
+	dial            func(ctx context.Context, network, addr string) (net.Conn, error)
+	resolver        hostResolver
+	refreshInterval time.Duration
+	onChange        func()
+	logger          Logger
+	happyEyeballs   time.Duration // Races the addresses with this delay, see dialHappyEyeballs; 0 tries them in turn
+
+	mu        sync.Mutex
+	hosts     map[string]dnsEntry
+	startLoop sync.Once
+}
+
+// dnsEntry is a cached resolution
+type dnsEntry struct {
+	addrs    []string
+	resolved time.Time
+}
+
+func newDNSDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error), resolver hostResolver, refreshInterval time.Duration, onChange func()) *dnsDialer {
+	return &dnsDialer{
+		dial:            dial,
+		resolver:        resolver,
+		refreshInterval: refreshInterval,
+		onChange:        onChange,
+		logger:          DefaultLogger(),
+		hosts:           make(map[string]dnsEntry),
+	}
+}
+
+// DialContext dials addr ("host:port"), trying each resolved address of host in turn.
+// IP addresses are dialed as is.
+func (d *dnsDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dial(ctx, network, addr)
+	}
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	d.startLoop.Do(func() { go d.refreshLoop() })
+	if d.happyEyeballs > 0 {
+		return dialHappyEyeballs(ctx, d.dial, network, addrs, port, d.happyEyeballs)
+	}
+
+	var lastErr error
+	for _, ip := range addrs {
+		conn, err := d.dial(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// lookup returns the cached addresses of host, resolving again once they are older than
+// the refresh interval
+func (d *dnsDialer) lookup(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	entry, ok := d.hosts[host]
+	d.mu.Unlock()
+	if ok && time.Since(entry.resolved) < d.refreshInterval {
+		return entry.addrs, nil
+	}
+	addrs, _, err := d.resolve(ctx, host)
+	if err != nil && ok {
+		return entry.addrs, nil // Stale beats nothing while DNS is unavailable
+	}
+	return addrs, err
+}
+
+// resolve looks up host and caches the result, reporting whether the addresses changed
+func (d *dnsDialer) resolve(ctx context.Context, host string) ([]string, bool, error) {
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	previous, known := d.hosts[host]
+	d.hosts[host] = dnsEntry{addrs: addrs, resolved: time.Now()}
+	return addrs, known && !sameAddrs(previous.addrs, addrs), nil
+}
+
+// refreshLoop re-resolves every known host each refresh interval, for the process lifetime
+func (d *dnsDialer) refreshLoop() {
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.refresh(context.Background())
+	}
+}
+
+// refresh re-resolves every known host, calling onChange once if any of them moved
+func (d *dnsDialer) refresh(ctx context.Context) {
+	d.mu.Lock()
+	hosts := make([]string, 0, len(d.hosts))
+	for host := range d.hosts {
+		hosts = append(hosts, host)
+	}
+	d.mu.Unlock()
+
+	changed := false
+	for _, host := range hosts {
+		addrs, moved, err := d.resolve(ctx, host)
+		if err != nil {
+			d.logger.Warn("Failed to re-resolve backend host, keeping previous addresses", "host", host, "error", err)
+			continue
+		}
+		if moved {
+			d.logger.Info("Backend host resolves to new addresses", "host", host, "addresses", addrs)
+			changed = true
+		}
+	}
+	if changed && d.onChange != nil {
+		d.onChange()
+	}
+}
+
+// sameAddrs compares address sets, ignoring order (resolvers often rotate answers)
+func sameAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
@@ -0,0 +1,121 @@
+package golb
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers host lookups from a map that tests can change
+type fakeResolver struct {
+	mu      sync.Mutex
+	answers map[string][]string
+	lookups int
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	if addrs, ok := f.answers[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (f *fakeResolver) set(host string, addrs ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.answers[host] = addrs
+}
+
+// newServerOn starts a server on ip:port answering with name
+func newServerOn(t *testing.T, ip, port, name string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", net.JoinHostPort(ip, port))
+	if err != nil {
+		t.Skipf("Cannot listen on %s: %v", ip, err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name)
+	}))
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+}
+
+func TestBackendDNSReResolution(t *testing.T) {
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := strconv.Itoa(first.Addr().(*net.TCPAddr).Port)
+	_ = first.Close()
+	newServerOn(t, "127.0.0.1", port, "old")
+	newServerOn(t, "127.0.0.2", port, "new") // Same port, so only the DNS answer tells them apart
+
+	resolver := &fakeResolver{answers: map[string][]string{}}
+	resolver.set("backend.test", "127.0.0.1")
+	cfg := DefaultConfig()
+	cfg.BackendDNSRefreshInterval = 100 * time.Millisecond
+	transport := newTransport(cfg, resolver)
+	t.Cleanup(transport.CloseIdleConnections)
+	client := &http.Client{Transport: transport, Timeout: 2 * time.Second}
+
+	get := func() string {
+		resp, err := client.Get("http://backend.test:" + port + "/")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	if got := get(); got != "old" {
+		t.Fatalf("Expected the initial address to be used, got %q", got)
+	}
+
+	// The backend moves; after a refresh the kept-alive connection to the old address is
+	// retired and the next connection goes to the new one
+	resolver.set("backend.test", "127.0.0.2")
+	time.Sleep(3 * cfg.BackendDNSRefreshInterval)
+	if got := get(); got != "new" {
+		t.Errorf("Expected requests to reach the new address after re-resolution, got %q", got)
+	}
+}
+
+func TestDNSDialerKeepsStaleAddressesWhenLookupFails(t *testing.T) {
+	resolver := &fakeResolver{answers: map[string][]string{}}
+	resolver.set("backend.test", "10.0.0.1")
+	var dialed []string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return nil, &net.OpError{Op: "dial", Err: io.EOF}
+	}
+	d := newDNSDialer(dial, resolver, time.Nanosecond, nil) // Every dial re-resolves
+	d.startLoop.Do(func() {})                               // No background refreshes in this test
+
+	_, _ = d.DialContext(context.Background(), "tcp", "backend.test:80")
+	delete(resolver.answers, "backend.test") // DNS outage
+	_, _ = d.DialContext(context.Background(), "tcp", "backend.test:80")
+	_, _ = d.DialContext(context.Background(), "tcp", "192.0.2.1:80") // IPs bypass the resolver
+
+	want := []string{"10.0.0.1:80", "10.0.0.1:80", "192.0.2.1:80"}
+	if len(dialed) != len(want) {
+		t.Fatalf("Dialed %v, want %v", dialed, want)
+	}
+	for i := range want {
+		if dialed[i] != want[i] {
+			t.Errorf("Dial %d went to %s, want %s", i, dialed[i], want[i])
+		}
+	}
+	if resolver.lookups != 2 {
+		t.Errorf("Expected 2 lookups, got %d", resolver.lookups)
+	}
+}
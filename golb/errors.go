@@ -0,0 +1,200 @@
+package golb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+)
+
+// StatusClientClosedRequest is nginx's non-standard status for a client that went away
+// before the response was ready
+const StatusClientClosedRequest = 499
+
+// Error categories reported in proxy error responses
+const (
+	ErrorCategoryNoBackend    = "no_backend"     // No backend available (all down, saturated or queue full)
+	ErrorCategoryTimeout      = "timeout"        // The backend did not answer within the request timeout
+	ErrorCategoryClientClosed = "client_closed"  // The client disconnected or the connection was reset
+	ErrorCategoryUpstream     = "upstream_error" // The backend could not be reached or failed mid-response
+	ErrorCategoryInternal     = "internal_error" // The proxy itself failed, e.g. a panic in a middleware
+	ErrorCategoryOverloaded   = "overloaded"     // The proxy is at its global concurrency limit
+	ErrorCategoryPaused       = "paused"         // The proxy was paused by an operator, see ServerPool.Pause
+)
+
+// ProxyError is the body of an error response for a request that could not be proxied.
+// It is sent as JSON to clients that accept it, otherwise only Message is sent as text.
+type ProxyError struct {
+	Status    int    `json:"status"`
+	Message   string `json:"error"`
+	Category  string `json:"category"`
+	RequestID string `json:"requestId,omitempty"`
+	Backend   string `json:"backend,omitempty"` // Omitted when Config.HideErrorDetails is set
+	Detail    string `json:"detail,omitempty"`  // Underlying error; omitted when Config.HideErrorDetails is set
+}
+
+// NewBackendProxy builds the reverse proxy for a single backend: requests are sent through
+// transport with the client headers cfg's forward lists let through, the backend's Host
+// header, its BackendOptions headers, their route's path rewriting and cfg.RequestTemplate,
+// responses lose the headers listed in cfg.StripResponseHeaders and the backend's own strip
+// list or are dropped for a retry if their status is in cfg.RetryOnStatuses, bodies are
+// copied with buffers from a pool shared by all backends (cfg.ProxyBufferSize), and failures
+// are answered by NewErrorHandler. A nil transport uses http.DefaultTransport.
+func NewBackendProxy(backendURL *url.URL, transport http.RoundTripper, pool *ServerPool, cfg *Config) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(backendURL)
+	proxy.Transport = transport
+	if cfg != nil {
+		if bp := sharedBufferPool(cfg.ProxyBufferSize); bp != nil {
+			proxy.BufferPool = bp
+		}
+	}
+
+	var headers map[string]string // Injected for this backend only
+	var strip []string            // Response headers hidden from clients
+	var rt *requestTemplate
+	var filter *headerFilter // Client headers kept from the backend
+	if cfg != nil {
+		opts := cfg.BackendOptionsFor(backendURL.String())
+		headers = opts.Headers
+		strip = append(slices.Clone(cfg.StripResponseHeaders), opts.StripResponseHeaders...)
+		rt, _ = newRequestTemplate(cfg.RequestTemplate) // Validated by LoadConfig
+		filter = newHeaderFilter(cfg.ForwardHeaderAllowList, cfg.ForwardHeaderDenyList)
+	}
+	defaultDirector := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		var data RequestTemplateData
+		if rt != nil {
+			data = templateData(req, backendURL.Host) // As the client sent it
+		}
+		rewritePath(req) // Before the backend's own path is joined in front
+		defaultDirector(req)
+		req.Host = backendURL.Host // Important for virtual hosting
+		if filter != nil {
+			filter.apply(req.Header) // Before the headers configured for the backend are added
+		}
+		for name, value := range headers {
+			if http.CanonicalHeaderKey(name) == "Host" {
+				req.Host = value // net/http ignores a Host header; it must be set on the request
+				continue
+			}
+			req.Header.Set(name, value)
+		}
+		if rt != nil {
+			if err := rt.apply(req, data); err != nil {
+				pool.Logger().Warn("Request template failed", "backend", backendURL.String(), "path", data.Path, "error", err)
+			}
+		}
+	}
+	if len(strip) > 0 || (cfg != nil && cfg.MaxRetries > 0 && len(cfg.RetryOnStatuses) > 0 && retriesStatuses(cfg)) {
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			if f := failoverFromContext(resp.Request.Context()); f != nil && f.retryStatus(resp) {
+				return errRetryStatus // Proxy.forward sends the request to the next backend instead
+			}
+			for _, name := range strip {
+				resp.Header.Del(name)
+			}
+			return nil
+		}
+	}
+	proxy.ErrorHandler = NewErrorHandler(pool, backendURL, cfg)
+	return proxy
+}
+
+// NewErrorHandler returns an httputil.ReverseProxy ErrorHandler for backendURL. Requests
+// canceled by the client going away get 499 and count as client disconnects, not against
+// the backend; timeouts get 504 and leave the backend alone; any other error marks the
+// backend down in pool and gets 502, unless the proxy is going to retry the request on
+// another backend (see Config.MaxRetries), as it does for responses dropped because of
+// Config.RetryOnStatuses. A nil cfg uses DefaultConfig().
+func NewErrorHandler(pool *ServerPool, backendURL *url.URL, cfg *Config) func(http.ResponseWriter, *http.Request, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, errRetryStatus) {
+			return // Not an error: the backend answered, with a status that is retried
+		}
+		proxyErr := ProxyError{Backend: backendURL.String(), Detail: err.Error()}
+		if isClientDisconnect(r, err) {
+			// Not the backend's fault: counted apart from proxy errors and the backend stays up
+			pool.Logger().Debug("Client disconnected", "backend", backendURL.String(), "method", r.Method, "path", r.URL.Path)
+			pool.recordClientDisconnect(backendURL)
+			proxyErr.Status, proxyErr.Message, proxyErr.Category = StatusClientClosedRequest, "Client Closed Request", ErrorCategoryClientClosed
+			writeProxyError(w, r, cfg, proxyErr)
+			return
+		}
+
+		pool.Logger().Warn("Proxy error", "backend", backendURL.String(), "method", r.Method, "path", r.URL.Path, "error", err)
+		pool.recordProxyError(backendURL)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+			// Request, dial, TLS handshake or response header timeout: the backend is slow, not necessarily down
+			proxyErr.Status, proxyErr.Message, proxyErr.Category = http.StatusGatewayTimeout, "Gateway Timeout", ErrorCategoryTimeout
+		default:
+			// Connection refused or reset, broken responses, etc.
+			pool.MarkBackendStatus(backendURL, false)
+			proxyErr.Status, proxyErr.Message, proxyErr.Category = http.StatusBadGateway, "Bad Gateway", ErrorCategoryUpstream
+		}
+		if f := failoverFromContext(r.Context()); f != nil && f.offer(err, proxyErr) {
+			return // Proxy.forward tries the next backend, or answers with proxyErr if none is left
+		}
+		writeProxyError(w, r, cfg, proxyErr)
+	}
+}
+
+// isClientDisconnect reports whether err is the request being canceled because the client
+// went away, rather than anything the backend did
+func isClientDisconnect(r *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) && errors.Is(r.Context().Err(), context.Canceled)
+}
+
+// isTimeout reports whether err is a network timeout, such as the transport giving up
+// waiting for response headers
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// noBackendError is the response to a request no backend is available for, with
+// cfg.NoBackendStatusCode (503 if unset)
+func noBackendError(cfg *Config, detail string) ProxyError {
+	e := ProxyError{Status: cfg.NoBackendStatusCode, Message: http.StatusText(cfg.NoBackendStatusCode), Category: ErrorCategoryNoBackend, Detail: detail}
+	if e.Status == 0 || e.Status == http.StatusServiceUnavailable {
+		e.Status, e.Message = http.StatusServiceUnavailable, "Service unavailable"
+	}
+	return e
+}
+
+// pausedError is the response to requests arriving while the pool is paused
+func pausedError(cfg *Config) ProxyError {
+	status := cfg.PausedStatusCode
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	return ProxyError{Status: status, Message: http.StatusText(status), Category: ErrorCategoryPaused, Detail: "the proxy is paused"}
+}
+
+// writeProxyError sends e as JSON if the client prefers it over plain text, otherwise as
+// text like http.Error. Backend details are dropped when cfg.HideErrorDetails is set.
+func writeProxyError(w http.ResponseWriter, r *http.Request, cfg *Config, e ProxyError) {
+	if cfg.RequestIDHeader != "" {
+		e.RequestID = r.Header.Get(cfg.RequestIDHeader)
+	}
+	if cfg.HideErrorDetails {
+		e.Backend, e.Detail = "", ""
+	}
+
+	accept := r.Header.Get("Accept")
+	if acceptQuality(accept, "application/json") <= acceptQuality(accept, "text/plain") {
+		http.Error(w, e.Message, e.Status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	_ = json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,122 @@
+package golb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newUnreachableBackend returns a pool with one backend whose server has already been closed
+func newUnreachableBackend(t *testing.T, cfg *Config) (*ServerPool, *Backend) {
+	t.Helper()
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	backendURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse backend URL: %v", err)
+	}
+	pool := NewServerPool(NewRoundRobinBalancer())
+	peer := NewBackend(backendURL, NewBackendProxy(backendURL, nil, pool, cfg), 1)
+	peer.SetAlive(true)
+	pool.AddBackend(peer)
+	return pool, peer
+}
+
+func TestProxyErrorJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		hideDetails bool
+	}{
+		{"with details", false},
+		{"details hidden", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.HideErrorDetails = tt.hideDetails
+			pool, peer := newUnreachableBackend(t, cfg)
+
+			req := httptest.NewRequest("GET", "/api", nil)
+			req.Header.Set("Accept", "application/json")
+			req.Header.Set("X-Request-ID", "req-123")
+			rr := httptest.NewRecorder()
+			NewProxy(pool, cfg).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadGateway {
+				t.Fatalf("Expected status %d, got %d", http.StatusBadGateway, rr.Code)
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Fatalf("Expected JSON, got Content-Type %q", contentType)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to decode error body: %v", err)
+			}
+			if body["status"] != float64(http.StatusBadGateway) || body["error"] != "Bad Gateway" || body["category"] != ErrorCategoryUpstream || body["requestId"] != "req-123" {
+				t.Errorf("Unexpected error body: %v", body)
+			}
+
+			_, hasBackend := body["backend"]
+			_, hasDetail := body["detail"]
+			if tt.hideDetails && (hasBackend || hasDetail) {
+				t.Errorf("Expected backend details to be hidden, got %v", body)
+			}
+			if !tt.hideDetails && (body["backend"] != peer.URL.String() || !hasDetail) {
+				t.Errorf("Expected backend details, got %v", body)
+			}
+			if peer.IsAlive() {
+				t.Errorf("Expected the unreachable backend to be marked down")
+			}
+		})
+	}
+}
+
+func TestProxyErrorPlainText(t *testing.T) {
+	pool, _ := newUnreachableBackend(t, DefaultConfig())
+
+	rr := httptest.NewRecorder()
+	NewProxy(pool, DefaultConfig()).ServeHTTP(rr, httptest.NewRequest("GET", "/api", nil))
+
+	if rr.Code != http.StatusBadGateway {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadGateway, rr.Code)
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") || strings.TrimSpace(rr.Body.String()) != "Bad Gateway" {
+		t.Errorf("Expected a plain text error, got %q (%s)", rr.Body.String(), rr.Header().Get("Content-Type"))
+	}
+}
+
+func TestClientDisconnectDoesNotMarkBackendDown(t *testing.T) {
+	received := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-r.Context().Done() // Never answers before the client goes away
+	}))
+	defer server.Close()
+	proxy := newRetryProxy(t, DefaultConfig(), server.URL)
+	backend := proxy.Pool().backends[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+	if rr.Code != StatusClientClosedRequest {
+		t.Errorf("Expected %d, got %d", StatusClientClosedRequest, rr.Code)
+	}
+	if !backend.IsAlive() {
+		t.Error("Expected the backend to stay alive after a client disconnect")
+	}
+	counters := backend.Counters()
+	if counters.ClientDisconnects != 1 || counters.ProxyErrors != 0 {
+		t.Errorf("Expected 1 client disconnect and no proxy errors, got %d and %d", counters.ClientDisconnects, counters.ProxyErrors)
+	}
+}
@@ -0,0 +1,116 @@
+package golb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Debug response headers added with Config.DebugHeaders
+const (
+	DebugBackendHeader  = "X-GoLB-Backend"  // URL of the backend that served the request
+	DebugDecisionHeader = "X-GoLB-Decision" // Why the balancer chose it
+)
+
+// ExplainingLoadBalancer is a LoadBalancer that can say why it picked a backend, for
+// Config.DebugHeaders and debug logs. The pool calls Explain right after the selection,
+// under the same lock, with the backends the selection was made from.
+type ExplainingLoadBalancer interface {
+	LoadBalancer
+	Explain(selected *Backend, backends []*Backend) string
+}
+
+type decisionKey struct{}
+
+// selectionDecision receives the reason for a request's backend selection
+type selectionDecision struct {
+	reason string
+}
+
+// withSelectionDecision makes selections for the request of ctx record their reason in the
+// returned decision. Explaining costs a little, so only requests that report it ask for it.
+func withSelectionDecision(ctx context.Context) (context.Context, *selectionDecision) {
+	d := &selectionDecision{}
+	return context.WithValue(ctx, decisionKey{}, d), d
+}
+
+func decisionFromContext(ctx context.Context) *selectionDecision {
+	d, _ := ctx.Value(decisionKey{}).(*selectionDecision)
+	return d
+}
+
+// explainSelection records why lb picked selected from backends, if ctx asks for it
+func explainSelection(ctx context.Context, lb LoadBalancer, selected *Backend, backends []*Backend) {
+	d := decisionFromContext(ctx)
+	if d == nil {
+		return
+	}
+	if selected == nil {
+		d.reason = "" // Nothing to explain; don't leave an earlier attempt's reason behind
+		return
+	}
+	if elb, ok := lb.(ExplainingLoadBalancer); ok {
+		d.reason = elb.Explain(selected, backends)
+	} else {
+		d.reason = fmt.Sprintf("%T: no explanation available", lb)
+	}
+	if selected.IsBackup() {
+		d.reason += " (backup, no primary alive)"
+	}
+}
+
+// annotate adds a note about the candidate set to the recorded reason
+func (d *selectionDecision) annotate(note string) {
+	if d != nil && d.reason != "" {
+		d.reason += " (" + note + ")"
+	}
+}
+
+// countAvailable returns how many of backends have capacity
+func countAvailable(backends []*Backend) int {
+	n := 0
+	for _, b := range backends {
+		if b.hasCapacity() {
+			n++
+		}
+	}
+	return n
+}
+
+// ewmaString formats a backend's EWMA for explanations
+func ewmaString(b *Backend) string {
+	if ewma := b.ewmaResponseTime.Load(); ewma > 0 {
+		return time.Duration(ewma).Round(time.Microsecond).String()
+	}
+	return "unmeasured"
+}
+
+func (r *RoundRobinBalancer) Explain(selected *Backend, backends []*Backend) string {
+	return fmt.Sprintf("round-robin: next in turn of %d available", countAvailable(backends))
+}
+
+func (lc *LeastConnectionBalancer) Explain(selected *Backend, backends []*Backend) string {
+	return fmt.Sprintf("least-connections: %d conns, min of %d available", selected.activeConnections.Load(), countAvailable(backends))
+}
+
+func (lrt *LeastResponseTimeBalancer) Explain(selected *Backend, backends []*Backend) string {
+	return fmt.Sprintf("least-response-time: EWMA %s at weight %d, lowest of %d available", ewmaString(selected), max(selected.GetWeight(), 1), countAvailable(backends))
+}
+
+func (p *PeakEWMABalancer) Explain(selected *Backend, backends []*Backend) string {
+	return fmt.Sprintf("peak-ewma: EWMA %s with %d conns, lowest cost of %d available", ewmaString(selected), selected.activeConnections.Load(), countAvailable(backends))
+}
+
+func (h *HybridBalancer) Explain(selected *Backend, backends []*Backend) string {
+	return fmt.Sprintf("hybrid: EWMA %s with %d conns at latency weight %g, lowest cost of %d available", ewmaString(selected), selected.activeConnections.Load(), h.blend, countAvailable(backends))
+}
+
+func (w *WeightedRoundRobinBalancer) Explain(selected *Backend, backends []*Backend) string {
+	total := 0
+	for _, b := range backends {
+		if b.hasCapacity() {
+			total += b.GetWeight()
+		}
+	}
+	return fmt.Sprintf("weighted-round-robin: weight %d of %d total", selected.GetWeight(), total)
+}
@@ -0,0 +1,69 @@
+package golb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDebugHeaders(t *testing.T) {
+	backends := newNamedBackends(t, "a", "b")
+	for _, enabled := range []bool{true, false} {
+		cfg := DefaultConfig()
+		cfg.DebugHeaders = enabled
+		pool, err := BuildServerPool(cfg, "least-connections", backends, nil, NewTransport(cfg))
+		if err != nil {
+			t.Fatalf("BuildServerPool failed: %v", err)
+		}
+		markAllAlive(pool)
+		proxy := NewProxy(pool, cfg)
+
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		backend, decision := rr.Header().Get(DebugBackendHeader), rr.Header().Get(DebugDecisionHeader)
+		if !enabled {
+			if backend != "" || decision != "" {
+				t.Errorf("Expected no debug headers when disabled, got %q and %q", backend, decision)
+			}
+			continue
+		}
+		if !slices.Contains(backends, backend) {
+			t.Errorf("Expected %s to name a backend, got %q", DebugBackendHeader, backend)
+		}
+		if want := "least-connections: 0 conns, min of 2 available"; decision != want {
+			t.Errorf("Expected decision %q, got %q", want, decision)
+		}
+	}
+}
+
+func TestDecisionReasons(t *testing.T) {
+	pool := newLargePool(t, NewWeightedRoundRobinBalancer(), 3)
+	pool.backends[0].SetWeight(2)
+	pool.backends[2].SetTags(ZoneTagPrefix + "a")
+	ctx, decision := withSelectionDecision(t.Context())
+
+	if b := pool.SelectBackendCtx(ctx); b != pool.backends[0] {
+		t.Fatalf("Expected the heaviest backend first, got %v", b)
+	}
+	if want := "weighted-round-robin: weight 2 of 4 total"; decision.reason != want {
+		t.Errorf("Expected reason %q, got %q", want, decision.reason)
+	}
+
+	// Zone affinity is noted alongside the balancer's reason
+	pool.SetLocalZone("a")
+	pool.SelectBackendCtx(ctx)
+	if !strings.HasSuffix(decision.reason, "(local zone a)") {
+		t.Errorf("Expected the local zone to be noted, got %q", decision.reason)
+	}
+	pool.backends[2].SetMaxConnections(1)
+	pool.backends[2].IncrementActiveConnections()
+	pool.SelectBackendCtx(ctx)
+	if !strings.HasSuffix(decision.reason, "(spilled over from zone a)") {
+		t.Errorf("Expected the spill-over to be noted, got %q", decision.reason)
+	}
+}
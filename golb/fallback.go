@@ -0,0 +1,41 @@
+package golb
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+)
+
+// newFallbackHandler returns the handler serving requests while no backend is available:
+// a proxy to cfg.FallbackBackend, or the files in cfg.FallbackStaticDir. It returns nil
+// when neither is configured or the configured one is unusable.
+func newFallbackHandler(cfg *Config, logger Logger) http.Handler {
+	switch {
+	case cfg.FallbackBackend != "":
+		u, err := url.Parse(cfg.FallbackBackend)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			logger.Warn("Invalid fallback backend URL, fallback disabled", "fallbackBackend", cfg.FallbackBackend, "error", err)
+			return nil
+		}
+		proxy := httputil.NewSingleHostReverseProxy(u)
+		proxy.Transport = NewTransport(cfg)
+		defaultDirector := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			defaultDirector(req)
+			req.Host = u.Host
+		}
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Warn("Fallback backend failed", "fallbackBackend", cfg.FallbackBackend, "path", r.URL.Path, "error", err)
+			writeProxyError(w, r, cfg, noBackendError(cfg, err.Error()))
+		}
+		return proxy
+	case cfg.FallbackStaticDir != "":
+		if info, err := os.Stat(cfg.FallbackStaticDir); err != nil || !info.IsDir() {
+			logger.Warn("Fallback static directory is not a readable directory, fallback disabled", "fallbackStaticDir", cfg.FallbackStaticDir, "error", err)
+			return nil
+		}
+		return http.FileServer(http.Dir(cfg.FallbackStaticDir))
+	}
+	return nil
+}
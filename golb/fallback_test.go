@@ -0,0 +1,73 @@
+package golb
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFallbackBackendOnlyWithoutBackends(t *testing.T) {
+	maintenance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, "down for maintenance")
+	}))
+	t.Cleanup(maintenance.Close)
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "backend")
+	}))
+	pool.SetLogger(&captureLogger{})
+	cfg := DefaultConfig()
+	cfg.FallbackBackend = maintenance.URL
+	proxy := NewProxy(pool, cfg)
+
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/page", nil))
+		return rr
+	}
+	if rr := serve(); rr.Body.String() != "backend" {
+		t.Errorf("Expected normal traffic to bypass the fallback, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	backend.SetAlive(false)
+	rr := serve()
+	if rr.Body.String() != "down for maintenance" || rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the fallback backend's response, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("X-Request-ID") == "" {
+		t.Errorf("Expected the request ID on fallback responses")
+	}
+
+	backend.SetAlive(true)
+	if rr := serve(); rr.Body.String() != "backend" {
+		t.Errorf("Expected traffic to return to the backend once it recovers, got %q", rr.Body.String())
+	}
+}
+
+func TestFallbackStaticDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>Maintenance</h1>"), 0o600); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	pool := NewServerPool(NewRoundRobinBalancer()) // Empty pool
+	pool.SetLogger(&captureLogger{})
+	cfg := DefaultConfig()
+	cfg.FallbackStaticDir = dir
+	proxy := NewProxy(pool, cfg)
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "<h1>Maintenance</h1>" {
+		t.Errorf("Expected the static maintenance page, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	cfg.FallbackStaticDir = filepath.Join(dir, "missing")
+	rr = httptest.NewRecorder()
+	NewProxy(pool, cfg).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a plain 503 when the fallback directory is unusable, got %d", rr.Code)
+	}
+}
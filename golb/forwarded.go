@@ -0,0 +1,106 @@
+package golb
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies parses CIDRs such as "10.0.0.0/8"; a bare IP trusts just that address
+func parseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// isTrusted reports whether addr is within one of the trusted prefixes
+func isTrusted(trusted []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type clientIPKey struct{}
+
+// ClientIP returns the address of the client that sent r: as derived by ForwardedHeaders
+// if it ran, otherwise the host of r.RemoteAddr. Use it wherever the client's identity
+// matters (access logs, hashing, limits) instead of reading forwarded headers directly.
+func ClientIP(r *http.Request) string {
+	if ip, ok := ClientIPFromContext(r.Context()); ok {
+		return ip
+	}
+	return remoteHost(r.RemoteAddr)
+}
+
+// remoteHost strips the port from a RemoteAddr
+func remoteHost(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// ForwardedHeaders derives the client IP from X-Forwarded-For, trusting only hops added by
+// cfg.TrustedProxies. Walking the header from the right, trusted proxies are skipped and the
+// first other address is the client; anything left of it could have been made up by the
+// client and is removed before the request is forwarded. Requests that don't come from a
+// trusted proxy have their forwarded headers stripped. The result is available via ClientIP.
+func ForwardedHeaders(cfg *Config, next http.Handler) http.Handler {
+	trusted, _ := parseTrustedProxies(cfg.TrustedProxies) // Validated by LoadConfig
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP := remoteHost(r.RemoteAddr)
+		remote, err := netip.ParseAddr(clientIP)
+		if err != nil || !isTrusted(trusted, remote) {
+			r.Header.Del("X-Forwarded-For")
+			r.Header.Del("X-Real-IP")
+			r.Header.Del("Forwarded")
+		} else {
+			var hops []string
+			for _, value := range r.Header.Values("X-Forwarded-For") {
+				hops = append(hops, parseCommaSeparatedString(value)...)
+			}
+			kept := len(hops)
+			for i := len(hops) - 1; i >= 0; i-- {
+				addr, err := netip.ParseAddr(hops[i])
+				if err != nil {
+					break // Garbage: nothing from here leftwards can be trusted
+				}
+				clientIP, kept = addr.String(), i
+				if !isTrusted(trusted, addr) {
+					break
+				}
+			}
+			if kept < len(hops) {
+				r.Header.Set("X-Forwarded-For", strings.Join(hops[kept:], ", "))
+			} else {
+				r.Header.Del("X-Forwarded-For")
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(WithClientIP(r.Context(), clientIP)))
+	})
+}
@@ -0,0 +1,89 @@
+package golb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		wantIP     string
+		wantXFF    string // As forwarded to the backend, before the proxy appends RemoteAddr
+	}{
+		{"untrusted source spoofing", "203.0.113.7:5000", "1.2.3.4", "203.0.113.7", ""},
+		{"trusted proxy", "10.0.0.5:5000", "198.51.100.9", "198.51.100.9", "198.51.100.9"},
+		{"trusted chain", "10.0.0.5:5000", "198.51.100.9, 192.168.1.1, 10.1.1.1", "198.51.100.9", "198.51.100.9, 192.168.1.1, 10.1.1.1"},
+		{"spoofed hops left of the client are stripped", "10.0.0.5:5000", "1.2.3.4, 198.51.100.9, 10.1.1.1", "198.51.100.9", "198.51.100.9, 10.1.1.1"},
+		{"garbage hop", "10.0.0.5:5000", "not-an-ip, 10.1.1.1", "10.1.1.1", "10.1.1.1"},
+		{"trusted proxy without header", "10.0.0.5:5000", "", "10.0.0.5", ""},
+		{"all hops trusted", "10.0.0.5:5000", "10.2.2.2", "10.2.2.2", "10.2.2.2"},
+		{"ipv6 trusted proxy", "[fd00::1]:5000", "2001:db8::7", "2001:db8::7", "2001:db8::7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotIP, gotXFF string
+			handler := ForwardedHeaders(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotIP, gotXFF = ClientIP(r), r.Header.Get("X-Forwarded-For")
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			req.Header.Set("X-Real-IP", "1.2.3.4")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if gotIP != tt.wantIP {
+				t.Errorf("ClientIP = %q, want %q", gotIP, tt.wantIP)
+			}
+			if gotXFF != tt.wantXFF {
+				t.Errorf("X-Forwarded-For = %q, want %q", gotXFF, tt.wantXFF)
+			}
+		})
+	}
+}
+
+func TestForwardedHeadersReachBackend(t *testing.T) {
+	var received http.Header
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	capture := &captureLogger{}
+	pool.SetLogger(capture)
+	cfg := DefaultConfig()
+	cfg.AccessLogEnabled = true
+	proxy := NewProxy(pool, cfg) // No trusted proxies: forwarded headers from clients are dropped
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	req.Header.Set("X-Real-IP", "1.2.3.4")
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := received.Get("X-Forwarded-For"); got != "203.0.113.7" {
+		t.Errorf("Expected the backend to see only the real client, got X-Forwarded-For %q", got)
+	}
+	if got := received.Get("X-Real-IP"); got != "" {
+		t.Errorf("Expected the spoofed X-Real-IP to be stripped, got %q", got)
+	}
+	if line, ok := capture.find("Access"); !ok || !strings.Contains(line, "client203.0.113.7") {
+		t.Errorf("Expected the access log to record the client IP, got %q", line)
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalid(t *testing.T) {
+	if _, err := parseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("Expected an invalid CIDR to be rejected")
+	}
+	if _, err := parseTrustedProxies([]string{"proxy.internal"}); err == nil {
+		t.Errorf("Expected a hostname to be rejected")
+	}
+}
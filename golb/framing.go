@@ -0,0 +1,40 @@
+package golb
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// checkFraming returns an error if r's body framing is ambiguous: Content-Length together
+// with Transfer-Encoding, more than one or an invalid Content-Length, or a Transfer-Encoding
+// other than chunked. Front ends and backends that resolve such requests differently can be
+// made to disagree on where one request ends and the next begins (request smuggling).
+// net/http already rejects or normalizes most of these on the way in; this does not rely on
+// that, nor on what httputil.ReverseProxy does with the headers it is handed.
+func checkFraming(r *http.Request) error {
+	transferEncoding := append(slices.Clone(r.TransferEncoding), r.Header.Values("Transfer-Encoding")...)
+	contentLength := r.Header.Values("Content-Length")
+	if len(transferEncoding) > 0 && len(contentLength) > 0 {
+		return errors.New("both Content-Length and Transfer-Encoding are set")
+	}
+	for _, te := range transferEncoding {
+		if !strings.EqualFold(strings.TrimSpace(te), "chunked") {
+			return errors.New("unsupported Transfer-Encoding " + strconv.Quote(te))
+		}
+	}
+	if len(transferEncoding) > 1 {
+		return errors.New("multiple Transfer-Encoding values")
+	}
+	if len(contentLength) > 1 {
+		return errors.New("multiple Content-Length values")
+	}
+	if len(contentLength) == 1 {
+		if n, err := strconv.ParseUint(contentLength[0], 10, 63); err != nil || (r.ContentLength >= 0 && int64(n) != r.ContentLength) {
+			return errors.New("invalid Content-Length " + strconv.Quote(contentLength[0]))
+		}
+	}
+	return nil
+}
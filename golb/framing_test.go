@@ -0,0 +1,80 @@
+package golb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStrictHTTPRejectsAmbiguousFraming(t *testing.T) {
+	var contacted atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contacted.Add(1)
+	}))
+	defer server.Close()
+	cfg := DefaultConfig()
+	cfg.StrictHTTP = true
+	proxy := newRetryProxy(t, cfg, server.URL)
+
+	tests := []struct {
+		name             string
+		contentLength    []string
+		transferEncoding []string
+	}{
+		{"content length and chunked", []string{"7"}, []string{"chunked"}},
+		{"conflicting content lengths", []string{"7", "12"}, nil},
+		{"duplicate content lengths", []string{"7", "7"}, nil},
+		{"content length list", []string{"7, 7"}, nil},
+		{"negative content length", []string{"-7"}, nil},
+		{"content length not matching the body", []string{"3"}, nil},
+		{"unsupported transfer encoding", nil, []string{"gzip, chunked"}},
+		{"obfuscated transfer encoding", nil, []string{"xchunked"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+			req.Header.Del("Content-Length")
+			for _, v := range tt.contentLength {
+				req.Header.Add("Content-Length", v)
+			}
+			req.TransferEncoding = tt.transferEncoding
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+			if rr.Header().Get("Connection") != "close" {
+				t.Errorf("Expected the connection to be closed after the rejection")
+			}
+		})
+	}
+	if n := contacted.Load(); n != 0 {
+		t.Errorf("Expected the backend never to be contacted, got %d requests", n)
+	}
+
+	// Unambiguous requests go through
+	for _, te := range [][]string{nil, {"chunked"}} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+		if te == nil {
+			req.Header.Set("Content-Length", "7")
+		}
+		req.TransferEncoding = te
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected a well-framed request with Transfer-Encoding %v to be proxied, got %d", te, rr.Code)
+		}
+	}
+
+	// Without StrictHTTP the check is skipped
+	proxy = newRetryProxy(t, DefaultConfig(), server.URL)
+	req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+	req.Header["Content-Length"] = []string{"7", "7"}
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+	if rr.Code == http.StatusBadRequest {
+		t.Errorf("Expected framing not to be checked without StrictHTTP")
+	}
+}
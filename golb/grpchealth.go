@@ -0,0 +1,201 @@
+package golb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Health check types, see Config.HealthCheckType
+const (
+	HealthCheckTypeHTTP = "http"
+	HealthCheckTypeGRPC = "grpc"
+)
+
+// grpcHealthCheckMethod is the path of grpc.health.v1.Health/Check
+const grpcHealthCheckMethod = "/grpc.health.v1.Health/Check"
+
+// grpc.health.v1.HealthCheckResponse.ServingStatus values
+var grpcServingStatuses = []string{"UNKNOWN", "SERVING", "NOT_SERVING", "SERVICE_UNKNOWN"}
+
+const grpcServing = 1
+
+// grpcHealthClients maps each management client to the client making its gRPC health checks
+var grpcHealthClients sync.Map // *http.Client -> *http.Client
+
+// grpcHealthClient returns the client making gRPC health checks for the management client c.
+// gRPC needs HTTP/2: negotiated over TLS for https backends, and with prior knowledge (h2c)
+// for plain http ones. c's transport is cloned with both enabled, keeping its TLS, egress
+// proxy and dial settings; a transport of another type is used as is.
+func grpcHealthClient(c *http.Client) *http.Client {
+	if cached, ok := grpcHealthClients.Load(c); ok {
+		return cached.(*http.Client)
+	}
+	transport, ok := c.Transport.(*http.Transport)
+	if c.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport), true
+	}
+	if !ok {
+		return c
+	}
+	grpcClient := *c
+	grpcClient.Transport = newGRPCHealthTransport(transport)
+	cached, _ := grpcHealthClients.LoadOrStore(c, &grpcClient)
+	return cached.(*http.Client)
+}
+
+func newGRPCHealthTransport(base *http.Transport) *http.Transport {
+	transport := base.Clone()
+	transport.Protocols = new(http.Protocols)
+	transport.Protocols.SetHTTP2(true)
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	return transport
+}
+
+// isGRPCBackendServing asks b for its serving status with the gRPC health checking protocol,
+// about the backend's HealthCheckService or else cfg.HealthCheckService ("" for the whole
+// server). Only SERVING counts as alive. cfg.HealthCheckHeaders are sent as metadata. A
+// HealthCheckURL override keeps its scheme and host but not its path.
+// The check goes through a gRPC client derived from client (see grpcHealthClient) and is
+// bounded by ctx. Returns alive status and the duration of the check.
+func isGRPCBackendServing(ctx context.Context, client *http.Client, b *Backend, cfg *Config, logger Logger) (bool, time.Duration) {
+	startTime := time.Now()
+	service := b.HealthCheckService(cfg.HealthCheckService)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, grpcHealthURL(b), bytes.NewReader(grpcHealthCheckRequest(service)))
+	if err != nil {
+		logger.Error("Error creating health check request", "backend", b.URL.String(), "error", err)
+		return false, 0
+	}
+	for name, value := range cfg.HealthCheckHeaders {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	resp, err := grpcHealthClient(client).Do(req)
+	duration := time.Since(startTime)
+	if err != nil {
+		logger.Debug("Health check failed", "backend", b.URL.String(), "error", err) // Can be noisy
+		return false, duration
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, healthCheckDrainLimit)) // Trailers arrive after the body
+	if err != nil {
+		logger.Debug("Health check failed", "backend", b.URL.String(), "error", err)
+		return false, duration
+	}
+
+	status, err := parseGRPCHealthResponse(resp, body)
+	if err != nil {
+		logger.Debug("Health check failed", "backend", b.URL.String(), "service", service, "error", err)
+		return false, duration
+	}
+	if status != grpcServing {
+		logger.Debug("Health check non-OK", "backend", b.URL.String(), "service", service, "status", grpcServingStatusName(status)) // Can be noisy
+		return false, duration
+	}
+	return true, duration
+}
+
+// grpcHealthURL returns the URL of the health checking method on b
+func grpcHealthURL(b *Backend) string {
+	if override := b.healthCheckURL.Load(); override != nil && *override != "" {
+		if u, err := url.Parse(*override); err == nil {
+			u.Path, u.RawPath, u.RawQuery = grpcHealthCheckMethod, "", ""
+			return u.String()
+		}
+	}
+	return b.ResolvePath(grpcHealthCheckMethod)
+}
+
+// grpcHealthCheckRequest returns the length-prefixed grpc.health.v1.HealthCheckRequest for service
+func grpcHealthCheckRequest(service string) []byte {
+	var msg []byte
+	if service != "" {
+		msg = append(msg, 1<<3|2) // Field 1 (service), length-delimited
+		msg = binary.AppendUvarint(msg, uint64(len(service)))
+		msg = append(msg, service...)
+	}
+	frame := make([]byte, 5, 5+len(msg)) // Uncompressed flag and message length
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// parseGRPCHealthResponse returns the serving status of a Check response with the given body
+func parseGRPCHealthResponse(resp *http.Response, body []byte) (uint64, error) {
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+	grpcStatus, grpcMessage := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if grpcStatus == "" { // Trailers-only response, as for errors
+		grpcStatus, grpcMessage = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if grpcStatus != "0" {
+		return 0, fmt.Errorf("gRPC status %q: %s", grpcStatus, grpcMessage)
+	}
+	if len(body) < 5 || body[0] != 0 {
+		return 0, errors.New("missing or compressed response message")
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if uint64(len(body)-5) < uint64(n) {
+		return 0, errors.New("truncated response message")
+	}
+	return parseServingStatus(body[5 : 5+n])
+}
+
+// parseServingStatus decodes the status field of a HealthCheckResponse message, skipping
+// any other fields; a message without it has the default status, UNKNOWN
+func parseServingStatus(msg []byte) (uint64, error) {
+	var status uint64
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("malformed response message")
+		}
+		msg = msg[n:]
+		var size uint64
+		switch tag & 7 { // Wire type
+		case 0: // Varint
+			value, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("malformed response message")
+			}
+			if tag>>3 == 1 {
+				status = value
+			}
+			msg = msg[n:]
+			continue
+		case 1:
+			size = 8
+		case 2:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("malformed response message")
+			}
+			msg, size = msg[n:], length
+		case 5:
+			size = 4
+		default:
+			return 0, errors.New("malformed response message")
+		}
+		if uint64(len(msg)) < size {
+			return 0, errors.New("truncated response message")
+		}
+		msg = msg[size:]
+	}
+	return status, nil
+}
+
+func grpcServingStatusName(status uint64) string {
+	if status < uint64(len(grpcServingStatuses)) {
+		return grpcServingStatuses[status]
+	}
+	return fmt.Sprint(status)
+}
@@ -0,0 +1,161 @@
+package golb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeGRPCHealthServer implements grpc.health.v1.Health/Check over h2c with settable
+// per-service statuses; services without a status get NOT_FOUND
+type fakeGRPCHealthServer struct {
+	mu       sync.Mutex
+	statuses map[string]uint64
+}
+
+func (f *fakeGRPCHealthServer) set(service string, status uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[service] = status
+}
+
+func (f *fakeGRPCHealthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.URL.Path != grpcHealthCheckMethod || r.Header.Get("Content-Type") != "application/grpc" {
+		http.Error(w, "not a gRPC health check", http.StatusBadRequest)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var service string
+	if len(body) > 5 {
+		msg := body[5:]
+		n, size := binary.Uvarint(msg[1:]) // After the field 1 tag
+		service = string(msg[1+size : 1+size+int(n)])
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	f.mu.Lock()
+	status, ok := f.statuses[service]
+	f.mu.Unlock()
+	if !ok {
+		w.Header().Set("Grpc-Status", "5") // NOT_FOUND, trailers-only
+		w.Header().Set("Grpc-Message", "unknown service")
+		return
+	}
+	w.Header().Set("Trailer", "Grpc-Status")
+	msg := binary.AppendUvarint([]byte{1 << 3}, status) // Field 1, varint
+	frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg)))
+	_, _ = w.Write(append(frame, msg...))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+func TestGRPCHealthCheck(t *testing.T) {
+	fake := &fakeGRPCHealthServer{statuses: map[string]uint64{"": grpcServing}}
+	server := httptest.NewUnstartedServer(fake)
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.HealthCheckType = HealthCheckTypeGRPC
+	pool, err := BuildServerPool(cfg, "round-robin", []string{server.URL}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build pool: %v", err)
+	}
+	backend := pool.backends[0]
+	check := func() bool {
+		pool.PerformHealthCheckCycle(nil, cfg)
+		return backend.IsAlive()
+	}
+
+	if !check() {
+		t.Fatal("Expected the backend to be alive while SERVING")
+	}
+	fake.set("", 2) // NOT_SERVING
+	if check() {
+		t.Error("Expected the backend to be down while NOT_SERVING")
+	}
+	fake.set("", grpcServing)
+	if !check() {
+		t.Error("Expected the backend to be alive again once SERVING")
+	}
+
+	// The per-backend service name is checked instead of the global one
+	backend.SetHealthCheckService("payments.v1.Payments")
+	if check() {
+		t.Error("Expected the backend to be down while its service is unknown")
+	}
+	fake.set("payments.v1.Payments", grpcServing)
+	if !check() {
+		t.Error("Expected the backend to be alive once its service is SERVING")
+	}
+	fake.set("", 2)
+	if !check() {
+		t.Error("Expected the server-wide status not to matter with a per-backend service")
+	}
+}
+
+// proxyHeaderListener reads a PROXY v1 header line off each accepted connection and reports it
+type proxyHeaderListener struct {
+	net.Listener
+	headers chan string
+}
+
+func (l *proxyHeaderListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		header = "error: " + err.Error()
+	}
+	select {
+	case l.headers <- header:
+	default:
+	}
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn reads through reader, which may hold bytes already read from Conn
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func TestGRPCHealthCheckUsesManagementTransport(t *testing.T) {
+	fake := &fakeGRPCHealthServer{statuses: map[string]uint64{"": grpcServing}}
+	server := httptest.NewUnstartedServer(fake)
+	headers := make(chan string, 10)
+	server.Listener = &proxyHeaderListener{Listener: server.Listener, headers: headers}
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.HealthCheckType = HealthCheckTypeGRPC
+	cfg.BackendProxyProtocol = ProxyProtocolV1
+	pool, err := BuildServerPool(cfg, "round-robin", []string{server.URL}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build pool: %v", err)
+	}
+	pool.SetLogger(&captureLogger{})
+
+	pool.PerformHealthCheckCycle(pool.ManagementClient(), cfg)
+	if !pool.backends[0].IsAlive() {
+		t.Fatal("Expected a gRPC backend requiring PROXY headers to pass its health check")
+	}
+	if header := <-headers; header != "PROXY UNKNOWN\r\n" {
+		t.Errorf("Expected the gRPC health check to send a PROXY header, got %q", header)
+	}
+}
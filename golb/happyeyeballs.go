@@ -0,0 +1,123 @@
+package golb
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// happyEyeballsDelay is how long a connection attempt gets before the next address is
+// tried alongside it, as recommended by RFC 8305
+const happyEyeballsDelay = 250 * time.Millisecond
+
+// happyEyeballsDialer resolves backend host names on every dial and races connections to
+// their addresses with dialHappyEyeballs. It is used when cfg.BackendHappyEyeballs is set
+// without cfg.BackendDNSRefreshInterval; the dnsDialer races its cached addresses itself.
+type happyEyeballsDialer struct {
+	dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+	resolver hostResolver
+	delay    time.Duration
+}
+
+// DialContext dials addr ("host:port"). IP addresses are dialed as is.
+func (d *happyEyeballsDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dial(ctx, network, addr)
+	}
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dialHappyEyeballs(ctx, d.dial, network, addrs, port, d.delay)
+}
+
+// dialHappyEyeballs connects to the first of addrs to answer (RFC 8305). Addresses are tried
+// alternating between IPv6 and IPv4, starting with the family of the first one; each attempt
+// gets delay before the next starts alongside it, and a failed attempt starts the next right
+// away. Once one connects, the others are cancelled, and closed if they connect anyway.
+func dialHappyEyeballs(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), network string, addrs []string, port string, delay time.Duration) (net.Conn, error) {
+	addrs = interleaveFamilies(addrs)
+	if len(addrs) == 1 {
+		return dial(ctx, network, net.JoinHostPort(addrs[0], port))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type attempt struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan attempt, len(addrs)) // Buffered so losing attempts never block
+	next, pending := 0, 0
+	start := func() {
+		addr := net.JoinHostPort(addrs[next], port)
+		next++
+		pending++
+		go func() {
+			conn, err := dial(ctx, network, addr)
+			results <- attempt{conn, err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var lastErr error
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				go func(losers int) {
+					for range losers {
+						if late := <-results; late.conn != nil {
+							_ = late.conn.Close()
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			}
+			lastErr = res.err
+		case <-timer.C:
+		}
+		if next < len(addrs) {
+			start()
+			timer.Reset(delay)
+		}
+	}
+	return nil, lastErr
+}
+
+// interleaveFamilies reorders addrs to alternate between IPv6 and IPv4, keeping the
+// resolver's order within each family and starting with the family it put first
+func interleaveFamilies(addrs []string) []string {
+	var first, second []string
+	firstIsV4 := len(addrs) > 0 && isIPv4(addrs[0])
+	for _, addr := range addrs {
+		if isIPv4(addr) == firstIsV4 {
+			first = append(first, addr)
+		} else {
+			second = append(second, addr)
+		}
+	}
+	out := make([]string, 0, len(addrs))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			out = append(out, first[i])
+		}
+		if i < len(second) {
+			out = append(out, second[i])
+		}
+	}
+	return out
+}
+
+// isIPv4 reports whether addr is an IPv4 address
+func isIPv4(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() != nil
+}
@@ -0,0 +1,71 @@
+package golb
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHappyEyeballsAvoidsBlackholedFamily(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	// The backend resolves to a blackholed IPv6 address first: connecting to it hangs
+	const blackhole = "2001:db8::1"
+	resolver := &fakeResolver{answers: map[string][]string{"dual.test": {blackhole, "127.0.0.1"}}}
+	dialer := &net.Dialer{}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, _ := net.SplitHostPort(addr); host == blackhole {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	dnsDialer := newDNSDialer(dial, resolver, time.Minute, nil)
+	dnsDialer.happyEyeballs = happyEyeballsDelay
+	dialers := map[string]func(ctx context.Context, network, addr string) (net.Conn, error){
+		"resolving on every dial": (&happyEyeballsDialer{dial: dial, resolver: resolver, delay: happyEyeballsDelay}).DialContext,
+		"with DNS refresh":        dnsDialer.DialContext,
+	}
+	for name, dialContext := range dialers {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // Stands in for the dial timeout
+			defer cancel()
+			client := &http.Client{Transport: &http.Transport{DialContext: dialContext}}
+			req, _ := http.NewRequestWithContext(ctx, "GET", "http://"+net.JoinHostPort("dual.test", serverURL.Port()), nil)
+
+			start := time.Now()
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Expected the request to reach the backend over IPv4, got %v", err)
+			}
+			_ = resp.Body.Close()
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Expected the connection within about %v, took %v", happyEyeballsDelay, elapsed)
+			}
+		})
+	}
+}
+
+func TestInterleaveFamilies(t *testing.T) {
+	got := interleaveFamilies([]string{"2001:db8::1", "2001:db8::2", "2001:db8::3", "192.0.2.1", "192.0.2.2"})
+	want := []string{"2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2", "2001:db8::3"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	got = interleaveFamilies([]string{"192.0.2.1", "2001:db8::1", "192.0.2.2"})
+	want = []string{"192.0.2.1", "2001:db8::1", "192.0.2.2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected the resolver's first family first, %v, got %v", want, got)
+	}
+}
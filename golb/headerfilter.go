@@ -0,0 +1,60 @@
+package golb
+
+import "net/http"
+
+// hopByHopHeaders are left to httputil.ReverseProxy, which never forwards them but needs
+// Connection and Upgrade to proxy protocol upgrades such as WebSockets
+var hopByHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Proxy-Connection":    true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// headerFilter limits the client request headers forwarded to backends: with an allow list
+// only its headers pass, and headers on the deny list never do
+type headerFilter struct {
+	allow map[string]bool // Nil allows all
+	deny  map[string]bool
+}
+
+// newHeaderFilter builds the filter for the given lists, or returns nil if both are empty
+func newHeaderFilter(allowList, denyList []string) *headerFilter {
+	if len(allowList) == 0 && len(denyList) == 0 {
+		return nil
+	}
+	canonical := func(names []string) map[string]bool {
+		set := make(map[string]bool, len(names))
+		for _, name := range names {
+			set[http.CanonicalHeaderKey(name)] = true
+		}
+		return set
+	}
+	f := &headerFilter{deny: canonical(denyList)}
+	if len(allowList) > 0 {
+		f.allow = canonical(allowList)
+	}
+	return f
+}
+
+func (f *headerFilter) allowed(name string) bool {
+	return (f.allow == nil || f.allow[name]) && !f.deny[name]
+}
+
+// apply removes the headers the filter doesn't let through. X-Forwarded-For is suppressed
+// rather than deleted, as the reverse proxy would add it again.
+func (f *headerFilter) apply(header http.Header) {
+	for name := range header {
+		if !hopByHopHeaders[name] && !f.allowed(name) {
+			delete(header, name)
+		}
+	}
+	if !f.allowed("X-Forwarded-For") {
+		header["X-Forwarded-For"] = nil
+	}
+}
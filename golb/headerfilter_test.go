@@ -0,0 +1,100 @@
+package golb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newHeaderEchoBackend returns the URL of a server that sends back the request headers it got
+func newHeaderEchoBackend(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range r.Header {
+			w.Header()["Echo-"+name] = values
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// forwardedHeaders sends a request with Cookie, Authorization and X-Keep through handler
+// and returns the headers the backend received
+func forwardedHeaders(t *testing.T, handler http.Handler, path string) http.Header {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Cookie", "session=abc")
+	req.Header.Set("Authorization", "Bearer xyz")
+	req.Header.Set("X-Keep", "yes")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, rr.Code)
+	}
+	received := http.Header{}
+	for name, values := range rr.Header() {
+		if original, ok := strings.CutPrefix(name, "Echo-"); ok {
+			received[original] = values
+		}
+	}
+	return received
+}
+
+func TestForwardHeaderLists(t *testing.T) {
+	backend := newHeaderEchoBackend(t)
+	newProxy := func(cfg *Config) *Proxy {
+		pool, err := BuildServerPool(cfg, "round-robin", []string{backend}, nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to build pool: %v", err)
+		}
+		markAllAlive(pool)
+		return NewProxy(pool, cfg)
+	}
+
+	cfg := DefaultConfig()
+	cfg.ForwardHeaderDenyList = []string{"cookie", "Authorization"}
+	got := forwardedHeaders(t, newProxy(cfg), "/")
+	if got.Get("Cookie") != "" || got.Get("Authorization") != "" {
+		t.Errorf("Expected denied headers not to reach the backend, got %v", got)
+	}
+	if got.Get("X-Keep") != "yes" || got.Get("X-Forwarded-For") == "" {
+		t.Errorf("Expected other headers to reach the backend, got %v", got)
+	}
+
+	cfg = DefaultConfig()
+	cfg.ForwardHeaderAllowList = []string{"X-Keep", "Cookie"}
+	cfg.ForwardHeaderDenyList = []string{"Cookie"}
+	got = forwardedHeaders(t, newProxy(cfg), "/")
+	if got.Get("X-Keep") != "yes" {
+		t.Errorf("Expected allowed headers to reach the backend, got %v", got)
+	}
+	for _, name := range []string{"Cookie", "Authorization", "X-Forwarded-For"} {
+		if got.Get(name) != "" {
+			t.Errorf("Expected %s to be kept from the backend by the lists, got %q", name, got.Get(name))
+		}
+	}
+}
+
+func TestForwardHeaderListsPerRoute(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ForwardHeaderDenyList = []string{"Authorization"}
+	cfg.Routes = []RouteConfig{
+		{PathPrefix: "/public", Backends: []string{newHeaderEchoBackend(t)}, ForwardHeaderDenyList: []string{"Cookie", "Authorization"}},
+		{PathPrefix: "/app", Backends: []string{newHeaderEchoBackend(t)}},
+	}
+	router, err := NewRouter(cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	for _, route := range router.Routes() {
+		markAllAlive(route.Pool)
+	}
+
+	if got := forwardedHeaders(t, router, "/public/page"); got.Get("Cookie") != "" || got.Get("Authorization") != "" {
+		t.Errorf("Expected the route's deny list to apply, got %v", got)
+	}
+	if got := forwardedHeaders(t, router, "/app/page"); got.Get("Cookie") == "" || got.Get("Authorization") != "" {
+		t.Errorf("Expected the global deny list on routes without their own, got %v", got)
+	}
+}
@@ -2,71 +2,389 @@ package golb
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
 )
 
-// performHealthCheckCycle runs one round of health checks for all backends
+// PerformHealthCheckCycle runs one round of health checks for all backends. A nil client
+// uses the pool's ManagementClient.
 func (s *ServerPool) PerformHealthCheckCycle(client *http.Client, cfg *Config) {
-	log.Println("Performing health checks...")
-	for _, b := range s.backends {
-		// Perform check and get duration
-		alive, duration := isBackendAlive(client, b, cfg.HealthCheckPath)
-
-		// Update status if changed and log
-		currentStatus := b.IsAlive()
-		if currentStatus != alive {
-			statusStr := "DOWN"
-			if alive {
-				statusStr = "UP"
+	s.logger.Debug("Performing health checks")
+	s.checkBackends(client, cfg, s.snapshotBackends())
+}
+
+// healthCheckDrainLimit caps how much of a health check response body is read so its
+// connection can be reused; longer bodies are dropped along with the connection
+const healthCheckDrainLimit = 64 << 10
+
+// startupCheckInterval is how often WaitUntilReady re-checks backends during the startup grace period
+const startupCheckInterval = 500 * time.Millisecond
+
+// WaitUntilReady runs health check rounds until the pool is Ready or cfg.StartupGracePeriod
+// has passed, so backends that need a moment to warm up are serving before traffic arrives.
+// A zero grace period runs a single round. It returns whether the pool became ready.
+func (s *ServerPool) WaitUntilReady(ctx context.Context, client *http.Client, cfg *Config) bool {
+	deadline := s.clock.Now().Add(cfg.StartupGracePeriod)
+	for {
+		s.PerformHealthCheckCycle(client, cfg)
+		if s.Ready(cfg) {
+			return true
+		}
+		remaining := deadline.Sub(s.clock.Now())
+		if remaining <= 0 {
+			return false
+		}
+		s.logger.Debug("Waiting for backends to warm up", "alive", s.AliveCount(), "remaining", remaining)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-s.clock.After(min(startupCheckInterval, remaining)):
+		}
+	}
+}
+
+// RunHealthChecks checks every backend on its own schedule until ctx is done: healthy
+// backends every cfg.HealthCheckInterval, down ones every cfg.UnhealthyCheckInterval.
+// Backends added later are picked up and first checked one interval after they appear.
+func (s *ServerPool) RunHealthChecks(ctx context.Context, client *http.Client, cfg *Config) {
+	nextCheck := make(map[*Backend]time.Time)
+	wake := s.clock.After(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		}
+
+		// Run due checks and find the earliest upcoming one; never sleep past the shortest
+		// interval, so newly added backends get scheduled promptly
+		backends := s.snapshotBackends()
+		var checks []*Backend
+		for _, b := range backends {
+			if due, scheduled := nextCheck[b]; scheduled && !s.clock.Now().Before(due) {
+				checks = append(checks, b)
 			}
-			log.Printf("HealthCheck: Backend %s status changed to [%s]", b.URL, statusStr)
-			b.SetAlive(alive)
 		}
+		s.checkBackends(client, cfg, checks)
+		for _, b := range checks {
+			delete(nextCheck, b) // Rescheduled below, from its new status
+		}
+
+		earliest := s.clock.Now().Add(min(cfg.HealthCheckInterval, healthCheckInterval(cfg, false)))
+		for _, b := range backends {
+			due, scheduled := nextCheck[b]
+			if !scheduled {
+				due = s.clock.Now().Add(healthCheckInterval(cfg, b.IsAlive()))
+			}
+			nextCheck[b] = due
+			if due.Before(earliest) {
+				earliest = due
+			}
+		}
+		wake = s.clock.After(earliest.Sub(s.clock.Now()))
+	}
+}
+
+// healthCheckInterval returns how long until a backend with the given status is checked again
+func healthCheckInterval(cfg *Config, alive bool) time.Duration {
+	if !alive && cfg.UnhealthyCheckInterval > 0 {
+		return cfg.UnhealthyCheckInterval
+	}
+	return cfg.HealthCheckInterval
+}
+
+// snapshotBackends returns a copy of the backend list, safe to range over while backends are added
+func (s *ServerPool) snapshotBackends() []*Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Backend(nil), s.backends...)
+}
+
+// checkBackends checks backends concurrently, at most cfg.HealthCheckConcurrency at a time,
+// and returns once every check is done or abandoned
+func (s *ServerPool) checkBackends(client *http.Client, cfg *Config, backends []*Backend) {
+	if client == nil {
+		client = s.ManagementClient()
+	}
+	var g errgroup.Group
+	if cfg.HealthCheckConcurrency > 0 {
+		g.SetLimit(cfg.HealthCheckConcurrency)
+	}
+	for _, b := range backends {
+		g.Go(func() error {
+			s.checkBackend(client, cfg, b)
+			return nil
+		})
+	}
+	_ = g.Wait()
+}
+
+// healthCheckTimeout returns the limit for a single health check, 0 for none
+func healthCheckTimeout(cfg *Config) time.Duration {
+	if cfg.HealthCheckTimeout > 0 {
+		return cfg.HealthCheckTimeout
+	}
+	return cfg.BackendRequestTimeout
+}
+
+// checkBackend runs a single health check and applies the result. A check still running
+// at healthCheckTimeout is abandoned and counts as failed: its context is canceled and its
+// result, whenever it comes, ignored, so a hung backend can't hold up the others.
+func (s *ServerPool) checkBackend(client *http.Client, cfg *Config, b *Backend) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout := healthCheckTimeout(cfg); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
 
-		// Update response time metric if the check was successful
-		if alive && duration > 0 {
-			s.lb.UpdateResponseTime(b, duration) // Update EWMA etc. via interface
+	// Perform check and get duration
+	type result struct {
+		alive    bool
+		duration time.Duration
+	}
+	done := make(chan result, 1) // Buffered so an abandoned check can still finish
+	go func() {
+		alive, duration := isBackendAlive(ctx, client, b, cfg, s.logger)
+		done <- result{alive, duration}
+	}()
+	var alive bool
+	var duration time.Duration
+	select {
+	case res := <-done:
+		alive, duration = res.alive, res.duration
+	case <-ctx.Done():
+		s.logger.Debug("Health check timed out", "backend", b.URL.String(), "timeout", healthCheckTimeout(cfg)) // Can be noisy
+	}
+
+	// Update status if changed, log and tell the OnHealthChange callbacks
+	if b.setAlive(alive) {
+		// Recoveries are informational; losing a backend is logged as a warning so it survives -log-level=warn
+		if alive {
+			s.logger.Info("Backend health status changed", "backend", b.URL.String(), "status", "UP")
+			s.notifyBackendAvailable() // Wake requests waiting in GetNextPeer
+		} else {
+			s.logger.Warn("Backend health status changed", "backend", b.URL.String(), "status", "DOWN")
 		}
+		s.notifyHealthChange(b, alive)
+	}
+
+	// Update response time metric if the check was successful
+	if alive && duration > 0 {
+		s.lb.UpdateResponseTime(b, duration) // Update EWMA etc. via interface
 	}
 }
 
-// isBackendAlive performs a single health check GET request
-// Returns alive status and the duration of the check.
-func isBackendAlive(client *http.Client, b *Backend, healthCheckPath string) (bool, time.Duration) {
-	healthURL := b.URL.String() + healthCheckPath
+// isBackendAlive performs a single health check request using the configured method and headers,
+// or a gRPC health check with Config.HealthCheckType "grpc" (see isGRPCBackendServing).
+// The check is bounded by ctx. Returns alive status and the duration of the check.
+func isBackendAlive(ctx context.Context, client *http.Client, b *Backend, cfg *Config, logger Logger) (bool, time.Duration) {
+	if cfg.HealthCheckType == HealthCheckTypeGRPC {
+		return isGRPCBackendServing(ctx, client, b, cfg, logger)
+	}
+	healthURL := b.HealthCheckURL(cfg.HealthCheckPath)
 	startTime := time.Now()
 
-	req, err := http.NewRequestWithContext(context.Background(), "GET", healthURL, nil)
+	method := cfg.HealthCheckMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, healthURL, nil)
 	if err != nil {
 		// Log locally, don't affect overall check status necessarily here
-		log.Printf("Error creating health check request for %s: %v", b.URL, err)
+		logger.Error("Error creating health check request", "backend", b.URL.String(), "error", err)
 		return false, 0 // Cannot reach, definitely not alive
 	}
+	for name, value := range cfg.HealthCheckHeaders {
+		req.Header.Set(name, value)
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host // net/http ignores a Host header; it must be set on the request
+	}
 
 	resp, err := client.Do(req)
 	duration := time.Since(startTime) // Measure duration regardless of success/failure
 
 	if err != nil {
 		// Network errors mean it's down
-		log.Printf("Health check failed for %s: %v\n", b.URL, err) // Can be noisy
+		logger.Debug("Health check failed", "backend", b.URL.String(), "error", err) // Can be noisy
 		return false, duration
 	}
 	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, healthCheckDrainLimit)) // Lets the connection be reused
 		cerr := resp.Body.Close()
 		if cerr != nil && err != nil {
-			log.Printf("Error closing response body for %s: %v", b.URL, err)
+			logger.Error("Error closing response body", "backend", b.URL.String(), "error", err)
 			err = cerr
 		}
 	}()
 
-	// Any status other than 200 OK means unhealthy
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Health check non-OK for %s: Status %d\n", b.URL, resp.StatusCode) // Can be noisy
+	// Any status outside the expected ones means unhealthy
+	if !cfg.healthyStatuses().contains(resp.StatusCode) {
+		logger.Debug("Health check non-OK", "backend", b.URL.String(), "status", resp.StatusCode) // Can be noisy
 		return false, duration
 	}
+	if cfg.HealthCheckCapacityHeader != "" {
+		applyReportedCapacity(b, resp.Header.Get(cfg.HealthCheckCapacityHeader), logger)
+	}
 
 	// Success!
 	return true, duration
 }
+
+// applyReportedCapacity sets b's weight to the capacity it reported in a health check
+// response, see Config.HealthCheckCapacityHeader. When a backend stops reporting a valid
+// capacity its configured weight is restored; backends that never reported one keep
+// whatever weight SetWeight gave them. Backends whose weight a cutover steers, or that a
+// cutover drained, are left alone. The weight is only set when it changes, as SetWeight
+// restarts weighted round robin's smoothing.
+func applyReportedCapacity(b *Backend, value string, logger Logger) {
+	if b.cutoverWeight.Load() {
+		return
+	}
+	capacity, err := strconv.Atoi(strings.TrimSpace(value))
+	if value == "" || err != nil || capacity < 0 {
+		if value != "" {
+			logger.Debug("Ignoring invalid reported capacity", "backend", b.URL.String(), "capacity", value)
+		}
+		if b.capacityReported.Swap(false) {
+			b.SetWeight(b.configuredWeight)
+		}
+		return
+	}
+	b.capacityReported.Store(true)
+	if b.GetWeight() != capacity {
+		b.SetWeight(capacity)
+	}
+}
+
+// statusRanges is a set of HTTP status codes as inclusive ranges
+type statusRanges [][2]int
+
+// parseStatusRanges parses a comma-separated list of status codes ("204"), ranges ("200-299")
+// and classes ("2xx"). An empty spec means 200 only.
+func parseStatusRanges(spec string) (statusRanges, error) {
+	if strings.TrimSpace(spec) == "" {
+		return statusRanges{{http.StatusOK, http.StatusOK}}, nil
+	}
+	var ranges statusRanges
+	for _, part := range parseCommaSeparatedString(spec) {
+		lo, hi, isRange := strings.Cut(part, "-")
+		if class, ok := strings.CutSuffix(strings.ToLower(part), "xx"); ok && !isRange {
+			n, err := strconv.Atoi(class)
+			if err != nil || n < 1 || n > 5 {
+				return nil, fmt.Errorf("invalid status class %q", part)
+			}
+			ranges = append(ranges, [2]int{n * 100, n*100 + 99})
+			continue
+		}
+		if !isRange {
+			hi = lo
+		}
+		low, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		high, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || low < 100 || high > 599 || low > high {
+			return nil, fmt.Errorf("invalid status code or range %q", part)
+		}
+		ranges = append(ranges, [2]int{low, high})
+	}
+	return ranges, nil
+}
+
+// healthyStatuses returns cfg.HealthCheckExpectedStatuses as parsed by validateConfig, or
+// parses it now for a Config used without validation, e.g. passed straight to
+// BuildServerPool. An invalid spec then means the default, 200 only.
+func (cfg *Config) healthyStatuses() statusRanges {
+	if cfg.expectedStatuses != nil {
+		return cfg.expectedStatuses
+	}
+	ranges, _ := parseStatusRanges(string(cfg.HealthCheckExpectedStatuses))
+	return ranges
+}
+
+// contains reports whether status is in any of the ranges; no ranges means 200 only
+func (r statusRanges) contains(status int) bool {
+	if len(r) == 0 {
+		return status == http.StatusOK
+	}
+	for _, rng := range r {
+		if status >= rng[0] && status <= rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusCodes is the spec of Config.HealthCheckExpectedStatuses (see parseStatusRanges).
+// Config files may also give it as a list of codes and specs, e.g. [200, 204] or
+// ["2xx", 304], which is joined with commas.
+type StatusCodes string
+
+// UnmarshalYAML accepts a scalar spec or a sequence of them
+func (s *StatusCodes) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.SequenceNode {
+		var spec string
+		if err := value.Decode(&spec); err != nil {
+			return err
+		}
+		*s = StatusCodes(spec)
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*s = StatusCodes(strings.Join(list, ","))
+	return nil
+}
+
+// UnmarshalJSON accepts a string, a number or an array of them
+func (s *StatusCodes) UnmarshalJSON(data []byte) error {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		list = []json.RawMessage{data}
+	}
+	parts := make([]string, 0, len(list))
+	for _, item := range list {
+		var spec string
+		if err := json.Unmarshal(item, &spec); err != nil {
+			var code json.Number
+			if err := json.Unmarshal(item, &code); err != nil {
+				return fmt.Errorf("expected status codes as a string, number or list, got %s", item)
+			}
+			spec = code.String()
+		}
+		parts = append(parts, spec)
+	}
+	*s = StatusCodes(strings.Join(parts, ","))
+	return nil
+}
+
+// UnmarshalTOML accepts a string, an integer or an array of them
+func (s *StatusCodes) UnmarshalTOML(value any) error {
+	list, ok := value.([]any)
+	if !ok {
+		list = []any{value}
+	}
+	parts := make([]string, 0, len(list))
+	for _, item := range list {
+		switch item := item.(type) {
+		case string:
+			parts = append(parts, item)
+		case int64:
+			parts = append(parts, strconv.FormatInt(item, 10))
+		default:
+			return fmt.Errorf("expected status codes as a string, integer or list, got %v", item)
+		}
+	}
+	*s = StatusCodes(strings.Join(parts, ","))
+	return nil
+}
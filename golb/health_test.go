@@ -0,0 +1,350 @@
+package golb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckMethodAndHeaders(t *testing.T) {
+	var gotMethod, gotAuth string
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotAuth = r.Method, r.Header.Get("Authorization")
+		if r.Method != http.MethodHead || gotAuth != "Bearer health-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	backend.SetAlive(false)
+
+	cfg := DefaultConfig()
+	cfg.HealthCheckMethod = http.MethodHead
+	cfg.HealthCheckHeaders = map[string]string{"Authorization": "Bearer health-token"}
+	pool.PerformHealthCheckCycle(&http.Client{Timeout: cfg.BackendRequestTimeout}, cfg)
+
+	if gotMethod != http.MethodHead {
+		t.Errorf("Expected a HEAD health check, got %s", gotMethod)
+	}
+	if gotAuth != "Bearer health-token" {
+		t.Errorf("Expected the configured Authorization header, got %q", gotAuth)
+	}
+	if !backend.IsAlive() {
+		t.Errorf("Expected backend to be marked alive by the HEAD check")
+	}
+
+	// Without the headers the same endpoint reports the backend down
+	cfg.HealthCheckHeaders = nil
+	pool.PerformHealthCheckCycle(&http.Client{Timeout: cfg.BackendRequestTimeout}, cfg)
+	if backend.IsAlive() {
+		t.Errorf("Expected backend to be marked down without the auth header")
+	}
+}
+
+func TestEnvHeaders(t *testing.T) {
+	t.Setenv(EnvPrefix+"HEALTH_CHECK_HEADERS", "Authorization: Bearer abc, X-Probe:1")
+	cfg := DefaultConfig()
+	loadConfigFromEnv(cfg)
+
+	if cfg.HealthCheckHeaders["Authorization"] != "Bearer abc" || cfg.HealthCheckHeaders["X-Probe"] != "1" {
+		t.Errorf("Unexpected headers from env: %v", cfg.HealthCheckHeaders)
+	}
+	if redacted := cfg.Redacted(); redacted.HealthCheckHeaders["Authorization"] != "REDACTED" || cfg.HealthCheckHeaders["Authorization"] != "Bearer abc" {
+		t.Errorf("Expected header values redacted in a copy only, got %v", redacted.HealthCheckHeaders)
+	}
+}
+
+func TestUnhealthyBackendCheckedMoreOften(t *testing.T) {
+	var healthyChecks, downChecks atomic.Int64
+	pool, healthy := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		healthyChecks.Add(1)
+	}))
+	_, down := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downChecks.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	down.SetAlive(false)
+	pool.AddBackend(down)
+
+	cfg := DefaultConfig()
+	cfg.HealthCheckInterval = 150 * time.Millisecond
+	cfg.UnhealthyCheckInterval = 20 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	pool.RunHealthChecks(ctx, &http.Client{Timeout: time.Second}, cfg)
+
+	// ~2 checks at 150ms for the healthy backend vs ~19 at 20ms for the down one
+	if n := healthyChecks.Load(); n < 1 || n > 3 {
+		t.Errorf("Expected the healthy backend checked at the regular interval, got %d checks", n)
+	}
+	if n := downChecks.Load(); n < 8 {
+		t.Errorf("Expected the down backend re-checked at the faster interval, got %d checks", n)
+	}
+	if !healthy.IsAlive() || down.IsAlive() {
+		t.Errorf("Expected statuses to be unchanged")
+	}
+}
+
+func TestHealthCheckURLOverride(t *testing.T) {
+	var sidecarChecks, mainChecks atomic.Int64
+	sidecar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sidecarChecks.Add(1)
+	}))
+	t.Cleanup(sidecar.Close)
+	main := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			mainChecks.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable) // Would fail the check if it were asked
+			return
+		}
+		_, _ = io.WriteString(w, "main")
+	}))
+	t.Cleanup(main.Close)
+
+	cfg := DefaultConfig()
+	cfg.BackendOptions = map[string]BackendOptions{main.URL: {HealthCheckURL: sidecar.URL + "/ready"}}
+	pool, err := BuildServerPool(cfg, "round-robin", []string{main.URL}, nil, NewTransport(cfg))
+	if err != nil {
+		t.Fatalf("Failed to build pool: %v", err)
+	}
+	pool.SetLogger(&captureLogger{})
+	pool.PerformHealthCheckCycle(&http.Client{Timeout: cfg.BackendRequestTimeout}, cfg)
+
+	if sidecarChecks.Load() != 1 || mainChecks.Load() != 0 {
+		t.Errorf("Expected the health check on the override URL only, got %d sidecar and %d main checks", sidecarChecks.Load(), mainChecks.Load())
+	}
+	if pool.AliveCount() != 1 {
+		t.Fatalf("Expected the backend marked alive by the sidecar check")
+	}
+	rr := httptest.NewRecorder()
+	NewProxy(pool, cfg).ServeHTTP(rr, httptest.NewRequest("GET", "/page", nil))
+	if rr.Body.String() != "main" {
+		t.Errorf("Expected traffic to go to the backend URL, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHealthCheckExpectedStatuses(t *testing.T) {
+	var status atomic.Int64
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	client := &http.Client{}
+
+	for _, tc := range []struct {
+		spec   string
+		status int
+		alive  bool
+	}{
+		{"", http.StatusOK, true}, // Default: 200 only
+		{"", http.StatusNoContent, false},
+		{"200,204", http.StatusNoContent, true},
+		{"200,204", http.StatusInternalServerError, false},
+		{"2xx", http.StatusAccepted, true},
+		{"2xx", http.StatusInternalServerError, false},
+		{"200-299, 404", http.StatusNotFound, true},
+	} {
+		cfg := DefaultConfig()
+		cfg.HealthCheckExpectedStatuses = StatusCodes(tc.spec)
+		if err := validateConfig(cfg); err != nil {
+			t.Fatalf("Unexpected validation error for %q: %v", tc.spec, err)
+		}
+		status.Store(int64(tc.status))
+		backend.SetAlive(!tc.alive)
+		pool.PerformHealthCheckCycle(client, cfg)
+		if backend.IsAlive() != tc.alive {
+			t.Errorf("Expected status %d with %q to report alive=%v", tc.status, tc.spec, tc.alive)
+		}
+	}
+
+	// Library users may skip validateConfig: the spec is parsed when the check needs it
+	cfg := DefaultConfig()
+	cfg.HealthCheckExpectedStatuses = "2xx"
+	status.Store(http.StatusNoContent)
+	backend.SetAlive(false)
+	pool.PerformHealthCheckCycle(client, cfg)
+	if !backend.IsAlive() {
+		t.Error("Expected an unvalidated config's expected statuses to apply")
+	}
+
+	for _, spec := range []string{"ok", "6xx", "299-200", "200-", "99"} {
+		if _, err := parseStatusRanges(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestOnHealthChange(t *testing.T) {
+	var healthy atomic.Bool
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	backend.SetAlive(false)
+
+	type change struct {
+		backend *Backend
+		alive   bool
+	}
+	first, second := make(chan change, 10), make(chan change, 10)
+	pool.OnHealthChange(func(b *Backend, alive bool) { first <- change{b, alive} })
+	pool.OnHealthChange(func(b *Backend, alive bool) { panic("broken callback") }) // Must not stop the others
+	pool.OnHealthChange(func(b *Backend, alive bool) { second <- change{b, alive} })
+
+	cfg := DefaultConfig()
+	client := &http.Client{Timeout: cfg.BackendRequestTimeout}
+	expect := func(alive bool) {
+		t.Helper()
+		for _, ch := range []chan change{first, second} {
+			select {
+			case got := <-ch:
+				if got.backend != backend || got.alive != alive {
+					t.Errorf("Expected a change of %s to alive=%v, got %s alive=%v", backend.URL, alive, got.backend.URL, got.alive)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Expected a callback for the change to alive=%v", alive)
+			}
+		}
+	}
+
+	healthy.Store(true)
+	pool.PerformHealthCheckCycle(client, cfg)
+	expect(true)
+
+	// A check confirming the current status is not a change
+	pool.PerformHealthCheckCycle(client, cfg)
+	healthy.Store(false)
+	pool.PerformHealthCheckCycle(client, cfg)
+	expect(false)
+	select {
+	case got := <-first:
+		t.Errorf("Expected one callback per change, got an extra one for alive=%v", got.alive)
+	default:
+	}
+
+	// Requests marking the backend down count as changes too
+	healthy.Store(true)
+	pool.PerformHealthCheckCycle(client, cfg)
+	expect(true)
+	pool.MarkBackendStatus(backend.URL, false)
+	expect(false)
+}
+
+// hangingTransport never answers requests to host, ignoring their context like a stuck
+// dependency would, and sends the rest over http.DefaultTransport
+type hangingTransport struct {
+	host    string
+	release chan struct{}
+}
+
+func (h *hangingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == h.host {
+		<-h.release
+		return nil, context.Canceled
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestHealthCheckTimeoutAbandonsHungBackend(t *testing.T) {
+	pool := NewServerPool(NewRoundRobinBalancer())
+	for range 3 {
+		_, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		backend.SetAlive(true)
+		pool.AddBackend(backend)
+	}
+	hung := pool.backends[1]
+	transport := &hangingTransport{host: hung.URL.Host, release: make(chan struct{})}
+	defer close(transport.release)
+
+	cfg := DefaultConfig()
+	cfg.HealthCheckConcurrency = 1 // The hung check must not hold up the ones queued behind it
+	cfg.HealthCheckTimeout = 100 * time.Millisecond
+	start := time.Now()
+	pool.PerformHealthCheckCycle(&http.Client{Transport: transport}, cfg)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the cycle to finish soon after the %v timeout, took %v", cfg.HealthCheckTimeout, elapsed)
+	}
+	if hung.IsAlive() {
+		t.Error("Expected the hung backend to be marked down")
+	}
+	for _, b := range []*Backend{pool.backends[0], pool.backends[2]} {
+		if !b.IsAlive() {
+			t.Errorf("Expected %s to stay alive", b.URL)
+		}
+	}
+}
+
+func TestHealthCheckCapacityHeader(t *testing.T) {
+	var capacity atomic.Value
+	capacity.Store("")
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if value := capacity.Load().(string); value != "" {
+			w.Header().Set("X-Capacity", value)
+		}
+	}))
+	configured := backend.GetWeight()
+	cfg := DefaultConfig()
+	cfg.HealthCheckCapacityHeader = "X-Capacity"
+	client := &http.Client{}
+
+	for _, tc := range []struct {
+		header string
+		weight int
+	}{
+		{"80", 80},
+		{"35", 35},
+		{" 50 ", 50},
+		{"", configured}, // Absent: back to the configured weight
+		{"90", 90},
+		{"lots", configured},
+		{"-5", configured},
+		{"0", 0},
+	} {
+		capacity.Store(tc.header)
+		pool.PerformHealthCheckCycle(client, cfg)
+		if got := backend.GetWeight(); got != tc.weight {
+			t.Errorf("Expected weight %d after reporting %q, got %d", tc.weight, tc.header, got)
+		}
+	}
+
+	// Without the option the header is ignored
+	backend.SetWeight(configured)
+	capacity.Store("70")
+	pool.PerformHealthCheckCycle(client, DefaultConfig())
+	if got := backend.GetWeight(); got != configured {
+		t.Errorf("Expected the configured weight %d without a capacity header option, got %d", configured, got)
+	}
+
+	// A weight set at runtime survives backends that don't report a capacity
+	capacity.Store("")
+	pool.PerformHealthCheckCycle(client, cfg) // Clears the capacity reported earlier
+	backend.SetWeight(5)
+	pool.PerformHealthCheckCycle(client, cfg)
+	pool.PerformHealthCheckCycle(client, cfg)
+	if got := backend.GetWeight(); got != 5 {
+		t.Errorf("Expected SetWeight's 5 to be kept without a reported capacity, got %d", got)
+	}
+
+	// A cutover's weights aren't overridden by reported capacities
+	clock := newFakeClock()
+	pool.SetClock(clock)
+	green, _ := url.Parse("http://127.0.0.1:1")
+	pool.AddBackend(NewBackend(green, nil, 1))
+	backend.SetTags("blue")
+	pool.backends[1].SetTags("green")
+	if err := pool.BeginCutover("blue", "green", time.Hour); err != nil {
+		t.Fatalf("Failed to begin cutover: %v", err)
+	}
+	during := backend.GetWeight()
+	capacity.Store("80")
+	pool.PerformHealthCheckCycle(client, cfg)
+	if got := backend.GetWeight(); got != during {
+		t.Errorf("Expected the cutover weight %d to be kept, got %d", during, got)
+	}
+}
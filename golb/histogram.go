@@ -0,0 +1,59 @@
+package golb
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// durationBucketBounds are the upper bounds of the request duration histogram exported in
+// /metrics; longer requests fall in the +Inf bucket
+var durationBucketBounds = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// Exemplar is a representative request of a histogram bucket, linking the metric to its trace
+type Exemplar struct {
+	TraceID string
+	Value   time.Duration
+	Time    time.Time
+}
+
+// durationHistogram counts request durations in durationBucketBounds and keeps the latest
+// traced request of each bucket as its exemplar. Unlike latencyHistogram its buckets are
+// coarse and fixed, so they can be exported as a Prometheus histogram.
+type durationHistogram struct {
+	buckets   []atomic.Uint64 // Not cumulative; len(durationBucketBounds)+1, last is +Inf
+	exemplars []atomic.Pointer[Exemplar]
+	count     atomic.Uint64
+	sum       atomic.Int64 // Nanoseconds
+}
+
+func newDurationHistogram() *durationHistogram {
+	n := len(durationBucketBounds) + 1
+	return &durationHistogram{buckets: make([]atomic.Uint64, n), exemplars: make([]atomic.Pointer[Exemplar], n)}
+}
+
+// Observe records d, making it its bucket's exemplar if traceID isn't empty
+func (h *durationHistogram) Observe(d time.Duration, traceID string) {
+	i := len(durationBucketBounds)
+	for j, bound := range durationBucketBounds {
+		if d <= bound {
+			i = j
+			break
+		}
+	}
+	h.buckets[i].Add(1)
+	h.sum.Add(int64(d))
+	h.count.Add(1)
+	if traceID != "" {
+		h.exemplars[i].Store(&Exemplar{TraceID: traceID, Value: d, Time: time.Now()})
+	}
+}
+
+// Exemplar returns the exemplar of bucket i (an index into durationBucketBounds, or its
+// length for +Inf), or nil if no traced request fell in it
+func (h *durationHistogram) Exemplar(i int) *Exemplar {
+	return h.exemplars[i].Load()
+}
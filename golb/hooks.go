@@ -0,0 +1,67 @@
+package golb
+
+import "runtime/debug"
+
+// HealthChangeFunc is called with a backend whose status changed and its new status
+type HealthChangeFunc func(b *Backend, alive bool)
+
+// healthEvent is a status change waiting for the OnHealthChange callbacks
+type healthEvent struct {
+	backend *Backend
+	alive   bool
+}
+
+// OnHealthChange registers fn to be called whenever a backend goes UP (alive) or DOWN, be
+// it through a health check or a failed request marking it down; checks that confirm the
+// current status don't call it. Callbacks run one change at a time on a separate goroutine,
+// in the order the changes happened, so a slow callback delays later notifications but never
+// health checks or requests. A panicking callback is logged and skipped.
+func (s *ServerPool) OnHealthChange(fn HealthChangeFunc) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	// Copy on write, so a running dispatch keeps the list it started with
+	s.healthHooks = append(s.healthHooks[:len(s.healthHooks):len(s.healthHooks)], fn)
+}
+
+// notifyHealthChange queues a status change for the OnHealthChange callbacks
+func (s *ServerPool) notifyHealthChange(b *Backend, alive bool) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	if len(s.healthHooks) == 0 {
+		return
+	}
+	s.healthEvents = append(s.healthEvents, healthEvent{backend: b, alive: alive})
+	if !s.hooksRunning {
+		s.hooksRunning = true
+		go s.dispatchHealthChanges()
+	}
+}
+
+// dispatchHealthChanges runs the callbacks for queued changes until the queue is empty
+func (s *ServerPool) dispatchHealthChanges() {
+	for {
+		s.hooksMu.Lock()
+		if len(s.healthEvents) == 0 {
+			s.hooksRunning = false
+			s.hooksMu.Unlock()
+			return
+		}
+		event := s.healthEvents[0]
+		s.healthEvents = s.healthEvents[1:]
+		hooks := s.healthHooks
+		s.hooksMu.Unlock()
+
+		for _, fn := range hooks {
+			s.runHealthHook(fn, event)
+		}
+	}
+}
+
+func (s *ServerPool) runHealthHook(fn HealthChangeFunc, event healthEvent) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			s.logger.Error("Health change callback panicked", "backend", event.backend.URL.String(), "panic", rec, "stack", string(debug.Stack()))
+		}
+	}()
+	fn(event.backend, event.alive)
+}
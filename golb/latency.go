@@ -0,0 +1,114 @@
+package golb
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Latency histogram bucket layout: upper bounds grow geometrically by latencyBucketGrowth from
+// latencyMinBound, so any percentile is accurate to within one bucket (~10% relative error)
+// across the whole range while memory stays fixed per backend.
+const (
+	latencyMinBound     = 50 * time.Microsecond
+	latencyMaxBound     = 2 * time.Minute
+	latencyBucketGrowth = 1.1
+)
+
+// latencyBucketBounds holds the inclusive upper bound of each bucket; larger samples go to an overflow bucket
+var latencyBucketBounds = func() []time.Duration {
+	var bounds []time.Duration
+	for b := float64(latencyMinBound); b < float64(latencyMaxBound); b *= latencyBucketGrowth {
+		bounds = append(bounds, time.Duration(b))
+	}
+	return append(bounds, latencyMaxBound)
+}()
+
+// latencyHistogram is a fixed-bucket latency histogram. Updates are lock-free atomic increments;
+// readers may see a sample counted in total before its bucket, which only skews a percentile
+// by that sample.
+type latencyHistogram struct {
+	buckets []atomic.Uint64 // len(latencyBucketBounds)+1, last is overflow
+	count   atomic.Uint64
+	sum     atomic.Int64 // Nanoseconds
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{buckets: make([]atomic.Uint64, len(latencyBucketBounds)+1)}
+}
+
+// bucketIndex finds the first bucket whose upper bound is >= d
+func bucketIndex(d time.Duration) int {
+	if d <= latencyMinBound {
+		return 0
+	}
+	if d > latencyMaxBound {
+		return len(latencyBucketBounds)
+	}
+	// Estimate from the geometric layout, then correct for float rounding at bucket edges
+	i := int(math.Log(float64(d)/float64(latencyMinBound)) / math.Log(latencyBucketGrowth))
+	for i > 0 && latencyBucketBounds[i-1] >= d {
+		i--
+	}
+	for latencyBucketBounds[i] < d {
+		i++
+	}
+	return i
+}
+
+// Observe records a single latency sample
+func (h *latencyHistogram) Observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.buckets[bucketIndex(d)].Add(1)
+	h.sum.Add(int64(d))
+	h.count.Add(1)
+}
+
+// Count returns the number of samples recorded
+func (h *latencyHistogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum returns the total of all samples recorded
+func (h *latencyHistogram) Sum() time.Duration {
+	return time.Duration(h.sum.Load())
+}
+
+// Percentile estimates the q-th quantile (0 < q <= 1), interpolating linearly within the
+// bucket that holds it. Returns 0 when no samples have been recorded.
+func (h *latencyHistogram) Percentile(q float64) time.Duration {
+	counts := make([]uint64, len(h.buckets))
+	var total uint64
+	for i := range h.buckets {
+		counts[i] = h.buckets[i].Load()
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+	q = math.Min(math.Max(q, 0), 1)
+	rank := math.Max(1, math.Ceil(q*float64(total)))
+
+	var seen uint64
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+		if float64(seen+c) >= rank {
+			if i == len(latencyBucketBounds) {
+				return latencyMaxBound // Overflow bucket has no upper bound to interpolate to
+			}
+			lower := time.Duration(0)
+			if i > 0 {
+				lower = latencyBucketBounds[i-1]
+			}
+			upper := latencyBucketBounds[i]
+			fraction := (rank - float64(seen)) / float64(c)
+			return lower + time.Duration(fraction*float64(upper-lower))
+		}
+		seen += c
+	}
+	return latencyMaxBound
+}
@@ -0,0 +1,236 @@
+package golb
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withinTolerance reports whether got is within frac (relative) of want
+func withinTolerance(got, want time.Duration, frac float64) bool {
+	return math.Abs(float64(got-want)) <= frac*float64(want)
+}
+
+func TestLatencyHistogramPercentilesUniform(t *testing.T) {
+	h := newLatencyHistogram()
+	// 1ms..1000ms, each once, in shuffled order
+	for _, i := range rand.New(rand.NewSource(1)).Perm(1000) {
+		h.Observe(time.Duration(i+1) * time.Millisecond)
+	}
+
+	for q, want := range map[float64]time.Duration{
+		0.5:  500 * time.Millisecond,
+		0.9:  900 * time.Millisecond,
+		0.99: 990 * time.Millisecond,
+	} {
+		if got := h.Percentile(q); !withinTolerance(got, want, 0.1) {
+			t.Errorf("p%g = %v, want %v within 10%%", q*100, got, want)
+		}
+	}
+	if h.Count() != 1000 {
+		t.Errorf("Expected count 1000, got %d", h.Count())
+	}
+	if want := 500500 * time.Millisecond; h.Sum() != want {
+		t.Errorf("Expected sum %v, got %v", want, h.Sum())
+	}
+}
+
+func TestLatencyHistogramPercentilesBimodal(t *testing.T) {
+	h := newLatencyHistogram()
+	// 95% fast requests around 2ms, 5% slow ones around 800ms
+	for i := 0; i < 950; i++ {
+		h.Observe(2 * time.Millisecond)
+	}
+	for i := 0; i < 50; i++ {
+		h.Observe(800 * time.Millisecond)
+	}
+
+	if got := h.Percentile(0.5); !withinTolerance(got, 2*time.Millisecond, 0.1) {
+		t.Errorf("p50 = %v, want ~2ms", got)
+	}
+	if got := h.Percentile(0.9); !withinTolerance(got, 2*time.Millisecond, 0.1) {
+		t.Errorf("p90 = %v, want ~2ms", got)
+	}
+	if got := h.Percentile(0.99); !withinTolerance(got, 800*time.Millisecond, 0.1) {
+		t.Errorf("p99 = %v, want ~800ms", got)
+	}
+}
+
+func TestLatencyHistogramEdges(t *testing.T) {
+	h := newLatencyHistogram()
+	if got := h.Percentile(0.99); got != 0 {
+		t.Errorf("Expected 0 for empty histogram, got %v", got)
+	}
+
+	h.Observe(-time.Second) // Clamped to 0
+	h.Observe(time.Hour)    // Overflow
+	if got := h.Percentile(0.5); got > latencyMinBound {
+		t.Errorf("Expected p50 within the first bucket, got %v", got)
+	}
+	if got := h.Percentile(1); got != latencyMaxBound {
+		t.Errorf("Expected overflow to report %v, got %v", latencyMaxBound, got)
+	}
+
+	for _, d := range latencyBucketBounds {
+		i := bucketIndex(d)
+		if latencyBucketBounds[i] != d {
+			t.Fatalf("bucketIndex(%v) = %d with bound %v, want exact bucket", d, i, latencyBucketBounds[i])
+		}
+		if d > latencyMinBound && bucketIndex(d+1) != i+1 {
+			t.Fatalf("bucketIndex(%v) should be the next bucket after %d", d+1, i)
+		}
+	}
+}
+
+func TestLatencyHistogramConcurrentObserve(t *testing.T) {
+	h := newLatencyHistogram()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				h.Observe(10 * time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+	if h.Count() != 8000 {
+		t.Errorf("Expected 8000 samples, got %d", h.Count())
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	u, _ := url.Parse("http://backend-a:8080")
+	backend := NewBackend(u, nil, 1)
+	backend.SetAlive(true)
+	for i := 1; i <= 100; i++ {
+		backend.ObserveLatency(time.Duration(i) * time.Millisecond)
+	}
+	pool := NewServerPool(NewRoundRobinBalancer())
+	pool.AddBackend(backend)
+
+	rr := httptest.NewRecorder()
+	MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil), pool)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`golb_backend_up{backend="http://backend-a:8080"} 1`,
+		`# TYPE golb_backend_response_time_seconds summary`,
+		`golb_backend_response_time_seconds{backend="http://backend-a:8080",quantile="0.99"}`,
+		`golb_backend_response_time_seconds_count{backend="http://backend-a:8080"} 100`,
+		`golb_backend_response_time_seconds_sum{backend="http://backend-a:8080"} 5.05`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsLabelValue(t *testing.T) {
+	// Only backslash, double quote and line feed are escaped; tabs and UTF-8 stay literal
+	got := labelValue("a\\b\"c\nd\tü")
+	if want := `"a\\b\"c\nd` + "\tü" + `"`; got != want {
+		t.Errorf("Expected label value %s, got %s", want, got)
+	}
+}
+
+func TestMetricsExemplars(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	u, _ := url.Parse("http://backend-a:8080")
+	backend := NewBackend(u, nil, 1)
+	backend.ObserveLatencyCtx(WithTraceID(context.Background(), traceID), 30*time.Millisecond)
+	backend.ObserveLatency(3 * time.Millisecond) // Untraced: counted, but no exemplar
+	pool := NewServerPool(NewRoundRobinBalancer())
+	pool.AddBackend(backend)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+	rr := httptest.NewRecorder()
+	MetricsHandler(rr, req, pool)
+	body := rr.Body.String()
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("Expected OpenMetrics for a scraper preferring it, got %q", ct)
+	}
+	for _, want := range []string{
+		`# TYPE golb_backend_requests counter`,
+		`# TYPE golb_backend_request_duration_seconds histogram`,
+		`golb_backend_request_duration_seconds_bucket{backend="http://backend-a:8080",le="0.005"} 1` + "\n",
+		`golb_backend_request_duration_seconds_bucket{backend="http://backend-a:8080",le="0.05"} 2 # {trace_id="` + traceID + `"} 0.03 `,
+		`golb_backend_request_duration_seconds_bucket{backend="http://backend-a:8080",le="+Inf"} 2` + "\n",
+		`golb_backend_request_duration_seconds_count{backend="http://backend-a:8080"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Error("Expected OpenMetrics output to end with # EOF")
+	}
+
+	// The Prometheus text format has no exemplar syntax
+	rr = httptest.NewRecorder()
+	MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil), pool)
+	if body := rr.Body.String(); strings.Contains(body, "trace_id") || !strings.Contains(body, `le="0.05"} 2`) {
+		t.Errorf("Expected the histogram without exemplars in the text format, got:\n%s", body)
+	}
+}
+
+func TestProxyRecordsTraceExemplar(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	proxy := NewProxy(pool, nil)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	var e *Exemplar
+	for i := range backend.durations.buckets {
+		if e == nil {
+			e = backend.durations.Exemplar(i)
+		}
+	}
+	if e == nil || e.TraceID != "0af7651916cd43dd8448eb211c80319c" {
+		t.Fatalf("Expected the traceparent trace ID as the bucket's exemplar, got %+v", e)
+	}
+
+	// Without a valid trace ID the request is counted but leaves the exemplar alone
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-00000000000000000000000000000000-b7ad6b7169203331-01")
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+	if got := backend.durations.count.Load(); got != 2 {
+		t.Errorf("Expected 2 observations, got %d", got)
+	}
+	for i := range backend.durations.buckets {
+		if got := backend.durations.Exemplar(i); got != nil && got != e {
+			t.Errorf("Expected an invalid trace ID not to become an exemplar, got %+v", got)
+		}
+	}
+}
+
+func TestProxyRecordsBackendLatency(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	proxy := NewProxy(pool, nil)
+	for i := 0; i < 3; i++ {
+		proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	if backend.latency.Count() != 3 {
+		t.Fatalf("Expected 3 latency samples, got %d", backend.latency.Count())
+	}
+	if p50 := backend.LatencyPercentile(0.5); p50 < 18*time.Millisecond {
+		t.Errorf("Expected p50 of at least ~20ms, got %v", p50)
+	}
+}
@@ -1,18 +1,20 @@
 package golb
 
 import (
-	"log"
 	"math"
+	"sync"
 	"sync/atomic"
 	"time"
 	// Note: No direct dependency on 'Backend' struct fields like 'weight' here,
 	// it accesses them via the passed-in slice.
 )
 
-// LoadBalancer defines the contract for backend selection strategies.
+// LoadBalancer defines the contract for backend selection strategies. Strategies that need
+// request metadata (client IP, hash key, tags) also implement ContextLoadBalancer.
 type LoadBalancer interface {
-	// SelectBackend picks the next backend based on the strategy.
-	// Implementations should only return backends confirmed to be Alive, or nil if none are available.
+	// SelectBackend picks the next backend based on the strategy, or nil if none are available.
+	// ServerPool only passes backends that are alive, so implementations need not check
+	// liveness, but must skip backends without capacity (ejected or at their connection limit).
 	SelectBackend(backends []*Backend) *Backend
 
 	// UpdateResponseTime allows strategies to react to latency measurements.
@@ -39,7 +41,7 @@ func (r *RoundRobinBalancer) SelectBackend(backends []*Backend) *Backend {
 	for i := uint64(0); i < numBackends; i++ {
 		idx := (startIndex + i) % numBackends
 		backend := backends[idx]
-		if backend.IsAlive() {
+		if backend.hasCapacity() {
 			atomic.StoreUint64(&r.current, (idx+1)%numBackends)
 			return backend
 		}
@@ -49,20 +51,41 @@ func (r *RoundRobinBalancer) SelectBackend(backends []*Backend) *Backend {
 
 func (r *RoundRobinBalancer) UpdateResponseTime(backend *Backend, duration time.Duration) {}
 
+// --- Tie Breaking ---
+
+// tieBreaker rotates where minimum-seeking strategies start scanning, so backends tied on
+// the minimum (e.g. all at 0 connections at startup) take turns instead of the first one
+// always winning
+type tieBreaker struct {
+	next atomic.Uint64
+}
+
+// start returns the index to start scanning n backends from, advancing for the next call
+func (t *tieBreaker) start(n int) int {
+	return int((t.next.Add(1) - 1) % uint64(n))
+}
+
 // --- Least Connections Implementation ---
 
-type LeastConnectionBalancer struct{}
+type LeastConnectionBalancer struct {
+	ties tieBreaker
+}
 
 func NewLeastConnectionBalancer() LoadBalancer {
 	return &LeastConnectionBalancer{}
 }
 
 func (lc *LeastConnectionBalancer) SelectBackend(backends []*Backend) *Backend {
+	if len(backends) == 0 {
+		return nil
+	}
 	var selected *Backend = nil
 	minConnections := int64(-1)
 
-	for _, backend := range backends {
-		if backend.IsAlive() {
+	start := lc.ties.start(len(backends))
+	for i := range backends {
+		backend := backends[(start+i)%len(backends)]
+		if backend.hasCapacity() {
 			connections := backend.activeConnections.Load()
 			if selected == nil || connections < minConnections {
 				selected = backend
@@ -78,31 +101,43 @@ func (lc *LeastConnectionBalancer) UpdateResponseTime(backend *Backend, duration
 
 // --- Least Response Time (EWMA) Implementation ---
 
+// LeastResponseTimeBalancer picks the backend with the lowest EWMA divided by its weight, so
+// at equal latency a backend of weight 2 is preferred over one of weight 1. Backends without
+// a measurement yet are tried first.
 type LeastResponseTimeBalancer struct {
 	alpha float64
+	ties  tieBreaker
 }
 
 func NewLeastResponseTimeBalancer(alpha float64) LoadBalancer {
 	// Use default if alpha is invalid
 	effectiveAlpha := alpha
 	if effectiveAlpha <= 0 || effectiveAlpha > 1.0 {
-		log.Printf("Warning: Invalid EWMA alpha value (%.2f), using default %.2f.", effectiveAlpha, DefaultEWMAAlpha)
+		DefaultLogger().Warn("Invalid EWMA alpha value, using default", "alpha", effectiveAlpha, "default", DefaultEWMAAlpha)
 		effectiveAlpha = DefaultEWMAAlpha
 	}
 	return &LeastResponseTimeBalancer{alpha: effectiveAlpha}
 }
 
 func (lrt *LeastResponseTimeBalancer) SelectBackend(backends []*Backend) *Backend {
+	if len(backends) == 0 {
+		return nil
+	}
 	var selected *Backend = nil
 	minEwma := int64(-1)
+	minCost := math.Inf(1)
 
-	for _, backend := range backends {
-		if backend.IsAlive() {
+	start := lrt.ties.start(len(backends))
+	for i := range backends {
+		backend := backends[(start+i)%len(backends)]
+		if backend.hasCapacity() {
 			ewma := backend.ewmaResponseTime.Load()
-			// Select if: nothing selected yet OR current EWMA is lower than min (and >0) OR current is 0 and min was >0 (bootstrap)
-			if selected == nil || (ewma > 0 && (minEwma <= 0 || ewma < minEwma)) || (ewma == 0 && minEwma > 0) {
+			cost := float64(ewma) / float64(max(backend.GetWeight(), 1)) // Unweighted backends count as weight 1
+			// Select if: nothing selected yet OR current cost is lower than min (and EWMA >0) OR current is 0 and min was >0 (bootstrap)
+			if selected == nil || (ewma > 0 && (minEwma <= 0 || cost < minCost)) || (ewma == 0 && minEwma > 0) {
 				selected = backend
 				minEwma = ewma
+				minCost = cost
 			}
 		}
 	}
@@ -110,6 +145,11 @@ func (lrt *LeastResponseTimeBalancer) SelectBackend(backends []*Backend) *Backen
 }
 
 func (lrt *LeastResponseTimeBalancer) UpdateResponseTime(backend *Backend, duration time.Duration) {
+	updateEWMA(backend, lrt.alpha, duration)
+}
+
+// updateEWMA folds duration into backend's EWMA with smoothing factor alpha
+func updateEWMA(backend *Backend, alpha float64, duration time.Duration) {
 	if duration < 0 {
 		return
 	}
@@ -123,7 +163,7 @@ func (lrt *LeastResponseTimeBalancer) UpdateResponseTime(backend *Backend, durat
 	if oldEWMA <= 0 { // Handle initial case or reset
 		newEWMA = measurement
 	} else {
-		newEWMA = int64(lrt.alpha*float64(measurement) + (1.0-lrt.alpha)*float64(oldEWMA))
+		newEWMA = int64(alpha*float64(measurement) + (1.0-alpha)*float64(oldEWMA))
 	}
 	if newEWMA <= 0 {
 		newEWMA = 1 // Ensure EWMA stays positive
@@ -131,35 +171,191 @@ func (lrt *LeastResponseTimeBalancer) UpdateResponseTime(backend *Backend, durat
 	backend.ewmaResponseTime.Store(newEWMA)
 }
 
+// --- Peak EWMA Implementation ---
+
+// PeakEWMABalancer picks the backend with the lowest cost ewma * (activeConnections + 1),
+// so a fast backend stops attracting traffic once requests pile up on it. Its EWMA jumps
+// straight to any slower measurement (the peak) and decays with alpha as latency improves,
+// reacting to slowdowns faster than LeastResponseTimeBalancer. Backends without a
+// measurement yet cost next to nothing and are tried first. Ties take turns.
+type PeakEWMABalancer struct {
+	alpha float64
+	ties  tieBreaker
+}
+
+func NewPeakEWMABalancer(alpha float64) LoadBalancer {
+	if alpha <= 0 || alpha > 1.0 {
+		DefaultLogger().Warn("Invalid EWMA alpha value, using default", "alpha", alpha, "default", DefaultEWMAAlpha)
+		alpha = DefaultEWMAAlpha
+	}
+	return &PeakEWMABalancer{alpha: alpha}
+}
+
+func (p *PeakEWMABalancer) SelectBackend(backends []*Backend) *Backend {
+	if len(backends) == 0 {
+		return nil
+	}
+	var selected *Backend
+	minCost := math.Inf(1)
+	start := p.ties.start(len(backends))
+	for i := range backends {
+		backend := backends[(start+i)%len(backends)]
+		if !backend.hasCapacity() {
+			continue
+		}
+		ewma := max(backend.ewmaResponseTime.Load(), 1) // Unmeasured: ordered by connections only
+		cost := float64(ewma) * float64(backend.activeConnections.Load()+1)
+		if cost < minCost {
+			selected, minCost = backend, cost
+		}
+	}
+	return selected
+}
+
+func (p *PeakEWMABalancer) UpdateResponseTime(backend *Backend, duration time.Duration) {
+	if duration < 0 {
+		return
+	}
+	measurement := max(duration.Nanoseconds(), 1)
+	oldEWMA := backend.ewmaResponseTime.Load()
+	newEWMA := measurement // Initial value, or a peak
+	if oldEWMA > 0 && measurement < oldEWMA {
+		newEWMA = max(int64(p.alpha*float64(measurement)+(1.0-p.alpha)*float64(oldEWMA)), 1)
+	}
+	backend.ewmaResponseTime.Store(newEWMA)
+}
+
+// --- Hybrid (Latency and Connections Blend) Implementation ---
+
+// HybridBalancer picks the backend with the lowest cost
+// blend * EWMA/maxEWMA + (1-blend) * activeConnections/maxConnections, both normalized over
+// the backends with capacity, so blend tunes between latency and load: at 1 it orders by
+// latency like LeastResponseTimeBalancer (ignoring weights), at 0 by connections like
+// LeastConnectionBalancer. Backends without a measurement yet count as the fastest. Ties
+// take turns.
+type HybridBalancer struct {
+	alpha float64
+	blend float64
+	ties  tieBreaker
+}
+
+func NewHybridBalancer(alpha, blend float64) LoadBalancer {
+	if alpha <= 0 || alpha > 1.0 {
+		DefaultLogger().Warn("Invalid EWMA alpha value, using default", "alpha", alpha, "default", DefaultEWMAAlpha)
+		alpha = DefaultEWMAAlpha
+	}
+	return &HybridBalancer{alpha: alpha, blend: min(max(blend, 0), 1)}
+}
+
+func (h *HybridBalancer) SelectBackend(backends []*Backend) *Backend {
+	var maxEWMA, maxConnections int64
+	for _, backend := range backends {
+		if backend.hasCapacity() {
+			maxEWMA = max(maxEWMA, backend.ewmaResponseTime.Load())
+			maxConnections = max(maxConnections, backend.activeConnections.Load())
+		}
+	}
+	var selected *Backend
+	minCost := math.Inf(1)
+	start := 0
+	if len(backends) > 0 {
+		start = h.ties.start(len(backends))
+	}
+	for i := range backends {
+		backend := backends[(start+i)%len(backends)]
+		if !backend.hasCapacity() {
+			continue
+		}
+		if cost := h.cost(backend, maxEWMA, maxConnections); cost < minCost {
+			selected, minCost = backend, cost
+		}
+	}
+	return selected
+}
+
+// cost returns the blended, normalized cost of backend
+func (h *HybridBalancer) cost(backend *Backend, maxEWMA, maxConnections int64) float64 {
+	var latency, load float64
+	if maxEWMA > 0 {
+		latency = float64(backend.ewmaResponseTime.Load()) / float64(maxEWMA)
+	}
+	if maxConnections > 0 {
+		load = float64(backend.activeConnections.Load()) / float64(maxConnections)
+	}
+	return h.blend*latency + (1-h.blend)*load
+}
+
+func (h *HybridBalancer) UpdateResponseTime(backend *Backend, duration time.Duration) {
+	updateEWMA(backend, h.alpha, duration)
+}
+
 // --- Weighted Round Robin (Smooth WRR) Implementation ---
 
-type WeightedRoundRobinBalancer struct{}
+// WeightedRoundRobinBalancer implements nginx's smooth weighted round robin. All
+// currentWeight updates happen under one balancer-wide lock held for a single pass over
+// the backends, rather than locking each backend in turn.
+type WeightedRoundRobinBalancer struct {
+	mu             sync.Mutex
+	maxWeightRatio float64 // Weights are capped at this multiple of the smallest one; 0 disables
+}
 
 func NewWeightedRoundRobinBalancer() LoadBalancer {
 	return &WeightedRoundRobinBalancer{}
 }
 
+// NewCappedWeightedRoundRobinBalancer is NewWeightedRoundRobinBalancer with each backend's
+// weight capped at maxWeightRatio times the smallest positive weight among the candidates,
+// so with weights 1000 and 1 and a ratio of 10 the small backend still gets 1 pick in 11.
+// A maxWeightRatio of 0 leaves weights uncapped.
+func NewCappedWeightedRoundRobinBalancer(maxWeightRatio float64) LoadBalancer {
+	return &WeightedRoundRobinBalancer{maxWeightRatio: maxWeightRatio}
+}
+
 func (w *WeightedRoundRobinBalancer) SelectBackend(backends []*Backend) *Backend {
 	var selected *Backend = nil
 	maxCurrentWeight := math.MinInt // Use MinInt to correctly handle negative weights if they were allowed (they aren't here)
 	totalWeight := 0
 
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	weightCap, minWeight := math.MaxInt, math.MaxInt
+	allBackups := true // The pool only offers backups while no primary is alive
+	for _, backend := range backends {
+		if !backend.hasCapacity() {
+			continue
+		}
+		if weight := backend.GetWeight(); weight > 0 {
+			minWeight = min(minWeight, weight)
+		}
+		allBackups = allBackups && backend.IsBackup()
+	}
+	if w.maxWeightRatio > 0 && minWeight < math.MaxInt {
+		weightCap = max(int(w.maxWeightRatio*float64(minWeight)), minWeight)
+	}
+
 	// This pass calculates total weight and finds the backend with highest current weight
 	for _, backend := range backends {
-		if backend.IsAlive() && backend.weight > 0 {
-			backend.stateMutex.Lock()
-			backend.currentWeight += backend.weight
-			if backend.currentWeight > maxCurrentWeight {
-				maxCurrentWeight = backend.currentWeight
-				selected = backend
-			}
-			totalWeight += backend.weight
-			backend.stateMutex.Unlock()
-		} else if backend.IsAlive() { // Alive but zero or negative weight
-			backend.stateMutex.Lock()
+		if backend.weightChanged.CompareAndSwap(true, false) {
+			backend.currentWeight = 0 // Credit earned under the old weight no longer applies
+		}
+		if !backend.hasCapacity() {
+			continue
+		}
+		weight := min(backend.GetWeight(), weightCap) // Read once: SetWeight may change it mid-pass
+		if allBackups {
+			weight = max(weight, 1) // Weight-0 backups take their turn too
+		}
+		if weight <= 0 {
 			backend.currentWeight = 0 // Reset weight if not participating
-			backend.stateMutex.Unlock()
+			continue
 		}
+		backend.currentWeight += weight
+		if backend.currentWeight > maxCurrentWeight {
+			maxCurrentWeight = backend.currentWeight
+			selected = backend
+		}
+		totalWeight += weight
 	}
 
 	if selected == nil {
@@ -167,10 +363,7 @@ func (w *WeightedRoundRobinBalancer) SelectBackend(backends []*Backend) *Backend
 	}
 
 	// Adjust the weight of the selected backend for the next round
-	selected.stateMutex.Lock()
 	selected.currentWeight -= totalWeight
-	selected.stateMutex.Unlock()
-
 	return selected
 }
 
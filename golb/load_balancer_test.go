@@ -0,0 +1,281 @@
+package golb
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWeightedRoundRobinDistribution(t *testing.T) {
+	pool := newLargePool(t, NewWeightedRoundRobinBalancer(), 3)
+	weights := []int{5, 1, 1}
+	for i, b := range pool.backends {
+		b.SetWeight(weights[i])
+	}
+	lb := NewWeightedRoundRobinBalancer()
+	backends := pool.AliveBackends()
+
+	// Smooth WRR interleaves picks: the first cycle of 7 is exactly a a b a c a a
+	counts := make([]int, len(weights))
+	var sequence []int
+	for range 700 {
+		selected := lb.SelectBackend(backends)
+		for i, b := range pool.backends {
+			if selected == b {
+				counts[i]++
+				if len(sequence) < 7 {
+					sequence = append(sequence, i)
+				}
+			}
+		}
+	}
+	for i, weight := range weights {
+		if counts[i] != weight*100 {
+			t.Errorf("Expected backend %d (weight %d) to be selected %d times, got %d", i, weight, weight*100, counts[i])
+		}
+	}
+	want := []int{0, 0, 1, 0, 2, 0, 0}
+	for i := range want {
+		if sequence[i] != want[i] {
+			t.Fatalf("Expected smooth sequence %v, got %v", want, sequence)
+		}
+	}
+}
+
+func BenchmarkWeightedRoundRobinParallel(b *testing.B) {
+	pool := newLargePool(b, NewWeightedRoundRobinBalancer(), 50)
+	for i, backend := range pool.backends {
+		backend.SetWeight(i%5 + 1)
+	}
+	lb := NewWeightedRoundRobinBalancer()
+	backends := pool.AliveBackends()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if lb.SelectBackend(backends) == nil {
+				b.Error("expected a backend")
+				return
+			}
+		}
+	})
+}
+
+func TestLeastResponseTimeWeighted(t *testing.T) {
+	pool := newLargePool(t, NewLeastResponseTimeBalancer(0.5), 3)
+	heavy, light, fresh := pool.backends[0], pool.backends[1], pool.backends[2]
+	heavy.SetWeight(3)
+	light.SetWeight(1)
+	lb := NewLeastResponseTimeBalancer(0.5)
+	lb.UpdateResponseTime(heavy, 20*time.Millisecond)
+	lb.UpdateResponseTime(light, 20*time.Millisecond)
+
+	// The unmeasured backend is still tried first
+	if got := lb.SelectBackend(pool.AliveBackends()); got != fresh {
+		t.Fatalf("Expected the backend without a measurement to be selected first, got %s", got.URL)
+	}
+	lb.UpdateResponseTime(fresh, time.Second) // Slow: out of the way from now on
+
+	counts := map[*Backend]int{}
+	for range 100 {
+		selected := lb.SelectBackend(pool.AliveBackends())
+		counts[selected]++
+		lb.UpdateResponseTime(selected, 20*time.Millisecond) // Latencies stay equal
+	}
+	if counts[heavy] <= counts[light] {
+		t.Errorf("Expected the heavier backend to be selected more often at equal latency, got %d vs %d", counts[heavy], counts[light])
+	}
+
+	// Weight outweighs a moderately lower latency: 30ms/3 beats 15ms/1
+	heavy.ewmaResponseTime.Store(int64(30 * time.Millisecond))
+	light.ewmaResponseTime.Store(int64(15 * time.Millisecond))
+	if got := lb.SelectBackend(pool.AliveBackends()); got != heavy {
+		t.Errorf("Expected the latency scaled by weight to favor the heavier backend, got %s", got.URL)
+	}
+}
+
+func TestPeakEWMAShiftsAwayFromBusyBackend(t *testing.T) {
+	pool := newLargePool(t, NewPeakEWMABalancer(DefaultEWMAAlpha), 2)
+	fast, slow := pool.backends[0], pool.backends[1]
+	fast.ewmaResponseTime.Store(int64(10 * time.Millisecond))
+	slow.ewmaResponseTime.Store(int64(30 * time.Millisecond))
+	lb := NewPeakEWMABalancer(DefaultEWMAAlpha)
+	backends := pool.AliveBackends()
+
+	// Cost is ewma * (active + 1): the fast backend wins until 3 requests are in flight on it
+	for active := range 6 {
+		if active == 2 {
+			continue // 30ms either way: a tie, which may go to either
+		}
+		fast.activeConnections.Store(int64(active))
+		want := fast
+		if active >= 3 {
+			want = slow
+		}
+		if got := lb.SelectBackend(backends); got != want {
+			t.Errorf("With %d active on the fast backend, expected %s, got %s", active, want.URL, got.URL)
+		}
+	}
+}
+
+func TestPeakEWMAUpdate(t *testing.T) {
+	pool := newLargePool(t, NewPeakEWMABalancer(0.5), 1)
+	b := pool.backends[0]
+	lb := NewPeakEWMABalancer(0.5)
+
+	lb.UpdateResponseTime(b, 10*time.Millisecond)
+	lb.UpdateResponseTime(b, 100*time.Millisecond) // Peaks are taken immediately
+	if got := time.Duration(b.ewmaResponseTime.Load()); got != 100*time.Millisecond {
+		t.Errorf("Expected the EWMA to jump to the peak, got %v", got)
+	}
+	lb.UpdateResponseTime(b, 20*time.Millisecond) // Improvements decay in with alpha
+	if got := time.Duration(b.ewmaResponseTime.Load()); got != 60*time.Millisecond {
+		t.Errorf("Expected the EWMA to decay to 60ms, got %v", got)
+	}
+}
+
+func TestMinimumSelectionSpreadsTies(t *testing.T) {
+	balancers := map[string]LoadBalancer{
+		"least-connections":   NewLeastConnectionBalancer(),
+		"least-response-time": NewLeastResponseTimeBalancer(DefaultEWMAAlpha),
+		"peak-ewma":           NewPeakEWMABalancer(DefaultEWMAAlpha),
+	}
+	for name, lb := range balancers {
+		t.Run(name, func(t *testing.T) {
+			pool := newLargePool(t, lb, 4)
+			for _, b := range pool.backends {
+				b.ewmaResponseTime.Store(int64(5 * time.Millisecond)) // All tied on latency and connections
+			}
+			backends := pool.AliveBackends()
+
+			counts := make(map[*Backend]int)
+			for range 400 {
+				counts[lb.SelectBackend(backends)]++
+			}
+			for i, b := range pool.backends {
+				if counts[b] != 100 {
+					t.Errorf("Expected tied backend %d to be picked 100 times, got %d", i, counts[b])
+				}
+			}
+
+			// A strictly better backend still always wins
+			for i, b := range pool.backends {
+				if i != 2 {
+					b.activeConnections.Store(1)
+				}
+			}
+			pool.backends[2].ewmaResponseTime.Store(int64(time.Millisecond))
+			for range 8 {
+				if got := lb.SelectBackend(backends); got != pool.backends[2] {
+					t.Fatalf("Expected the strictly best backend, got %s", got.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedRoundRobinWeightUpdate(t *testing.T) {
+	pool := newLargePool(t, NewWeightedRoundRobinBalancer(), 2)
+	a, b := pool.backends[0], pool.backends[1]
+	a.SetWeight(3)
+	b.SetWeight(1)
+	lb := NewWeightedRoundRobinBalancer()
+	backends := pool.AliveBackends()
+
+	count := func(n int) map[*Backend]int {
+		counts := map[*Backend]int{}
+		for range n {
+			counts[lb.SelectBackend(backends)]++
+		}
+		return counts
+	}
+	if counts := count(41); counts[a] != 31 || counts[b] != 10 { // Stop mid-cycle, with credit outstanding
+		t.Fatalf("Expected a 3:1 split before the update, got %d:%d", counts[a], counts[b])
+	}
+
+	if !pool.SetBackendWeight(b.URL, 3) || pool.SetBackendWeight(&url.URL{Scheme: "http", Host: "unknown"}, 1) {
+		t.Fatalf("Expected SetBackendWeight to find only backends in the pool")
+	}
+	a.SetWeight(1)
+	if counts := count(400); counts[a] != 100 || counts[b] != 300 {
+		t.Errorf("Expected a 1:3 split after the update, got %d:%d", counts[a], counts[b])
+	}
+
+	// A weight of 0 takes a backend out of rotation; negative weights count as 0
+	b.SetWeight(-5)
+	if b.GetWeight() != 0 {
+		t.Errorf("Expected a negative weight to be stored as 0, got %d", b.GetWeight())
+	}
+	if counts := count(10); counts[a] != 10 {
+		t.Errorf("Expected all traffic on the remaining backend, got %d:%d", counts[a], counts[b])
+	}
+}
+
+func TestWeightedRoundRobinMaxWeightRatio(t *testing.T) {
+	pool := newLargePool(t, NewWeightedRoundRobinBalancer(), 3)
+	big, small1, small2 := pool.backends[0], pool.backends[1], pool.backends[2]
+	big.SetWeight(1000)
+	small1.SetWeight(1)
+	small2.SetWeight(2)
+	backends := pool.AliveBackends()
+
+	// windowMisses returns how often a small backend went unpicked for a whole window of picks
+	windowMisses := func(lb LoadBalancer, window int) int {
+		misses := 0
+		for range 20 {
+			picked := false
+			for range window {
+				if selected := lb.SelectBackend(backends); selected == small1 {
+					picked = true
+				}
+			}
+			if !picked {
+				misses++
+			}
+		}
+		return misses
+	}
+
+	// Uncapped, the weight-1 backend gets 1 pick in 1003 and is absent from most windows of 50
+	if misses := windowMisses(NewWeightedRoundRobinBalancer(), 50); misses < 15 {
+		t.Errorf("Expected the uncapped small backend to be starved in most windows, missed only %d", misses)
+	}
+	// Capped at 10x the smallest weight, effective weights are 10:1:2, so every window of 13 has it
+	if misses := windowMisses(NewCappedWeightedRoundRobinBalancer(10), 13); misses != 0 {
+		t.Errorf("Expected the small backend in every window of 13 picks, missed %d", misses)
+	}
+}
+
+func TestHybridBlend(t *testing.T) {
+	pool := newLargePool(t, NewHybridBalancer(DefaultEWMAAlpha, 0.5), 3)
+	fastBusy, slowIdle, balanced := pool.backends[0], pool.backends[1], pool.backends[2]
+	fastBusy.ewmaResponseTime.Store(int64(10 * time.Millisecond))
+	fastBusy.activeConnections.Store(8)
+	slowIdle.ewmaResponseTime.Store(int64(40 * time.Millisecond))
+	balanced.ewmaResponseTime.Store(int64(20 * time.Millisecond))
+	balanced.activeConnections.Store(3)
+	backends := pool.AliveBackends()
+
+	tests := []struct {
+		blend     float64
+		reference LoadBalancer // Balancer the blend reproduces, if any
+		want      *Backend
+	}{
+		{1, NewLeastResponseTimeBalancer(DefaultEWMAAlpha), fastBusy},
+		{0, NewLeastConnectionBalancer(), slowIdle},
+		{0.5, nil, balanced}, // Costs 0.625, 0.5 and 0.4375
+	}
+	for _, tt := range tests {
+		lb := NewHybridBalancer(DefaultEWMAAlpha, tt.blend)
+		for range 3 {
+			got := lb.SelectBackend(backends)
+			if got != tt.want {
+				t.Errorf("With blend %g, expected %s, got %s", tt.blend, tt.want.URL, got.URL)
+			}
+			if tt.reference != nil {
+				if ref := tt.reference.SelectBackend(backends); got != ref {
+					t.Errorf("With blend %g, expected the same pick as %T (%s), got %s", tt.blend, tt.reference, ref.URL, got.URL)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package golb
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Logger is the logging interface used throughout golb. Arguments after msg are
+// alternating key/value pairs. The method set matches *slog.Logger, so a slog
+// logger can be injected directly (e.g. pool.SetLogger(slog.Default())).
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// stdLogger is the default Logger, writing "LEVEL msg key=value ..." lines through a *log.Logger
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger returns a Logger backed by the standard library log package.
+// A nil l uses log.Default().
+func NewStdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return &stdLogger{l: l}
+}
+
+func (s *stdLogger) Debug(msg string, args ...any) { s.output("DEBUG", msg, args) }
+func (s *stdLogger) Info(msg string, args ...any)  { s.output("INFO", msg, args) }
+func (s *stdLogger) Warn(msg string, args ...any)  { s.output("WARN", msg, args) }
+func (s *stdLogger) Error(msg string, args ...any) { s.output("ERROR", msg, args) }
+
+func (s *stdLogger) output(level, msg string, args []any) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i]) // Dangling value without a key
+		}
+	}
+	_ = s.l.Output(3, b.String())
+}
+
+// loggerBox gives atomic.Value a single concrete type to store
+type loggerBox struct{ Logger }
+
+var defaultLogger atomic.Value
+
+func init() {
+	defaultLogger.Store(loggerBox{NewStdLogger(nil)})
+}
+
+// DefaultLogger returns the logger used by package-level functions (e.g. LoadConfig)
+// and given to new ServerPools.
+func DefaultLogger() Logger {
+	return defaultLogger.Load().(loggerBox).Logger
+}
+
+// SetDefaultLogger replaces the package default logger. ServerPools created earlier keep their logger.
+func SetDefaultLogger(l Logger) {
+	if l == nil {
+		l = NewStdLogger(nil)
+	}
+	defaultLogger.Store(loggerBox{l})
+}
+
+// LogLevel is a minimum severity for log output
+type LogLevel int
+
+// Log levels, from most to least verbose
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var logLevelNames = map[string]LogLevel{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+}
+
+// ParseLogLevel parses "debug", "info", "warn" (or "warning") and "error", case-insensitively
+func ParseLogLevel(s string) (LogLevel, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "warning" {
+		name = "warn"
+	}
+	if level, ok := logLevelNames[name]; ok {
+		return level, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", s)
+}
+
+// leveledLogger drops messages below a minimum level before passing them to the wrapped Logger
+type leveledLogger struct {
+	next Logger
+	min  LogLevel
+}
+
+// NewLeveledLogger wraps any Logger so that only messages at or above min are emitted
+func NewLeveledLogger(l Logger, min LogLevel) Logger {
+	return &leveledLogger{next: l, min: min}
+}
+
+func (l *leveledLogger) Debug(msg string, args ...any) {
+	if l.min <= LevelDebug {
+		l.next.Debug(msg, args...)
+	}
+}
+
+func (l *leveledLogger) Info(msg string, args ...any) {
+	if l.min <= LevelInfo {
+		l.next.Info(msg, args...)
+	}
+}
+
+func (l *leveledLogger) Warn(msg string, args ...any) {
+	if l.min <= LevelWarn {
+		l.next.Warn(msg, args...)
+	}
+}
+
+func (l *leveledLogger) Error(msg string, args ...any) {
+	if l.min <= LevelError {
+		l.next.Error(msg, args...)
+	}
+}
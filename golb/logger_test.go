@@ -0,0 +1,159 @@
+package golb
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Both the stdlib-backed logger and slog must satisfy the interface
+var (
+	_ Logger = NewStdLogger(nil)
+	_ Logger = slog.Default()
+)
+
+// captureLogger records every log call as "LEVEL msg k=v ..."
+type captureLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (c *captureLogger) record(level, msg string, args []any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines = append(c.lines, strings.TrimSpace(level+" "+msg+" "+fmt.Sprint(args...)))
+}
+
+func (c *captureLogger) Debug(msg string, args ...any) { c.record("DEBUG", msg, args) }
+func (c *captureLogger) Info(msg string, args ...any)  { c.record("INFO", msg, args) }
+func (c *captureLogger) Warn(msg string, args ...any)  { c.record("WARN", msg, args) }
+func (c *captureLogger) Error(msg string, args ...any) { c.record("ERROR", msg, args) }
+
+// find returns the first captured line containing all substrings
+func (c *captureLogger) find(substrs ...string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, line := range c.lines {
+		matched := true
+		for _, s := range substrs {
+			if !strings.Contains(line, s) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+func TestHealthCheckLogsThroughInjectedLogger(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	backend.SetAlive(false)
+	capture := &captureLogger{}
+	pool.SetLogger(capture)
+
+	client := &http.Client{Timeout: time.Second}
+	cfg := DefaultConfig()
+	cfg.HealthCheckPath = "/health"
+
+	pool.PerformHealthCheckCycle(client, cfg)
+	if _, ok := capture.find("INFO", "Backend health status changed", backend.URL.String(), "UP"); !ok {
+		t.Fatalf("Expected UP transition to be logged through injected logger, got %v", capture.lines)
+	}
+
+	healthy.Store(false)
+	pool.PerformHealthCheckCycle(client, cfg)
+	if _, ok := capture.find("WARN", "Backend health status changed", backend.URL.String(), "DOWN"); !ok {
+		t.Fatalf("Expected DOWN transition to be logged through injected logger, got %v", capture.lines)
+	}
+}
+
+func TestSlogLoggerInjection(t *testing.T) {
+	var buf bytes.Buffer
+	pool := NewServerPool(&mockLoadBalancer{})
+	pool.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	// No backends, so Lb answers 503 immediately
+	req := httptest.NewRequest("GET", "/nowhere", nil)
+	rr := httptest.NewRecorder()
+	Lb(rr, req, pool, false, false)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if !strings.Contains(buf.String(), "level=WARN") || !strings.Contains(buf.String(), "path=/nowhere") {
+		t.Errorf("Expected warning to be written through slog, got %q", buf.String())
+	}
+}
+
+func TestStdLoggerFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdLogger(log.New(&buf, "", 0))
+	logger.Warn("Backend slow", "backend", "http://a:1", "ms", 250)
+
+	if got, want := strings.TrimSpace(buf.String()), "WARN Backend slow backend=http://a:1 ms=250"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := map[string]LogLevel{
+		"debug":   LevelDebug,
+		"INFO":    LevelInfo,
+		"warn":    LevelWarn,
+		"warning": LevelWarn,
+		" error ": LevelError,
+	}
+	for input, want := range tests {
+		got, err := ParseLogLevel(input)
+		if err != nil || got != want {
+			t.Errorf("ParseLogLevel(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Errorf("Expected error for unknown log level")
+	}
+}
+
+func TestWarnLevelDropsRequestLogsButKeepsBackendDown(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	capture := &captureLogger{}
+	pool.SetLogger(NewLeveledLogger(capture, LevelWarn))
+
+	rr := httptest.NewRecorder()
+	Lb(rr, httptest.NewRequest("GET", "/work", nil), pool, true, true)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if line, ok := capture.find("/work"); ok {
+		t.Errorf("Expected no per-request log line at warn level, got %q", line)
+	}
+
+	healthy.Store(false)
+	pool.PerformHealthCheckCycle(&http.Client{Timeout: time.Second}, DefaultConfig())
+	if _, ok := capture.find("Backend health status changed", backend.URL.String(), "DOWN"); !ok {
+		t.Errorf("Expected backend-down transition to be logged at warn level, got %v", capture.lines)
+	}
+}
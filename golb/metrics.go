@@ -0,0 +1,147 @@
+package golb
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsQuantiles are the latency quantiles exported per backend
+var metricsQuantiles = []float64{0.5, 0.9, 0.99}
+
+// openMetricsContentType is served to scrapers that prefer OpenMetrics, e.g. Prometheus with
+// exemplar storage enabled
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// labelEscaper escapes label values as the exposition formats require: only backslash,
+// double quote and line feed. Go quoting would also escape other bytes, which Prometheus
+// reads back literally.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue returns s as a quoted, escaped label value
+func labelValue(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+// MetricsHandler serves backend metrics in the Prometheus text exposition format, or in
+// OpenMetrics if the scraper prefers it. Only OpenMetrics can carry exemplars, so the request
+// duration histogram links its buckets to traces (see WithTraceID) in that format alone.
+func MetricsHandler(w http.ResponseWriter, r *http.Request, pool *ServerPool) {
+	accept := r.Header.Get("Accept")
+	openMetrics := acceptQuality(accept, "application/openmetrics-text") > acceptQuality(accept, "text/plain")
+	var b strings.Builder
+	family := func(name, metricType, help string) {
+		if openMetrics && metricType == "counter" {
+			name = strings.TrimSuffix(name, "_total") // OpenMetrics names the counter family without the suffix
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	}
+
+	family("golb_backend_up", "gauge", "Whether the backend passed its last health check (1) or not (0).")
+	for _, backend := range pool.backends {
+		up := 0
+		if backend.IsAlive() {
+			up = 1
+		}
+		fmt.Fprintf(&b, "golb_backend_up{backend=%s} %d\n", labelValue(backend.URL.String()), up)
+	}
+
+	family("golb_backend_active_connections", "gauge", "Requests currently in flight to the backend.")
+	for _, backend := range pool.backends {
+		fmt.Fprintf(&b, "golb_backend_active_connections{backend=%s} %d\n", labelValue(backend.URL.String()), backend.activeConnections.Load())
+	}
+
+	family("golb_backend_requests_total", "counter", "Requests routed to the backend.")
+	for _, backend := range pool.backends {
+		fmt.Fprintf(&b, "golb_backend_requests_total{backend=%s} %d\n", labelValue(backend.URL.String()), backend.Counters().Requests)
+	}
+
+	family("golb_backend_responses_total", "counter", "Responses from the backend by status class.")
+	for _, backend := range pool.backends {
+		label := labelValue(backend.URL.String())
+		counters := backend.Counters()
+		for _, class := range []struct {
+			code  string
+			count int64
+		}{{"2xx", counters.Responses2xx}, {"3xx", counters.Responses3xx}, {"4xx", counters.Responses4xx}, {"5xx", counters.Responses5xx}} {
+			fmt.Fprintf(&b, "golb_backend_responses_total{backend=%s,code=%s} %d\n", label, labelValue(class.code), class.count)
+		}
+	}
+
+	family("golb_backend_proxy_errors_total", "counter", "Requests that failed to reach the backend or get a complete response.")
+	for _, backend := range pool.backends {
+		fmt.Fprintf(&b, "golb_backend_proxy_errors_total{backend=%s} %d\n", labelValue(backend.URL.String()), backend.Counters().ProxyErrors)
+	}
+
+	family("golb_backend_client_disconnects_total", "counter", "Requests to the backend abandoned by the client before it answered.")
+	for _, backend := range pool.backends {
+		fmt.Fprintf(&b, "golb_backend_client_disconnects_total{backend=%s} %d\n", labelValue(backend.URL.String()), backend.Counters().ClientDisconnects)
+	}
+
+	family("golb_backend_response_bytes_total", "counter", "Response body bytes proxied from the backend to clients.")
+	for _, backend := range pool.backends {
+		fmt.Fprintf(&b, "golb_backend_response_bytes_total{backend=%s} %d\n", labelValue(backend.URL.String()), backend.Counters().BytesProxied)
+	}
+
+	family("golb_backend_response_time_seconds", "summary", "Latency of requests proxied to the backend.")
+	for _, backend := range pool.backends {
+		label := labelValue(backend.URL.String())
+		for _, q := range metricsQuantiles {
+			fmt.Fprintf(&b, "golb_backend_response_time_seconds{backend=%s,quantile=\"%g\"} %g\n", label, q, backend.LatencyPercentile(q).Seconds())
+		}
+		fmt.Fprintf(&b, "golb_backend_response_time_seconds_sum{backend=%s} %g\n", label, backend.latency.Sum().Seconds())
+		fmt.Fprintf(&b, "golb_backend_response_time_seconds_count{backend=%s} %d\n", label, backend.latency.Count())
+	}
+
+	family("golb_backend_request_duration_seconds", "histogram", "Duration of requests proxied to the backend.")
+	for _, backend := range pool.backends {
+		label := labelValue(backend.URL.String())
+		h := backend.durations
+		var cumulative uint64
+		for i := range h.buckets {
+			cumulative += h.buckets[i].Load()
+			le := "+Inf"
+			if i < len(durationBucketBounds) {
+				le = formatBucketBound(durationBucketBounds[i])
+			}
+			fmt.Fprintf(&b, "golb_backend_request_duration_seconds_bucket{backend=%s,le=%s} %d", label, labelValue(le), cumulative)
+			if e := h.Exemplar(i); openMetrics && e != nil {
+				fmt.Fprintf(&b, " # {trace_id=%s} %g %.3f", labelValue(e.TraceID), e.Value.Seconds(), float64(e.Time.UnixMilli())/1000)
+			}
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "golb_backend_request_duration_seconds_sum{backend=%s} %g\n", label, time.Duration(h.sum.Load()).Seconds())
+		fmt.Fprintf(&b, "golb_backend_request_duration_seconds_count{backend=%s} %d\n", label, h.count.Load())
+	}
+
+	family("golb_shadow_dropped_total", "counter", "Requests not mirrored to the shadow backend because too many mirrored requests were in flight.")
+	fmt.Fprintf(&b, "golb_shadow_dropped_total %d\n", pool.ShadowDropped())
+
+	family("golb_pool_capacity", "gauge", "Total share of traffic the pool's backends can take now, 100 per backend at full share.")
+	fmt.Fprintf(&b, "golb_pool_capacity %d\n", pool.Capacity())
+
+	if summary := pool.lastSummary.Load(); summary != nil {
+		family("golb_pool_requests_per_second", "gauge", "Requests per second over the last pool summary interval.")
+		fmt.Fprintf(&b, "golb_pool_requests_per_second %g\n", summary.RequestsPerSecond)
+	}
+
+	if openMetrics {
+		b.WriteString("# EOF\n")
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// formatBucketBound formats a histogram bucket bound in seconds the way Prometheus clients do,
+// keeping a fractional part so "1.0" is the same le label in both formats
+func formatBucketBound(d time.Duration) string {
+	s := strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,298 @@
+package golb
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"path"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RequestFilter rejects requests before a backend is selected: methods not in
+// cfg.AllowedMethods get 405 and paths under cfg.BlockedPathPrefixes get 403. Blocked
+// prefixes match whole path segments, case-insensitively, against the cleaned path, so
+// "/admin" blocks "/Admin/" and "//x/../admin" but not "/administrator".
+// Empty lists disable the respective check.
+func RequestFilter(cfg *Config, next http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(cfg.AllowedMethods))
+	methods := make([]string, 0, len(cfg.AllowedMethods))
+	for _, m := range cfg.AllowedMethods {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m != "" && !allowed[m] {
+			allowed[m] = true
+			methods = append(methods, m)
+		}
+	}
+	allowHeader := strings.Join(methods, ", ")
+	blocked := make([]string, 0, len(cfg.BlockedPathPrefixes))
+	for _, prefix := range cfg.BlockedPathPrefixes {
+		if prefix != "" {
+			blocked = append(blocked, cleanFilterPath(prefix))
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(allowed) > 0 && !allowed[r.Method] {
+			w.Header().Set("Allow", allowHeader)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(blocked) > 0 {
+			requestPath := cleanFilterPath(r.URL.Path)
+			for _, prefix := range blocked {
+				if pathHasPrefix(requestPath, prefix) {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cleanFilterPath returns p rooted, cleaned of ".." and duplicate slashes, and lower-cased,
+// as RequestFilter compares paths
+func cleanFilterPath(p string) string {
+	return strings.ToLower(path.Clean("/" + p))
+}
+
+// Recover turns a panic further down the chain into a 500 for that request instead of a
+// dropped connection, logging the panic with the request ID and stack. If the response had
+// already started, the connection is aborted since the status can no longer change.
+// http.ErrAbortHandler panics are passed on untouched. A nil logger uses DefaultLogger().
+func Recover(cfg *Config, logger Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := ensureRequestID(r, cfg.RequestIDHeader) // So the log line can be matched to the client's
+		tracker := &headerInterceptor{ResponseWriter: w, onHeader: func(http.Header) {}}
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+			if logger == nil {
+				logger = DefaultLogger()
+			}
+			logger.Error("Recovered from panic", "method", r.Method, "path", r.URL.Path, "requestId", requestID, "panic", rec, "stack", string(debug.Stack()))
+			if tracker.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			if requestID != "" {
+				w.Header().Set(cfg.RequestIDHeader, requestID)
+			}
+			writeProxyError(w, r, cfg, ProxyError{Status: http.StatusInternalServerError, Message: "Internal Server Error", Category: ErrorCategoryInternal})
+		}()
+		next.ServeHTTP(tracker, r)
+	})
+}
+
+// LimitConcurrency caps the requests in flight through next at cfg.MaxGlobalConcurrency to
+// protect the proxy process itself: requests beyond the cap get 503 right away instead of
+// queueing. A slot is held until next returns, panics included. Zero disables the cap. A nil
+// logger uses DefaultLogger().
+func LimitConcurrency(cfg *Config, logger Logger, next http.Handler) http.Handler {
+	if cfg.MaxGlobalConcurrency <= 0 {
+		return next
+	}
+	if logger == nil {
+		logger = DefaultLogger()
+	}
+	slots := make(chan struct{}, cfg.MaxGlobalConcurrency) // Counting semaphore
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			logger.Warn("Service unavailable: global concurrency limit reached", "method", r.Method, "path", r.URL.Path, "limit", cfg.MaxGlobalConcurrency)
+			w.Header().Set("Retry-After", "1")
+			writeProxyError(w, r, cfg, ProxyError{Status: http.StatusServiceUnavailable, Message: "Service unavailable", Category: ErrorCategoryOverloaded})
+			return
+		}
+		defer func() { <-slots }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Authenticate requires HTTP Basic credentials (cfg.AuthUsername/cfg.AuthPasswordHash, a bcrypt
+// hash) or a bearer token (cfg.AuthBearerToken) on every request except cfg.AuthExemptPaths.
+// If both are configured either is accepted; if neither is, requests pass through untouched.
+// A username without a hash, or the reverse, is rejected by validateConfig and otherwise
+// accepts no Basic credentials. The Authorization header is consumed here and not
+// forwarded to backends.
+func Authenticate(cfg *Config, next http.Handler) http.Handler {
+	basicEnabled := cfg.AuthUsername != "" || cfg.AuthPasswordHash != "" // Half-configured fails closed
+	bearerEnabled := cfg.AuthBearerToken != ""
+	if !basicEnabled && !bearerEnabled {
+		return next
+	}
+	exempt := make(map[string]bool, len(cfg.AuthExemptPaths))
+	for _, p := range cfg.AuthExemptPaths {
+		exempt[p] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authorized := false
+		if basicEnabled {
+			if username, password, ok := r.BasicAuth(); ok {
+				// Always run bcrypt so a wrong username takes as long as a wrong password
+				userOK := subtle.ConstantTimeCompare([]byte(username), []byte(cfg.AuthUsername)) == 1
+				passOK := bcrypt.CompareHashAndPassword([]byte(cfg.AuthPasswordHash), []byte(password)) == nil
+				authorized = userOK && passOK
+			}
+		}
+		if !authorized && bearerEnabled {
+			// The scheme is case-insensitive (RFC 7235)
+			if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+				authorized = subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AuthBearerToken)) == 1
+			}
+		}
+
+		if !authorized {
+			if basicEnabled {
+				w.Header().Add("WWW-Authenticate", `Basic realm="golb"`)
+			}
+			if bearerEnabled {
+				w.Header().Add("WWW-Authenticate", `Bearer realm="golb"`)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		r.Header.Del("Authorization")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CORS answers browser preflight requests directly (without contacting a backend) and
+// injects Access-Control-* headers on other responses for allowed origins. Origins in
+// cfg.CORSAllowedOrigins may be exact ("https://app.example.com"), a subdomain wildcard
+// ("https://*.example.com") or "*"; "*" can't be combined with cfg.CORSAllowCredentials, which
+// would let every site make credentialed requests. It is disabled when no origins are configured.
+func CORS(cfg *Config, next http.Handler) http.Handler {
+	if len(cfg.CORSAllowedOrigins) == 0 {
+		return next
+	}
+	allowMethods := strings.Join(cfg.CORSAllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.CORSAllowedHeaders, ", ")
+	maxAge := ""
+	if cfg.CORSMaxAge > 0 {
+		maxAge = strconv.Itoa(int(cfg.CORSMaxAge.Seconds()))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		allowOrigin, ok := corsAllowOrigin(origin, cfg.CORSAllowedOrigins)
+		if !ok {
+			if preflight {
+				http.Error(w, "CORS origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r) // Serve as usual; the browser blocks the response without CORS headers
+			return
+		}
+
+		setCORSHeaders := func(h http.Header) {
+			h.Set("Access-Control-Allow-Origin", allowOrigin)
+			if allowOrigin != "*" && !headerHasToken(h, "Vary", "Origin") { // The backend may have set it already
+				h.Add("Vary", "Origin")
+			}
+			if cfg.CORSAllowCredentials && allowOrigin != "*" {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if preflight {
+			h := w.Header()
+			setCORSHeaders(h)
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			if allowHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", allowHeaders)
+			} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested) // No list configured: allow what was asked for
+			}
+			if maxAge != "" {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// Applied just before the status is written so backend-provided CORS headers are replaced, not duplicated
+		next.ServeHTTP(&headerInterceptor{ResponseWriter: w, onHeader: setCORSHeaders}, r)
+	})
+}
+
+// corsAllowOrigin matches origin against the allowed patterns and returns the value for
+// Access-Control-Allow-Origin
+func corsAllowOrigin(origin string, allowed []string) (string, bool) {
+	for _, pattern := range allowed {
+		if pattern == "*" {
+			return "*", true
+		}
+		if strings.EqualFold(pattern, origin) {
+			return origin, true
+		}
+		if prefix, suffix, found := strings.Cut(pattern, "*"); found {
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) &&
+				!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:") {
+				return origin, true
+			}
+		}
+	}
+	return "", false
+}
+
+// headerInterceptor calls onHeader once, just before the status line is written,
+// letting middleware adjust the headers set further down the chain (e.g. by a backend).
+type headerInterceptor struct {
+	http.ResponseWriter
+	onHeader    func(h http.Header)
+	wroteHeader bool
+}
+
+func (w *headerInterceptor) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.onHeader(w.ResponseWriter.Header())
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *headerInterceptor) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush supports streaming responses through the interceptor
+func (w *headerInterceptor) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *headerInterceptor) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
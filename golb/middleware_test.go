@@ -0,0 +1,409 @@
+package golb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRequestFilter(t *testing.T) {
+	var backendHits atomic.Int32
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cfg := DefaultConfig()
+	cfg.AllowedMethods = []string{"GET", "post"}
+	cfg.BlockedPathPrefixes = []string{"/admin"}
+	handler := RequestFilter(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Lb(w, r, pool, false, false)
+	}))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		reachesBackend bool
+	}{
+		{"allowed GET", "GET", "/api", http.StatusOK, true},
+		{"allowed POST (case-insensitive config)", "POST", "/api", http.StatusOK, true},
+		{"TRACE rejected", "TRACE", "/api", http.StatusMethodNotAllowed, false},
+		{"blocked prefix", "GET", "/admin/users", http.StatusForbidden, false},
+		{"similar but unblocked path", "GET", "/api/admin", http.StatusOK, true},
+		{"blocked prefix itself", "GET", "/admin", http.StatusForbidden, false},
+		{"longer segment not blocked", "GET", "/administrator", http.StatusOK, true},
+		{"blocked prefix in another case", "GET", "/Admin/users", http.StatusForbidden, false},
+		{"blocked prefix behind dot segments", "GET", "/api/../admin/users", http.StatusForbidden, false},
+		{"blocked prefix behind duplicate slashes", "GET", "//admin/users", http.StatusForbidden, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := backendHits.Load()
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if reached := backendHits.Load() > before; reached != tt.reachesBackend {
+				t.Errorf("Expected backend reached=%v, got %v", tt.reachesBackend, reached)
+			}
+			if tt.expectedStatus == http.StatusMethodNotAllowed && rr.Header().Get("Allow") == "" {
+				t.Errorf("Expected Allow header on 405 response")
+			}
+		})
+	}
+}
+
+func TestRequestFilterDisabledByDefault(t *testing.T) {
+	called := false
+	handler := RequestFilter(DefaultConfig(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("TRACE", "/admin", nil))
+	if !called {
+		t.Errorf("Expected request to pass through with no filters configured")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	var lastAuthHeader atomic.Value
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastAuthHeader.Store(r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.AuthUsername = "admin"
+	cfg.AuthPasswordHash = string(hash)
+	cfg.AuthBearerToken = "token-123"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", LivezHandler)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		Lb(w, r, pool, false, false)
+	})
+	handler := Authenticate(cfg, mux)
+
+	tests := []struct {
+		name           string
+		path           string
+		setAuth        func(r *http.Request)
+		expectedStatus int
+	}{
+		{"valid basic credentials", "/api", func(r *http.Request) { r.SetBasicAuth("admin", "s3cret") }, http.StatusOK},
+		{"valid bearer token", "/api", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token-123") }, http.StatusOK},
+		{"lowercase bearer scheme", "/api", func(r *http.Request) { r.Header.Set("Authorization", "bearer token-123") }, http.StatusOK},
+		{"wrong password", "/api", func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }, http.StatusUnauthorized},
+		{"wrong username", "/api", func(r *http.Request) { r.SetBasicAuth("root", "s3cret") }, http.StatusUnauthorized},
+		{"wrong token", "/api", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"missing credentials", "/api", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"exempt path", "/livez", func(r *http.Request) {}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lastAuthHeader.Store("unset")
+			req := httptest.NewRequest("GET", tt.path, nil)
+			tt.setAuth(req)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus == http.StatusUnauthorized {
+				challenges := rr.Header().Values("WWW-Authenticate")
+				if len(challenges) != 2 {
+					t.Errorf("Expected Basic and Bearer WWW-Authenticate challenges, got %v", challenges)
+				}
+			}
+			if tt.expectedStatus == http.StatusOK && tt.path == "/api" && lastAuthHeader.Load() != "" {
+				t.Errorf("Expected Authorization header to be stripped before proxying, backend saw %q", lastAuthHeader.Load())
+			}
+		})
+	}
+}
+
+func TestAuthenticateDisabledByDefault(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	rr := httptest.NewRecorder()
+	Authenticate(DefaultConfig(), next).ServeHTTP(rr, httptest.NewRequest("GET", "/api", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected passthrough with no auth configured, got %d", rr.Code)
+	}
+}
+
+func TestAuthenticateHalfConfigured(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	for _, tc := range []struct {
+		username, hash, missing string
+	}{
+		{"admin", "", "password hash"},
+		{"", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", "username"},
+	} {
+		cfg := DefaultConfig()
+		cfg.AuthUsername, cfg.AuthPasswordHash = tc.username, tc.hash
+		if err := validateConfig(cfg); err == nil || !strings.Contains(err.Error(), tc.missing) {
+			t.Errorf("Expected validation to name the missing %s, got %v", tc.missing, err)
+		}
+		// Unvalidated, the proxy fails closed rather than serving without authentication
+		req := httptest.NewRequest("GET", "/api", nil)
+		req.SetBasicAuth("admin", "")
+		rr := httptest.NewRecorder()
+		Authenticate(cfg, next).ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected half-configured Basic auth to reject requests, got %d", rr.Code)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	var backendHits atomic.Int32
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendHits.Add(1)
+	}))
+
+	cfg := DefaultConfig()
+	cfg.CORSAllowedOrigins = []string{"https://app.example.com", "https://*.example.org"}
+	cfg.CORSAllowedHeaders = []string{"Content-Type", "X-Api-Key"}
+	handler := CORS(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Lb(w, r, pool, false, false)
+	}))
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/api", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "PUT")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := preflight("https://app.example.com")
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
+		"Access-Control-Allow-Headers": "Content-Type, X-Api-Key",
+		"Access-Control-Max-Age":       "600",
+	}
+	for header, want := range expected {
+		if got := rr.Header().Get(header); got != want {
+			t.Errorf("Expected %s %q, got %q", header, want, got)
+		}
+	}
+
+	if rr := preflight("https://api.example.org"); rr.Header().Get("Access-Control-Allow-Origin") != "https://api.example.org" {
+		t.Errorf("Expected wildcard subdomain origin to be allowed, got headers %v", rr.Header())
+	}
+	if rr := preflight("https://example.org.evil.com"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected %d for disallowed origin, got %d", http.StatusForbidden, rr.Code)
+	}
+	if backendHits.Load() != 0 {
+		t.Errorf("Expected preflights to be answered without contacting the backend, got %d hits", backendHits.Load())
+	}
+}
+
+func TestCORSHeaderInjection(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "https://stale.example.com") // Must be replaced, not duplicated
+		w.Header().Set("X-Backend", "yes")
+		w.Header().Set("Vary", "Accept-Encoding, Origin") // Must not be repeated
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cfg := DefaultConfig()
+	cfg.CORSAllowedOrigins = []string{"https://*.example.net"}
+	cfg.CORSAllowCredentials = true
+	handler := CORS(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Lb(w, r, pool, false, false)
+	}))
+
+	req := httptest.NewRequest("GET", "/api", nil)
+	req.Header.Set("Origin", "https://anything.example.net")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	// Credentialed responses must echo the origin rather than "*"
+	if got := rr.Header().Values("Access-Control-Allow-Origin"); len(got) != 1 || got[0] != "https://anything.example.net" {
+		t.Errorf("Expected a single echoed Access-Control-Allow-Origin, got %v", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Expected Access-Control-Allow-Credentials true, got %q", got)
+	}
+	if got := rr.Header().Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding, Origin" {
+		t.Errorf("Expected the backend's Vary without a second Origin, got %q", got)
+	}
+	if got := rr.Header().Get("X-Backend"); got != "yes" {
+		t.Errorf("Expected backend headers to pass through, got %q", got)
+	}
+
+	// "*" with credentials would let any site make credentialed requests
+	cfg.CORSAllowedOrigins = []string{"*"}
+	if err := validateConfig(cfg); err == nil {
+		t.Error(`Expected "*" with credentials to fail validation`)
+	}
+	rr = httptest.NewRecorder()
+	CORS(cfg, http.NotFoundHandler()).ServeHTTP(rr, req)
+	if rr.Header().Get("Access-Control-Allow-Origin") != "*" || rr.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("Expected an unvalidated \"*\" never to allow credentials, got %v", rr.Header())
+	}
+}
+
+func TestRecoverFromPanic(t *testing.T) {
+	cfg := DefaultConfig()
+	logger := &captureLogger{}
+	panicking := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/panic" {
+				panic("middleware bug")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	server := httptest.NewServer(Recover(cfg, logger, panicking(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/panic", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected a response despite the panic, got %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Request-ID"); got != "req-123" {
+		t.Errorf("Expected the request ID to be echoed, got %q", got)
+	}
+	if _, ok := logger.find("Recovered from panic", "req-123", "middleware bug", "goroutine"); !ok {
+		t.Errorf("Expected the panic to be logged with the request ID and stack, got %v", logger.lines)
+	}
+
+	// The server keeps serving
+	resp, err = http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Expected the server to keep serving, got %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d after the panic, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestProxyPanicReleasesConnection(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	pool.SetLogger(&captureLogger{})
+	backend.ReverseProxy.ModifyResponse = func(*http.Response) error {
+		panic("response hook bug")
+	}
+	proxy := NewProxy(pool, DefaultConfig())
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if n := backend.activeConnections.Load(); n != 0 {
+		t.Errorf("Expected the connection to be released after the panic, got %d active", n)
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	entered := make(chan struct{}, 3) // Room for the request after the limit freed up
+	release := make(chan struct{})
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	cfg := DefaultConfig()
+	cfg.MaxGlobalConcurrency = 2
+	logger := &captureLogger{}
+	server := httptest.NewServer(LimitConcurrency(cfg, logger, NewProxy(pool, cfg)))
+	defer server.Close()
+
+	// Fill the limit with requests the backend holds on to
+	statuses := make(chan int, 2)
+	for range 2 {
+		go func() {
+			resp, err := http.Get(server.URL)
+			if err != nil {
+				statuses <- 0
+				return
+			}
+			_ = resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+		<-entered
+	}
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request beyond the limit failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d beyond the limit, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header on the rejection")
+	}
+	if _, ok := logger.find("global concurrency limit reached"); !ok {
+		t.Errorf("Expected the rejection to be logged, got %v", logger.lines)
+	}
+
+	close(release)
+	for range 2 {
+		if status := <-statuses; status != http.StatusOK {
+			t.Errorf("Expected in-flight requests to complete with %d, got %d", http.StatusOK, status)
+		}
+	}
+
+	// Slots are released once requests complete, also when the handler panics
+	panicking := LimitConcurrency(cfg, logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler bug")
+	}))
+	handler := Recover(cfg, logger, panicking)
+	for range 3 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected the panic to be answered with %d, got %d (slot leaked?)", http.StatusInternalServerError, rec.Code)
+		}
+	}
+	resp, err = http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request after the limit freed up failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d once the limit freed up, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
@@ -0,0 +1,108 @@
+package golb
+
+import (
+	"sync"
+	"time"
+)
+
+// outlierWindowSlots is how many time slots the outlier detection window is split into.
+// Old slots expire one at a time, so the window slides in steps of window/outlierWindowSlots.
+const outlierWindowSlots = 10
+
+// outcomeSlot counts request outcomes within one time slot of the window
+type outcomeSlot struct {
+	epoch    int64 // Slot number since the Unix epoch; stale slots are reset on reuse
+	requests int
+	errors   int
+}
+
+// outcomeWindow keeps rolling request and error counts for a backend
+type outcomeWindow struct {
+	mu    sync.Mutex
+	slots [outlierWindowSlots]outcomeSlot
+}
+
+// record adds one outcome at now and returns the totals over the window ending at now
+func (w *outcomeWindow) record(now time.Time, window time.Duration, failed bool) (requests, errors int) {
+	slotSize := int64(window) / outlierWindowSlots
+	if slotSize <= 0 {
+		slotSize = 1
+	}
+	epoch := now.UnixNano() / slotSize
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	slot := &w.slots[epoch%outlierWindowSlots]
+	if slot.epoch != epoch {
+		*slot = outcomeSlot{epoch: epoch}
+	}
+	slot.requests++
+	if failed {
+		slot.errors++
+	}
+	for _, s := range w.slots {
+		if s.epoch > epoch-outlierWindowSlots {
+			requests += s.requests
+			errors += s.errors
+		}
+	}
+	return requests, errors
+}
+
+// reset clears all counts, giving the backend a clean window after reinstatement
+func (w *outcomeWindow) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.slots = [outlierWindowSlots]outcomeSlot{}
+}
+
+// RecordOutcome feeds the result of a proxied request into outlier detection. When the
+// backend's error rate over cfg.OutlierWindow exceeds cfg.OutlierErrorRateThreshold (with at
+// least cfg.OutlierMinRequests requests seen), it is ejected from selection for
+// cfg.OutlierEjectionTime and then reinstated. A threshold of 0 disables detection.
+// No more than cfg.OutlierMaxEjectionPercent of the backends are ejected at once (but always
+// at least one), so a pool-wide failure doesn't leave nothing to route to.
+func (s *ServerPool) RecordOutcome(b *Backend, failed bool, cfg *Config) {
+	if cfg.OutlierErrorRateThreshold <= 0 || b.IsEjected() {
+		return
+	}
+	requests, errors := b.outcomes.record(time.Now(), cfg.OutlierWindow, failed)
+	if requests < cfg.OutlierMinRequests || requests == 0 {
+		return
+	}
+	errorRate := float64(errors) / float64(requests)
+	if errorRate <= cfg.OutlierErrorRateThreshold {
+		return
+	}
+	s.ejectMu.Lock()
+	if !s.canEject(cfg.OutlierMaxEjectionPercent) {
+		s.ejectMu.Unlock()
+		s.logger.Debug("Backend not ejected, too many ejected already", "backend", b.URL.String(), "errorRate", errorRate, "maxEjectionPercent", cfg.OutlierMaxEjectionPercent) // Can be noisy
+		return
+	}
+	ejected := b.eject(time.Now().Add(cfg.OutlierEjectionTime))
+	s.ejectMu.Unlock()
+	if !ejected {
+		return // Another request ejected it first
+	}
+	b.outcomes.reset()
+	s.logger.Warn("Backend ejected", "backend", b.URL.String(), "errorRate", errorRate, "requests", requests, "ejectionTime", cfg.OutlierEjectionTime)
+
+	time.AfterFunc(cfg.OutlierEjectionTime, func() {
+		s.logger.Info("Backend reinstated", "backend", b.URL.String())
+		s.notifyBackendAvailable() // Wake requests waiting in GetNextPeer
+	})
+}
+
+// canEject reports whether one more backend can be ejected while keeping at most maxPercent of
+// the pool's backends ejected. One backend can always be. Called with ejectMu held.
+func (s *ServerPool) canEject(maxPercent int) bool {
+	backends := s.snapshotBackends()
+	ejected := 0
+	for _, b := range backends {
+		if b.IsEjected() {
+			ejected++
+		}
+	}
+	return ejected == 0 || (ejected+1)*100 <= len(backends)*maxPercent
+}
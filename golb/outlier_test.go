@@ -0,0 +1,176 @@
+package golb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func outlierConfig() *Config {
+	cfg := DefaultConfig()
+	cfg.OutlierErrorRateThreshold = 0.5
+	cfg.OutlierWindow = time.Minute
+	cfg.OutlierMinRequests = 10
+	cfg.OutlierEjectionTime = time.Minute
+	return cfg
+}
+
+func TestOutlierEjectionThreshold(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		successes   int
+		expectEject bool
+	}{
+		{"below threshold", 4, 6, false},
+		{"at threshold", 5, 5, false},
+		{"above threshold", 6, 4, true},
+		{"above threshold but too few requests", 5, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse("http://backend:8080")
+			backend := NewBackend(u, nil, 1)
+			backend.SetAlive(true)
+			pool := NewServerPool(NewRoundRobinBalancer())
+			pool.AddBackend(backend)
+			cfg := outlierConfig()
+
+			// Successes first so the rate only crosses the threshold once the window is full
+			for i := 0; i < tt.successes; i++ {
+				pool.RecordOutcome(backend, false, cfg)
+			}
+			for i := 0; i < tt.failures; i++ {
+				pool.RecordOutcome(backend, true, cfg)
+			}
+
+			if backend.IsEjected() != tt.expectEject {
+				t.Errorf("Expected ejected=%v, got %v", tt.expectEject, backend.IsEjected())
+			}
+			if backend.IsAvailable() == tt.expectEject {
+				t.Errorf("Expected available=%v", !tt.expectEject)
+			}
+		})
+	}
+}
+
+func TestOutlierDetectionDisabled(t *testing.T) {
+	u, _ := url.Parse("http://backend:8080")
+	backend := NewBackend(u, nil, 1)
+	pool := NewServerPool(NewRoundRobinBalancer())
+	cfg := outlierConfig()
+	cfg.OutlierErrorRateThreshold = 0
+
+	for i := 0; i < 100; i++ {
+		pool.RecordOutcome(backend, true, cfg)
+	}
+	if backend.IsEjected() {
+		t.Errorf("Expected no ejection with outlier detection disabled")
+	}
+}
+
+func TestOutlierMaxEjectionPercent(t *testing.T) {
+	for _, tt := range []struct {
+		maxPercent, backends, wantEjected int
+	}{
+		{50, 4, 2},
+		{50, 5, 2},
+		{100, 3, 3},
+		{0, 3, 1}, // One can always be ejected
+	} {
+		pool := NewServerPool(NewRoundRobinBalancer())
+		pool.SetLogger(&captureLogger{})
+		backends := make([]*Backend, tt.backends)
+		for i := range backends {
+			u, _ := url.Parse(fmt.Sprintf("http://backend%d:8080", i))
+			backends[i] = NewBackend(u, nil, 1)
+			backends[i].SetAlive(true)
+			pool.AddBackend(backends[i])
+		}
+		cfg := outlierConfig()
+		cfg.OutlierMaxEjectionPercent = tt.maxPercent
+
+		// Every backend fails every request
+		for range cfg.OutlierMinRequests {
+			for _, b := range backends {
+				pool.RecordOutcome(b, true, cfg)
+			}
+		}
+		ejected := 0
+		for _, b := range backends {
+			if b.IsEjected() {
+				ejected++
+			}
+		}
+		if ejected != tt.wantEjected {
+			t.Errorf("Expected %d of %d failing backends ejected at %d%%, got %d",
+				tt.wantEjected, tt.backends, tt.maxPercent, ejected)
+		}
+	}
+}
+
+func TestOutcomeWindowSlides(t *testing.T) {
+	var w outcomeWindow
+	window := 10 * time.Second
+	start := time.Unix(1000, 0)
+
+	for i := 0; i < 5; i++ {
+		w.record(start, window, true)
+	}
+	requests, errors := w.record(start.Add(5*time.Second), window, false)
+	if requests != 6 || errors != 5 {
+		t.Errorf("Expected 6 requests / 5 errors within the window, got %d / %d", requests, errors)
+	}
+
+	// Once the window has moved past the failures only the newer outcomes count
+	requests, errors = w.record(start.Add(12*time.Second), window, false)
+	if requests != 2 || errors != 0 {
+		t.Errorf("Expected 2 requests / 0 errors after the failures expired, got %d / %d", requests, errors)
+	}
+}
+
+func TestOutlierEjectionAndReinstatementThroughProxy(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	pool.SetLogger(&captureLogger{})
+	cfg := outlierConfig()
+	cfg.OutlierMinRequests = 4
+	cfg.OutlierEjectionTime = 200 * time.Millisecond
+	proxy := NewProxy(pool, cfg)
+
+	for _, path := range []string{"/ok", "/fail", "/fail", "/fail"} {
+		proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	if !backend.IsEjected() {
+		t.Fatalf("Expected backend to be ejected after 3/4 failures")
+	}
+
+	rr := httptest.NewRecorder()
+	StatusHandler(rr, httptest.NewRequest("GET", "/status", nil), pool, cfg)
+	var statuses []BackendStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if len(statuses) != 1 || !statuses[0].Ejected || statuses[0].EjectedUntil == nil {
+		t.Errorf("Expected /status to report the ejection, got %+v", statuses)
+	}
+
+	// A request waiting for a backend proceeds once the ejection ends
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if peer, _ := pool.GetNextPeer(ctx); peer != backend {
+		t.Fatalf("Expected backend to be reinstated after the ejection time")
+	}
+	if backend.IsEjected() {
+		t.Errorf("Expected ejection to have ended")
+	}
+}
@@ -2,9 +2,13 @@ package golb
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,9 +16,49 @@ import (
 type ServerPool struct {
 	backends []*Backend
 	lb       LoadBalancer
+	logger   Logger
 
 	mu               sync.Mutex
-	backendAvailable *sync.Cond
+	backendAvailable chan struct{} // Closed, and replaced, to wake waiting requests; guarded by mu
+	queued           atomic.Int64  // Requests waiting for a backend
+	maxWait          time.Duration // Longest wait while no backend is alive, see SetMaxWaitForBackend
+
+	// Deterministic subsetting, see SetSubset; subset is nil when disabled
+	subsetID   string
+	subsetSize int
+	subset     []*Backend
+
+	// Alive members of the selection candidates, rebuilt whenever a backend's status flips,
+	// so selection doesn't scan dead backends. Lock order: mu, then aliveMu.
+	aliveMu sync.Mutex
+	alive   atomic.Pointer[[]*Backend]
+	// Backend counts over the whole pool, rebuilt with alive; see AliveCount and Ready
+	counts atomic.Pointer[backendCounts]
+
+	// Zone affinity, see SetLocalZone; localAlive holds the alive backends in localZone
+	localZone  string
+	localAlive atomic.Pointer[[]*Backend]
+
+	draining atomic.Bool // Shutting down: report not ready, see StartDraining
+	paused   atomic.Bool // Refusing new requests, see Pause
+
+	management *http.Client // Health checks and info fetches, see ManagementClient
+	clock      Clock        // Schedules health checks and summaries, see SetClock
+
+	lastSummary atomic.Pointer[PoolSummary] // Most recent RunSummaryLog summary, nil before the first
+
+	ejectMu sync.Mutex // Serializes outlier ejections so Config.OutlierMaxEjectionPercent holds
+
+	shadowDropped atomic.Int64 // Mirrored requests dropped at Config.ShadowMaxInFlight, see ShadowDropped
+
+	cutoverMu sync.Mutex
+	cutover   *CutoverStatus // Most recent BeginCutover, nil if none
+
+	// Status change callbacks, see OnHealthChange
+	hooksMu      sync.Mutex
+	healthHooks  []HealthChangeFunc
+	healthEvents []healthEvent // Changes not yet handed to the callbacks
+	hooksRunning bool          // A goroutine is dispatching healthEvents
 }
 
 // NewServerPool creates a new ServerPool with a specific load balancing strategy
@@ -22,52 +66,341 @@ func NewServerPool(lbStrategy LoadBalancer) *ServerPool {
 	pool := &ServerPool{
 		backends: []*Backend{},
 		lb:       lbStrategy,
+		logger:   DefaultLogger(),
+
+		management: defaultManagementClient,
+		clock:      realClock{},
+
+		backendAvailable: make(chan struct{}),
 	}
-	pool.backendAvailable = sync.NewCond(&pool.mu)
+	pool.alive.Store(&[]*Backend{})
+	pool.localAlive.Store(&[]*Backend{})
+	pool.counts.Store(&backendCounts{})
 	return pool
 }
 
+// backendCounts is how many backends a pool has and how many of them are marked alive, as
+// of the same moment
+type backendCounts struct {
+	total, alive int
+}
+
+// SetLogger replaces the logger used for the pool's health checks and proxied requests
+func (s *ServerPool) SetLogger(l Logger) {
+	if l == nil {
+		l = DefaultLogger()
+	}
+	s.logger = l
+}
+
+// Logger returns the logger used by the pool
+func (s *ServerPool) Logger() Logger {
+	return s.logger
+}
+
+// SetManagementClient replaces the client used for health checks and /status info fetches.
+// Requests are bounded by their context, so the client needs no Timeout. Nil restores the
+// shared default.
+func (s *ServerPool) SetManagementClient(c *http.Client) {
+	if c == nil {
+		c = defaultManagementClient
+	}
+	s.management = c
+}
+
+// SetClock replaces the clock scheduling the pool's health checks, startup wait and
+// summaries. Call it before starting them.
+func (s *ServerPool) SetClock(c Clock) {
+	s.clock = c
+}
+
+// ManagementClient returns the client the pool uses to reach backends' health and info
+// endpoints; it is shared across calls so their connections are reused
+func (s *ServerPool) ManagementClient() *http.Client {
+	return s.management
+}
+
 // AddBackend adds a new backend server to the pool
 func (s *ServerPool) AddBackend(b *Backend) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aliveMu.Lock()
+	defer s.aliveMu.Unlock()
+	b.onAliveChange = s.refreshAlive
 	s.backends = append(s.backends, b)
+	s.rebuildSubset()
+	s.rebuildAlive()
+	if b.IsAlive() {
+		s.broadcastAvailable() // Wake requests that queued before any backend could serve them
+	}
+}
+
+// Size returns the number of backends in the pool, alive or not
+func (s *ServerPool) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.backends)
+}
+
+// AliveBackends returns the backends currently considered for selection that are alive.
+// The slice is shared and must not be modified.
+func (s *ServerPool) AliveBackends() []*Backend {
+	return *s.alive.Load()
+}
+
+// refreshAlive rebuilds the alive set after a backend's status flipped
+func (s *ServerPool) refreshAlive() {
+	s.aliveMu.Lock()
+	defer s.aliveMu.Unlock()
+	s.rebuildAlive()
+}
+
+// rebuildAlive recomputes the alive set from the current status of every candidate: the
+// alive primaries, or the alive backups (see Backend.IsBackup) if no primary is alive.
+// The local zone's share of it (see SetLocalZone) is rebuilt along with it.
+// Callers must hold aliveMu; every status flip is followed by a rebuild, so the last
+// rebuild always sees the latest statuses.
+func (s *ServerPool) rebuildAlive() {
+	candidates := s.candidates()
+	alive := make([]*Backend, 0, len(candidates))
+	var backups []*Backend
+	for _, b := range candidates {
+		switch {
+		case !b.IsAlive():
+		case b.IsBackup():
+			backups = append(backups, b)
+		default:
+			alive = append(alive, b)
+		}
+	}
+	if len(alive) == 0 && len(backups) > 0 {
+		alive = backups
+		s.logger.Debug("No primary backend alive, selecting among backups", "backups", len(backups))
+	}
+	local := s.localBackends(alive)
+	s.localAlive.Store(&local)
+	s.alive.Store(&alive)
+
+	counts := backendCounts{total: len(s.backends)}
+	for _, b := range s.backends {
+		if b.IsAlive() {
+			counts.alive++
+		}
+	}
+	s.counts.Store(&counts)
+}
+
+// ErrQueueFull is returned by AcquirePeer when the wait queue is already at its limit
+var ErrQueueFull = errors.New("request queue is full")
+
+// ErrNoBackends is reported when the pool has no backends at all, e.g. before discovery adds any
+var ErrNoBackends = errors.New("no backends configured")
+
+// ErrAllBackendsDown is reported when the pool has backends but none of them is alive
+var ErrAllBackendsDown = errors.New("all backends are down")
+
+// GetNextPeer selects the next available backend using the configured strategy, which
+// receives ctx if it is a ContextLoadBalancer.
+// It blocks and waits for an available backend if none are currently alive. Without a
+// backend it returns ErrNoBackends right away for an empty pool, ErrAllBackendsDown once
+// the pool's max wait (see SetMaxWaitForBackend) passes without any backend alive, or the
+// context's error if ctx is done first, also matching ErrAllBackendsDown if none was alive.
+func (s *ServerPool) GetNextPeer(ctx context.Context) (*Backend, error) {
+	return s.waitForPeer(ctx, false, 0)
+}
+
+// SelectBackend makes a single selection from the alive backends, preferring the local zone
+// (see SetLocalZone), without waiting or reserving a connection. Nil means no backend
+// currently has capacity.
+func (s *ServerPool) SelectBackend() *Backend {
+	return s.SelectBackendCtx(context.Background())
+}
+
+// SelectBackendCtx is SelectBackend with request metadata for context-aware strategies
+// (see ContextLoadBalancer)
+func (s *ServerPool) SelectBackendCtx(ctx context.Context) *Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.selectAlive(ctx)
+}
+
+// AcquirePeer is GetNextPeer that also reserves a connection on the chosen backend while
+// holding the pool lock, so concurrent requests cannot overshoot a backend's connection limit.
+// If no backend has capacity the caller queues until ctx is done; at most maxQueue callers
+// wait at once (0 means unbounded), beyond which ErrQueueFull is returned immediately.
+// Every acquired backend must be handed back with ReleasePeer.
+func (s *ServerPool) AcquirePeer(ctx context.Context, maxQueue int) (*Backend, error) {
+	return s.waitForPeer(ctx, true, maxQueue)
 }
 
-// GetNextPeer selects the next available backend using the configured strategy
-// It blocks and waits for an available backend if none are currently alive.
-// It returns nil if the context is canceled or times out.
-func (s *ServerPool) GetNextPeer(ctx context.Context) *Backend {
+// tryAcquirePeer is AcquirePeer without queueing, for retrying a request on another backend:
+// it returns nil right away if no backend other than those tried (see withTriedPeers) is
+// alive and has capacity.
+func (s *ServerPool) tryAcquirePeer(ctx context.Context) *Backend {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	backend := s.selectAlive(ctx)
+	if backend != nil {
+		backend.IncrementActiveConnections()
+	}
+	return backend
+}
+
+// ReleasePeer returns a connection reserved by AcquirePeer and wakes queued requests
+func (s *ServerPool) ReleasePeer(b *Backend) {
+	b.DecrementActiveConnections()
+	if s.queued.Load() > 0 {
+		s.notifyBackendAvailable()
+	}
+}
+
+// waitForPeer implements GetNextPeer and AcquirePeer
+func (s *ServerPool) waitForPeer(ctx context.Context, acquire bool, maxQueue int) (*Backend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.backends) == 0 {
+		return nil, ErrNoBackends
+	}
+
+	queued := false
+	var maxWaitTimer *time.Timer // Started the first time the pool is found without alive backends
+	defer func() {
+		if queued {
+			s.queued.Add(-1)
+		}
+	}()
 
 	for {
-		backend := s.lb.SelectBackend(s.backends)
+		backend := s.selectAlive(ctx)
 		if backend != nil {
-			return backend
+			if acquire {
+				backend.IncrementActiveConnections()
+			}
+			return backend, nil
 		}
 
-		// Wait for a backend to become available or context cancellation
-		// Removed unused waitCh variable
+		if !queued {
+			if maxQueue > 0 && s.queued.Load() >= int64(maxQueue) {
+				return nil, ErrQueueFull
+			}
+			s.queued.Add(1)
+			queued = true
+			continue // Select again: ReleasePeer only notifies once it sees a queued request
+		}
 
-		// Wait for backendAvailable or context done
-		waitDone := make(chan struct{})
-		go func() {
-			s.mu.Lock()
-			s.backendAvailable.Wait()
-			s.mu.Unlock()
-			close(waitDone)
-		}()
+		// With no backend alive at all, give up after maxWait rather than waiting out ctx
+		var maxWaitC <-chan time.Time
+		if s.maxWait > 0 && len(s.AliveBackends()) == 0 {
+			if maxWaitTimer == nil {
+				maxWaitTimer = time.NewTimer(s.maxWait)
+				defer maxWaitTimer.Stop()
+			}
+			maxWaitC = maxWaitTimer.C
+		}
 
+		// Wait for a notification or ctx. The channel is taken under mu, so a notification
+		// sent after unlocking closes this very channel and can't be missed; nothing is left
+		// blocked once ctx is done.
+		available := s.backendAvailable
 		s.mu.Unlock()
 		select {
 		case <-ctx.Done():
 			s.mu.Lock()
-			return nil
-		case <-waitDone:
+			if len(s.AliveBackends()) == 0 {
+				return nil, fmt.Errorf("%w: %w", ErrAllBackendsDown, ctx.Err())
+			}
+			return nil, fmt.Errorf("no backend became available: %w", ctx.Err())
+		case <-maxWaitC:
+			s.mu.Lock()
+			return nil, ErrAllBackendsDown
+		case <-available:
 			s.mu.Lock()
 		}
 	}
 }
 
+// SetMaxWaitForBackend bounds how long GetNextPeer and AcquirePeer wait while no backend
+// in the pool is alive, independent of the caller's context; 0 waits until the context is
+// done. Waiting for a busy backend to free a connection is not limited.
+func (s *ServerPool) SetMaxWaitForBackend(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxWait = d
+}
+
+// notifyBackendAvailable wakes requests waiting for a backend, e.g. after a backend comes
+// back up or a connection slot is released
+func (s *ServerPool) notifyBackendAvailable() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broadcastAvailable()
+}
+
+// broadcastAvailable wakes every request waiting in waitForPeer. Callers must hold mu.
+func (s *ServerPool) broadcastAvailable() {
+	close(s.backendAvailable)
+	s.backendAvailable = make(chan struct{})
+}
+
+// ShadowDropped returns how many requests weren't mirrored to the shadow backend because
+// Config.ShadowMaxInFlight mirrored requests were already in flight
+func (s *ServerPool) ShadowDropped() int64 {
+	return s.shadowDropped.Load()
+}
+
+// AliveCount returns the number of backends currently marked alive.
+// It reads the counts kept with the alive set and never waits on the pool lock.
+func (s *ServerPool) AliveCount() int {
+	return s.counts.Load().alive
+}
+
+// StartDraining marks the pool as shutting down: it keeps serving requests, but Ready
+// reports false from now on so upstream load balancers stop sending new traffic
+func (s *ServerPool) StartDraining() {
+	s.draining.Store(true)
+}
+
+// Draining reports whether StartDraining was called
+func (s *ServerPool) Draining() bool {
+	return s.draining.Load()
+}
+
+// Pause makes the proxy refuse new requests with cfg.PausedStatusCode until Resume is
+// called. Requests in flight finish, health checks keep running and readiness is unchanged.
+func (s *ServerPool) Pause() {
+	s.paused.Store(true)
+}
+
+// Resume undoes Pause
+func (s *ServerPool) Resume() {
+	s.paused.Store(false)
+}
+
+// Paused reports whether the pool is paused
+func (s *ServerPool) Paused() bool {
+	return s.paused.Load()
+}
+
+// Ready reports whether enough backends are alive to serve traffic and the pool is not
+// draining. At least one alive backend is always required, raised by
+// cfg.MinHealthyBackends and cfg.MinHealthyFraction (of all configured backends),
+// whichever is stricter.
+func (s *ServerPool) Ready(cfg *Config) bool {
+	counts := s.counts.Load() // Total and alive from the same moment
+	total := counts.total
+	if total == 0 || s.draining.Load() {
+		return false
+	}
+	required := 1
+	if cfg.MinHealthyBackends > required {
+		required = cfg.MinHealthyBackends
+	}
+	if byFraction := int(math.Ceil(cfg.MinHealthyFraction * float64(total))); byFraction > required {
+		required = byFraction
+	}
+	return counts.alive >= required
+}
+
 // MarkBackendStatus updates the Alive status of a specific backend by URL
 func (s *ServerPool) MarkBackendStatus(backendURL *url.URL, alive bool) {
 	if backendURL == nil {
@@ -78,31 +411,36 @@ func (s *ServerPool) MarkBackendStatus(backendURL *url.URL, alive bool) {
 	defer s.mu.Unlock()
 	for _, b := range s.backends {
 		if b.URL.String() == targetURLStr {
-			previousAlive := b.IsAlive()
-			b.SetAlive(alive)
-			if !previousAlive && alive {
-				// Notify waiters that a backend became available
-				s.backendAvailable.Broadcast()
+			if !b.setAlive(alive) {
+				return
+			}
+			if alive {
+				s.broadcastAvailable() // Notify waiters that a backend became available
 			}
+			s.notifyHealthChange(b, alive)
 			return
 		}
 	}
 }
 
-// HealthCheck starts the periodic health checking process for all backends
-func (s *ServerPool) HealthCheck(cfg *Config) {
-	// Use a single client for all health checks in this cycle for efficiency
-	client := &http.Client{
-		Timeout: cfg.BackendRequestTimeout,
-		// Consider customizing transport if needed (e.g., disable keep-alives)
-		// Transport: &http.Transport{ DisableKeepAlives: true },
+// SetBackendWeight changes the weight of the backend with backendURL at runtime (see
+// Backend.SetWeight), reporting whether the pool has such a backend
+func (s *ServerPool) SetBackendWeight(backendURL *url.URL, weight int) bool {
+	if backendURL == nil {
+		return false
 	}
-
-	// Start ticker for subsequent checks
-	ticker := time.NewTicker(cfg.HealthCheckInterval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		s.PerformHealthCheckCycle(client, cfg)
+	targetURLStr := backendURL.String()
+	for _, b := range s.snapshotBackends() {
+		if b.URL.String() == targetURLStr {
+			b.SetWeight(weight)
+			return true
+		}
 	}
+	return false
+}
+
+// HealthCheck starts the periodic health checking process for all backends, using the
+// pool's ManagementClient. It never returns; see RunHealthChecks for a cancellable variant.
+func (s *ServerPool) HealthCheck(cfg *Config) {
+	s.RunHealthChecks(context.Background(), s.ManagementClient(), cfg)
 }
@@ -2,6 +2,7 @@ package golb
 
 import (
 	"context"
+	"errors"
 	"net/url"
 	"sync"
 	"testing"
@@ -52,7 +53,7 @@ func TestGetNextPeer(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer cancel()
 
-	got := pool.GetNextPeer(ctx)
+	got, _ := pool.GetNextPeer(ctx)
 	if got != backend {
 		t.Errorf("expected backend %v, got %v", backend, got)
 	}
@@ -70,7 +71,7 @@ func TestGetNextPeer(t *testing.T) {
 	var got2 *Backend
 	go func() {
 		defer wg.Done()
-		got2 = pool.GetNextPeer(ctx2)
+		got2, _ = pool.GetNextPeer(ctx2)
 	}()
 	// Wait a short time before signaling availability to avoid unlocking an unlocked mutex
 	time.Sleep(10 * time.Millisecond)
@@ -113,3 +114,169 @@ func TestMarkBackendStatus(t *testing.T) {
 	// Mark with nil URL should do nothing
 	pool.MarkBackendStatus(nil, true)
 }
+
+// TestAliveSetConsistentUnderConcurrentFlips checks the cached alive set matches backend
+// statuses once concurrent status changes settle
+func TestAliveSetConsistentUnderConcurrentFlips(t *testing.T) {
+	pool := newLargePool(t, NewRoundRobinBalancer(), 20)
+
+	var wg sync.WaitGroup
+	for i, b := range pool.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 200 {
+				if j%3 == 0 {
+					pool.MarkBackendStatus(b.URL, j%2 == 0)
+				} else {
+					b.SetAlive(j%2 == 0)
+				}
+				_ = pool.AliveBackends() // Concurrent readers
+			}
+			b.SetAlive(i%2 == 0) // Final state: even backends alive
+		}()
+	}
+	wg.Wait()
+
+	alive := pool.AliveBackends()
+	if len(alive) != 10 {
+		t.Fatalf("expected 10 alive backends, got %d", len(alive))
+	}
+	for _, b := range alive {
+		if !b.IsAlive() {
+			t.Errorf("expected only alive backends in the alive set, found %s", b.URL)
+		}
+	}
+}
+
+// BenchmarkSelectBackendMostlyDown selects from 500 backends of which only 5 are alive
+func BenchmarkSelectBackendMostlyDown(b *testing.B) {
+	pool := newLargePool(b, NewRoundRobinBalancer(), 500)
+	for i, backend := range pool.backends {
+		backend.SetAlive(i%100 == 0)
+	}
+	ctx := context.Background()
+	b.ResetTimer()
+	for range b.N {
+		if peer, _ := pool.GetNextPeer(ctx); peer == nil {
+			b.Fatal("expected an alive backend")
+		}
+	}
+}
+
+func TestSelectBackendDoesNotReserve(t *testing.T) {
+	pool := newLargePool(t, NewLeastConnectionBalancer(), 3)
+	pool.backends[0].SetAlive(false)
+	for range 5 {
+		b := pool.SelectBackend()
+		if b == nil || b == pool.backends[0] {
+			t.Fatalf("expected an alive backend, got %v", b)
+		}
+		if n := b.activeConnections.Load(); n != 0 {
+			t.Fatalf("expected SelectBackend not to reserve a connection, got %d active", n)
+		}
+	}
+	for _, b := range pool.backends {
+		b.SetAlive(false)
+	}
+	if b := pool.SelectBackend(); b != nil {
+		t.Errorf("expected nil with no alive backends, got %s", b.URL)
+	}
+}
+
+func TestDecrementActiveConnectionsFloorsAtZero(t *testing.T) {
+	previous := DefaultLogger()
+	capture := &captureLogger{}
+	SetDefaultLogger(capture)
+	t.Cleanup(func() { SetDefaultLogger(previous) })
+
+	u, _ := url.Parse("http://localhost:9090")
+	b := NewBackend(u, nil, 1)
+	b.IncrementActiveConnections()
+	b.DecrementActiveConnections()
+	if _, ok := capture.find("below zero"); ok {
+		t.Fatalf("Expected no warning for a matched decrement")
+	}
+	b.DecrementActiveConnections()
+	b.DecrementActiveConnections()
+
+	if n := b.activeConnections.Load(); n != 0 {
+		t.Errorf("Expected the count to floor at 0, got %d", n)
+	}
+	if _, ok := capture.find("WARN", "below zero", "http://localhost:9090"); !ok {
+		t.Errorf("Expected a warning for the unmatched decrement, got %v", capture.lines)
+	}
+	b.IncrementActiveConnections()
+	if n := b.activeConnections.Load(); n != 1 {
+		t.Errorf("Expected counting to resume normally, got %d", n)
+	}
+}
+
+func TestGetNextPeerErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := NewServerPool(NewRoundRobinBalancer()).GetNextPeer(ctx); !errors.Is(err, ErrNoBackends) {
+		t.Errorf("Expected ErrNoBackends for an empty pool, got %v", err)
+	}
+
+	u, _ := url.Parse("http://localhost:8080")
+	backend := NewBackend(u, nil, 1)
+	pool := NewServerPool(NewRoundRobinBalancer())
+	pool.AddBackend(backend) // Down until the first health check
+	_, err := pool.GetNextPeer(ctx)
+	if !errors.Is(err, ErrAllBackendsDown) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected ErrAllBackendsDown wrapping the context error, got %v", err)
+	}
+
+	// Alive but at its connection limit: only the context error
+	backend.SetAlive(true)
+	backend.SetMaxConnections(1)
+	backend.IncrementActiveConnections()
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	_, err = pool.GetNextPeer(canceled)
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrAllBackendsDown) {
+		t.Errorf("Expected only the wrapped context error for a busy pool, got %v", err)
+	}
+}
+
+func TestBackupBackends(t *testing.T) {
+	for _, lb := range []LoadBalancer{NewRoundRobinBalancer(), NewLeastConnectionBalancer(), NewWeightedRoundRobinBalancer()} {
+		pool := newLargePool(t, lb, 4)
+		primary1, primary2, zeroWeight, tagged := pool.backends[0], pool.backends[1], pool.backends[2], pool.backends[3]
+		zeroWeight.SetWeight(0)
+		tagged.SetTags(BackupTag)
+		pool.MarkBackendStatus(tagged.URL, false) // Re-evaluated on the next status flip
+		pool.MarkBackendStatus(tagged.URL, true)
+
+		selected := func() map[*Backend]int {
+			counts := map[*Backend]int{}
+			for range 20 {
+				counts[pool.SelectBackend()]++
+			}
+			return counts
+		}
+		if counts := selected(); counts[zeroWeight] != 0 || counts[tagged] != 0 || counts[primary1] == 0 || counts[primary2] == 0 {
+			t.Errorf("%T: expected backups idle while primaries are up, got %v", lb, counts)
+		}
+
+		primary1.SetAlive(false)
+		if counts := selected(); counts[primary2] != 20 {
+			t.Errorf("%T: expected the remaining primary to take all traffic, got %v", lb, counts)
+		}
+		primary2.SetAlive(false)
+		if counts := selected(); counts[zeroWeight] == 0 || counts[tagged] == 0 || counts[nil] != 0 {
+			t.Errorf("%T: expected both backups to take over with all primaries down, got %v", lb, counts)
+		}
+		primary1.SetAlive(true)
+		if counts := selected(); counts[primary1] != 20 {
+			t.Errorf("%T: expected a recovered primary to take traffic back from the backups, got %v", lb, counts)
+		}
+
+		// Promoting a backup by giving it a weight makes it a primary straight away
+		zeroWeight.SetWeight(1)
+		if counts := selected(); counts[zeroWeight] == 0 {
+			t.Errorf("%T: expected the promoted backend in rotation, got %v", lb, counts)
+		}
+	}
+}
@@ -2,60 +2,358 @@ package golb
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
-	"log"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// responseCaptureWriter wraps http.ResponseWriter to capture response body
+// responseCaptureWriter wraps http.ResponseWriter to record the status code and size of the
+// response for access logging, and the body itself when body is non-nil. If requestIDHeader
+// is set, the request ID is echoed in that response header.
 type responseCaptureWriter struct {
 	http.ResponseWriter
-	body *bytes.Buffer
+	body   *bytes.Buffer
+	status int
+	bytes  int
+
+	requestIDHeader string
+	requestID       string
+}
+
+func (w *responseCaptureWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+		w.echoRequestID()
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
 }
 
 func (w *responseCaptureWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
+	if w.status == 0 {
+		w.status = http.StatusOK // Implicit WriteHeader, as in net/http
+		w.echoRequestID()
+	}
+	if w.body != nil {
+		w.body.Write(b)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
 }
 
-// Lb is the main request handler, selecting a backend and proxying the request
+// echoRequestID sets the request ID header, replacing any value copied from the backend
+func (w *responseCaptureWriter) echoRequestID() {
+	if w.requestIDHeader != "" {
+		w.Header().Set(w.requestIDHeader, w.requestID)
+	}
+}
+
+// Flush keeps streamed responses (e.g. SSE) flowing through the capture
+func (w *responseCaptureWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *responseCaptureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Proxy is an http.Handler that forwards each request to a backend selected from its pool.
+// Panic recovery, forwarded header sanitizing, request filtering, decompression and
+// compression from the config are applied in front of the forwarding, so a Proxy can be
+// mounted directly: mux.Handle("/", proxy).
+type Proxy struct {
+	pool      *ServerPool
+	cfg       *Config
+	shadow    *shadowTarget // Nil unless cfg.ShadowBackend is set
+	fallback  http.Handler  // Serves requests no backend is available for; nil answers 503
+	accessLog *accessLog    // Formatted access log; nil logs access through the pool's Logger
+	retries   *retryBudget  // Throttles failover retries; nil if unlimited or retries are off
+	retryOn   map[int]bool  // Backend statuses retried, from cfg.RetryOnStatuses
+	handler   http.Handler  // Middleware chain ending in forward
+}
+
+// NewProxy creates a Proxy for pool. A nil cfg uses DefaultConfig().
+func NewProxy(pool *ServerPool, cfg *Config) *Proxy {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	p := &Proxy{pool: pool, cfg: cfg, shadow: newShadowTarget(cfg, pool), fallback: newFallbackHandler(cfg, pool.Logger()), retries: newRetryBudget(cfg)}
+	if cfg.AccessLogEnabled {
+		p.accessLog = newAccessLog(cfg, pool.Logger())
+	}
+	if len(cfg.RetryOnStatuses) > 0 && retriesStatuses(cfg) {
+		p.retryOn = make(map[int]bool, len(cfg.RetryOnStatuses))
+		for _, status := range cfg.RetryOnStatuses {
+			p.retryOn[status] = true
+		}
+	}
+	p.handler = Recover(cfg, pool.Logger(), ForwardedHeaders(cfg, RequestFilter(cfg, DecompressRequest(cfg, Compress(cfg, Coalesce(cfg, http.HandlerFunc(p.forward)))))))
+	return p
+}
+
+// Pool returns the pool the proxy forwards to
+func (p *Proxy) Pool() *ServerPool {
+	return p.pool
+}
+
+// ServeHTTP runs the request through the middleware chain and proxies it to a backend
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.handler.ServeHTTP(w, r)
+}
+
+// Lb selects a backend and proxies the request without any middleware.
+// Kept for compatibility; new code should use NewProxy.
 func Lb(w http.ResponseWriter, r *http.Request, pool *ServerPool, accessLogEnabled bool, accessLogPayloads bool) {
-	peer := pool.GetNextPeer(r.Context())
-	if peer == nil {
-		log.Printf("Service Unavailable: No healthy backends available for request %s %s", r.Method, r.URL.Path)
-		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+	p := &Proxy{pool: pool, cfg: &Config{AccessLogEnabled: accessLogEnabled, AccessLogPayloads: accessLogPayloads}}
+	p.forward(w, r)
+}
+
+// retryAfterSeconds formats a Retry-After value: the queue timeout rounded up, at least 1 second
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(d.Seconds()))))
+}
+
+// forward selects a backend and proxies the request to it
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	pool := p.pool
+	accessLogEnabled, accessLogPayloads := p.cfg.AccessLogEnabled, p.cfg.AccessLogPayloads
+	logger := pool.Logger()
+	requestID := ensureRequestID(r, p.cfg.RequestIDHeader) // Set before proxying so the backend receives it
+
+	if pool.Paused() {
+		logger.Debug("Rejected request while paused", "method", r.Method, "path", r.URL.Path, "requestId", requestID)
+		if requestID != "" {
+			w.Header().Set(p.cfg.RequestIDHeader, requestID)
+		}
+		writeProxyError(w, r, p.cfg, pausedError(p.cfg))
 		return
 	}
 
-	if accessLogEnabled {
-		log.Printf("Forwarding %s %s to backend %s", r.Method, r.URL.Path, peer.URL)
-		if accessLogPayloads {
-			// Read and log request body
-			var reqBodyBytes []byte
-			if r.Body != nil {
-				reqBodyBytes, _ = io.ReadAll(r.Body)
-				log.Printf("Request Body: %s", string(reqBodyBytes))
-				// Restore the io.ReadCloser to its original state
-				r.Body = io.NopCloser(bytes.NewBuffer(reqBodyBytes))
-			}
+	if p.cfg.StrictHTTP {
+		if err := checkFraming(r); err != nil {
+			logger.Warn("Rejected request with ambiguous framing", "method", r.Method, "path", r.URL.Path, "client", ClientIP(r), "requestId", requestID, "error", err)
+			w.Header().Set("Connection", "close") // Whatever follows on the connection can't be trusted
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
 		}
 	}
 
-	// Wrap ResponseWriter to capture response body if payload logging enabled
-	rw := w
-	var respBody *bytes.Buffer
-	if accessLogEnabled && accessLogPayloads {
-		respBody = &bytes.Buffer{}
-		rw = &responseCaptureWriter{ResponseWriter: w, body: respBody}
+	// Queue for up to QueueTimeout while every backend is down or at its connection limit.
+	// The context also carries request metadata for context-aware balancers, and the trace ID
+	// for latency exemplars.
+	ctx := WithClientIP(traceContext(r), ClientIP(r))
+	var decision *selectionDecision // Why the backend was chosen, only with DebugHeaders
+	if p.cfg.DebugHeaders {
+		ctx, decision = withSelectionDecision(ctx)
+	}
+	if p.cfg.QueueTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.QueueTimeout)
+		defer cancel()
+	}
+	var peer *Backend
+	var err error
+	if p.fallback != nil && pool.Size() > 0 && len(pool.AliveBackends()) == 0 {
+		// With a fallback there is no point queueing for a recovery: serve it right away
+		err = ErrAllBackendsDown
+	} else {
+		peer, err = pool.AcquirePeer(ctx, p.cfg.MaxQueueLength) // Fails right away for an empty pool
+	}
+	if peer == nil {
+		switch clientErr := r.Context().Err(); {
+		case errors.Is(clientErr, context.Canceled):
+			// The client went away while waiting; nobody is left to read a response body
+			logger.Debug("Client disconnected while waiting for a backend", "method", r.Method, "path", r.URL.Path)
+			w.WriteHeader(StatusClientClosedRequest)
+			return
+		case errors.Is(clientErr, context.DeadlineExceeded):
+			// The request's own deadline passed (not the queue timeout): the gateway timed out
+			logger.Warn("Gateway timeout: no backend became available before the request deadline", "method", r.Method, "path", r.URL.Path)
+			writeProxyError(w, r, p.cfg, ProxyError{Status: http.StatusGatewayTimeout, Message: "Gateway Timeout", Category: ErrorCategoryTimeout, Detail: clientErr.Error()})
+			return
+		}
+		if requestID != "" {
+			w.Header().Set(p.cfg.RequestIDHeader, requestID)
+		}
+		if p.fallback != nil {
+			logger.Warn("No healthy backends available, serving fallback", "method", r.Method, "path", r.URL.Path, "error", err)
+			p.fallback.ServeHTTP(w, r)
+			return
+		}
+		logger.Warn("Service unavailable: no backend available", "method", r.Method, "path", r.URL.Path, "error", err)
+		w.Header().Set("Retry-After", retryAfterSeconds(p.cfg.QueueTimeout))
+		var detail string
+		if err != nil {
+			detail = err.Error()
+		}
+		writeProxyError(w, r, p.cfg, noBackendError(p.cfg, detail))
+		return
+	}
+	defer func() { pool.ReleasePeer(peer) }() // peer changes if the request is retried
+
+	if p.shadow != nil {
+		p.shadow.mirror(r)
 	}
 
-	peer.ReverseProxy.ServeHTTP(rw, r)
+	logger.Debug("Forwarding request", "method", r.Method, "path", r.URL.Path, "backend", peer.URL.String(), "requestId", requestID)
 
+	var reqBody string
+	if accessLogEnabled && accessLogPayloads && r.Body != nil {
+		// Not a pooled buffer: the transport may read the body after we return, so it is read
+		// once into a string shared by the backend and the log
+		var body strings.Builder
+		_, _ = io.Copy(&body, r.Body)
+		_ = r.Body.Close()
+		reqBody = body.String()
+		r.Body = io.NopCloser(strings.NewReader(reqBody)) // Restore the body for the backend
+	}
+	capture := &responseCaptureWriter{ResponseWriter: w, requestIDHeader: p.cfg.RequestIDHeader, requestID: requestID}
 	if accessLogEnabled && accessLogPayloads {
-		if respBody != nil {
-			log.Printf("Response Body: %s", respBody.String())
-		} else {
-			log.Println("Response Body: <empty>")
+		capture.body = getCaptureBuffer(p.cfg.MaxPooledBufferSize)
+		defer putCaptureBuffer(capture.body, p.cfg.MaxPooledBufferSize) // Also runs if the copy aborts with a panic
+	}
+	// Failover retries replay the request body, so it is buffered up front
+	retry := p.cfg.MaxRetries > 0 && p.cfg.RetryPolicy != RetryPolicyNone
+	var replay []byte
+	if retry {
+		replay, retry = replayableBody(r, p.cfg.RetryMaxBodySize)
+	}
+	start := time.Now()
+	deadline, _ := r.Context().Deadline() // Retries don't wait past it
+
+	var tried []*Backend
+	var attemptStart time.Time
+	for attempt := 0; ; attempt++ {
+		peer.counters.requests.Add(1)
+		attemptStart = time.Now()
+		proxyCtx := withClientAddr(r.Context(), r.RemoteAddr) // For the PROXY protocol dialer
+		timeout := peer.RequestTimeout()
+		if timeout == 0 {
+			timeout = p.cfg.RequestTimeout
+		}
+		cancel := context.CancelFunc(func() {})
+		if timeout > 0 {
+			proxyCtx, cancel = context.WithTimeout(proxyCtx, timeout)
+		}
+		var f *failover
+		if retry {
+			f = &failover{
+				method:      r.Method,
+				connectOnly: p.cfg.RetryPolicy == RetryPolicyConnectOnly,
+				retriesLeft: p.cfg.MaxRetries - attempt,
+				budget:      p.retries,
+				statuses:    p.retryOn,
+				backoff:     retryBackoff(p.cfg.RetryBackoff, attempt),
+				deadline:    deadline,
+				acquire: func() *Backend {
+					return pool.tryAcquirePeer(withTriedPeers(ctx, append(slices.Clip(tried), peer)))
+				},
+			}
+			proxyCtx = withFailover(proxyCtx, f)
+			if replay != nil {
+				r.Body = io.NopCloser(bytes.NewReader(replay))
+			}
+		}
+		if decision != nil {
+			logger.Debug("Selected backend", "backend", peer.URL.String(), "reason", decision.reason, "requestId", requestID)
+			capture.Header().Set(DebugBackendHeader, peer.URL.String())
+			capture.Header().Set(DebugDecisionHeader, decision.reason)
 		}
+		attemptReq := r.WithContext(proxyCtx)
+		peer.ReverseProxy.ServeHTTP(capture, attemptReq)
+		cancel()
+		if f == nil || (f.err == nil && f.next == nil) {
+			if f != nil && !f.failed {
+				p.retries.onSuccess()
+			}
+			r = attemptReq
+			break
+		}
+
+		// The backend couldn't be reached, or answered with a status worth a retry, and the
+		// response was held back: try another
+		pool.RecordOutcome(peer, true, p.cfg)
+		tried = append(tried, peer)
+		next, failure := f.next, "failed"
+		if next != nil {
+			peer.counters.recordResponse(f.status, 0)
+			failure = "answered " + strconv.Itoa(f.status)
+		} else if next = pool.tryAcquirePeer(withTriedPeers(ctx, tried)); next == nil {
+			writeProxyError(capture, attemptReq, p.cfg, *f.err)
+			r = attemptReq
+			break
+		}
+		decision.annotate("retried after " + peer.URL.String() + " " + failure)
+		logger.Warn("Retrying request on another backend", "method", r.Method, "path", r.URL.Path, "failedBackend", peer.URL.String(), "failure", failure, "backend", next.URL.String(), "attempt", attempt+2, "backoff", f.backoff)
+		pool.ReleasePeer(peer)
+		peer = next
+		if f.backoff > 0 {
+			timer := time.NewTimer(f.backoff)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done(): // The next attempt fails right away and answers 499
+				timer.Stop()
+			}
+		}
+	}
+	duration := time.Since(start)
+	latency := time.Since(attemptStart) // The answering backend's share of duration
+	peer.ObserveLatencyCtx(ctx, latency)
+	peer.observeConcurrency(latency)
+	peer.counters.recordResponse(capture.status, capture.bytes)
+	pool.RecordOutcome(peer, capture.status >= http.StatusInternalServerError, p.cfg)
+	pool.HonorRetryAfter(peer, capture.status, capture.Header(), p.cfg)
+
+	if !accessLogEnabled {
+		return
+	}
+	// Access logging: one line per request once the response is complete, with payloads if enabled
+	if p.accessLog != nil {
+		entry := &AccessLogEntry{
+			Time:      start,
+			Method:    r.Method,
+			URI:       r.URL.RequestURI(),
+			Proto:     r.Proto,
+			Client:    ClientIP(r),
+			Backend:   peer.URL.String(),
+			Status:    capture.status,
+			Bytes:     capture.bytes,
+			Duration:  duration,
+			RequestID: requestID,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		}
+		if accessLogPayloads {
+			entry.RequestBody, entry.ResponseBody = reqBody, capture.body.String()
+		}
+		if err := p.accessLog.write(entry); err != nil {
+			logger.Error("Failed to write access log", "error", err)
+		}
+		return
+	}
+	args := []any{
+		"method", r.Method,
+		"path", r.URL.Path,
+		"client", ClientIP(r),
+		"backend", peer.URL.String(),
+		"status", capture.status,
+		"bytes", capture.bytes,
+		"duration", duration,
+	}
+	if requestID != "" {
+		args = append(args, "requestId", requestID)
+	}
+	if accessLogPayloads {
+		args = append(args, "requestBody", reqBody, "responseBody", capture.body.String())
 	}
+	logger.Info("Access", args...)
 }
@@ -54,6 +54,7 @@ func TestLbProxyWithSingleBackend(t *testing.T) {
 	}
 
 	pool.AddBackend(peer)
+	pool.MarkBackendStatus(backendURL, true) // Backends start down until the first health check
 
 	// Test cases
 	tests := []struct {
@@ -165,6 +166,23 @@ func TestLbNoHealthyBackends(t *testing.T) {
 	}
 }
 
+func TestNoBackendStatusCode(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.NoBackendStatusCode = http.StatusBadGateway
+	rr := httptest.NewRecorder()
+	NewProxy(NewServerPool(NewRoundRobinBalancer()), cfg).ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+	if rr.Code != http.StatusBadGateway || !strings.Contains(rr.Body.String(), "Bad Gateway") {
+		t.Errorf("Expected the configured 502, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	for _, code := range []int{200, 404, 600} {
+		cfg.NoBackendStatusCode = code
+		if err := validateConfig(cfg); err == nil {
+			t.Errorf("Expected no-backend status code %d to be rejected", code)
+		}
+	}
+}
+
 func TestLbWithUnhealthyBackend(t *testing.T) {
 	// Create a backend that will be marked as unhealthy
 	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -192,7 +210,7 @@ func TestLbWithUnhealthyBackend(t *testing.T) {
 
 	req := httptest.NewRequest("GET", "/test", nil)
 	// Add timeout context to prevent indefinite blocking
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
 	defer cancel()
 	req = req.WithContext(ctx)
 
@@ -200,8 +218,9 @@ func TestLbWithUnhealthyBackend(t *testing.T) {
 
 	Lb(rr, req, pool, true, true)
 
-	if rr.Code != http.StatusServiceUnavailable {
-		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	// The request's own deadline expired while waiting for the backend to recover
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, rr.Code)
 	}
 }
 
@@ -261,6 +280,7 @@ func TestLbConcurrentRequests(t *testing.T) {
 	}
 
 	pool.AddBackend(peer)
+	pool.MarkBackendStatus(backendURL, true) // Backends start down until the first health check
 
 	// Run concurrent requests
 	const numRequests = 10
@@ -322,3 +342,313 @@ func TestLbDirectProxy(t *testing.T) {
 		t.Errorf("Buffer should contain '%s', got '%s'", string(testData), buffer.String())
 	}
 }
+
+func TestProxyServeHTTP(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello from "+r.URL.Path)
+	}))
+
+	mux := http.NewServeMux()
+	mux.Handle("/", NewProxy(pool, nil))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/greeting")
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if string(body) != "hello from /greeting" {
+		t.Errorf("Expected backend response, got %q", body)
+	}
+}
+
+func TestProxyAppliesConfiguredMiddleware(t *testing.T) {
+	backendHit := false
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendHit = true
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, strings.Repeat("compress me ", 200))
+	}))
+
+	cfg := DefaultConfig()
+	cfg.BlockedPathPrefixes = []string{"/admin"}
+	cfg.CompressionEnabled = true
+	proxy := NewProxy(pool, cfg)
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/users", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for blocked path, got %d", http.StatusForbidden, rr.Code)
+	}
+	if backendHit {
+		t.Errorf("Expected blocked request not to reach the backend")
+	}
+
+	req := httptest.NewRequest("GET", "/page", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expected response to be gzipped, got Content-Encoding %q", rr.Header().Get("Content-Encoding"))
+	}
+	if proxy.Pool() != pool {
+		t.Errorf("Expected Pool() to return the configured pool")
+	}
+}
+
+func TestResponseCaptureWriterWriteHeader(t *testing.T) {
+	rr := httptest.NewRecorder()
+	captureWriter := &responseCaptureWriter{ResponseWriter: rr}
+
+	captureWriter.WriteHeader(http.StatusTeapot)
+	captureWriter.WriteHeader(http.StatusOK) // Superfluous calls don't change the recorded status
+	_, _ = captureWriter.Write([]byte("short and stout"))
+
+	if captureWriter.status != http.StatusTeapot {
+		t.Errorf("Expected captured status %d, got %d", http.StatusTeapot, captureWriter.status)
+	}
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("Expected status %d to reach the client, got %d", http.StatusTeapot, rr.Code)
+	}
+	if captureWriter.bytes != len("short and stout") {
+		t.Errorf("Expected %d bytes counted, got %d", len("short and stout"), captureWriter.bytes)
+	}
+
+	// Without an explicit WriteHeader the status is the implicit 200
+	implicit := &responseCaptureWriter{ResponseWriter: httptest.NewRecorder()}
+	_, _ = implicit.Write([]byte("ok"))
+	if implicit.status != http.StatusOK {
+		t.Errorf("Expected implicit status %d, got %d", http.StatusOK, implicit.status)
+	}
+}
+
+func TestLbAccessLogging(t *testing.T) {
+	tests := []struct {
+		name              string
+		accessLogEnabled  bool
+		accessLogPayloads bool
+		expectAccess      bool
+		expectPayloads    bool
+	}{
+		{"access log disabled", false, false, false, false},
+		{"payloads ignored without access log", false, true, false, false},
+		{"access log without payloads", true, false, true, false},
+		{"access log with payloads", true, true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var receivedBody string
+			pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				receivedBody = string(body)
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, "created-widget")
+			}))
+			capture := &captureLogger{}
+			pool.SetLogger(capture)
+
+			rr := httptest.NewRecorder()
+			Lb(rr, httptest.NewRequest("POST", "/widgets", strings.NewReader("widget-spec")), pool, tt.accessLogEnabled, tt.accessLogPayloads)
+
+			if rr.Code != http.StatusCreated || rr.Body.String() != "created-widget" {
+				t.Fatalf("Expected 201 created-widget, got %d %q", rr.Code, rr.Body.String())
+			}
+			if receivedBody != "widget-spec" {
+				t.Errorf("Expected backend to receive the full request body, got %q", receivedBody)
+			}
+
+			line, logged := capture.find("INFO", "Access")
+			if logged != tt.expectAccess {
+				t.Fatalf("Expected access log=%v, got lines %v", tt.expectAccess, capture.lines)
+			}
+			if !logged {
+				return
+			}
+			for _, want := range []string{"POST", "/widgets", backend.URL.String(), "201", "14"} {
+				if !strings.Contains(line, want) {
+					t.Errorf("Expected access log line to contain %q, got %q", want, line)
+				}
+			}
+			hasPayloads := strings.Contains(line, "widget-spec") && strings.Contains(line, "created-widget")
+			if hasPayloads != tt.expectPayloads {
+				t.Errorf("Expected payloads in access log=%v, got %q", tt.expectPayloads, line)
+			}
+		})
+	}
+}
+
+// newTestPool starts a backend running handler and returns a round-robin pool
+// containing it, already marked alive. The backend is closed when the test ends.
+func newTestPool(t testing.TB, handler http.Handler) (*ServerPool, *Backend) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	backendURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse backend URL: %v", err)
+	}
+	peer := NewBackend(backendURL, httputil.NewSingleHostReverseProxy(backendURL), 1)
+	peer.SetAlive(true)
+
+	pool := NewServerPool(NewRoundRobinBalancer())
+	pool.AddBackend(peer)
+	return pool, peer
+}
+
+func TestProxyEmptyPoolThenBackendAdded(t *testing.T) {
+	pool := NewServerPool(NewRoundRobinBalancer())
+	cfg := DefaultConfig()
+	cfg.AllowEmptyStart = true
+	cfg.BackendServers = []string{}
+	proxy := NewProxy(pool, cfg)
+
+	// No backends yet: 503 right away rather than waiting for the client to give up
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d with an empty pool, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	_, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("discovered"))
+	}))
+	pool.AddBackend(backend)
+
+	rr = httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "discovered" {
+		t.Errorf("Expected traffic to flow once a backend is added, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestLbNoPeerStatus(t *testing.T) {
+	deadPool := func() *ServerPool {
+		pool, backend := newTestPool(t, http.NotFoundHandler())
+		backend.SetAlive(false)
+		return pool
+	}
+
+	t.Run("client canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		rr := httptest.NewRecorder()
+		Lb(rr, httptest.NewRequest("GET", "/", nil).WithContext(ctx), deadPool(), false, false)
+		if rr.Code != StatusClientClosedRequest || rr.Body.Len() != 0 {
+			t.Errorf("Expected %d without a body, got %d %q", StatusClientClosedRequest, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("request deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		rr := httptest.NewRecorder()
+		Lb(rr, httptest.NewRequest("GET", "/", nil).WithContext(ctx), deadPool(), false, false)
+		if rr.Code != http.StatusGatewayTimeout {
+			t.Errorf("Expected %d, got %d", http.StatusGatewayTimeout, rr.Code)
+		}
+	})
+
+	t.Run("no capacity", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.QueueTimeout = 50 * time.Millisecond
+		rr := httptest.NewRecorder()
+		NewProxy(deadPool(), cfg).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected %d with Retry-After, got %d", http.StatusServiceUnavailable, rr.Code)
+		}
+	})
+}
+
+func TestBackendHeaderInjection(t *testing.T) {
+	type seen struct{ token, host string }
+	received := make(chan seen, 2)
+	newRecordingServer := func() string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- seen{r.Header.Get("X-Internal-Token"), r.Host}
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	a, b := newRecordingServer(), newRecordingServer()
+
+	cfg := DefaultConfig()
+	cfg.BackendOptions = map[string]BackendOptions{
+		a: {Headers: map[string]string{"X-Internal-Token": "a-secret", "host": "a.internal"}},
+	}
+	pool, err := BuildServerPool(cfg, "round-robin", []string{a, b}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build pool: %v", err)
+	}
+	markAllAlive(pool)
+	proxy := NewProxy(pool, cfg)
+
+	for range 2 { // Round robin: one request each
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Internal-Token", "client-supplied")
+		proxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	aSeen, bSeen := <-received, <-received
+	if aSeen.token != "a-secret" || aSeen.host != "a.internal" {
+		t.Errorf("Expected backend A to receive its token and Host, got %+v", aSeen)
+	}
+	if bSeen.token != "client-supplied" || bSeen.host != strings.TrimPrefix(b, "http://") {
+		t.Errorf("Expected backend B to receive the request untouched, got %+v", bSeen)
+	}
+
+	if got := cfg.Redacted().BackendOptions[a].Headers["X-Internal-Token"]; got != "REDACTED" {
+		t.Errorf("Expected per-backend header values to be redacted, got %q", got)
+	}
+	if cfg.BackendOptions[a].Headers["X-Internal-Token"] != "a-secret" {
+		t.Errorf("Expected Redacted to leave the original config untouched")
+	}
+}
+
+func TestStripResponseHeaders(t *testing.T) {
+	newLeakyServer := func() string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", "nginx/1.2.3")
+			w.Header().Set("X-Powered-By", "PHP/5.6")
+			w.Header().Set("X-Keep", "yes")
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	a, b := newLeakyServer(), newLeakyServer()
+
+	cfg := DefaultConfig()
+	cfg.StripResponseHeaders = []string{"server"}
+	cfg.BackendOptions = map[string]BackendOptions{
+		a: {StripResponseHeaders: []string{"X-Powered-By"}},
+	}
+	pool, err := BuildServerPool(cfg, "round-robin", []string{a, b}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build pool: %v", err)
+	}
+	markAllAlive(pool)
+	proxy := NewProxy(pool, cfg)
+
+	for i, wantPoweredBy := range []string{"", "PHP/5.6"} { // Round robin: A, then B
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if got := rr.Header().Get("Server"); got != "" {
+			t.Errorf("Request %d: expected Server to be stripped globally, got %q", i, got)
+		}
+		if got := rr.Header().Get("X-Powered-By"); got != wantPoweredBy {
+			t.Errorf("Request %d: expected X-Powered-By %q, got %q", i, wantPoweredBy, got)
+		}
+		if got := rr.Header().Get("X-Keep"); got != "yes" {
+			t.Errorf("Request %d: expected unlisted headers to pass through, got X-Keep %q", i, got)
+		}
+	}
+}
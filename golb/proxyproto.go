@@ -0,0 +1,230 @@
+package golb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol versions accepted by Config.BackendProxyProtocol
+const (
+	ProxyProtocolV1 = "v1"
+	ProxyProtocolV2 = "v2"
+)
+
+// proxyProtocolV2Signature starts every PROXY protocol v2 header
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtocolHeaderTimeout bounds how long an inbound connection may take to send its PROXY header
+const proxyProtocolHeaderTimeout = 5 * time.Second
+
+type clientAddrKey struct{}
+
+// withClientAddr records the client's address (http.Request.RemoteAddr) for the backend dialer
+func withClientAddr(ctx context.Context, remoteAddr string) context.Context {
+	return context.WithValue(ctx, clientAddrKey{}, remoteAddr)
+}
+
+// proxyProtocolAddrs returns the client (source) and proxy listener (destination) addresses
+// for a PROXY header, or nils if the client address isn't known
+func proxyProtocolAddrs(ctx context.Context, upstream net.Conn) (src, dst *net.TCPAddr) {
+	remoteAddr, _ := ctx.Value(clientAddrKey{}).(string)
+	host, port, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return nil, nil
+	}
+	ip := net.ParseIP(host)
+	portNum, err := strconv.Atoi(port)
+	if ip == nil || err != nil {
+		return nil, nil
+	}
+	src = &net.TCPAddr{IP: ip, Port: portNum}
+
+	// The destination is where the client connected to us; fall back to our side of the upstream connection
+	if local, ok := ctx.Value(http.LocalAddrContextKey).(*net.TCPAddr); ok {
+		dst = local
+	} else if local, ok := upstream.LocalAddr().(*net.TCPAddr); ok {
+		dst = local
+	} else {
+		return nil, nil
+	}
+	return src, dst
+}
+
+// proxyProtocolHeader builds a v1 or v2 PROXY header. Nil addresses produce an
+// "unknown"/LOCAL header, telling the backend to use the connection's own addresses.
+func proxyProtocolHeader(version string, src, dst *net.TCPAddr) []byte {
+	ipv4 := src != nil && dst != nil && src.IP.To4() != nil && dst.IP.To4() != nil
+	if version == ProxyProtocolV1 {
+		switch {
+		case src == nil || dst == nil:
+			return []byte("PROXY UNKNOWN\r\n")
+		case ipv4:
+			return fmt.Appendf(nil, "PROXY TCP4 %s %s %d %d\r\n", src.IP.To4(), dst.IP.To4(), src.Port, dst.Port)
+		default:
+			return fmt.Appendf(nil, "PROXY TCP6 %s %s %d %d\r\n", src.IP.To16(), dst.IP.To16(), src.Port, dst.Port)
+		}
+	}
+
+	header := append([]byte(nil), proxyProtocolV2Signature...)
+	if src == nil || dst == nil {
+		return append(header, 0x20, 0x00, 0x00, 0x00) // v2 LOCAL, unspecified family, no addresses
+	}
+	var addrs []byte
+	family := byte(0x21) // TCP over IPv6
+	if ipv4 {
+		family = 0x11 // TCP over IPv4
+		addrs = append(append(addrs, src.IP.To4()...), dst.IP.To4()...)
+	} else {
+		addrs = append(append(addrs, src.IP.To16()...), dst.IP.To16()...)
+	}
+	addrs = binary.BigEndian.AppendUint16(addrs, uint16(src.Port))
+	addrs = binary.BigEndian.AppendUint16(addrs, uint16(dst.Port))
+	header = append(header, 0x21, family) // v2 PROXY command
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+// NewProxyProtocolListener wraps l so accepted connections must start with a PROXY protocol
+// v1 or v2 header; RemoteAddr then reports the original client address from the header.
+// The header is read on first use of the connection, not in Accept, so a slow client
+// cannot stall the accept loop. Connections without a valid header fail on first read.
+func NewProxyProtocolListener(l net.Listener) net.Listener {
+	return &proxyProtocolListener{Listener: l}
+}
+
+type proxyProtocolListener struct {
+	net.Listener
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyProtocolConn strips the PROXY header from an inbound connection
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+// readHeader parses the PROXY header exactly once
+func (c *proxyProtocolConn) readHeader() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolHeaderTimeout))
+		c.remoteAddr, c.err = parseProxyProtocolHeader(c.reader)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			_ = c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+var errInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// parseProxyProtocolHeader consumes a v1 or v2 header from r and returns the client address
+// it carries, or nil for UNKNOWN/LOCAL headers
+func parseProxyProtocolHeader(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(len(proxyProtocolV2Signature))
+	if err != nil && !bytes.HasPrefix(prefix, []byte("PROXY ")) {
+		return nil, fmt.Errorf("%w: %v", errInvalidProxyHeader, err)
+	}
+	if bytes.HasPrefix(prefix, []byte("PROXY ")) {
+		return parseProxyProtocolV1(r)
+	}
+	if bytes.Equal(prefix, proxyProtocolV2Signature) {
+		return parseProxyProtocolV2(r)
+	}
+	return nil, fmt.Errorf("%w: missing signature", errInvalidProxyHeader)
+}
+
+func parseProxyProtocolV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidProxyHeader, err)
+		}
+		line = append(line, b)
+		if len(line) > 107 { // Longest valid v1 header
+			return nil, fmt.Errorf("%w: v1 header too long", errInvalidProxyHeader)
+		}
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: %q", errInvalidProxyHeader, strings.TrimSpace(string(line)))
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("%w: bad source address in %q", errInvalidProxyHeader, strings.TrimSpace(string(line)))
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func parseProxyProtocolV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidProxyHeader, err)
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", errInvalidProxyHeader, header[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidProxyHeader, err)
+	}
+	if header[12]&0x0F == 0x00 {
+		return nil, nil // LOCAL: connection made by the proxy itself, e.g. a health check
+	}
+
+	switch header[13] >> 4 {
+	case 0x1: // IPv4
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("%w: short IPv4 address block", errInvalidProxyHeader)
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x2: // IPv6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("%w: short IPv6 address block", errInvalidProxyHeader)
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	return nil, nil // Unix sockets and unspecified families carry no usable client address
+}
@@ -0,0 +1,197 @@
+package golb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startProxyProtocolBackend runs a raw TCP backend that reads the PROXY header with readHeader,
+// reports it on the returned channel and answers one HTTP request per connection
+func startProxyProtocolBackend(t *testing.T, readHeader func(*bufio.Reader) (string, error)) (*url.URL, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	headers := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				header, err := readHeader(reader)
+				if err != nil {
+					headers <- "error: " + err.Error()
+					return
+				}
+				headers <- header
+				if _, err := http.ReadRequest(reader); err != nil {
+					return
+				}
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+			}()
+		}
+	}()
+	backendURL, _ := url.Parse("http://" + listener.Addr().String())
+	return backendURL, headers
+}
+
+// proxyThrough sends a request from clientAddr to backendURL through a Proxy using NewTransport(cfg)
+func proxyThrough(t *testing.T, cfg *Config, backendURL *url.URL, clientAddr string) *httptest.ResponseRecorder {
+	t.Helper()
+	reverseProxy := httputil.NewSingleHostReverseProxy(backendURL)
+	reverseProxy.Transport = NewTransport(cfg)
+	backend := NewBackend(backendURL, reverseProxy, 1)
+	backend.SetAlive(true)
+	pool := NewServerPool(NewRoundRobinBalancer())
+	pool.AddBackend(backend)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = clientAddr
+	rr := httptest.NewRecorder()
+	NewProxy(pool, cfg).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestBackendProxyProtocolV1(t *testing.T) {
+	backendURL, headers := startProxyProtocolBackend(t, func(r *bufio.Reader) (string, error) {
+		return r.ReadString('\n')
+	})
+	cfg := DefaultConfig()
+	cfg.BackendProxyProtocol = ProxyProtocolV1
+
+	rr := proxyThrough(t, cfg, backendURL, "203.0.113.7:41234")
+	if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+		t.Fatalf("Expected 200 ok through the proxy, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	header := <-headers
+	if !strings.HasPrefix(header, "PROXY TCP4 203.0.113.7 127.0.0.1 41234 ") || !strings.HasSuffix(header, "\r\n") {
+		t.Errorf("Unexpected PROXY v1 header %q", header)
+	}
+}
+
+func TestBackendProxyProtocolV2(t *testing.T) {
+	backendURL, headers := startProxyProtocolBackend(t, func(r *bufio.Reader) (string, error) {
+		addr, err := parseProxyProtocolHeader(r)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprint(addr), nil
+	})
+	cfg := DefaultConfig()
+	cfg.BackendProxyProtocol = ProxyProtocolV2
+
+	for _, clientAddr := range []string{"198.51.100.9:5555", "[2001:db8::1]:443"} {
+		rr := proxyThrough(t, cfg, backendURL, clientAddr)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		if header := <-headers; header != clientAddr {
+			t.Errorf("Expected backend to decode client address %s from PROXY v2 header, got %q", clientAddr, header)
+		}
+	}
+}
+
+func TestProxyProtocolHeaderUnknownClient(t *testing.T) {
+	if got := string(proxyProtocolHeader(ProxyProtocolV1, nil, nil)); got != "PROXY UNKNOWN\r\n" {
+		t.Errorf("Expected PROXY UNKNOWN header, got %q", got)
+	}
+	addr, err := parseProxyProtocolHeader(bufio.NewReader(strings.NewReader(string(proxyProtocolHeader(ProxyProtocolV2, nil, nil)))))
+	if err != nil || addr != nil {
+		t.Errorf("Expected v2 LOCAL header to parse with no address, got %v, %v", addr, err)
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RemoteAddr)
+	})}
+	go func() { _ = server.Serve(NewProxyProtocolListener(listener)) }()
+	defer server.Close()
+
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.44"), Port: 6000}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 443}
+	tests := map[string]string{
+		"v1":      string(proxyProtocolHeader(ProxyProtocolV1, src, dst)),
+		"v2":      string(proxyProtocolHeader(ProxyProtocolV2, src, dst)),
+		"v1 ipv6": "PROXY TCP6 2001:db8::44 2001:db8::1 6000 443\r\n",
+	}
+	expected := map[string]string{"v1": "192.0.2.44:6000", "v2": "192.0.2.44:6000", "v1 ipv6": "[2001:db8::44]:6000"}
+
+	for name, header := range tests {
+		t.Run(name, func(t *testing.T) {
+			body, err := rawRequest(listener.Addr().String(), header)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			if body != expected[name] {
+				t.Errorf("Expected RemoteAddr %s, got %q", expected[name], body)
+			}
+		})
+	}
+
+	if _, err := rawRequest(listener.Addr().String(), ""); err == nil {
+		t.Errorf("Expected a connection without PROXY header to be rejected")
+	}
+}
+
+// rawRequest writes prefix and a GET request on a fresh connection and returns the response body
+func rawRequest(addr, prefix string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, prefix+"GET / HTTP/1.1\r\nHost: golb\r\nConnection: close\r\n\r\n"); err != nil {
+		return "", err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestBackendProxyProtocolHealthCheck(t *testing.T) {
+	backendURL, headers := startProxyProtocolBackend(t, func(r *bufio.Reader) (string, error) {
+		return r.ReadString('\n')
+	})
+	cfg := DefaultConfig()
+	cfg.BackendProxyProtocol = ProxyProtocolV1
+	pool, err := BuildServerPool(cfg, "round-robin", []string{backendURL.String()}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build pool: %v", err)
+	}
+	pool.SetLogger(&captureLogger{})
+
+	pool.PerformHealthCheckCycle(pool.ManagementClient(), cfg)
+	if !pool.backends[0].IsAlive() {
+		t.Fatalf("Expected a backend requiring PROXY headers to pass its health check")
+	}
+	if header := <-headers; header != "PROXY UNKNOWN\r\n" {
+		t.Errorf("Expected the health check to send an unknown-client PROXY header, got %q", header)
+	}
+}
@@ -0,0 +1,191 @@
+package golb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newSaturatedProxy returns a proxy over one backend limited to a single connection, plus a
+// channel that releases requests blocked in the backend and one that reports their arrival
+func newSaturatedProxy(t *testing.T, cfg *Config) (*Proxy, *Backend, chan struct{}, chan struct{}) {
+	t.Helper()
+	release := make(chan struct{})
+	arrived := make(chan struct{}, 10)
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	pool.SetLogger(&captureLogger{})
+	backend.SetMaxConnections(1)
+	return NewProxy(pool, cfg), backend, release, arrived
+}
+
+// serveAsync runs a request through the proxy in the background and delivers the recorder when done
+func serveAsync(proxy *Proxy, path string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		done <- rr
+	}()
+	return done
+}
+
+func TestQueuedRequestProceedsWhenConnectionReleased(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.QueueTimeout = 5 * time.Second
+	proxy, backend, release, arrived := newSaturatedProxy(t, cfg)
+
+	first := serveAsync(proxy, "/first")
+	<-arrived // First request now holds the only connection slot
+	if !backend.IsSaturated() {
+		t.Fatalf("Expected backend to be saturated")
+	}
+
+	second := serveAsync(proxy, "/second")
+	select {
+	case <-arrived:
+		t.Fatalf("Expected second request to queue while the backend is saturated")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	release <- struct{}{} // Finish the first request, freeing its slot
+	if rr := <-first; rr.Code != http.StatusOK {
+		t.Errorf("Expected first request to succeed, got %d", rr.Code)
+	}
+	select {
+	case <-arrived:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected queued request to reach the backend after the slot was released")
+	}
+	release <- struct{}{}
+	if rr := <-second; rr.Code != http.StatusOK {
+		t.Errorf("Expected queued request to succeed, got %d", rr.Code)
+	}
+	if n := backend.activeConnections.Load(); n != 0 {
+		t.Errorf("Expected all connections released, got %d active", n)
+	}
+}
+
+func TestQueuedRequestTimesOut(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.QueueTimeout = 150 * time.Millisecond
+	proxy, _, release, arrived := newSaturatedProxy(t, cfg)
+	defer close(release)
+
+	first := serveAsync(proxy, "/first")
+	<-arrived
+
+	start := time.Now()
+	rr := <-serveAsync(proxy, "/second")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d after queue timeout, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After: 1, got %q", rr.Header().Get("Retry-After"))
+	}
+	if elapsed := time.Since(start); elapsed < cfg.QueueTimeout {
+		t.Errorf("Expected request to wait for the queue timeout, returned after %v", elapsed)
+	}
+
+	release <- struct{}{}
+	<-first
+}
+
+func TestQueueLengthIsBounded(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.QueueTimeout = 5 * time.Second
+	cfg.MaxQueueLength = 1
+	proxy, _, release, arrived := newSaturatedProxy(t, cfg)
+
+	first := serveAsync(proxy, "/first")
+	<-arrived
+	queued := serveAsync(proxy, "/queued")
+	waitFor(t, func() bool { return proxy.Pool().queued.Load() == 1 })
+
+	// The queue is full, so a third request is rejected without waiting
+	start := time.Now()
+	rr := <-serveAsync(proxy, "/overflow")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d for a full queue, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected Retry-After header on queue overflow")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected overflow to be rejected immediately, took %v", elapsed)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 2 {
+			release <- struct{}{}
+		}
+	}()
+	<-first
+	<-arrived
+	if rr := <-queued; rr.Code != http.StatusOK {
+		t.Errorf("Expected queued request to succeed, got %d", rr.Code)
+	}
+	wg.Wait()
+}
+
+// waitFor polls cond until it holds or a second passes
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMaxWaitForBackendWithAllBackendsDown(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	pool.SetLogger(&captureLogger{})
+	backend.SetAlive(false)
+	pool.SetMaxWaitForBackend(100 * time.Millisecond)
+	proxy := NewProxy(pool, DefaultConfig())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // Client is willing to wait much longer
+	defer cancel()
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Expected the request to give up after the max wait, took %v", elapsed)
+	}
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after the max wait, got %d", rr.Code)
+	}
+	if _, err := pool.AcquirePeer(ctx, 0); !errors.Is(err, ErrAllBackendsDown) {
+		t.Errorf("Expected ErrAllBackendsDown from AcquirePeer, got %v", err)
+	}
+}
+
+func TestWaitForPeerLeavesNoGoroutines(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	backend.SetAlive(false)
+
+	before := runtime.NumGoroutine()
+	for range 50 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		if peer, _ := pool.GetNextPeer(ctx); peer != nil {
+			t.Fatalf("Expected no peer while the backend is down")
+		}
+		cancel()
+	}
+	if after := runtime.NumGoroutine(); after > before+5 {
+		t.Errorf("Expected timed out waits to leave no goroutines behind, went from %d to %d", before, after)
+	}
+}
@@ -0,0 +1,33 @@
+package golb
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// LivezHandler reports that the load balancer process is up. It always returns 200.
+func LivezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// ReadyzHandler reports whether the load balancer can serve traffic, i.e. whether enough
+// backends are alive and it isn't shutting down (see ServerPool.Ready). It returns 200 when
+// ready and 503 otherwise.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request, pool *ServerPool, cfg *Config) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if pool.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("not ready: shutting down\n"))
+		return
+	}
+	if !pool.Ready(cfg) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		counts := pool.counts.Load()
+		_, _ = fmt.Fprintf(w, "not ready: %d/%d backends healthy\n", counts.alive, counts.total)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,187 @@
+package golb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestLivezHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	LivezHandler(rr, httptest.NewRequest("GET", "/livez", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	pool := NewServerPool(NewRoundRobinBalancer())
+	u1, _ := url.Parse("http://localhost:9091")
+	u2, _ := url.Parse("http://localhost:9092")
+	b1 := NewBackend(u1, nil, 1)
+	b2 := NewBackend(u2, nil, 1)
+	pool.AddBackend(b1)
+	pool.AddBackend(b2)
+
+	readyz := func() int {
+		rr := httptest.NewRecorder()
+		ReadyzHandler(rr, httptest.NewRequest("GET", "/readyz", nil), pool, DefaultConfig())
+		return rr.Code
+	}
+
+	// Backends start down until the first health check
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d before any backend is alive, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	pool.MarkBackendStatus(u1, true)
+	pool.MarkBackendStatus(u2, true)
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("Expected %d with alive backends, got %d", http.StatusOK, code)
+	}
+
+	pool.MarkBackendStatus(u1, false)
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("Expected %d with one backend still alive, got %d", http.StatusOK, code)
+	}
+
+	pool.MarkBackendStatus(u2, false)
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d once all backends are down, got %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+func TestServerPoolReadyMinHealthyBackends(t *testing.T) {
+	pool := NewServerPool(NewRoundRobinBalancer())
+	urls := make([]*url.URL, 4)
+	for i := range urls {
+		urls[i], _ = url.Parse(fmt.Sprintf("http://localhost:%d", 9091+i))
+		pool.AddBackend(NewBackend(urls[i], nil, 1))
+	}
+
+	cfg := DefaultConfig()
+	cfg.MinHealthyBackends = 3
+
+	readyz := func() int {
+		rr := httptest.NewRecorder()
+		ReadyzHandler(rr, httptest.NewRequest("GET", "/readyz", nil), pool, cfg)
+		return rr.Code
+	}
+
+	// Bring backends up one at a time: ready only once 3 of 4 are alive
+	for i, u := range urls {
+		pool.MarkBackendStatus(u, true)
+		wantReady := i+1 >= 3
+		if got := pool.Ready(cfg); got != wantReady {
+			t.Errorf("With %d/4 alive: expected Ready()=%v, got %v", i+1, wantReady, got)
+		}
+	}
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("Expected %d with 4/4 alive, got %d", http.StatusOK, code)
+	}
+
+	pool.MarkBackendStatus(urls[0], false)
+	if !pool.Ready(cfg) {
+		t.Errorf("Expected ready with 3/4 alive")
+	}
+
+	pool.MarkBackendStatus(urls[1], false)
+	if pool.Ready(cfg) {
+		t.Errorf("Expected not ready with 2/4 alive")
+	}
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d with 2/4 alive, got %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+func TestServerPoolReadyMinHealthyFraction(t *testing.T) {
+	pool := NewServerPool(NewRoundRobinBalancer())
+	urls := make([]*url.URL, 4)
+	for i := range urls {
+		urls[i], _ = url.Parse(fmt.Sprintf("http://localhost:%d", 9091+i))
+		pool.AddBackend(NewBackend(urls[i], nil, 1))
+		pool.MarkBackendStatus(urls[i], true)
+	}
+
+	cfg := DefaultConfig()
+	cfg.MinHealthyFraction = 0.75 // 3 of 4
+
+	if !pool.Ready(cfg) {
+		t.Errorf("Expected ready with 4/4 alive")
+	}
+	pool.MarkBackendStatus(urls[0], false)
+	if !pool.Ready(cfg) {
+		t.Errorf("Expected ready with 3/4 alive")
+	}
+	pool.MarkBackendStatus(urls[1], false)
+	if pool.Ready(cfg) {
+		t.Errorf("Expected not ready with 2/4 alive")
+	}
+}
+
+// Readiness is polled while backends are added at runtime (AllowEmptyStart); run with -race
+func TestServerPoolReadyWhileAddingBackends(t *testing.T) {
+	pool := NewServerPool(NewRoundRobinBalancer())
+	cfg := DefaultConfig()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 50 {
+			u, _ := url.Parse(fmt.Sprintf("http://localhost:%d", 9200+i))
+			b := NewBackend(u, nil, 1)
+			b.SetAlive(true)
+			pool.AddBackend(b)
+		}
+	}()
+	for {
+		pool.Ready(cfg)
+		ReadyzHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/readyz", nil), pool, cfg)
+		select {
+		case <-done:
+			if n := pool.AliveCount(); n != 50 {
+				t.Errorf("Expected 50 alive backends, got %d", n)
+			}
+			return
+		default:
+		}
+	}
+}
+
+func TestWaitUntilReadyDuringStartupGracePeriod(t *testing.T) {
+	warmAt := time.Now().Add(300 * time.Millisecond)
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if time.Now().Before(warmAt) {
+			w.WriteHeader(http.StatusServiceUnavailable) // Still warming up
+		}
+	}))
+	pool.SetLogger(&captureLogger{})
+	backend.SetAlive(false)
+	cfg := DefaultConfig()
+	cfg.StartupGracePeriod = 5 * time.Second
+	client := &http.Client{Timeout: time.Second}
+
+	start := time.Now()
+	if !pool.WaitUntilReady(context.Background(), client, cfg) {
+		t.Fatalf("Expected the pool to become ready within the grace period")
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Expected startup to wait for the backend and proceed once it was up, took %v", elapsed)
+	}
+
+	// A backend that never comes up only holds startup for the grace period
+	backend.SetAlive(false)
+	warmAt = time.Now().Add(time.Hour)
+	cfg.StartupGracePeriod = 200 * time.Millisecond
+	start = time.Now()
+	if pool.WaitUntilReady(context.Background(), client, cfg) {
+		t.Errorf("Expected the pool not to become ready")
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected startup to give up after the grace period, took %v", elapsed)
+	}
+}
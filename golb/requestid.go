@@ -0,0 +1,34 @@
+package golb
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// DefaultRequestIDHeader is the header carrying the request ID unless configured otherwise
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// newRequestID returns a random (version 4) UUID
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])  // Never fails, see crypto/rand.Read
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// ensureRequestID returns the request's ID from header, generating one and setting it on the
+// request (so it is forwarded to the backend) if the client didn't send one. An empty header
+// name disables request IDs and returns "".
+func ensureRequestID(r *http.Request, header string) string {
+	if header == "" {
+		return ""
+	}
+	id := r.Header.Get(header)
+	if id == "" {
+		id = newRequestID()
+		r.Header.Set(header, id)
+	}
+	return id
+}
@@ -0,0 +1,73 @@
+package golb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+var uuidV4Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+	var received string
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("X-Correlation-ID")
+		w.Header().Set("X-Correlation-ID", "backend-echo") // Must not be duplicated or override ours
+		_, _ = w.Write([]byte("ok"))
+	}))
+	capture := &captureLogger{}
+	pool.SetLogger(capture)
+	cfg := DefaultConfig()
+	cfg.RequestIDHeader = "X-Correlation-ID"
+	cfg.AccessLogEnabled = true
+	proxy := NewProxy(pool, cfg)
+
+	tests := []struct {
+		name     string
+		incoming string
+	}{
+		{"generated when absent", ""},
+		{"preserved when present", "client-id-42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set("X-Correlation-ID", tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, req)
+
+			echoed := rr.Header().Values("X-Correlation-ID")
+			if len(echoed) != 1 {
+				t.Fatalf("Expected one request ID in the response, got %q", echoed)
+			}
+			id := echoed[0]
+			if tt.incoming != "" && id != tt.incoming {
+				t.Errorf("Expected request ID %q to be preserved, got %q", tt.incoming, id)
+			}
+			if tt.incoming == "" && !uuidV4Pattern.MatchString(id) {
+				t.Errorf("Expected a generated UUIDv4, got %q", id)
+			}
+			if received != id {
+				t.Errorf("Expected backend to receive request ID %q, got %q", id, received)
+			}
+			if _, ok := capture.find("INFO Access", id); !ok {
+				t.Errorf("Expected access log line with request ID %q, got %v", id, capture.lines)
+			}
+		})
+	}
+}
+
+func TestNewRequestIDUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 1000 {
+		id := newRequestID()
+		if seen[id] {
+			t.Fatalf("Duplicate request ID %q", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,202 @@
+package golb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Retry policies, see Config.RetryPolicy
+const (
+	RetryPolicyNone             = "none"               // Never retry
+	RetryPolicyConnectOnly      = "connect-only"       // Retry connection failures only, never on a backend status
+	RetryPolicyConnectAndStatus = "connect-and-status" // Also retry Config.RetryOnStatuses
+)
+
+// retriesStatuses reports whether cfg's retry policy covers backend statuses; an unset
+// policy, as in a Config not loaded with LoadConfig, is the default connect-and-status
+func retriesStatuses(cfg *Config) bool {
+	return cfg.RetryPolicy == "" || cfg.RetryPolicy == RetryPolicyConnectAndStatus
+}
+
+// retryBudget throttles failover retries like gRPC's retry throttling: it holds up to
+// maxTokens tokens, starting full; every failed attempt costs one token and every successful
+// request earns ratio tokens back. Retries are only allowed while more than half the tokens
+// are left, so when failures are widespread retries stop instead of multiplying the load on
+// the backends still standing. A nil budget allows every retry.
+type retryBudget struct {
+	mu        sync.Mutex
+	tokens    float64
+	maxTokens float64
+	ratio     float64
+}
+
+// newRetryBudget returns the budget configured by cfg, or nil if it is disabled
+func newRetryBudget(cfg *Config) *retryBudget {
+	if cfg.MaxRetries <= 0 || cfg.RetryBudgetMaxTokens <= 0 {
+		return nil
+	}
+	maxTokens := float64(cfg.RetryBudgetMaxTokens)
+	return &retryBudget{tokens: maxTokens, maxTokens: maxTokens, ratio: cfg.RetryBudgetTokenRatio}
+}
+
+// onFailure spends a token for a failed attempt and reports whether a retry is still allowed
+func (b *retryBudget) onFailure() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = max(0, b.tokens-1)
+	return b.tokens > b.maxTokens/2
+}
+
+// onSuccess earns tokens back for a request a backend answered
+func (b *retryBudget) onSuccess() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.maxTokens, b.tokens+b.ratio)
+}
+
+// failover tracks the current attempt of a request that may be retried on another backend.
+// NewErrorHandler offers it the attempt's failure; if it takes it, the error response is
+// held back so the proxy can try the next backend. Responses with a status in statuses are
+// checked by the backend proxy's ModifyResponse with retryStatus, and dropped if retried.
+type failover struct {
+	method      string
+	connectOnly bool // Only connection failures are retried, see RetryPolicyConnectOnly
+	retriesLeft int
+	budget      *retryBudget
+	statuses    map[int]bool    // Backend statuses worth a retry, see Config.RetryOnStatuses
+	backoff     time.Duration   // Wait before the retry
+	deadline    time.Time       // The request's deadline, zero if none; no retry is made that would wait past it
+	acquire     func() *Backend // Reserves a backend not tried yet, nil if none is available
+	failed      bool            // The attempt failed in a way worth retrying, see offer and retryStatus
+	err         *ProxyError     // Failure held back for a retry, nil if none will be made
+	status      int             // Status of the response dropped for a retry on next, 0 if none
+	next        *Backend        // Backend reserved for the retry of a dropped response
+}
+
+// errRetryStatus is returned by the backend proxy's ModifyResponse for a response dropped
+// for a retry; NewErrorHandler leaves it to Proxy.forward
+var errRetryStatus = errors.New("response dropped for a retry on another backend")
+
+type (
+	failoverKey   struct{}
+	triedPeersKey struct{}
+)
+
+// withFailover lets the error handler hand failures of the request of ctx to f
+func withFailover(ctx context.Context, f *failover) context.Context {
+	return context.WithValue(ctx, failoverKey{}, f)
+}
+
+func failoverFromContext(ctx context.Context) *failover {
+	f, _ := ctx.Value(failoverKey{}).(*failover)
+	return f
+}
+
+// offer reports whether the failed attempt will be retried, holding proxyErr back if so.
+// Only failures to reach the backend are retried, not timeouts or clients going away, and
+// for non-idempotent methods only if the connection was never made, as the backend may
+// otherwise have acted on the request. With connectOnly, failures other than the connection
+// being refused or reset (such as a malformed response) aren't retried either.
+func (f *failover) offer(err error, proxyErr ProxyError) bool {
+	if proxyErr.Category != ErrorCategoryUpstream || (!isIdempotent(f.method) && !isDialError(err)) {
+		return false
+	}
+	if f.connectOnly && !isDialError(err) && !errors.Is(err, syscall.ECONNRESET) {
+		return false
+	}
+	f.failed = true
+	if !f.budget.onFailure() || f.retriesLeft <= 0 || !f.inTime() {
+		return false
+	}
+	f.err = &proxyErr
+	return true
+}
+
+// retryStatus reports whether resp is dropped for a retry because of its status, reserving
+// the backend for it. Only idempotent requests are retried, as the backend did receive the
+// request; if no other backend is available the response goes to the client after all.
+func (f *failover) retryStatus(resp *http.Response) bool {
+	if !f.statuses[resp.StatusCode] || !isIdempotent(f.method) {
+		return false
+	}
+	f.failed = true
+	if !f.budget.onFailure() || f.retriesLeft <= 0 || !f.inTime() {
+		return false
+	}
+	next := f.acquire()
+	if next == nil {
+		return false
+	}
+	f.status, f.next = resp.StatusCode, next
+	return true
+}
+
+// inTime reports whether the retry can wait out its backoff before the request's deadline
+func (f *failover) inTime() bool {
+	return f.deadline.IsZero() || time.Until(f.deadline) > f.backoff
+}
+
+// retryBackoff returns the wait before retry number n (from 0): base doubled n times
+func retryBackoff(base time.Duration, n int) time.Duration {
+	for ; n > 0 && base > 0 && base < time.Hour; n-- {
+		base *= 2
+	}
+	return base
+}
+
+// isIdempotent reports whether repeating a request with method has no further effect
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isDialError reports whether err happened while connecting, before any of the request was sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// withTriedPeers excludes the backends that already failed a request from selection
+func withTriedPeers(ctx context.Context, tried []*Backend) context.Context {
+	return context.WithValue(ctx, triedPeersKey{}, tried)
+}
+
+func triedPeersFromContext(ctx context.Context) []*Backend {
+	tried, _ := ctx.Value(triedPeersKey{}).([]*Backend)
+	return tried
+}
+
+// replayableBody reads r's body so every attempt can send it again; nil means there is none.
+// If the body is larger than limit (or can't be read), ok is false and r.Body is restored to
+// stream the whole body once, so the request can't be retried.
+func replayableBody(r *http.Request, limit int64) (body []byte, ok bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil || int64(len(body)) > limit {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false
+	}
+	_ = r.Body.Close()
+	return body, true
+}
@@ -0,0 +1,258 @@
+package golb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// deadBackendURL returns the URL of a server that is no longer listening
+func deadBackendURL(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+// newRetryProxy returns a round-robin proxy over backends, all marked alive
+func newRetryProxy(t *testing.T, cfg *Config, backends ...string) *Proxy {
+	t.Helper()
+	pool, err := BuildServerPool(cfg, "round-robin", backends, nil, NewTransport(cfg))
+	if err != nil {
+		t.Fatalf("BuildServerPool failed: %v", err)
+	}
+	markAllAlive(pool)
+	return NewProxy(pool, cfg)
+}
+
+// attempts returns the number of attempts made on the pool's backends
+func attempts(pool *ServerPool) int64 {
+	var n int64
+	for _, b := range pool.backends {
+		n += b.Counters().Requests
+	}
+	return n
+}
+
+func TestFailoverRetry(t *testing.T) {
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer echo.Close()
+	cfg := DefaultConfig()
+	cfg.MaxRetries = 1
+	proxy := newRetryProxy(t, cfg, deadBackendURL(t), echo.URL)
+
+	for i := range 4 {
+		markAllAlive(proxy.Pool())
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+		if rr.Code != http.StatusOK || rr.Body.String() != "payload" {
+			t.Fatalf("Request %d: expected the body echoed by the live backend, got %d %q", i, rr.Code, rr.Body.String())
+		}
+	}
+	if got := attempts(proxy.Pool()); got <= 4 || got > 8 {
+		t.Errorf("Expected requests to the dead backend to be retried once, got %d attempts for 4 requests", got)
+	}
+
+	// Without retries the failure reaches the client
+	cfg = DefaultConfig()
+	proxy = newRetryProxy(t, cfg, deadBackendURL(t), echo.URL)
+	var failed int
+	for range 2 {
+		markAllAlive(proxy.Pool())
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Code == http.StatusBadGateway {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("Expected one of two requests to fail without retries, got %d", failed)
+	}
+}
+
+func TestFailoverRetryBodyTooLarge(t *testing.T) {
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer echo.Close()
+	cfg := DefaultConfig()
+	cfg.MaxRetries = 1
+	cfg.RetryMaxBodySize = 4
+	proxy := newRetryProxy(t, cfg, echo.URL, deadBackendURL(t))
+
+	// The body still streams to the first backend in full
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+	if rr.Code != http.StatusOK || rr.Body.String() != "payload" {
+		t.Fatalf("Expected the whole body to be proxied, got %d %q", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected a body over the limit not to be retried, got %d", rr.Code)
+	}
+}
+
+func TestRetryBudgetThrottlesRetries(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxRetries = 1
+	cfg.RetryBudgetMaxTokens = 10
+	cfg.RetryBudgetTokenRatio = 0.1
+	proxy := newRetryProxy(t, cfg, deadBackendURL(t), deadBackendURL(t))
+
+	// Every attempt fails and costs a token; retries stop once half the budget is spent:
+	// the first two requests are retried (10 -> 8 -> 6 tokens), later ones are not
+	for i := range 8 {
+		markAllAlive(proxy.Pool())
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Code != http.StatusBadGateway {
+			t.Fatalf("Request %d: expected %d, got %d", i, http.StatusBadGateway, rr.Code)
+		}
+	}
+	if got := attempts(proxy.Pool()); got != 8+2 {
+		t.Errorf("Expected only 2 retries once the budget ran low, got %d attempts for 8 requests", got)
+	}
+
+	// Successful requests earn the budget back
+	for range 100 {
+		proxy.retries.onSuccess()
+	}
+	markAllAlive(proxy.Pool())
+	before := attempts(proxy.Pool())
+	proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := attempts(proxy.Pool()) - before; got != 2 {
+		t.Errorf("Expected retries to resume after successes, got %d attempts", got)
+	}
+}
+
+// newStatusBackend returns the URL of a server answering with status and counting requests
+func newStatusBackend(t *testing.T, status int, hits *atomic.Int32) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+		_, _ = fmt.Fprintf(w, "status %d", status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestRetryOnStatus(t *testing.T) {
+	var unavailableHits, okHits atomic.Int32
+	cfg := DefaultConfig()
+	cfg.MaxRetries = 1
+	cfg.RetryOnStatuses = []int{502, 503, 504}
+	cfg.RetryBackoff = 50 * time.Millisecond
+	proxy := newRetryProxy(t, cfg, newStatusBackend(t, http.StatusServiceUnavailable, &unavailableHits), newStatusBackend(t, http.StatusOK, &okHits))
+
+	// Round robin starts with the backend answering 503
+	begin := time.Now()
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	elapsed := time.Since(begin)
+	if rr.Code != http.StatusOK || rr.Body.String() != "status 200" {
+		t.Fatalf("Expected the retry to succeed, got %d %q", rr.Code, rr.Body.String())
+	}
+	if unavailableHits.Load() != 1 || okHits.Load() != 1 {
+		t.Errorf("Expected one attempt on each backend, got %d and %d", unavailableHits.Load(), okHits.Load())
+	}
+	if elapsed < cfg.RetryBackoff {
+		t.Errorf("Expected the retry to wait %v, took %v", cfg.RetryBackoff, elapsed)
+	}
+	if !proxy.Pool().backends[0].IsAlive() {
+		t.Error("Expected a retried status not to mark the backend down")
+	}
+
+	// Non-idempotent requests were received by the backend, so they are not retried
+	markAllAlive(proxy.Pool())
+	rr = httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader("payload")))
+	if rr.Code != http.StatusServiceUnavailable || unavailableHits.Load() != 2 || okHits.Load() != 1 {
+		t.Errorf("Expected the POST to get the 503 without a retry, got %d", rr.Code)
+	}
+
+	// A retry that would wait past the request's deadline isn't made
+	proxy = newRetryProxy(t, cfg, newStatusBackend(t, http.StatusServiceUnavailable, &unavailableHits), newStatusBackend(t, http.StatusOK, &okHits))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	rr = httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if rr.Code != http.StatusServiceUnavailable || rr.Body.String() != "status 503" {
+		t.Errorf("Expected the backend's 503 with no time left to retry, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRetryOnStatusNotListed(t *testing.T) {
+	var errorHits, okHits atomic.Int32
+	cfg := DefaultConfig()
+	cfg.MaxRetries = 1
+	cfg.RetryOnStatuses = []int{503}
+	proxy := newRetryProxy(t, cfg, newStatusBackend(t, http.StatusInternalServerError, &errorHits), newStatusBackend(t, http.StatusOK, &okHits))
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusInternalServerError || rr.Body.String() != "status 500" {
+		t.Errorf("Expected the backend's 500 to be passed through, got %d %q", rr.Code, rr.Body.String())
+	}
+	if errorHits.Load() != 1 || okHits.Load() != 0 {
+		t.Errorf("Expected no retry for a status that isn't listed, got %d and %d attempts", errorHits.Load(), okHits.Load())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for n, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		if got := retryBackoff(100*time.Millisecond, n); got != want {
+			t.Errorf("retryBackoff(100ms, %d) = %v, want %v", n, got, want)
+		}
+	}
+	if got := retryBackoff(0, 3); got != 0 {
+		t.Errorf("Expected no backoff without a base, got %v", got)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		policy                  string
+		wantConnect, wantStatus int // Responses when the first backend refuses the connection or answers 503
+	}{
+		{RetryPolicyNone, http.StatusBadGateway, http.StatusServiceUnavailable},
+		{RetryPolicyConnectOnly, http.StatusOK, http.StatusServiceUnavailable},
+		{RetryPolicyConnectAndStatus, http.StatusOK, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			var unavailableHits, okHits atomic.Int32
+			cfg := DefaultConfig()
+			cfg.MaxRetries = 1
+			cfg.RetryOnStatuses = []int{503}
+			cfg.RetryPolicy = tt.policy
+
+			// Round robin starts with the failing backend
+			proxy := newRetryProxy(t, cfg, deadBackendURL(t), newStatusBackend(t, http.StatusOK, &okHits))
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+			if rr.Code != tt.wantConnect {
+				t.Errorf("Expected %d after a connection failure, got %d", tt.wantConnect, rr.Code)
+			}
+
+			proxy = newRetryProxy(t, cfg, newStatusBackend(t, http.StatusServiceUnavailable, &unavailableHits), newStatusBackend(t, http.StatusOK, &okHits))
+			rr = httptest.NewRecorder()
+			proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Expected %d after a 503, got %d", tt.wantStatus, rr.Code)
+			}
+			if unavailableHits.Load() != 1 {
+				t.Errorf("Expected a single attempt on the backend answering 503, got %d", unavailableHits.Load())
+			}
+		})
+	}
+}
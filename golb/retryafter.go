@@ -0,0 +1,78 @@
+package golb
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBackendRetryAfter caps how long a backend's Retry-After can keep it out of rotation
+const maxBackendRetryAfter = 5 * time.Minute
+
+// IsBackingOff reports whether the backend asked, via 503 and Retry-After, not to receive requests yet
+func (b *Backend) IsBackingOff() bool {
+	return time.Now().UnixNano() < b.backoffUntil.Load()
+}
+
+// BackoffUntil returns when the backend's requested back-off ends, or the zero time if none is active
+func (b *Backend) BackoffUntil() time.Time {
+	if !b.IsBackingOff() {
+		return time.Time{}
+	}
+	return time.Unix(0, b.backoffUntil.Load())
+}
+
+// backOff keeps the backend out of selection until the given time, extending but never
+// shortening a back-off already in progress. It returns false if nothing changed.
+func (b *Backend) backOff(until time.Time) bool {
+	for {
+		current := b.backoffUntil.Load()
+		if until.UnixNano() <= current {
+			return false
+		}
+		if b.backoffUntil.CompareAndSwap(current, until.UnixNano()) {
+			return true
+		}
+	}
+}
+
+// HonorRetryAfter applies a backend's 503 response with a Retry-After header when
+// cfg.HonorBackendRetryAfter is set: the backend is skipped by selection for the requested
+// time (at most maxBackendRetryAfter), independently of health checks and outlier detection.
+func (s *ServerPool) HonorRetryAfter(b *Backend, status int, header http.Header, cfg *Config) {
+	if !cfg.HonorBackendRetryAfter || status != http.StatusServiceUnavailable {
+		return
+	}
+	delay, ok := parseRetryAfter(header.Get("Retry-After"), time.Now())
+	if !ok || delay <= 0 {
+		return
+	}
+	delay = min(delay, maxBackendRetryAfter)
+	if !b.backOff(time.Now().Add(delay)) {
+		return
+	}
+	s.logger.Warn("Backend requested back-off", "backend", b.URL.String(), "retryAfter", delay)
+
+	time.AfterFunc(delay, func() {
+		if !b.IsBackingOff() { // Not extended in the meantime
+			s.logger.Info("Backend back-off ended", "backend", b.URL.String())
+			s.notifyBackendAvailable() // Wake requests waiting in GetNextPeer
+		}
+	})
+}
+
+// parseRetryAfter reads a Retry-After value, either delay seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, seconds >= 0
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now), true
+	}
+	return 0, false
+}
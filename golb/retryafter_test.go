@@ -0,0 +1,89 @@
+package golb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHonorBackendRetryAfter(t *testing.T) {
+	var overloadedHits atomic.Int64
+	pool, overloaded := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if overloadedHits.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("overloaded"))
+	}))
+	_, other := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("other"))
+	}))
+	pool.AddBackend(other)
+
+	cfg := DefaultConfig()
+	cfg.HonorBackendRetryAfter = true
+	proxy := NewProxy(pool, cfg)
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		return rr
+	}
+
+	// Round robin starts with the overloaded backend, which asks for a 1s pause
+	if rr := serve(); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected the backend's 503 to be passed through, got %d", rr.Code)
+	}
+	if !overloaded.IsBackingOff() {
+		t.Fatalf("Expected the backend to back off after 503 + Retry-After")
+	}
+	for range 5 {
+		if rr := serve(); rr.Body.String() != "other" {
+			t.Fatalf("Expected requests to skip the backing-off backend, got %q", rr.Body.String())
+		}
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	seen := map[string]bool{}
+	for range 4 {
+		seen[serve().Body.String()] = true
+	}
+	if !seen["overloaded"] || overloaded.IsBackingOff() {
+		t.Errorf("Expected the backend to be reinstated after Retry-After, got %v", seen)
+	}
+}
+
+func TestRetryAfterIgnoredByDefault(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	rr := httptest.NewRecorder()
+	NewProxy(pool, DefaultConfig()).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if backend.IsBackingOff() {
+		t.Errorf("Expected Retry-After to be ignored unless HonorBackendRetryAfter is set")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"30", 30 * time.Second, true},
+		{"Wed, 01 May 2024 12:02:00 GMT", 2 * time.Minute, true},
+		{"", 0, false},
+		{"soon", 0, false},
+		{"-5", -5 * time.Second, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package golb
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// PathRewriteConfig replaces matches of Pattern in the request path with Replacement,
+// which may refer to capture groups as in regexp.Regexp.ReplaceAllString (e.g. "/v2/$1")
+type PathRewriteConfig struct {
+	Pattern     string `yaml:"pattern" json:"pattern" toml:"pattern"`
+	Replacement string `yaml:"replacement" json:"replacement" toml:"replacement"`
+}
+
+// pathRewrite is the compiled path rewriting of a route: the prefix is stripped first,
+// then the regex replacement is applied
+type pathRewrite struct {
+	stripPrefix string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// newPathRewrite compiles the rewriting configured for a route, or returns nil if it has none
+func newPathRewrite(rc RouteConfig) (*pathRewrite, error) {
+	if rc.StripPrefix == "" && rc.PathRewrite == nil {
+		return nil, nil
+	}
+	rw := &pathRewrite{stripPrefix: strings.TrimSuffix(rc.StripPrefix, "/")}
+	if rc.PathRewrite != nil {
+		re, err := regexp.Compile(rc.PathRewrite.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		rw.pattern, rw.replacement = re, rc.PathRewrite.Replacement
+	}
+	return rw, nil
+}
+
+// apply rewrites the path of req in place. The query string is left untouched, and an
+// encoded path (e.g. %2F) keeps its encoding when only a prefix is stripped.
+func (rw *pathRewrite) apply(req *http.Request) {
+	path, rawPath := req.URL.Path, req.URL.RawPath
+	if rw.stripPrefix != "" && pathHasPrefix(path, rw.stripPrefix) {
+		path = path[len(rw.stripPrefix):]
+		rawPath = strings.TrimPrefix(rawPath, rw.stripPrefix)
+	}
+	if rw.pattern != nil {
+		path = rw.pattern.ReplaceAllString(path, rw.replacement)
+		rawPath = "" // Re-derived from Path when the request is sent
+	}
+	req.URL.Path, req.URL.RawPath = ensureLeadingSlash(path), ""
+	if rawPath != "" {
+		req.URL.RawPath = ensureLeadingSlash(rawPath) // Ignored by net/url if it no longer matches Path
+	}
+}
+
+// ensureLeadingSlash makes path absolute, turning "" into "/"
+func ensureLeadingSlash(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
+
+type pathRewriteKey struct{}
+
+// withPathRewrite records the rewriting for the backend proxy's Director
+func withPathRewrite(ctx context.Context, rw *pathRewrite) context.Context {
+	return context.WithValue(ctx, pathRewriteKey{}, rw)
+}
+
+// rewritePath applies the rewriting recorded in the context of req, if any
+func rewritePath(req *http.Request) {
+	if rw, ok := req.Context().Value(pathRewriteKey{}).(*pathRewrite); ok {
+		rw.apply(req)
+	}
+}
@@ -0,0 +1,331 @@
+package golb
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RouteConfig sends matching requests to their own backend pool (file only). A route
+// matches when every condition it sets matches: Host (exact, or "*.example.com" for any
+// subdomain), PathRegex, PathPrefix and Methods. Methods alone splits traffic by method,
+// e.g. GET and HEAD to read replicas while writes fall through to the default pool.
+type RouteConfig struct {
+	Host                   string   `yaml:"host,omitempty" json:"host,omitempty" toml:"host,omitempty"`
+	PathRegex              string   `yaml:"pathRegex,omitempty" json:"pathRegex,omitempty" toml:"pathRegex,omitempty"` // Unanchored unless the pattern says otherwise
+	PathPrefix             string   `yaml:"pathPrefix,omitempty" json:"pathPrefix,omitempty" toml:"pathPrefix,omitempty"`
+	Methods                []string `yaml:"methods,omitempty" json:"methods,omitempty" toml:"methods,omitempty"` // Empty matches any method
+	Backends               []string `yaml:"backends" json:"backends" toml:"backends"`
+	BackendWeights         []int    `yaml:"backendWeights,omitempty" json:"backendWeights,omitempty" toml:"backendWeights,omitempty"`                         // For WRR
+	LoadBalancingAlgorithm string   `yaml:"loadBalancingAlgorithm,omitempty" json:"loadBalancingAlgorithm,omitempty" toml:"loadBalancingAlgorithm,omitempty"` // Empty uses Config.LoadBalancingAlgorithm
+
+	// Path rewriting before forwarding: StripPrefix is removed first (e.g. /api/users -> /users), then PathRewrite applies
+	StripPrefix string             `yaml:"stripPrefix,omitempty" json:"stripPrefix,omitempty" toml:"stripPrefix,omitempty"`
+	PathRewrite *PathRewriteConfig `yaml:"pathRewrite,omitempty" json:"pathRewrite,omitempty" toml:"pathRewrite,omitempty"`
+
+	// Request headers forwarded to this route's backends; either list replaces both of Config's
+	ForwardHeaderAllowList []string `yaml:"forwardHeaderAllowList,omitempty" json:"forwardHeaderAllowList,omitempty" toml:"forwardHeaderAllowList,omitempty"`
+	ForwardHeaderDenyList  []string `yaml:"forwardHeaderDenyList,omitempty" json:"forwardHeaderDenyList,omitempty" toml:"forwardHeaderDenyList,omitempty"`
+}
+
+// Route is a configured route with the pool serving it
+type Route struct {
+	RouteConfig
+	Pool      *ServerPool
+	proxy     *Proxy
+	pathRegex *regexp.Regexp
+	rewrite   *pathRewrite // Nil if the path is forwarded as is
+}
+
+// Route kinds in order of precedence, by the most specific condition a route sets
+const (
+	routeExactHost = iota
+	routeWildcardHost
+	routeRegexPath
+	routePrefix
+)
+
+// kind returns the precedence class of the route
+func (route *Route) kind() int {
+	switch {
+	case route.Host != "" && !strings.HasPrefix(route.Host, "*."):
+		return routeExactHost
+	case route.Host != "":
+		return routeWildcardHost
+	case route.PathRegex != "":
+		return routeRegexPath
+	default:
+		return routePrefix
+	}
+}
+
+// String describes the route for logs and errors, e.g. "host=api.example.com prefix=/v1"
+func (route *Route) String() string {
+	return describeRoute(route.RouteConfig)
+}
+
+// Router dispatches requests to the first matching route, and everything else to a
+// fallback handler (usually the Proxy for the default pool). Precedence is exact host,
+// wildcard host, regex path, then path prefix; ties go to the longer prefix, then to
+// routes restricted by method, then to config order.
+type Router struct {
+	routes   []*Route // In precedence order
+	fallback http.Handler
+}
+
+// NewRouter builds a pool, with its own balancer, for each of cfg.Routes. Backends share
+// transport; a nil fallback answers unmatched requests with 404.
+func NewRouter(cfg *Config, transport http.RoundTripper, fallback http.Handler) (*Router, error) {
+	if fallback == nil {
+		fallback = http.NotFoundHandler()
+	}
+	rt := &Router{fallback: fallback}
+	for _, rc := range cfg.Routes {
+		algorithm := rc.LoadBalancingAlgorithm
+		if algorithm == "" {
+			algorithm = cfg.LoadBalancingAlgorithm
+		}
+		route := &Route{RouteConfig: rc}
+		route.Host = strings.ToLower(rc.Host)
+		route.Methods = make([]string, len(rc.Methods))
+		for i, method := range rc.Methods {
+			route.Methods[i] = strings.ToUpper(method)
+		}
+		if rc.PathRegex != "" {
+			re, err := regexp.Compile(rc.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: invalid path regex: %w", route, err)
+			}
+			route.pathRegex = re
+		}
+		rewrite, err := newPathRewrite(rc)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: invalid path rewrite: %w", route, err)
+		}
+		route.rewrite = rewrite
+		routeCfg := cfg
+		if len(rc.ForwardHeaderAllowList) > 0 || len(rc.ForwardHeaderDenyList) > 0 {
+			c := *cfg
+			c.ForwardHeaderAllowList, c.ForwardHeaderDenyList = rc.ForwardHeaderAllowList, rc.ForwardHeaderDenyList
+			routeCfg = &c
+		}
+		pool, err := BuildServerPool(routeCfg, algorithm, rc.Backends, rc.BackendWeights, transport)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route, err)
+		}
+		route.Pool, route.proxy = pool, NewProxy(pool, routeCfg)
+		rt.routes = append(rt.routes, route)
+	}
+	slices.SortStableFunc(rt.routes, func(a, b *Route) int {
+		return cmp.Or(
+			cmp.Compare(a.kind(), b.kind()),
+			cmp.Compare(len(b.Host), len(a.Host)), // *.api.example.com before *.example.com
+			cmp.Compare(len(b.PathPrefix), len(a.PathPrefix)),
+			cmp.Compare(min(len(b.Methods), 1), min(len(a.Methods), 1)), // GET /api before any method on /api
+		)
+	})
+	return rt, nil
+}
+
+// Routes returns the configured routes in precedence order
+func (rt *Router) Routes() []*Route {
+	return rt.routes
+}
+
+// Match returns the route for r, or nil if the fallback handles it
+func (rt *Router) Match(r *http.Request) *Route {
+	host := requestHost(r)
+	for _, route := range rt.routes {
+		if route.matches(host, r.Method, r.URL.Path) {
+			return route
+		}
+	}
+	return nil
+}
+
+// matches reports whether every condition of the route holds for host, method and path
+func (route *Route) matches(host, method, path string) bool {
+	if route.Host != "" && !hostMatches(host, route.Host) {
+		return false
+	}
+	if len(route.Methods) > 0 && !slices.Contains(route.Methods, method) {
+		return false
+	}
+	if route.pathRegex != nil && !route.pathRegex.MatchString(path) {
+		return false
+	}
+	return pathHasPrefix(path, route.PathPrefix)
+}
+
+// requestHost returns the lower-cased Host of r without its port
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// hostMatches matches host against an exact pattern or "*.example.com", which matches
+// any subdomain of example.com but not example.com itself
+func hostMatches(host, pattern string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
+// ServeHTTP proxies r to the pool of its route, rewriting the path if the route says so
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if route := rt.Match(r); route != nil {
+		if route.rewrite != nil {
+			r = r.WithContext(withPathRewrite(r.Context(), route.rewrite))
+		}
+		route.proxy.ServeHTTP(w, r)
+		return
+	}
+	rt.fallback.ServeHTTP(w, r)
+}
+
+// pathHasPrefix matches whole path segments: "/api" matches "/api" and "/api/users" but not "/apix"
+func pathHasPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// BuildServerPool creates a pool balancing over backends with the named algorithm. Each
+// backend is built by NewBackendFromURL, sharing transport. Weights apply only to weight-aware algorithms (weighted-round-robin and
+// least-response-time) and only if there is one per backend. Backends in cfg.LocalZone are
+// preferred, see SetLocalZone. Backends start down until the first health check.
+func BuildServerPool(cfg *Config, algorithm string, backends []string, weights []int, transport http.RoundTripper) (*ServerPool, error) {
+	lb, err := NewBalancer(algorithm, cfg)
+	if err != nil {
+		return nil, err
+	}
+	pool := NewServerPool(lb)
+	pool.SetMaxWaitForBackend(cfg.MaxWaitForBackend)
+	pool.SetLocalZone(cfg.LocalZone)
+	if transport := configuredManagementTransport(cfg); transport != nil {
+		// Health checks and info fetches must reach the backends the same way as requests
+		pool.SetManagementClient(&http.Client{Transport: transport})
+	}
+	weighted := algorithm == "weighted-round-robin" || algorithm == "least-response-time"
+	useWeights := weighted && len(weights) == len(backends)
+	if weighted && !useWeights && (len(weights) > 0 || algorithm == "weighted-round-robin") {
+		pool.Logger().Warn("Weights ignored due to count mismatch, using equal weights", "backends", len(backends), "weights", len(weights))
+	}
+
+	for i, backendAddr := range backends {
+		weight := 1 // Default weight if not specified or counts mismatch
+		if useWeights {
+			weight = weights[i]
+			if weight < 0 {
+				pool.Logger().Warn("Backend has negative weight, treating as 0 (backup)", "backend", backendAddr, "weight", weight)
+				weight = 0
+			}
+		}
+		backend, err := NewBackendFromURL(backendAddr, weight, transport, pool, cfg)
+		if err != nil {
+			pool.Logger().Warn("Failed to parse backend URL, skipping", "backend", backendAddr, "error", err)
+			continue
+		}
+		pool.AddBackend(backend)
+		pool.Logger().Info("Configured backend", "backend", backendAddr, "weight", weight, "algorithm", algorithm)
+	}
+	return pool, nil
+}
+
+// NewBackendFromURL parses rawURL and builds a backend for it whose reverse proxy (see
+// NewBackendProxy) sends requests through transport with the backend's Host header and
+// options, and reports failures to pool: the backend is marked down there and the client
+// gets an error response. The connection limits, request timeout and health check URL from
+// cfg are applied; the backend is not added to pool and starts down until a health check.
+// A path in rawURL is a base path that proxied requests and the health check and info paths
+// go under, e.g. http://host/base serves /users from /base/users (see Backend.ResolvePath).
+func NewBackendFromURL(rawURL string, weight int, transport http.RoundTripper, pool *ServerPool, cfg *Config) (*Backend, error) {
+	backendURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if backendURL.Scheme == "" || backendURL.Host == "" {
+		return nil, fmt.Errorf("backend URL %q needs a scheme and host", rawURL)
+	}
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	backend := NewBackend(backendURL, NewBackendProxy(backendURL, transport, pool, cfg), weight)
+	backend.SetMaxConnections(cfg.MaxConnectionsPerBackend)
+	if cfg.AdaptiveConcurrency {
+		backend.EnableAdaptiveConcurrency(cfg.AdaptiveConcurrencyInitialLimit, cfg.AdaptiveConcurrencyMaxLimit)
+	}
+	opts := cfg.BackendOptionsFor(rawURL)
+	backend.SetRequestTimeout(opts.RequestTimeout)
+	backend.SetHealthCheckURL(opts.HealthCheckURL)
+	backend.SetHealthCheckService(opts.HealthCheckService)
+	backend.SetTags(opts.Tags...)
+	return backend, nil
+}
+
+// describeRoute lists the conditions of a route, e.g. "host=api.example.com prefix=/v1"
+func describeRoute(rc RouteConfig) string {
+	var parts []string
+	if rc.Host != "" {
+		parts = append(parts, "host="+rc.Host)
+	}
+	if rc.PathRegex != "" {
+		parts = append(parts, "regex="+rc.PathRegex)
+	}
+	if rc.PathPrefix != "" {
+		parts = append(parts, "prefix="+rc.PathPrefix)
+	}
+	if len(rc.Methods) > 0 {
+		parts = append(parts, "methods="+strings.Join(rc.Methods, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// validateRoutes checks the routing rules in cfg
+func validateRoutes(cfg *Config) error {
+	for i, rc := range cfg.Routes {
+		if rc.Host == "" && rc.PathRegex == "" && rc.PathPrefix == "" && len(rc.Methods) == 0 {
+			return fmt.Errorf("configuration error: route %d needs a host, path regex, path prefix or methods", i)
+		}
+		name := describeRoute(rc)
+		if rc.PathPrefix != "" && !strings.HasPrefix(rc.PathPrefix, "/") {
+			return fmt.Errorf("configuration error: route %s: path prefix must start with /", name)
+		}
+		if strings.Contains(rc.Host, "*") && (!strings.HasPrefix(rc.Host, "*.") || strings.Count(rc.Host, "*") > 1) {
+			return fmt.Errorf("configuration error: route %s: wildcard hosts must look like *.example.com", name)
+		}
+		if rc.PathRegex != "" {
+			if _, err := regexp.Compile(rc.PathRegex); err != nil {
+				return fmt.Errorf("configuration error: route %s: invalid path regex: %w", name, err)
+			}
+		}
+		if rc.StripPrefix != "" && !strings.HasPrefix(rc.StripPrefix, "/") {
+			return fmt.Errorf("configuration error: route %s: strip prefix must start with /", name)
+		}
+		if rc.PathRewrite != nil {
+			if _, err := regexp.Compile(rc.PathRewrite.Pattern); err != nil {
+				return fmt.Errorf("configuration error: route %s: invalid path rewrite pattern: %w", name, err)
+			}
+		}
+		if len(rc.Backends) == 0 {
+			return fmt.Errorf("configuration error: route %s has no backends", name)
+		}
+		if err := validateBackendURLs(rc.Backends); err != nil {
+			return fmt.Errorf("configuration error: route %s: %w", name, err)
+		}
+		if rc.LoadBalancingAlgorithm != "" && !HasBalancer(rc.LoadBalancingAlgorithm) {
+			return fmt.Errorf("configuration error: route %s: unknown load balancing algorithm %q", name, rc.LoadBalancingAlgorithm)
+		}
+	}
+	return nil
+}
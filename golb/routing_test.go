@@ -0,0 +1,345 @@
+package golb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// newNamedBackends starts servers answering with their name and returns their URLs
+func newNamedBackends(t *testing.T, names ...string) []string {
+	t.Helper()
+	var urls []string
+	for _, name := range names {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, name)
+		}))
+		t.Cleanup(server.Close)
+		urls = append(urls, server.URL)
+	}
+	return urls
+}
+
+// markAllAlive stands in for the first health check
+func markAllAlive(pools ...*ServerPool) {
+	for _, pool := range pools {
+		for _, b := range pool.backends {
+			b.SetAlive(true)
+		}
+	}
+}
+
+func TestPerRouteLoadBalancingAlgorithm(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Routes = []RouteConfig{
+		{PathPrefix: "/api", Backends: newNamedBackends(t, "api-1", "api-2"), LoadBalancingAlgorithm: "least-connections"},
+		{PathPrefix: "/static", Backends: newNamedBackends(t, "static-1", "static-2")}, // Global round-robin
+	}
+	if err := validateRoutes(cfg); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	defaultPool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "default")
+	}))
+	router, err := NewRouter(cfg, nil, NewProxy(defaultPool, cfg))
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	for _, route := range router.Routes() {
+		markAllAlive(route.Pool)
+		route.Pool.backends[0].IncrementActiveConnections() // A long-running request on the first backend
+	}
+
+	serve := func(path string) string {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Body.String()
+	}
+
+	// Least connections keeps avoiding the busy backend; round robin still alternates
+	for range 4 {
+		if got := serve("/api/users"); got != "api-2" {
+			t.Fatalf("Expected least-connections to pick the idle api backend, got %q", got)
+		}
+	}
+	first, second := serve("/static/app.js"), serve("/static/app.css")
+	if first == second {
+		t.Errorf("Expected round-robin to alternate static backends, got %q twice", first)
+	}
+	if got := serve("/other"); got != "default" {
+		t.Errorf("Expected unmatched paths to use the default pool, got %q", got)
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Routes = []RouteConfig{
+		{PathPrefix: "/api", Backends: []string{"http://api:8080"}},
+		{PathPrefix: "/api/v2", Backends: []string{"http://api-v2:8080"}},
+	}
+	router, err := NewRouter(cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string // Matched prefix, "" for none
+	}{
+		{"/api", "/api"},
+		{"/api/users", "/api"},
+		{"/api/v2/users", "/api/v2"},
+		{"/apix", ""},
+		{"/", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if route := router.Match(httptest.NewRequest("GET", tt.path, nil)); route != nil {
+			got = route.PathPrefix
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestBalancerRegistry(t *testing.T) {
+	if _, err := NewBalancer("no-such-algorithm", DefaultConfig()); err == nil {
+		t.Errorf("Expected an error for an unknown algorithm")
+	}
+	RegisterBalancer("test-first", func(*Config) LoadBalancer { return &mockLoadBalancer{} })
+	lb, err := NewBalancer("test-first", DefaultConfig())
+	if err != nil {
+		t.Fatalf("Expected the registered algorithm, got %v", err)
+	}
+	if _, ok := lb.(*mockLoadBalancer); !ok {
+		t.Errorf("Expected the registered factory to be used, got %T", lb)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Routes = []RouteConfig{{PathPrefix: "/api", Backends: []string{"http://api:8080"}, LoadBalancingAlgorithm: "no-such-algorithm"}}
+	if err := validateRoutes(cfg); err == nil {
+		t.Errorf("Expected routes with unknown algorithms to be rejected")
+	}
+}
+
+func TestHostAndRegexRouting(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Routes = []RouteConfig{
+		{PathPrefix: "/", Backends: []string{"http://catch-all:8080"}},
+		{PathRegex: `^/users/[0-9]+/avatar$`, Backends: []string{"http://avatars:8080"}},
+		{Host: "*.example.com", Backends: []string{"http://wildcard:8080"}},
+		{Host: "API.example.com", Backends: []string{"http://api:8080"}},
+		{Host: "web.example.com", Backends: []string{"http://web:8080"}},
+	}
+	if err := validateRoutes(cfg); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	router, err := NewRouter(cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+
+	tests := []struct {
+		host, path string
+		want       string // Backend of the matched pool, "" for the fallback
+	}{
+		{"api.example.com", "/users/1/avatar", "http://api:8080"}, // Exact host beats everything
+		{"web.example.com:8443", "/", "http://web:8080"},
+		{"shop.example.com", "/users/1/avatar", "http://wildcard:8080"}, // Wildcard host beats regex
+		{"example.com", "/users/42/avatar", "http://avatars:8080"},      // Wildcard doesn't match the apex
+		{"example.com", "/users/42/avatar.png", "http://catch-all:8080"},
+		{"other.test", "/users/x/avatar", "http://catch-all:8080"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Host = tt.host
+		got := ""
+		if route := router.Match(req); route != nil {
+			got = route.Backends[0]
+		}
+		if got != tt.want {
+			t.Errorf("Match(%s%s) = %q, want %q", tt.host, tt.path, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []RouteConfig{
+		{Backends: []string{"http://a:8080"}},
+		{Host: "api.*.com", Backends: []string{"http://a:8080"}},
+		{PathRegex: "(", Backends: []string{"http://a:8080"}},
+	} {
+		cfg.Routes = []RouteConfig{invalid}
+		if err := validateRoutes(cfg); err == nil {
+			t.Errorf("Expected route %+v to be rejected", invalid)
+		}
+	}
+}
+
+func TestRoutePathRewriting(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, r.URL.RequestURI())
+	}))
+	t.Cleanup(backend.Close)
+
+	cfg := DefaultConfig()
+	cfg.Routes = []RouteConfig{
+		{PathPrefix: "/api", StripPrefix: "/api", Backends: []string{backend.URL}},
+		{PathPrefix: "/mounted", StripPrefix: "/mounted/", Backends: []string{backend.URL + "/base"}}, // Composes with the backend's own path
+		{PathPrefix: "/v1", PathRewrite: &PathRewriteConfig{Pattern: `^/v1/users/([0-9]+)$`, Replacement: "/v2/accounts/$1"}, Backends: []string{backend.URL}},
+		{PathPrefix: "/old", StripPrefix: "/old", PathRewrite: &PathRewriteConfig{Pattern: `\.php$`, Replacement: ""}, Backends: []string{backend.URL}},
+	}
+	if err := validateRoutes(cfg); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	router, err := NewRouter(cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	for _, route := range router.Routes() {
+		markAllAlive(route.Pool)
+	}
+
+	tests := []struct {
+		request string
+		want    string // Request URI received by the backend
+	}{
+		{"/api/users?page=2&sort=name", "/users?page=2&sort=name"},
+		{"/api", "/"},
+		{"/mounted/users/a%2Fb?x=1", "/base/users/a%2Fb?x=1"},
+		{"/v1/users/42?expand=true", "/v2/accounts/42?expand=true"},
+		{"/v1/other", "/v1/other"}, // Pattern doesn't match: path unchanged
+		{"/old/index.php?id=7", "/index?id=7"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", tt.request, nil))
+		if got := rr.Body.String(); got != tt.want {
+			t.Errorf("%s: backend received %q, want %q", tt.request, got, tt.want)
+		}
+	}
+
+	cfg.Routes = []RouteConfig{{PathPrefix: "/api", PathRewrite: &PathRewriteConfig{Pattern: "("}, Backends: []string{backend.URL}}}
+	if err := validateRoutes(cfg); err == nil {
+		t.Errorf("Expected an invalid rewrite pattern to be rejected")
+	}
+}
+
+func TestMethodRoutingReadWriteSplit(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Routes = []RouteConfig{
+		{Methods: []string{"get", "HEAD"}, Backends: newNamedBackends(t, "replica-1", "replica-2")},
+	}
+	if err := validateRoutes(cfg); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	primary, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "primary")
+	}))
+	router, err := NewRouter(cfg, nil, NewProxy(primary, cfg))
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	markAllAlive(router.Routes()[0].Pool)
+
+	serve := func(method string) string {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, "/orders", nil))
+		return rr.Body.String()
+	}
+	if got := serve("GET"); got != "replica-1" && got != "replica-2" {
+		t.Errorf("Expected a GET to hit the replica pool, got %q", got)
+	}
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		if got := serve(method); got != "primary" {
+			t.Errorf("Expected a %s to hit the primary pool, got %q", method, got)
+		}
+	}
+}
+
+func TestNewBackendFromURL(t *testing.T) {
+	for _, raw := range []string{"localhost:8080", "/relative", "http://[::1"} {
+		if _, err := NewBackendFromURL(raw, 1, nil, NewServerPool(NewRoundRobinBalancer()), nil); err == nil {
+			t.Errorf("Expected an error for backend URL %q", raw)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.MaxConnectionsPerBackend = 7
+	cfg.BackendOptions = map[string]BackendOptions{"http://app:8080/base": {Headers: map[string]string{"X-Backend-Token": "secret"}}}
+	pool := NewServerPool(NewRoundRobinBalancer())
+	pool.SetLogger(&captureLogger{})
+	backend, err := NewBackendFromURL("http://app:8080/base", 3, nil, pool, cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if backend.GetWeight() != 3 || backend.ConnectionLimit() != 7 || backend.IsAlive() {
+		t.Errorf("Expected weight 3, limit 7 and a down backend, got %d, %d, %v", backend.GetWeight(), backend.ConnectionLimit(), backend.IsAlive())
+	}
+
+	// Director: target URL joined with the backend's path, Host rewritten, options headers set
+	req := httptest.NewRequest("GET", "http://lb.example.com/users?id=1", nil)
+	backend.ReverseProxy.Director(req)
+	if req.URL.String() != "http://app:8080/base/users?id=1" || req.Host != "app:8080" {
+		t.Errorf("Unexpected directed request: %s (Host %s)", req.URL, req.Host)
+	}
+	if req.Header.Get("X-Backend-Token") != "secret" {
+		t.Errorf("Expected the per-backend header, got %v", req.Header)
+	}
+
+	// Error handler: an unreachable backend is marked down and the client gets a 502
+	pool.AddBackend(backend)
+	backend.SetAlive(true)
+	rr := httptest.NewRecorder()
+	backend.ReverseProxy.ErrorHandler(rr, httptest.NewRequest("GET", "/users", nil), errors.New("connection refused"))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 from the error handler, got %d", rr.Code)
+	}
+	if backend.IsAlive() || backend.Counters().ProxyErrors != 1 {
+		t.Errorf("Expected the backend marked down with the error counted, got alive=%v errors=%d", backend.IsAlive(), backend.Counters().ProxyErrors)
+	}
+}
+
+func TestBasePathBackend(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.RequestURI())
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := DefaultConfig()
+	pool := NewServerPool(NewRoundRobinBalancer())
+	pool.SetLogger(&captureLogger{})
+	backend, err := NewBackendFromURL(server.URL+"/base/", 1, http.DefaultTransport, pool, cfg) // Trailing slash on purpose
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pool.AddBackend(backend)
+
+	pool.PerformHealthCheckCycle(server.Client(), cfg)
+	if !backend.IsAlive() {
+		t.Fatalf("Expected the health check under the base path to succeed")
+	}
+	NewProxy(pool, cfg).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users?id=1", nil))
+	StatusHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/status", nil), pool, cfg)
+
+	want := []string{"/base/health", "/base/users?id=1", "/base/info"}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(paths, want) {
+		t.Errorf("Expected requests %v, got %v", want, paths)
+	}
+
+	for path, want := range map[string]string{"/health": "/base/health", "health": "/base/health", "/ready?full=1": "/base/ready?full=1"} {
+		if got := backend.ResolvePath(path); got != server.URL+want {
+			t.Errorf("Expected %q to resolve to %s, got %s", path, server.URL+want, got)
+		}
+	}
+}
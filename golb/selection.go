@@ -0,0 +1,64 @@
+package golb
+
+import "context"
+
+// ContextLoadBalancer is a LoadBalancer that can use request metadata when selecting, for
+// strategies such as consistent hashing or tag-based canaries. The pool calls
+// SelectBackendCtx with a context carrying the client IP (ClientIPFromContext), a hash key
+// (HashKeyFromContext) and matched tags (TagsFromContext) where known; strategies that
+// don't implement it get SelectBackend.
+type ContextLoadBalancer interface {
+	LoadBalancer
+	SelectBackendCtx(ctx context.Context, backends []*Backend) *Backend
+}
+
+// selectBackend picks from backends with lb, passing ctx if lb can use it, and records why
+// if ctx asks for it (see withSelectionDecision)
+func selectBackend(ctx context.Context, lb LoadBalancer, backends []*Backend) *Backend {
+	var selected *Backend
+	if clb, ok := lb.(ContextLoadBalancer); ok {
+		selected = clb.SelectBackendCtx(ctx, backends)
+	} else {
+		selected = lb.SelectBackend(backends)
+	}
+	explainSelection(ctx, lb, selected, backends)
+	return selected
+}
+
+type (
+	hashKeyKey struct{}
+	tagsKey    struct{}
+)
+
+// WithClientIP records the client IP for selection; see ClientIP
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client IP recorded by WithClientIP or ForwardedHeaders
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok
+}
+
+// WithHashKey records the key hashing strategies should map to a backend, e.g. a user ID
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyKey{}, key)
+}
+
+// HashKeyFromContext returns the key recorded by WithHashKey
+func HashKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(hashKeyKey{}).(string)
+	return key, ok
+}
+
+// WithTags records tags the request matched (e.g. "canary"), for tag-aware strategies
+func WithTags(ctx context.Context, tags ...string) context.Context {
+	return context.WithValue(ctx, tagsKey{}, tags)
+}
+
+// TagsFromContext returns the tags recorded by WithTags
+func TagsFromContext(ctx context.Context) []string {
+	tags, _ := ctx.Value(tagsKey{}).([]string)
+	return tags
+}
@@ -0,0 +1,77 @@
+package golb
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// keyHashBalancer maps the context's hash key to a backend, recording the client IPs it saw
+type keyHashBalancer struct {
+	mu        sync.Mutex
+	clientIPs []string
+}
+
+func (k *keyHashBalancer) SelectBackend(backends []*Backend) *Backend {
+	return NewRoundRobinBalancer().SelectBackend(backends)
+}
+
+func (k *keyHashBalancer) SelectBackendCtx(ctx context.Context, backends []*Backend) *Backend {
+	if ip, ok := ClientIPFromContext(ctx); ok {
+		k.mu.Lock()
+		k.clientIPs = append(k.clientIPs, ip)
+		k.mu.Unlock()
+	}
+	key, ok := HashKeyFromContext(ctx)
+	if !ok || len(backends) == 0 {
+		return k.SelectBackend(backends)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return backends[int(h.Sum32()%uint32(len(backends)))]
+}
+
+func (k *keyHashBalancer) UpdateResponseTime(*Backend, time.Duration) {}
+
+func TestContextLoadBalancerReadsHashKey(t *testing.T) {
+	lb := &keyHashBalancer{}
+	pool := newLargePool(t, lb, 10)
+
+	for _, key := range []string{"user-1", "user-2", "user-3"} {
+		ctx := WithHashKey(context.Background(), key)
+		first, _ := pool.GetNextPeer(ctx)
+		for range 5 {
+			if got, _ := pool.GetNextPeer(ctx); got != first {
+				t.Fatalf("Expected key %s to keep mapping to %s, got %s", key, first.URL, got.URL)
+			}
+		}
+		if got := pool.SelectBackendCtx(ctx); got != first {
+			t.Errorf("Expected SelectBackendCtx to pass the key too, got %s", got.URL)
+		}
+	}
+
+	if tags := TagsFromContext(WithTags(context.Background(), "canary", "eu")); len(tags) != 2 || tags[0] != "canary" {
+		t.Errorf("Expected tags to round-trip, got %v", tags)
+	}
+	if _, ok := HashKeyFromContext(context.Background()); ok {
+		t.Errorf("Expected no hash key in an empty context")
+	}
+}
+
+func TestProxyPassesClientIPToSelection(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	lb := &keyHashBalancer{}
+	pool.lb = lb
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "198.51.100.4:1234"
+	NewProxy(pool, DefaultConfig()).ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(lb.clientIPs) != 1 || lb.clientIPs[0] != "198.51.100.4" {
+		t.Errorf("Expected selection to see the client IP, got %v", lb.clientIPs)
+	}
+}
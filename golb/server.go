@@ -0,0 +1,55 @@
+package golb
+
+import (
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// NewHTTPServer returns the client-facing server for handler. HTTP/1.1 is always served;
+// HTTP/2 is negotiated over TLS when cfg.EnableHTTP2 is set, and accepted without TLS
+// (h2c, prior knowledge) when cfg.EnableH2C is set. The read, write and idle timeouts from
+// cfg protect against slow or stalled clients.
+func NewHTTPServer(cfg *Config, handler http.Handler) *http.Server {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(cfg.EnableHTTP2)
+	protocols.SetUnencryptedHTTP2(cfg.EnableH2C)
+	return &http.Server{
+		Addr:              cfg.ProxyPort,
+		Handler:           handler,
+		Protocols:         protocols,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// NewHTTP3Server returns an HTTP/3 (QUIC) server listening on the UDP port matching
+// cfg.ProxyPort, or nil when cfg.EnableHTTP3 is off. It needs the TLS certificate from
+// cfg (see ListenAndServeTLS) or a TLSConfig set by the caller.
+func NewHTTP3Server(cfg *Config, handler http.Handler) *http3.Server {
+	if !cfg.EnableHTTP3 {
+		return nil
+	}
+	return &http3.Server{
+		Addr:        cfg.ProxyPort,
+		Handler:     handler,
+		IdleTimeout: cfg.IdleTimeout,
+	}
+}
+
+// AdvertiseHTTP3 adds an Alt-Svc header to HTTP/1.1 and HTTP/2 responses so that clients
+// can switch to the HTTP/3 server h3. A nil h3 returns next unchanged.
+func AdvertiseHTTP3(h3 *http3.Server, next http.Handler) http.Handler {
+	if h3 == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			_ = h3.SetQUICHeaders(w.Header()) // Fails only before the QUIC listener is up
+		}
+		next.ServeHTTP(w, r)
+	})
+}
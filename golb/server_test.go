@@ -0,0 +1,204 @@
+package golb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// testCertificate is a self-signed certificate for 127.0.0.1, also written to PEM files
+type testCertificate struct {
+	cert     tls.Certificate
+	pool     *x509.CertPool
+	certFile string
+	keyFile  string
+}
+
+func newTestCertificate(t *testing.T) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "golb test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	dir := t.TempDir()
+	tc := &testCertificate{certFile: filepath.Join(dir, "cert.pem"), keyFile: filepath.Join(dir, "key.pem"), pool: x509.NewCertPool()}
+	if err := os.WriteFile(tc.certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(tc.keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	if tc.cert, err = tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatalf("Failed to load key pair: %v", err)
+	}
+	tc.pool.AppendCertsFromPEM(certPEM)
+	return tc
+}
+
+func TestHTTP2OverTLS(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "backend")
+	}))
+	tc := newTestCertificate(t)
+	cfg := DefaultConfig()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := NewHTTPServer(cfg, NewProxy(pool, cfg))
+	go func() { _ = server.ServeTLS(listener, tc.certFile, tc.keyFile) }()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: tc.pool},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2, got %s", resp.Proto)
+	}
+	if string(body) != "backend" {
+		t.Errorf("Expected backend response, got %q", body)
+	}
+}
+
+func TestHTTP3ThroughProxy(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "backend via "+r.Proto)
+	}))
+	tc := newTestCertificate(t)
+	cfg := DefaultConfig()
+	cfg.EnableHTTP3 = true
+	proxy := NewProxy(pool, cfg)
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP not available: %v", err)
+	}
+	defer udpConn.Close()
+	h3 := NewHTTP3Server(cfg, proxy)
+	h3.TLSConfig = &tls.Config{Certificates: []tls.Certificate{tc.cert}}
+	go func() { _ = h3.Serve(udpConn) }()
+	defer h3.Close()
+
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{RootCAs: tc.pool}}
+	defer transport.Close()
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	resp, err := client.Get("https://" + udpConn.LocalAddr().String() + "/")
+	if err != nil {
+		t.Fatalf("HTTP/3 request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.ProtoMajor != 3 {
+		t.Errorf("Expected HTTP/3, got %s", resp.Proto)
+	}
+	// The backend is reached over the ordinary HTTP/1.1 transport
+	if string(body) != "backend via HTTP/1.1" {
+		t.Errorf("Expected backend response, got %q", body)
+	}
+
+	// HTTP/1.1 and HTTP/2 responses advertise the QUIC endpoint
+	rr := httptest.NewRecorder()
+	AdvertiseHTTP3(h3, http.NotFoundHandler()).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	_, port, _ := net.SplitHostPort(udpConn.LocalAddr().String())
+	if altSvc := rr.Header().Get("Alt-Svc"); !strings.Contains(altSvc, `h3=":`+port+`"`) {
+		t.Errorf("Expected Alt-Svc to advertise h3 on port %s, got %q", port, altSvc)
+	}
+}
+
+func TestHTTP3DisabledByDefault(t *testing.T) {
+	if NewHTTP3Server(DefaultConfig(), http.NotFoundHandler()) != nil {
+		t.Errorf("Expected no HTTP/3 server unless enabled")
+	}
+	rr := httptest.NewRecorder()
+	AdvertiseHTTP3(nil, http.NotFoundHandler()).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Header().Get("Alt-Svc") != "" {
+		t.Errorf("Expected no Alt-Svc header without an HTTP/3 server")
+	}
+}
+
+func TestHTTPServerTimeouts(t *testing.T) {
+	cfg := DefaultConfig()
+	if cfg.ReadTimeout != 0 || cfg.WriteTimeout != 0 {
+		t.Errorf("Expected no default read or write timeout so streams and uploads aren't cut, got read %v, write %v",
+			cfg.ReadTimeout, cfg.WriteTimeout)
+	}
+	cfg.ReadTimeout = 30 * time.Second
+	cfg.ReadHeaderTimeout = 100 * time.Millisecond
+	cfg.WriteTimeout = 45 * time.Second
+	cfg.IdleTimeout = 90 * time.Second
+	server := NewHTTPServer(cfg, http.NotFoundHandler())
+	if server.ReadTimeout != cfg.ReadTimeout || server.ReadHeaderTimeout != cfg.ReadHeaderTimeout ||
+		server.WriteTimeout != cfg.WriteTimeout || server.IdleTimeout != cfg.IdleTimeout {
+		t.Fatalf("Expected configured timeouts, got read %v, header %v, write %v, idle %v",
+			server.ReadTimeout, server.ReadHeaderTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	// A slowloris client sends part of its headers and then stalls
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n")); err != nil {
+		t.Fatalf("Failed to write partial headers: %v", err)
+	}
+	start := time.Now()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = io.ReadAll(conn)
+	if elapsed := time.Since(start); err != nil || elapsed > time.Second {
+		t.Errorf("Expected the server to close the stalled connection after the header timeout, got %v after %v", err, elapsed)
+	}
+}
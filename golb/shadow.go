@@ -0,0 +1,132 @@
+package golb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// shadowTarget mirrors requests to a secondary backend, discarding its responses
+type shadowTarget struct {
+	url         *url.URL
+	client      *http.Client
+	maxBodySize int64
+	sampleRate  float64       // Fraction of requests mirrored
+	inFlight    chan struct{} // Slots for mirrored requests, nil for no limit
+	dropped     *atomic.Int64 // Requests not mirrored because every slot was taken
+	logger      Logger
+}
+
+// newShadowTarget returns nil when no shadow backend is configured or its URL is invalid.
+// Dropped mirrors are counted in pool, see ServerPool.ShadowDropped.
+func newShadowTarget(cfg *Config, pool *ServerPool) *shadowTarget {
+	logger := pool.Logger()
+	if cfg.ShadowBackend == "" {
+		return nil
+	}
+	u, err := url.Parse(cfg.ShadowBackend)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		logger.Warn("Invalid shadow backend URL, mirroring disabled", "shadowBackend", cfg.ShadowBackend, "error", err)
+		return nil
+	}
+	s := &shadowTarget{
+		url:         u,
+		client:      &http.Client{Transport: NewTransport(cfg), Timeout: cfg.ShadowTimeout},
+		maxBodySize: cfg.ShadowMaxBodySize,
+		sampleRate:  cfg.ShadowSampleRate,
+		dropped:     &pool.shadowDropped,
+		logger:      logger,
+	}
+	if cfg.ShadowMaxInFlight > 0 {
+		s.inFlight = make(chan struct{}, cfg.ShadowMaxInFlight)
+	}
+	return s
+}
+
+// mirror buffers the request body (restoring it for the primary) and replays a copy of r to
+// the shadow backend in the background. Only a random sampleRate fraction of requests is
+// mirrored, and none with bodies over maxBodySize. Once Config.ShadowMaxInFlight mirrored requests
+// are in flight, further ones are dropped and counted, so a slow shadow backend can't pile up
+// goroutines and buffered bodies. The shadow outcome never affects the client response or
+// backend health.
+func (s *shadowTarget) mirror(r *http.Request) {
+	if s.sampleRate < 1 && rand.Float64() >= s.sampleRate {
+		return
+	}
+	if s.inFlight != nil {
+		select {
+		case s.inFlight <- struct{}{}:
+		default:
+			s.dropped.Add(1)
+			s.logger.Debug("Shadow request dropped, too many in flight", "shadowBackend", s.url.String(), "path", r.URL.Path) // Can be noisy
+			return
+		}
+	}
+	mirrored := false
+	defer func() {
+		if !mirrored && s.inFlight != nil {
+			<-s.inFlight // Not sent after all
+		}
+	}()
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		if r.ContentLength > s.maxBodySize {
+			return
+		}
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, s.maxBodySize+1))
+		rest := r.Body
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), rest), rest} // Primary still gets the whole body
+		if err != nil || int64(len(body)) > s.maxBodySize {
+			return
+		}
+	}
+
+	target := *s.url
+	target.Path = singleJoiningSlash(s.url.Path, r.URL.Path)
+	target.RawQuery = r.URL.RawQuery
+	// Detached from the client request so the shadow isn't cancelled when the primary response completes
+	req, err := http.NewRequestWithContext(context.WithoutCancel(r.Context()), r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		s.logger.Debug("Failed to build shadow request", "error", err)
+		return
+	}
+	req.Header = r.Header.Clone()
+	req.Header.Set("X-Golb-Shadow", "true")
+
+	mirrored = true
+	go func() {
+		if s.inFlight != nil {
+			defer func() { <-s.inFlight }()
+		}
+		start := time.Now()
+		resp, err := s.client.Do(req)
+		if err != nil {
+			s.logger.Debug("Shadow request failed", "shadowBackend", s.url.String(), "path", r.URL.Path, "error", err)
+			return
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		s.logger.Debug("Shadow request completed", "shadowBackend", s.url.String(), "path", r.URL.Path, "status", resp.StatusCode, "duration", time.Since(start))
+	}()
+}
+
+// singleJoiningSlash joins two URL paths with exactly one slash, like httputil.NewSingleHostReverseProxy
+func singleJoiningSlash(a, b string) string {
+	aslash, bslash := len(a) > 0 && a[len(a)-1] == '/', len(b) > 0 && b[0] == '/'
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,211 @@
+package golb
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// shadowCopy is what the shadow backend saw of a mirrored request
+type shadowCopy struct {
+	method, path, query, body, marker string
+}
+
+func TestShadowBackendReceivesCopy(t *testing.T) {
+	var primaryBody string
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		primaryBody = string(body)
+		_, _ = io.WriteString(w, "primary")
+	}))
+	pool.SetLogger(&captureLogger{})
+
+	copies := make(chan shadowCopy, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		copies <- shadowCopy{r.Method, r.URL.Path, r.URL.RawQuery, string(body), r.Header.Get("X-Golb-Shadow")}
+		_, _ = io.WriteString(w, "shadow response must be discarded")
+	}))
+	defer shadow.Close()
+
+	cfg := DefaultConfig()
+	cfg.ShadowBackend = shadow.URL
+	rr := httptest.NewRecorder()
+	NewProxy(pool, cfg).ServeHTTP(rr, httptest.NewRequest("POST", "/orders?dry=1", strings.NewReader(`{"id": 7}`)))
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "primary" {
+		t.Errorf("Expected the primary response, got %d %q", rr.Code, rr.Body.String())
+	}
+	if primaryBody != `{"id": 7}` {
+		t.Errorf("Expected primary to receive the full body, got %q", primaryBody)
+	}
+
+	select {
+	case got := <-copies:
+		want := shadowCopy{"POST", "/orders", "dry=1", `{"id": 7}`, "true"}
+		if got != want {
+			t.Errorf("Shadow copy mismatch: got %+v, want %+v", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected shadow backend to receive a copy of the request")
+	}
+}
+
+func TestShadowErrorsDoNotAffectClient(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "primary")
+	}))
+	pool.SetLogger(&captureLogger{})
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	for _, shadowURL := range []string{failing.URL, unreachable.URL} {
+		cfg := DefaultConfig()
+		cfg.ShadowBackend = shadowURL
+		cfg.OutlierErrorRateThreshold = 0.1
+		cfg.OutlierMinRequests = 1
+		proxy := NewProxy(pool, cfg)
+
+		for i := 0; i < 3; i++ {
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+			if rr.Code != http.StatusOK || rr.Body.String() != "primary" {
+				t.Errorf("Expected shadow failures to be invisible to the client, got %d %q", rr.Code, rr.Body.String())
+			}
+		}
+	}
+	time.Sleep(50 * time.Millisecond) // Let shadow requests finish
+	if !backend.IsAvailable() {
+		t.Errorf("Expected shadow errors not to count against the primary backend")
+	}
+}
+
+func TestShadowSkipsLargeBodies(t *testing.T) {
+	var primaryBody string
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		primaryBody = string(body)
+	}))
+	shadowHit := make(chan struct{}, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shadowHit <- struct{}{}
+	}))
+	defer shadow.Close()
+
+	cfg := DefaultConfig()
+	cfg.ShadowBackend = shadow.URL
+	cfg.ShadowMaxBodySize = 8
+	large := strings.Repeat("x", 64)
+	req := httptest.NewRequest("POST", "/upload", io.NopCloser(strings.NewReader(large)))
+	req.ContentLength = -1 // Unknown length, so the size is only discovered while buffering
+	NewProxy(pool, cfg).ServeHTTP(httptest.NewRecorder(), req)
+
+	if primaryBody != large {
+		t.Errorf("Expected primary to receive the whole body, got %d bytes", len(primaryBody))
+	}
+	select {
+	case <-shadowHit:
+		t.Errorf("Expected oversized request not to be mirrored")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// countingTransport answers every request with an empty 200 and counts them
+type countingTransport struct {
+	requests atomic.Int64
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestShadowSampleRate(t *testing.T) {
+	const requests = 2000
+	for _, rate := range []float64{0, 0.25, 1} {
+		cfg := DefaultConfig()
+		cfg.ShadowBackend = "http://shadow.invalid"
+		cfg.ShadowSampleRate = rate
+		cfg.ShadowMaxInFlight = 0 // Only sampling drops requests here
+		shadow := newShadowTarget(cfg, NewServerPool(NewRoundRobinBalancer()))
+		transport := &countingTransport{}
+		shadow.client.Transport = transport
+
+		for range requests {
+			shadow.mirror(httptest.NewRequest("GET", "/", nil))
+		}
+		// Mirrored requests are sent in the background: wait for the count to settle
+		got := int64(-1)
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+			time.Sleep(20 * time.Millisecond)
+			n := transport.requests.Load()
+			if n == got {
+				break
+			}
+			got = n
+		}
+
+		want := rate * requests
+		if tolerance := 0.2 * want; math.Abs(float64(got)-want) > tolerance {
+			t.Errorf("Expected about %g of %d requests mirrored at rate %g, got %d", want, requests, rate, got)
+		}
+	}
+}
+
+// blockingTransport holds every request until release is closed
+type blockingTransport struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestShadowMaxInFlight(t *testing.T) {
+	const maxInFlight = 3
+	cfg := DefaultConfig()
+	cfg.ShadowBackend = "http://shadow.invalid"
+	cfg.ShadowMaxInFlight = maxInFlight
+	pool := NewServerPool(NewRoundRobinBalancer())
+	shadow := newShadowTarget(cfg, pool)
+	transport := &blockingTransport{started: make(chan struct{}, 10), release: make(chan struct{})}
+	shadow.client.Transport = transport
+
+	for range maxInFlight {
+		shadow.mirror(httptest.NewRequest("POST", "/", strings.NewReader("body")))
+	}
+	for range maxInFlight {
+		<-transport.started
+	}
+	for range 5 {
+		shadow.mirror(httptest.NewRequest("POST", "/", strings.NewReader("body")))
+	}
+	if got := pool.ShadowDropped(); got != 5 {
+		t.Errorf("Expected 5 mirrors dropped with %d in flight, got %d", maxInFlight, got)
+	}
+
+	// Slots free up once the shadow backend answers
+	close(transport.release)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(shadow.inFlight) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	shadow.mirror(httptest.NewRequest("GET", "/", nil))
+	<-transport.started
+	if got := pool.ShadowDropped(); got != 5 {
+		t.Errorf("Expected a mirror to be sent after the backlog drained, %d dropped", got)
+	}
+}
@@ -0,0 +1,26 @@
+package golb
+
+import (
+	"context"
+	"time"
+)
+
+// Drain shuts down in two phases. First pool is marked draining, so /readyz fails and
+// upstream load balancers stop routing new traffic here, while requests keep being served
+// for delay (cfg.PreShutdownDelay). Then shutdown is called, typically http.Server.Shutdown,
+// to stop accepting connections and wait for in-flight requests. If ctx ends during the
+// delay, shutdown is called right away.
+func Drain(ctx context.Context, pool *ServerPool, delay time.Duration, shutdown func(context.Context) error) error {
+	pool.StartDraining()
+	if delay > 0 {
+		pool.Logger().Info("Reporting not ready before draining", "delay", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	pool.Logger().Info("Draining in-flight requests")
+	return shutdown(ctx)
+}
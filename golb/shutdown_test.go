@@ -0,0 +1,80 @@
+package golb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainReportsNotReadyBeforeShutdown(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	pool.SetLogger(&captureLogger{})
+	cfg := DefaultConfig()
+
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ReadyzHandler(w, r, pool, cfg)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	get := func(path string) (int, error) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			return 0, err
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	if code, _ := get("/readyz"); code != http.StatusOK {
+		t.Fatalf("Expected ready before shutdown, got %d", code)
+	}
+
+	// A request in flight when the signal arrives
+	slowDone := make(chan int, 1)
+	go func() {
+		code, err := get("/slow")
+		if err != nil {
+			t.Errorf("In-flight request failed during shutdown: %v", err)
+		}
+		slowDone <- code
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	const delay = 300 * time.Millisecond
+	drained := make(chan error, 1)
+	started := time.Now()
+	go func() {
+		drained <- Drain(context.Background(), pool, delay, server.Config.Shutdown)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Pre-shutdown window: not ready, but still serving new requests
+	if code, err := get("/readyz"); err != nil || code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return %d while draining, got %d (%v)", http.StatusServiceUnavailable, code, err)
+	}
+	if code, err := get("/"); err != nil || code != http.StatusOK {
+		t.Errorf("Expected new requests to be served during the pre-shutdown delay, got %d (%v)", code, err)
+	}
+
+	close(release)
+	if code := <-slowDone; code != http.StatusOK {
+		t.Errorf("Expected the in-flight request to complete, got %d", code)
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < delay {
+		t.Errorf("Expected shutdown to wait out the pre-shutdown delay, took %v", elapsed)
+	}
+	if _, err := get("/"); err == nil {
+		t.Errorf("Expected the server to stop accepting requests after draining")
+	}
+}
@@ -4,114 +4,293 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
-	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // BackendStatus holds information for the /status endpoint response for one backend
 type BackendStatus struct {
-	URL               string      `json:"url"`
-	Alive             bool        `json:"alive"`
-	Weight            int         `json:"weight,omitempty"` // Include weight if configured
-	ActiveConnections int64       `json:"activeConnections,omitempty"`
-	EWMANanoSec       int64       `json:"ewmaNanoSec,omitempty"`
-	Info              interface{} `json:"info,omitempty"` // Use interface{} for arbitrary JSON
-	InfoError         string      `json:"infoError,omitempty"`
+	Index             int             `json:"index"` // Position in the pool, i.e. config order
+	URL               string          `json:"url"`
+	Alive             bool            `json:"alive"`
+	Weight            int             `json:"weight,omitempty"` // Include weight if configured
+	ActiveConnections int64           `json:"activeConnections,omitempty"`
+	ConnectionLimit   int64           `json:"connectionLimit,omitempty"` // Static or adaptive limit in effect, 0 if unlimited
+	Capacity          int             `json:"capacity"`                  // Share of traffic the backend can take now, 0 to 100
+	EWMANanoSec       int64           `json:"ewmaNanoSec,omitempty"`
+	LatencyP50NanoSec int64           `json:"latencyP50NanoSec,omitempty"` // Percentiles of proxied request latency
+	LatencyP90NanoSec int64           `json:"latencyP90NanoSec,omitempty"`
+	LatencyP99NanoSec int64           `json:"latencyP99NanoSec,omitempty"`
+	Ejected           bool            `json:"ejected,omitempty"` // Temporarily removed by outlier detection
+	EjectedUntil      *time.Time      `json:"ejectedUntil,omitempty"`
+	BackoffUntil      *time.Time      `json:"backoffUntil,omitempty"` // Backend asked for a pause via Retry-After
+	Tags              []string        `json:"tags,omitempty"`
+	Cutover           *CutoverStatus  `json:"cutover,omitempty"` // Progress of the latest cutover involving this backend
+	Counters          BackendCounters `json:"counters"`
+	Info              interface{}     `json:"info,omitempty"`      // Use interface{} for arbitrary JSON
+	InfoRaw           string          `json:"infoRaw,omitempty"`   // Info body that isn't JSON, e.g. plain text
+	InfoError         string          `json:"infoError,omitempty"` // The info request failed or returned a non-200 status
 }
 
-// StatusHandler provides the status of all configured backends
+// PoolCapacityHeader carries the pool's total capacity (see ServerPool.Capacity) on JSON
+// /status responses
+const PoolCapacityHeader = "X-GoLB-Pool-Capacity"
+
+// maxInfoBodySize caps the info body read from each backend
+const maxInfoBodySize = 1 << 20
+
+// statusGracePeriod is how long past the per-fetch timeout StatusHandler waits for info
+// fetches before responding without them
+const statusGracePeriod = 500 * time.Millisecond
+
+// StatusHandler provides the status of all configured backends. Info endpoints are fetched
+// concurrently with the pool's ManagementClient, each bounded by cfg.BackendRequestTimeout
+// and the client's request; the handler itself answers within that timeout plus
+// statusGracePeriod, flagging backends whose info could not be fetched in time. A zero
+// timeout waits for every fetch, bounded only by the client's request.
 func StatusHandler(w http.ResponseWriter, r *http.Request, pool *ServerPool, cfg *Config) {
-	statuses := make([]BackendStatus, 0, len(pool.backends))
-	client := &http.Client{
-		Timeout: cfg.BackendRequestTimeout, // Use configured timeout
+	client := pool.ManagementClient()
+	ctx, cancel := r.Context(), context.CancelFunc(func() {})
+	if cfg.BackendRequestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cfg.BackendRequestTimeout+statusGracePeriod)
 	}
+	defer cancel()
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex // Protects the statuses slice append
+	// Basic status from pool state, in pool order
+	cutover, hasCutover := pool.Cutover()
+	maxWeight, totalCapacity := pool.maxWeight(), 0
+	backends := pool.snapshotBackends() // Backends may be added while the handler runs
+	statuses := make([]BackendStatus, len(backends))
+	fetched := make([]bool, len(backends))
+	for i, backend := range backends {
+		statuses[i] = BackendStatus{
+			Index: i,
+			URL:   backend.URL.String(),
+			Alive: backend.IsAlive(),
+			// Include LB-specific state if desired
+			Weight:            backend.GetWeight(),
+			ActiveConnections: backend.activeConnections.Load(),
+			ConnectionLimit:   backend.ConnectionLimit(),
+			EWMANanoSec:       backend.ewmaResponseTime.Load(),
+			LatencyP50NanoSec: int64(backend.LatencyPercentile(0.5)),
+			LatencyP90NanoSec: int64(backend.LatencyPercentile(0.9)),
+			LatencyP99NanoSec: int64(backend.LatencyPercentile(0.99)),
+			Tags:              backend.Tags(),
+			Counters:          backend.Counters(),
+		}
+		statuses[i].Capacity = backend.capacity(maxWeight)
+		totalCapacity += statuses[i].Capacity
+		if hasCutover && (backend.HasTag(cutover.From) || backend.HasTag(cutover.To)) {
+			statuses[i].Cutover = &cutover
+		}
+		if until := backend.EjectedUntil(); !until.IsZero() {
+			statuses[i].Ejected = true
+			statuses[i].EjectedUntil = &until
+		}
+		if until := backend.BackoffUntil(); !until.IsZero() {
+			statuses[i].BackoffUntil = &until
+		}
+	}
 
-	for _, b := range pool.backends {
+	var wg sync.WaitGroup
+	var mu sync.Mutex // Protects statuses and fetched while fetches may still be running
+	for i, b := range backends {
 		wg.Add(1)
 		// Fetch info concurrently for each backend
-		go func(backend *Backend) {
+		go func(i int, backend *Backend) {
 			defer wg.Done()
-
-			// Basic status from pool state
-			status := BackendStatus{
-				URL:   backend.URL.String(),
-				Alive: backend.IsAlive(),
-				// Include LB-specific state if desired
-				Weight:            backend.GetWeight(),
-				ActiveConnections: backend.activeConnections.Load(),
-				EWMANanoSec:       backend.ewmaResponseTime.Load(),
-			}
-
-			// Fetch /info endpoint data
-			infoURL := backend.URL.String() + cfg.InfoPath // Use configured path
-			req, err := http.NewRequestWithContext(context.Background(), "GET", infoURL, nil)
-			if err != nil {
-				status.InfoError = fmt.Sprintf("failed to create info request: %v", err)
-				// Safely append status even with error
-				mu.Lock()
-				statuses = append(statuses, status)
-				mu.Unlock()
-				return
-			}
-
-			resp, err := client.Do(req)
-			if err != nil {
-				status.InfoError = fmt.Sprintf("info request failed: %v", err)
-				mu.Lock()
-				statuses = append(statuses, status)
-				mu.Unlock()
-				return
+			fetchCtx, cancel := ctx, context.CancelFunc(func() {})
+			if cfg.BackendRequestTimeout > 0 {
+				fetchCtx, cancel = context.WithTimeout(ctx, cfg.BackendRequestTimeout)
 			}
-			defer func() {
-				cerr := resp.Body.Close()
-				if cerr != nil && err != nil {
-					log.Printf("Error closing response body for %s: %v", b.URL, err)
-					err = cerr
-				}
-			}()
-
-			bodyBytes, err := io.ReadAll(resp.Body)
-			if err != nil {
-				status.InfoError = fmt.Sprintf("failed to read info body: %v", err)
-				mu.Lock()
-				statuses = append(statuses, status)
-				mu.Unlock()
-				return
-			}
-
-			if resp.StatusCode != http.StatusOK {
-				status.InfoError = fmt.Sprintf("info endpoint returned status %d, body: %s", resp.StatusCode, string(bodyBytes))
-			} else {
-				// Attempt to unmarshal as JSON, otherwise store as string
-				var infoData interface{}
-				err = json.Unmarshal(bodyBytes, &infoData)
-				if err != nil {
-					status.Info = string(bodyBytes) // Store raw string if not JSON
-					status.InfoError = fmt.Sprintf("info body is not valid JSON: %v", err)
-				} else {
-					status.Info = infoData
-				}
-			}
-
-			// Append final status for this backend
+			defer cancel()
+			info, raw, infoErr := fetchBackendInfo(fetchCtx, client, backend, cfg.InfoPath, pool.logger)
 			mu.Lock()
-			statuses = append(statuses, status)
-			mu.Unlock()
+			defer mu.Unlock()
+			statuses[i].Info, statuses[i].InfoRaw, statuses[i].InfoError = info, raw, infoErr
+			fetched[i] = true
+		}(i, b)
+	}
 
-		}(b)
+	// Wait for all info fetches, but never past the handler deadline
+	allDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allDone)
+	}()
+	select {
+	case <-allDone:
+	case <-ctx.Done():
 	}
 
-	wg.Wait() // Wait for all info fetches to complete
+	// Snapshot so fetches finishing late can't race with rendering; laggards are flagged
+	mu.Lock()
+	statuses = append([]BackendStatus(nil), statuses...)
+	for i := range statuses {
+		if !fetched[i] {
+			statuses[i].InfoError = "info request did not complete before the status deadline"
+		}
+	}
+	mu.Unlock()
 
-	// Respond with collected statuses
+	// Browsers get the HTML dashboard; API clients get JSON
+	if prefersHTML(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusPageTemplate.Execute(w, statusPage{Backends: statuses, Capacity: totalCapacity, Generated: time.Now()}); err != nil {
+			pool.logger.Error("Error rendering status page", "error", err)
+		}
+		return
+	}
+
+	// Respond with collected statuses; the body stays an array, so the pool total is a header
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(PoolCapacityHeader, strconv.Itoa(totalCapacity))
 	if err := json.NewEncoder(w).Encode(statuses); err != nil {
-		log.Printf("Error encoding status response: %v", err)
+		pool.logger.Error("Error encoding status response", "error", err)
 		http.Error(w, `{"error": "Failed to generate status"}`, http.StatusInternalServerError)
 	}
 }
+
+// fetchBackendInfo fetches and decodes a backend's info endpoint, returning JSON bodies
+// decoded and any other body as raw text. The error message is only set when the request
+// failed, the status wasn't 200 or the body exceeded maxInfoBodySize.
+func fetchBackendInfo(ctx context.Context, client *http.Client, b *Backend, infoPath string, logger Logger) (info interface{}, raw string, errMsg string) {
+	infoURL := b.ResolvePath(infoPath) // Under the backend's base path, if any
+	req, err := http.NewRequestWithContext(ctx, "GET", infoURL, nil)
+	if err != nil {
+		return nil, "", fmt.Sprintf("failed to create info request: %v", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Sprintf("info request failed: %v", err)
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			logger.Error("Error closing response body", "backend", b.URL.String(), "error", cerr)
+		}
+	}()
+
+	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, maxInfoBodySize+1))
+	if err != nil {
+		return nil, "", fmt.Sprintf("failed to read info body: %v", err)
+	}
+	if len(bodyBytes) > maxInfoBodySize {
+		return nil, "", fmt.Sprintf("info body exceeds %d bytes", maxInfoBodySize)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Sprintf("info endpoint returned status %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	// Attempt to unmarshal as JSON; anything else is info too, just not structured
+	var infoData interface{}
+	if err := json.Unmarshal(bodyBytes, &infoData); err != nil {
+		return nil, string(bodyBytes), ""
+	}
+	return infoData, "", ""
+}
+
+// prefersHTML reports whether an Accept header ranks text/html above application/json.
+// Ties (including "*/*" and a missing header) go to JSON.
+func prefersHTML(accept string) bool {
+	return acceptQuality(accept, "text/html") > acceptQuality(accept, "application/json")
+}
+
+// acceptQuality returns the q-value an Accept header gives mediaType, using the most
+// specific matching range ("type/subtype" over "type/*" over "*/*"), or 0 if none match
+func acceptQuality(accept, mediaType string) float64 {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		rangeStr, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		rangeStr = strings.ToLower(strings.TrimSpace(rangeStr))
+
+		s := -1
+		switch rangeStr {
+		case mediaType:
+			s = 2
+		case mainType + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		quality, specificity = q, s
+	}
+	return quality
+}
+
+// statusPage is the data rendered by statusPageTemplate
+type statusPage struct {
+	Backends  []BackendStatus
+	Capacity  int // Pool total, see ServerPool.Capacity
+	Generated time.Time
+}
+
+// statusPageTemplate renders the /status dashboard. It is self-contained (inline CSS, no
+// external assets) and reloads itself every few seconds.
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"ms": func(ns int64) string {
+		if ns == 0 {
+			return "-"
+		}
+		return strconv.FormatFloat(float64(ns)/float64(time.Millisecond), 'f', 1, 64) + " ms"
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>golb status</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; min-width: 40rem; }
+th, td { padding: 0.4rem 0.8rem; border-bottom: 1px solid #ddd; text-align: left; }
+th { background: #f4f4f4; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.up { color: #18794e; font-weight: bold; }
+.down { color: #c62828; font-weight: bold; }
+.ejected { color: #b26a00; font-weight: bold; }
+footer { margin-top: 1rem; color: #777; font-size: 0.85rem; }
+</style>
+</head>
+<body>
+<h1>golb backends</h1>
+<table>
+<thead><tr><th>Backend</th><th>State</th><th>Weight</th><th>Capacity</th><th>Active connections</th><th>EWMA</th><th>p99</th></tr></thead>
+<tbody>
+{{- range .Backends}}
+<tr>
+<td>{{.URL}}</td>
+<td>{{if .Ejected}}<span class="ejected">EJECTED</span>{{else if .Alive}}<span class="up">UP</span>{{else}}<span class="down">DOWN</span>{{end}}</td>
+<td class="num">{{.Weight}}</td>
+<td class="num">{{.Capacity}}%</td>
+<td class="num">{{.ActiveConnections}}</td>
+<td class="num">{{ms .EWMANanoSec}}</td>
+<td class="num">{{ms .LatencyP99NanoSec}}</td>
+</tr>
+{{- else}}
+<tr><td colspan="7">No backends configured</td></tr>
+{{- end}}
+</tbody>
+</table>
+<p>Pool capacity: {{.Capacity}} (100 per backend able to take its full share)</p>
+<footer>Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}, refreshes every 5 seconds</footer>
+</body>
+</html>
+`))
@@ -0,0 +1,290 @@
+package golb
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatusContentNegotiation(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version": "1.2.3"}`))
+	}))
+	cfg := DefaultConfig()
+
+	tests := []struct {
+		name       string
+		accept     string
+		expectHTML bool
+	}{
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", true},
+		{"explicit html", "text/html", true},
+		{"json client", "application/json", false},
+		{"wildcard", "*/*", false},
+		{"no accept header", "", false},
+		{"json preferred over html", "text/html;q=0.5, application/json", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/status", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			StatusHandler(rr, req, pool, cfg)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+			contentType := rr.Header().Get("Content-Type")
+			if tt.expectHTML {
+				if !strings.HasPrefix(contentType, "text/html") {
+					t.Fatalf("Expected HTML, got Content-Type %q", contentType)
+				}
+				body := rr.Body.String()
+				for _, want := range []string{"<table>", backend.URL.String(), `class="up"`, `http-equiv="refresh"`} {
+					if !strings.Contains(body, want) {
+						t.Errorf("Expected dashboard to contain %q", want)
+					}
+				}
+				if strings.Contains(body, "<script src") || strings.Contains(body, `<link rel="stylesheet"`) {
+					t.Errorf("Expected a self-contained page without external assets")
+				}
+				return
+			}
+
+			if contentType != "application/json" {
+				t.Fatalf("Expected JSON, got Content-Type %q", contentType)
+			}
+			var statuses []BackendStatus
+			if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil {
+				t.Fatalf("Failed to decode JSON status: %v", err)
+			}
+			if len(statuses) != 1 || statuses[0].URL != backend.URL.String() || !statuses[0].Alive {
+				t.Errorf("Unexpected statuses: %+v", statuses)
+			}
+		})
+	}
+}
+
+func TestStatusHandlerHangingBackend(t *testing.T) {
+	pool, healthy := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version": "1.2.3"}`))
+	}))
+	release := make(chan struct{})
+	_, hanging := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() { close(release) }) // Runs before the servers close, unblocking the handler
+	pool.AddBackend(hanging)
+
+	cfg := DefaultConfig()
+	cfg.BackendRequestTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	StatusHandler(rr, httptest.NewRequest("GET", "/status", nil), pool, cfg)
+	if elapsed, limit := time.Since(start), cfg.BackendRequestTimeout+statusGracePeriod; elapsed > limit {
+		t.Fatalf("Expected /status within %v, took %v", limit, elapsed)
+	}
+
+	var statuses []BackendStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Failed to decode status JSON: %v", err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 backends, got %d", len(statuses))
+	}
+	if statuses[0].URL != healthy.URL.String() || statuses[0].InfoError != "" || statuses[0].Info == nil {
+		t.Errorf("Expected info from the healthy backend first, got %+v", statuses[0])
+	}
+	if statuses[1].URL != hanging.URL.String() || statuses[1].InfoError == "" {
+		t.Errorf("Expected the hanging backend to be flagged, got %+v", statuses[1])
+	}
+}
+
+func TestStatusOrderMatchesPool(t *testing.T) {
+	pool := NewServerPool(NewRoundRobinBalancer())
+	var want []string
+	for i := range 5 {
+		delay := time.Duration(5-i) * 5 * time.Millisecond // Later backends answer first
+		_, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		pool.AddBackend(backend)
+		want = append(want, backend.URL.String())
+	}
+	cfg := DefaultConfig()
+
+	for range 3 {
+		rr := httptest.NewRecorder()
+		StatusHandler(rr, httptest.NewRequest("GET", "/status", nil), pool, cfg)
+
+		var statuses []BackendStatus
+		if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil {
+			t.Fatalf("Failed to decode status JSON: %v", err)
+		}
+		if len(statuses) != len(want) {
+			t.Fatalf("Expected %d backends, got %d", len(want), len(statuses))
+		}
+		for i, status := range statuses {
+			if status.URL != want[i] || status.Index != i {
+				t.Fatalf("Expected backend %d to be %s, got index %d %s", i, want[i], status.Index, status.URL)
+			}
+		}
+	}
+}
+
+func TestManagementClientReusesConnections(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version":"1.0"}`))
+	}))
+	var dials atomic.Int64
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		return dial(ctx, network, addr)
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	pool.SetManagementClient(&http.Client{Transport: transport})
+	cfg := DefaultConfig()
+
+	for range 5 {
+		rr := httptest.NewRecorder()
+		StatusHandler(rr, httptest.NewRequest("GET", "/status", nil), pool, cfg)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200 from /status, got %d", rr.Code)
+		}
+	}
+	pool.PerformHealthCheckCycle(pool.ManagementClient(), cfg)
+	if n := dials.Load(); n != 1 {
+		t.Errorf("Expected one connection reused by every /status call and health check, got %d dials", n)
+	}
+}
+
+func TestStatusInfoKinds(t *testing.T) {
+	pool, jsonBackend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version": "1.2.3"}`))
+	}))
+	_, textBackend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("version 1.2.3"))
+	}))
+	_, bigBackend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", maxInfoBodySize+1)))
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedURL := "http://" + listener.Addr().String()
+	_ = listener.Close() // Nothing listens there any more: connections are refused
+	closed, err := NewBackendFromURL(closedURL, 1, nil, pool, nil)
+	if err != nil {
+		t.Fatalf("Failed to create backend: %v", err)
+	}
+	pool.AddBackend(textBackend)
+	pool.AddBackend(bigBackend)
+	pool.AddBackend(closed)
+
+	rr := httptest.NewRecorder()
+	StatusHandler(rr, httptest.NewRequest("GET", "/status", nil), pool, DefaultConfig())
+	var statuses []BackendStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil || len(statuses) != 4 {
+		t.Fatalf("Expected 4 statuses, got %d (%v)", len(statuses), err)
+	}
+
+	if s := statuses[0]; s.URL != jsonBackend.URL.String() || s.InfoError != "" || s.InfoRaw != "" || s.Info.(map[string]interface{})["version"] != "1.2.3" {
+		t.Errorf("Expected decoded JSON info without an error, got %+v", s)
+	}
+	if s := statuses[1]; s.Info != nil || s.InfoRaw != "version 1.2.3" || s.InfoError != "" {
+		t.Errorf("Expected plain-text info as InfoRaw without an error, got %+v", s)
+	}
+	if s := statuses[2]; s.InfoRaw != "" || !strings.Contains(s.InfoError, "exceeds") {
+		t.Errorf("Expected an oversized body to be reported, got info error %q", s.InfoError)
+	}
+	if s := statuses[3]; s.Info != nil || s.InfoRaw != "" || !strings.Contains(s.InfoError, "info request failed") {
+		t.Errorf("Expected the transport failure as InfoError, got %+v", s)
+	}
+}
+
+func TestStatusWithoutRequestTimeout(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version": "1.2.3"}`))
+	}))
+	cfg := DefaultConfig()
+	cfg.BackendRequestTimeout = 0 // No timeout, not an immediate one
+
+	rr := httptest.NewRecorder()
+	StatusHandler(rr, httptest.NewRequest("GET", "/status", nil), pool, cfg)
+	var statuses []BackendStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil || len(statuses) != 1 {
+		t.Fatalf("Expected 1 status, got %d (%v)", len(statuses), err)
+	}
+	if s := statuses[0]; s.InfoError != "" || s.Info == nil {
+		t.Errorf("Expected the info to be fetched without a timeout, got %+v", s)
+	}
+}
+
+func TestStatusCapacity(t *testing.T) {
+	pool := NewServerPool(NewWeightedRoundRobinBalancer())
+	var backends []*Backend
+	for range 2 {
+		_, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		backend.SetWeight(4)
+		pool.AddBackend(backend)
+		backends = append(backends, backend)
+	}
+	cfg := DefaultConfig()
+	capacities := func() ([]int, string) {
+		rr := httptest.NewRecorder()
+		StatusHandler(rr, httptest.NewRequest("GET", "/status", nil), pool, cfg)
+		var statuses []BackendStatus
+		if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil {
+			t.Fatalf("Failed to decode status JSON: %v", err)
+		}
+		var got []int
+		for _, status := range statuses {
+			got = append(got, status.Capacity)
+		}
+		return got, rr.Header().Get(PoolCapacityHeader)
+	}
+	check := func(desc string, want []int, wantTotal string) {
+		t.Helper()
+		got, total := capacities()
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || total != wantTotal {
+			t.Errorf("%s: expected capacities %v and total %s, got %v and %s", desc, want, wantTotal, got, total)
+		}
+	}
+
+	check("at full weight", []int{100, 100}, "200")
+
+	// Ramping weight, as a cutover does, lowers capacity relative to the heaviest backend
+	backends[1].SetWeight(1)
+	check("while ramping up", []int{100, 25}, "125")
+	backends[1].SetWeight(4)
+
+	// Connection saturation lowers it with the headroom left
+	backends[0].SetMaxConnections(4)
+	backends[0].IncrementActiveConnections()
+	check("with a connection in use", []int{75, 100}, "175")
+	backends[0].DecrementActiveConnections()
+
+	// An ejected backend, like one behind an open breaker, takes nothing
+	backends[1].eject(time.Now().Add(time.Minute))
+	check("while ejected", []int{100, 0}, "100")
+
+	backends[0].SetAlive(false)
+	check("while down", []int{0, 0}, "0")
+}
@@ -0,0 +1,88 @@
+package golb
+
+import (
+	"hash/fnv"
+	"slices"
+)
+
+// SetSubset restricts backend selection to a deterministic subset of size backends, chosen by
+// rendezvous hashing of id (identifying this proxy instance) with each backend URL. Instances
+// with different ids pick different subsets, spreading load evenly across the whole pool,
+// while the same id always yields the same subset. Adding a backend changes at most one
+// member of the subset. A size of 0, or one not smaller than the pool, disables subsetting.
+func (s *ServerPool) SetSubset(id string, size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aliveMu.Lock()
+	defer s.aliveMu.Unlock()
+	s.subsetID, s.subsetSize = id, size
+	s.rebuildSubset()
+	s.rebuildAlive()
+}
+
+// Subset returns the backends considered for selection: the subset if subsetting is active,
+// otherwise all backends
+func (s *ServerPool) Subset() []*Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.candidates())
+}
+
+// candidates returns the backends selection draws from. Callers must hold s.mu or s.aliveMu.
+func (s *ServerPool) candidates() []*Backend {
+	if s.subset != nil {
+		return s.subset
+	}
+	return s.backends
+}
+
+// rebuildSubset recomputes the subset after the subset settings or the backend set changed.
+// Callers must hold s.mu and s.aliveMu, and rebuild the alive set afterwards.
+func (s *ServerPool) rebuildSubset() {
+	if s.subsetSize <= 0 || s.subsetSize >= len(s.backends) {
+		s.subset = nil
+		return
+	}
+	scores := make(map[*Backend]uint64, len(s.backends))
+	for _, b := range s.backends {
+		scores[b] = subsetScore(s.subsetID, b.URL.String())
+	}
+	ranked := slices.Clone(s.backends)
+	slices.SortStableFunc(ranked, func(a, b *Backend) int {
+		switch {
+		case scores[a] > scores[b]:
+			return -1
+		case scores[a] < scores[b]:
+			return 1
+		}
+		return 0
+	})
+
+	// Keep the chosen backends in pool order, so e.g. round-robin visits them in config order
+	chosen := make(map[*Backend]bool, s.subsetSize)
+	for _, b := range ranked[:s.subsetSize] {
+		chosen[b] = true
+	}
+	s.subset = make([]*Backend, 0, s.subsetSize)
+	for _, b := range s.backends {
+		if chosen[b] {
+			s.subset = append(s.subset, b)
+		}
+	}
+}
+
+// subsetScore is the rendezvous hash weight of a backend for a proxy instance
+func subsetScore(id, backendURL string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(id))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(backendURL))
+	// FNV barely mixes its last bytes; finish with the SplitMix64 finalizer so similar URLs score independently
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,142 @@
+package golb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// newLargePool returns a pool of n alive backends (not backed by servers)
+func newLargePool(tb testing.TB, lb LoadBalancer, n int) *ServerPool {
+	tb.Helper()
+	pool := NewServerPool(lb)
+	for i := range n {
+		u, err := url.Parse(fmt.Sprintf("http://backend-%d.internal:8080", i))
+		if err != nil {
+			tb.Fatalf("Failed to parse backend URL: %v", err)
+		}
+		b := NewBackend(u, nil, 1)
+		b.SetAlive(true)
+		pool.AddBackend(b)
+	}
+	return pool
+}
+
+func subsetURLs(pool *ServerPool) []string {
+	var urls []string
+	for _, b := range pool.Subset() {
+		urls = append(urls, b.URL.String())
+	}
+	return urls
+}
+
+func TestSubsetStable(t *testing.T) {
+	first := newLargePool(t, NewRoundRobinBalancer(), 100)
+	first.SetSubset("proxy-a", 10)
+	second := newLargePool(t, NewRoundRobinBalancer(), 100)
+	second.SetSubset("proxy-a", 10)
+
+	if got := subsetURLs(first); len(got) != 10 {
+		t.Fatalf("Expected a subset of 10, got %d", len(got))
+	}
+	if !slices.Equal(subsetURLs(first), subsetURLs(second)) {
+		t.Errorf("Expected the same id to pick the same subset")
+	}
+
+	other := newLargePool(t, NewRoundRobinBalancer(), 100)
+	other.SetSubset("proxy-b", 10)
+	if slices.Equal(subsetURLs(first), subsetURLs(other)) {
+		t.Errorf("Expected different ids to pick different subsets")
+	}
+
+	// Selection never leaves the subset
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range 50 {
+		peer, _ := first.GetNextPeer(ctx)
+		if peer == nil || !slices.Contains(subsetURLs(first), peer.URL.String()) {
+			t.Fatalf("Expected selection from the subset, got %v", peer)
+		}
+	}
+}
+
+func TestSubsetRebalancesOnBackendChange(t *testing.T) {
+	pool := newLargePool(t, NewRoundRobinBalancer(), 50)
+	pool.SetSubset("proxy-a", 8)
+
+	for i := range 20 {
+		before := subsetURLs(pool)
+		u, _ := url.Parse(fmt.Sprintf("http://added-%d.internal:8080", i))
+		b := NewBackend(u, nil, 1)
+		b.SetAlive(true)
+		pool.AddBackend(b)
+		after := subsetURLs(pool)
+
+		if len(after) != 8 {
+			t.Fatalf("Expected subset size to stay 8, got %d", len(after))
+		}
+		changed := 0
+		for _, u := range after {
+			if !slices.Contains(before, u) {
+				changed++
+			}
+		}
+		if changed > 1 || (changed == 1 && !slices.Contains(after, u.String())) {
+			t.Fatalf("Expected adding a backend to replace at most one member with itself, before %v after %v", before, after)
+		}
+	}
+}
+
+func TestSubsetCoverageBalanced(t *testing.T) {
+	const backends, instances, size = 40, 200, 10
+	pool := newLargePool(t, NewRoundRobinBalancer(), backends)
+	counts := make(map[string]int)
+	for i := range instances {
+		pool.SetSubset(fmt.Sprintf("proxy-%d", i), size)
+		for _, u := range subsetURLs(pool) {
+			counts[u]++
+		}
+	}
+
+	expected := instances * size / backends // 50
+	for _, b := range pool.backends {
+		if n := counts[b.URL.String()]; n < expected/2 || n > expected*2 {
+			t.Errorf("Expected backend %s in about %d subsets, got %d", b.URL, expected, n)
+		}
+	}
+}
+
+func TestSubsetDisabled(t *testing.T) {
+	pool := newLargePool(t, NewRoundRobinBalancer(), 5)
+	pool.SetSubset("proxy-a", 0)
+	if len(pool.Subset()) != 5 {
+		t.Errorf("Expected all backends without subsetting, got %d", len(pool.Subset()))
+	}
+	pool.SetSubset("proxy-a", 10)
+	if len(pool.Subset()) != 5 {
+		t.Errorf("Expected all backends when the subset is larger than the pool, got %d", len(pool.Subset()))
+	}
+}
+
+func BenchmarkSelectBackend500(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		subset int
+	}{
+		{"full", 0},
+		{"subset-20", 20},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			pool := newLargePool(b, NewLeastConnectionBalancer(), 500)
+			pool.SetSubset("proxy-a", bc.subset)
+			ctx := context.Background()
+			b.ResetTimer()
+			for range b.N {
+				peer, _ := pool.AcquirePeer(ctx, 0)
+				pool.ReleasePeer(peer)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package golb
+
+import (
+	"context"
+	"time"
+)
+
+// PoolSummary is a pool-wide snapshot, logged periodically by RunSummaryLog
+type PoolSummary struct {
+	Backends          int
+	Healthy           int
+	ActiveConnections int64
+	Requests          int64   // Lifetime requests routed to the pool's current backends
+	RequestsPerSecond float64 // Over the last summary interval; 0 in a plain Summary
+}
+
+// Summary totals the pool's backends and their counters
+func (s *ServerPool) Summary() PoolSummary {
+	var summary PoolSummary
+	for _, b := range s.snapshotBackends() {
+		summary.Backends++
+		if b.IsAlive() {
+			summary.Healthy++
+		}
+		summary.ActiveConnections += b.activeConnections.Load()
+		summary.Requests += b.counters.requests.Load()
+	}
+	return summary
+}
+
+// RunSummaryLog logs a summary of the pool every interval until ctx is done, with the
+// request rate since the previous one. The latest summary is also exported by MetricsHandler.
+func (s *ServerPool) RunSummaryLog(ctx context.Context, interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	last, lastTime := s.Summary(), s.clock.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			last, lastTime = s.logSummary(last, now.Sub(lastTime)), now
+		}
+	}
+}
+
+// logSummary logs the current summary, computing the request rate from previous, taken
+// elapsed ago, and returns it
+func (s *ServerPool) logSummary(previous PoolSummary, elapsed time.Duration) PoolSummary {
+	summary := s.Summary()
+	if elapsed > 0 {
+		// Clamped, as backends removed since the previous summary take their counts with them
+		summary.RequestsPerSecond = float64(max(summary.Requests-previous.Requests, 0)) / elapsed.Seconds()
+	}
+	s.lastSummary.Store(&summary)
+	s.logger.Info("Pool summary", "backends", summary.Backends, "healthy", summary.Healthy,
+		"activeConnections", summary.ActiveConnections, "requestsPerSecond", summary.RequestsPerSecond)
+	return summary
+}
@@ -0,0 +1,61 @@
+package golb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPoolSummary(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.backends[0].SetAlive(false)
+	pool.AddBackend(down.backends[0])
+	capture := &captureLogger{}
+	pool.SetLogger(capture)
+
+	previous := pool.Summary()
+	proxy := NewProxy(pool, DefaultConfig())
+	for range 10 {
+		proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	summary := pool.logSummary(previous, 2*time.Second)
+
+	if summary.Backends != 2 || summary.Healthy != 1 || summary.Requests != previous.Requests+10 || summary.RequestsPerSecond != 5 {
+		t.Errorf("Expected 2 backends, 1 healthy and 10 requests at 5/s, got %+v", summary)
+	}
+	if _, ok := capture.find("INFO Pool summary", "backends2healthy1", "requestsPerSecond5"); !ok {
+		t.Errorf("Expected a summary log line, got %v", capture.lines)
+	}
+	rr := httptest.NewRecorder()
+	MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil), pool)
+	if !strings.Contains(rr.Body.String(), "golb_pool_requests_per_second 5\n") {
+		t.Errorf("Expected the request rate in the metrics, got:\n%s", rr.Body.String())
+	}
+}
+
+func TestRunSummaryLogStops(t *testing.T) {
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	capture := &captureLogger{}
+	pool.SetLogger(capture)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.RunSummaryLog(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected RunSummaryLog to return once its context is done")
+	}
+	if _, ok := capture.find("Pool summary", "backends1healthy1"); !ok {
+		t.Errorf("Expected periodic summary lines, got %v", capture.lines)
+	}
+}
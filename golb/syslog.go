@@ -0,0 +1,52 @@
+package golb
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SyslogLocal as Config.AccessLogSyslog sends access logs to the local system logger
+const SyslogLocal = "local"
+
+// syslogFacilities maps facility names to their codes (RFC 5424)
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// parseSyslogTarget splits a Config.AccessLogSyslog endpoint such as "udp://host:514" or
+// "unixgram:///dev/log" into the network and address for log/syslog.Dial. SyslogLocal
+// returns empty ones, which connect to the local system logger.
+func parseSyslogTarget(target string) (network, addr string, err error) {
+	if target == SyslogLocal {
+		return "", "", nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog endpoint %q: %w", target, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("syslog endpoint %q has no host", target)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix", "unixgram":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("syslog endpoint %q has no socket path", target)
+		}
+		return u.Scheme, u.Path, nil
+	}
+	return "", "", fmt.Errorf("unsupported syslog endpoint %q (expected udp://, tcp://, unix://, unixgram:// or %s)", target, SyslogLocal)
+}
+
+// parseSyslogFacility returns the code of a facility name such as "local0"
+func parseSyslogFacility(name string) (int, error) {
+	facility, ok := syslogFacilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+	return facility, nil
+}
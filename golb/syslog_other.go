@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package golb
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// newSyslogWriter reports that syslog is unavailable: log/syslog doesn't support this platform
+func newSyslogWriter(target, facility, tag string) (io.Writer, error) {
+	return nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
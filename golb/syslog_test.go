@@ -0,0 +1,73 @@
+//go:build !windows && !plan9
+
+package golb
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLogSyslog(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	pool, _ := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	cfg := DefaultConfig()
+	cfg.AccessLogEnabled = true
+	cfg.AccessLogSyslog = "udp://" + listener.LocalAddr().String()
+	cfg.AccessLogSyslogFacility = "local3"
+	cfg.AccessLogSyslogTag = "golb-test"
+	req := httptest.NewRequest("GET", "/syslogged", nil)
+	NewProxy(pool, cfg).ServeHTTP(httptest.NewRecorder(), req)
+
+	buf := make([]byte, 2048)
+	_ = listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Expected an access log message over syslog: %v", err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<158>") { // local3 (19) << 3 | info (6)
+		t.Errorf("Expected priority local3.info, got %q", msg)
+	}
+	if !strings.Contains(msg, " golb-test[") {
+		t.Errorf("Expected the configured tag, got %q", msg)
+	}
+	if !strings.Contains(msg, `"GET /syslogged HTTP/1.1" 200`) {
+		t.Errorf("Expected a combined log line, got %q", msg)
+	}
+}
+
+func TestParseSyslogTarget(t *testing.T) {
+	tests := []struct {
+		target, network, addr string
+		wantErr               bool
+	}{
+		{"udp://logs.example.com:514", "udp", "logs.example.com:514", false},
+		{"tcp://10.0.0.5:601", "tcp", "10.0.0.5:601", false},
+		{"unixgram:///dev/log", "unixgram", "/dev/log", false},
+		{SyslogLocal, "", "", false},
+		{"udp://", "", "", true},
+		{"http://logs.example.com", "", "", true},
+		{"logs.example.com:514", "", "", true},
+	}
+	for _, tt := range tests {
+		network, addr, err := parseSyslogTarget(tt.target)
+		if (err != nil) != tt.wantErr || network != tt.network || addr != tt.addr {
+			t.Errorf("parseSyslogTarget(%q) = %q, %q, %v", tt.target, network, addr, err)
+		}
+	}
+	if _, err := parseSyslogFacility("LOCAL7"); err != nil {
+		t.Errorf("Expected facility names to be case-insensitive: %v", err)
+	}
+	if _, err := parseSyslogFacility("local9"); err == nil {
+		t.Error("Expected an unknown facility to be rejected")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows && !plan9
+
+package golb
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// newSyslogWriter connects to the syslog endpoint, see Config.AccessLogSyslog. Each Write
+// is sent as one message with the facility and tag at severity info; the connection is
+// re-established if it breaks.
+func newSyslogWriter(target, facility, tag string) (io.Writer, error) {
+	network, addr, err := parseSyslogTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	code, err := parseSyslogFacility(facility)
+	if err != nil {
+		return nil, err
+	}
+	return syslog.Dial(network, addr, syslog.Priority(code<<3)|syslog.LOG_INFO, tag)
+}
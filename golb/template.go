@@ -0,0 +1,100 @@
+package golb
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplatePathKey is the Config.RequestTemplate key whose template replaces the upstream path
+const TemplatePathKey = ":path"
+
+// RequestTemplateData is what Config.RequestTemplate templates are executed against. It
+// describes the request as the client sent it, before any rewriting, e.g.
+// {{.ClientIP}}, {{.Header.Get "User-Agent"}} or {{index .Query "id" 0}}.
+type RequestTemplateData struct {
+	Method   string
+	Host     string // Host the client asked for
+	Path     string
+	Query    url.Values
+	Header   http.Header
+	ClientIP string // See ClientIP
+	Backend  string // Host of the backend the request goes to
+}
+
+// requestTemplate is the compiled Config.RequestTemplate
+type requestTemplate struct {
+	names     []string // Sorted, so templates are applied in a stable order
+	templates map[string]*template.Template
+}
+
+// newRequestTemplate compiles templates, or returns nil if there are none
+func newRequestTemplate(templates map[string]string) (*requestTemplate, error) {
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	rt := &requestTemplate{templates: make(map[string]*template.Template, len(templates))}
+	for name, text := range templates {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("request template for an empty header name")
+		}
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("request template %q: %w", name, err)
+		}
+		rt.names = append(rt.names, name)
+		rt.templates[name] = tmpl
+	}
+	sort.Strings(rt.names)
+	return rt, nil
+}
+
+// templateData describes req as received from the client, for the backend at backendHost
+func templateData(req *http.Request, backendHost string) RequestTemplateData {
+	return RequestTemplateData{
+		Method:   req.Method,
+		Host:     req.Host,
+		Path:     req.URL.Path,
+		Query:    req.URL.Query(),
+		Header:   req.Header.Clone(),
+		ClientIP: ClientIP(req),
+		Backend:  backendHost,
+	}
+}
+
+// apply executes the templates against data and sets their results on req: Host sets the
+// Host header, TemplatePathKey the path, any other name a header, which an empty result
+// removes. A template that fails leaves its target alone and its error is returned after
+// the others were applied.
+func (rt *requestTemplate) apply(req *http.Request, data RequestTemplateData) error {
+	var firstErr error
+	var out strings.Builder
+	for _, name := range rt.names {
+		out.Reset()
+		if err := rt.templates[name].Execute(&out, data); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		value := strings.TrimSpace(out.String())
+		switch {
+		case name == TemplatePathKey:
+			if value != "" {
+				req.URL.Path, req.URL.RawPath = ensureLeadingSlash(value), ""
+			}
+		case http.CanonicalHeaderKey(name) == "Host":
+			if value != "" {
+				req.Host = value
+			}
+		case value == "":
+			req.Header.Del(name)
+		default:
+			req.Header.Set(name, value)
+		}
+	}
+	return firstErr
+}
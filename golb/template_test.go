@@ -0,0 +1,56 @@
+package golb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestTemplate(t *testing.T) {
+	type seen struct{ clientIP, host, path, tenant string }
+	received := make(chan seen, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- seen{r.Header.Get("X-Client-IP"), r.Host, r.URL.Path, r.Header.Get("X-Tenant")}
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.BackendServers = []string{server.URL}
+	cfg.RequestTemplate = map[string]string{
+		"X-Client-IP": "{{.ClientIP}}",
+		"Host":        "{{.Host}}",
+		":path":       "/api{{.Path}}",
+		"X-Tenant":    `{{index .Query "tenant" 0}}`,
+	}
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("Expected the templates to validate, got %v", err)
+	}
+	pool, err := BuildServerPool(cfg, "round-robin", cfg.BackendServers, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to build pool: %v", err)
+	}
+	markAllAlive(pool)
+
+	req := httptest.NewRequest("GET", "http://shop.example.com/items?tenant=acme", nil)
+	req.RemoteAddr = "203.0.113.7:52100"
+	req.Header.Set("X-Tenant", "client-supplied")
+	rr := httptest.NewRecorder()
+	NewProxy(pool, cfg).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, rr.Code)
+	}
+	got := <-received
+	want := seen{clientIP: "203.0.113.7", host: "shop.example.com", path: "/api/items", tenant: "acme"}
+	if got != want {
+		t.Errorf("Expected the backend to receive %+v, got %+v", want, got)
+	}
+}
+
+func TestRequestTemplateValidation(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BackendServers = []string{"http://localhost:8080"}
+	cfg.RequestTemplate = map[string]string{"X-Broken": "{{.ClientIP"}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected a template that doesn't parse to fail validation")
+	}
+}
@@ -0,0 +1,93 @@
+package golb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPerBackendRequestTimeouts(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+			_, _ = w.Write([]byte("report"))
+		case <-r.Context().Done():
+		}
+	})
+	fastPool, fastAPI := newTestPool(t, slow)
+	reportPool, reports := newTestPool(t, slow)
+
+	cfg := DefaultConfig()
+	cfg.RequestTimeout = 5 * time.Second
+	cfg.BackendOptions = map[string]BackendOptions{
+		fastAPI.URL.String(): {RequestTimeout: 50 * time.Millisecond},
+		reports.URL.String(): {RequestTimeout: time.Second},
+	}
+	for pool, b := range map[*ServerPool]*Backend{fastPool: fastAPI, reportPool: reports} {
+		b.SetRequestTimeout(cfg.BackendOptionsFor(b.URL.String()).RequestTimeout)
+		b.ReverseProxy.ErrorHandler = NewErrorHandler(pool, b.URL, cfg)
+	}
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	NewProxy(fastPool, cfg).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected fast API backend to time out with %d, got %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Expected the 50ms backend timeout to apply, request took %v", elapsed)
+	}
+
+	rr = httptest.NewRecorder()
+	NewProxy(reportPool, cfg).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "report" {
+		t.Errorf("Expected report backend to finish within its own timeout, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestGlobalRequestTimeoutFallback(t *testing.T) {
+	pool, backend := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	if backend.RequestTimeout() != 0 {
+		t.Fatalf("Expected no per-backend override by default")
+	}
+	cfg := DefaultConfig()
+	cfg.RequestTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	NewProxy(pool, cfg).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code == http.StatusOK {
+		t.Errorf("Expected the global timeout to cut the request short")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the 50ms global timeout to apply, request took %v", elapsed)
+	}
+}
+
+func TestBackendOptionsFromFile(t *testing.T) {
+	path := writeConfigFile(t, "golb.yaml", `
+requestTimeout: 10s
+backendOptions:
+  "http://reports:8080":
+    requestTimeout: 2m
+`)
+	cfg := DefaultConfig()
+	if err := loadConfigFromFile(path, cfg); err != nil {
+		t.Fatalf("loadConfigFromFile returned error: %v", err)
+	}
+	if cfg.RequestTimeout != 10*time.Second {
+		t.Errorf("Expected global request timeout 10s, got %v", cfg.RequestTimeout)
+	}
+	if got := cfg.BackendOptionsFor("http://reports:8080").RequestTimeout; got != 2*time.Minute {
+		t.Errorf("Expected reports backend timeout 2m, got %v", got)
+	}
+	if got := cfg.BackendOptionsFor("http://other:8080").RequestTimeout; got != 0 {
+		t.Errorf("Expected no override for an unlisted backend, got %v", got)
+	}
+}
@@ -0,0 +1,53 @@
+package golb
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// TraceParentHeader is the W3C Trace Context header carrying the caller's trace, forwarded
+// to backends unchanged
+const TraceParentHeader = "Traceparent"
+
+type traceIDKey struct{}
+
+// WithTraceID records the ID of the trace the request belongs to, e.g. from a tracing
+// middleware, for exemplars on latency metrics
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceIDFromContext returns the trace ID recorded by WithTraceID
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	traceID, ok := ctx.Value(traceIDKey{}).(string)
+	return traceID, ok && traceID != ""
+}
+
+// traceContext returns r's context carrying its trace ID: the one recorded with WithTraceID,
+// or else the one in r's traceparent header, if valid
+func traceContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if _, ok := TraceIDFromContext(ctx); ok {
+		return ctx
+	}
+	if traceID := traceIDFromHeader(r.Header.Get(TraceParentHeader)); traceID != "" {
+		return WithTraceID(ctx, traceID)
+	}
+	return ctx
+}
+
+// traceIDFromHeader extracts the trace ID from a traceparent value
+// ("version-traceid-parentid-flags"), or returns "" if it is malformed or the invalid
+// all-zero ID
+func traceIDFromHeader(traceparent string) string {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 {
+		return ""
+	}
+	traceID := parts[1]
+	if strings.Trim(traceID, "0123456789abcdef") != "" || strings.Trim(traceID, "0") == "" {
+		return ""
+	}
+	return traceID
+}
@@ -0,0 +1,151 @@
+package golb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// NewTransport builds the http.Transport used to proxy requests to backends, based on
+// http.DefaultTransport with the backend connection settings from cfg applied. One transport
+// is shared by all backends, so its limits apply per backend host, not in total.
+func NewTransport(cfg *Config) *http.Transport {
+	return newTransport(cfg, net.DefaultResolver)
+}
+
+// defaultManagementClient makes the proxy's own calls to backends (health checks and /status
+// info fetches) for every pool that wasn't given another client. It keeps connections to the
+// management endpoints alive between calls and has no overall Timeout: callers bound each
+// request with its context, so one client serves any cfg.
+var defaultManagementClient = &http.Client{Transport: newManagementTransport()}
+
+// newManagementTransport returns the transport of defaultManagementClient
+func newManagementTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 4 // Health checks and a few concurrent /status polls per backend
+	return transport
+}
+
+// configuredManagementTransport returns a management transport that reaches backends the way
+// proxied requests do, through the egress proxy and with a PROXY header as configured in cfg,
+// or nil if neither is, leaving the pool on defaultManagementClient
+func configuredManagementTransport(cfg *Config) *http.Transport {
+	proxy := backendProxy(cfg)
+	if proxy == nil && cfg.BackendProxyProtocol == "" {
+		return nil
+	}
+	transport := newManagementTransport()
+	transport.Proxy = proxy
+	if version := cfg.BackendProxyProtocol; version != "" {
+		transport.DialContext = withProxyProtocol(version, (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext)
+		transport.DisableKeepAlives = true
+	}
+	return transport
+}
+
+// newTransport is NewTransport resolving backend host names with resolver
+func newTransport(cfg *Config, resolver hostResolver) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 0 // No pool-wide cap; MaxIdleConnsPerHost bounds each backend
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerBackend
+	transport.MaxConnsPerHost = cfg.MaxConnsPerBackend
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	transport.DisableKeepAlives = cfg.DisableKeepAlives
+	transport.TLSHandshakeTimeout = cfg.BackendTLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = cfg.BackendResponseHeaderTimeout
+	if proxy := backendProxy(cfg); proxy != nil {
+		transport.Proxy = proxy
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.BackendDialTimeout, KeepAlive: 30 * time.Second}
+	dial := dialer.DialContext
+	switch {
+	case cfg.BackendDNSRefreshInterval > 0:
+		// Resolve backend hosts ourselves so address changes are picked up, and retire idle
+		// connections to the old addresses when they are
+		dnsDialer := newDNSDialer(dial, resolver, cfg.BackendDNSRefreshInterval, transport.CloseIdleConnections)
+		if cfg.BackendHappyEyeballs {
+			dnsDialer.happyEyeballs = happyEyeballsDelay
+		}
+		dial = dnsDialer.DialContext
+	case cfg.BackendHappyEyeballs:
+		dial = (&happyEyeballsDialer{dial: dial, resolver: resolver, delay: happyEyeballsDelay}).DialContext
+	}
+
+	if version := cfg.BackendProxyProtocol; version != "" {
+		dial = withProxyProtocol(version, dial)
+		// A PROXY header describes a single client, so upstream connections can't be reused across requests
+		transport.DisableKeepAlives = true
+	}
+	transport.DialContext = dial
+	return transport
+}
+
+// withProxyProtocol wraps dial to start every connection with a PROXY header of version for
+// the client in the dial's context; without one, e.g. for health checks, the header is
+// "unknown"/LOCAL
+func withProxyProtocol(version string, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		src, dst := proxyProtocolAddrs(ctx, conn)
+		if _, err := conn.Write(proxyProtocolHeader(version, src, dst)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// parseEgressProxyURL parses an egress proxy URL, returning nil for ""
+func parseEgressProxyURL(rawURL string) (*url.URL, error) {
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q in %s (expected http, https, socks5 or socks5h)", u.Scheme, u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL %s has no host", u.Redacted())
+	}
+	return u, nil
+}
+
+// backendProxy returns the http.Transport Proxy function sending backend connections through
+// cfg.BackendProxyURL, or the ProxyURL in a backend's BackendOptions, and otherwise through
+// the proxy from the environment. It returns nil if no proxy is configured.
+func backendProxy(cfg *Config) func(*http.Request) (*url.URL, error) {
+	global, _ := parseEgressProxyURL(cfg.BackendProxyURL) // Validated by LoadConfig
+	perBackend := make(map[string]*url.URL)               // By scheme://host, as requests are made
+	for backend, opts := range cfg.BackendOptions {
+		proxyURL, _ := parseEgressProxyURL(opts.ProxyURL)
+		backendURL, err := url.Parse(backend)
+		if proxyURL == nil || err != nil {
+			continue
+		}
+		perBackend[backendURL.Scheme+"://"+backendURL.Host] = proxyURL
+	}
+	if global == nil && len(perBackend) == 0 {
+		return nil
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if proxyURL, ok := perBackend[req.URL.Scheme+"://"+req.URL.Host]; ok {
+			return proxyURL, nil
+		}
+		if global != nil {
+			return global, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}
+}
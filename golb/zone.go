@@ -0,0 +1,87 @@
+package golb
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// ZoneTagPrefix marks the tag naming a backend's zone, e.g. "zone:us-east-1a"
+const ZoneTagPrefix = "zone:"
+
+// Zone returns the zone the backend runs in, from its ZoneTagPrefix tag, or "" if it has none
+func (b *Backend) Zone() string {
+	for _, tag := range b.tags {
+		if zone, ok := strings.CutPrefix(tag, ZoneTagPrefix); ok {
+			return zone
+		}
+	}
+	return ""
+}
+
+// SetLocalZone makes selection prefer alive backends in zone, the zone this proxy instance
+// runs in. Other zones only get requests while no backend in zone is alive or has capacity.
+// An empty zone disables the preference.
+func (s *ServerPool) SetLocalZone(zone string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aliveMu.Lock()
+	defer s.aliveMu.Unlock()
+	s.localZone = zone
+	s.rebuildAlive()
+}
+
+// LocalZone returns the zone set with SetLocalZone
+func (s *ServerPool) LocalZone() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.localZone
+}
+
+// localBackends returns the members of alive in the local zone, or nil without a local zone.
+// Callers must hold aliveMu.
+func (s *ServerPool) localBackends(alive []*Backend) []*Backend {
+	if s.localZone == "" {
+		return nil
+	}
+	var local []*Backend
+	for _, b := range alive {
+		if b.Zone() == s.localZone {
+			local = append(local, b)
+		}
+	}
+	return local
+}
+
+// selectAlive picks an alive backend, trying the local zone before the whole alive set.
+// Backends a retried request already failed on (see withTriedPeers) are skipped.
+// Callers must hold s.mu.
+func (s *ServerPool) selectAlive(ctx context.Context) *Backend {
+	local, alive := *s.localAlive.Load(), s.AliveBackends()
+	if tried := triedPeersFromContext(ctx); len(tried) > 0 {
+		untried := func(b *Backend) bool { return !slices.Contains(tried, b) }
+		local, alive = filterBackends(local, untried), filterBackends(alive, untried)
+	}
+	if len(local) > 0 {
+		if backend := selectBackend(ctx, s.lb, local); backend != nil {
+			decisionFromContext(ctx).annotate("local zone " + s.localZone)
+			return backend
+		}
+		s.logger.Debug("No backend in the local zone has capacity, spilling over to other zones", "zone", s.localZone)
+		backend := selectBackend(ctx, s.lb, alive)
+		decisionFromContext(ctx).annotate("spilled over from zone " + s.localZone)
+		return backend
+	}
+	return selectBackend(ctx, s.lb, alive)
+}
+
+// filterBackends returns the backends keep reports true for, in a new slice
+func filterBackends(backends []*Backend, keep func(*Backend) bool) []*Backend {
+	var kept []*Backend
+	for _, b := range backends {
+		if keep(b) {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
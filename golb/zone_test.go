@@ -0,0 +1,89 @@
+package golb
+
+import (
+	"context"
+	"testing"
+)
+
+// newZonedPool returns a round-robin pool of four alive backends, the first two in zone "a"
+// and the others in zone "b", preferring localZone
+func newZonedPool(t *testing.T, localZone string) *ServerPool {
+	t.Helper()
+	pool := newLargePool(t, NewRoundRobinBalancer(), 4)
+	for i, b := range pool.backends {
+		b.SetTags("blue", ZoneTagPrefix+[]string{"a", "a", "b", "b"}[i])
+	}
+	pool.SetLocalZone(localZone)
+	return pool
+}
+
+func selectedZones(t *testing.T, pool *ServerPool, n int) map[string]int {
+	t.Helper()
+	zones := map[string]int{}
+	for range n {
+		b := pool.SelectBackend()
+		if b == nil {
+			t.Fatal("Expected a backend to be selected")
+		}
+		zones[b.Zone()]++
+	}
+	return zones
+}
+
+func TestLocalZonePreferred(t *testing.T) {
+	pool := newZonedPool(t, "a")
+	if got := pool.backends[0].Zone(); got != "a" {
+		t.Fatalf("Expected zone a from the tags, got %q", got)
+	}
+
+	if zones := selectedZones(t, pool, 20); zones["a"] != 20 {
+		t.Errorf("Expected every selection in the local zone, got %v", zones)
+	}
+
+	pool.SetLocalZone("")
+	if zones := selectedZones(t, pool, 20); zones["a"] != 10 || zones["b"] != 10 {
+		t.Errorf("Expected selections spread over both zones without a local zone, got %v", zones)
+	}
+}
+
+func TestLocalZoneSpillsOverWhenDown(t *testing.T) {
+	pool := newZonedPool(t, "a")
+	pool.backends[0].SetAlive(false)
+	if zones := selectedZones(t, pool, 10); zones["a"] != 10 {
+		t.Errorf("Expected the remaining local backend to take every request, got %v", zones)
+	}
+
+	pool.backends[1].SetAlive(false)
+	if zones := selectedZones(t, pool, 10); zones["b"] != 10 {
+		t.Errorf("Expected requests to spill over to zone b with zone a down, got %v", zones)
+	}
+
+	pool.backends[0].SetAlive(true)
+	if zones := selectedZones(t, pool, 10); zones["a"] != 10 {
+		t.Errorf("Expected requests back in the local zone once it recovered, got %v", zones)
+	}
+}
+
+func TestLocalZoneSpillsOverWhenSaturated(t *testing.T) {
+	pool := newZonedPool(t, "a")
+	for _, b := range pool.backends {
+		b.SetMaxConnections(1)
+	}
+
+	var zones []string
+	for range 3 {
+		b, err := pool.AcquirePeer(context.Background(), 0)
+		if err != nil {
+			t.Fatalf("AcquirePeer failed: %v", err)
+		}
+		zones = append(zones, b.Zone())
+	}
+	if zones[0] != "a" || zones[1] != "a" || zones[2] != "b" {
+		t.Errorf("Expected both local backends to fill before spilling over, got %v", zones)
+	}
+
+	pool.ReleasePeer(pool.backends[0])
+	if b := pool.SelectBackend(); b != pool.backends[0] {
+		t.Errorf("Expected the freed local backend to be preferred again, got %v", b)
+	}
+}